@@ -4,9 +4,15 @@ import (
 	"backend/config"
 	"backend/internal/app/panel"
 	"backend/internal/pkg/logger"
+	"context"
 	"log"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+const shutdownTimeout = 5 * time.Second
+
 func main() {
 	config, err := config.GetConfig()
 
@@ -26,7 +32,28 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	if err := app.Run(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	runErr := make(chan error, 1)
+
+	go func() {
+		runErr <- app.Run()
+	}()
+
+	select {
+	case err = <-runErr:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := app.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Println(shutdownErr)
+	}
+
+	if err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -16,6 +16,16 @@ const (
 	productionEnv                    = "production"
 	defaultCertRenewalInterval       = 3
 	defaultCertAboutToExpireInterval = 14
+	defaultAgentMaxResponseSize      = 64 // megabytes
+	defaultServerMonitorInterval     = 60 // seconds
+	defaultEnrollmentCodeTTL         = 60 // minutes
+	defaultDomainSyncInterval        = 15 // minutes
+	defaultCertInventoryInterval     = 60 // minutes
+	defaultAgentUpgradeConcurrency   = 5
+	defaultAgentUpgradeTimeout       = 300 // seconds
+	defaultAcmeDirectoryURL          = "https://acme-v02.api.letsencrypt.org/directory"
+	defaultTelemetryServiceName      = "sslpanel"
+	defaultTelemetryExportInterval   = 60 // seconds
 )
 
 var config *Config
@@ -44,8 +54,30 @@ type Config struct {
 	CertRenewalInterval       time.Duration
 	CertAboutToExpireInterval time.Duration
 	AllowedHosts              []string
+	TrustedProxies            []string
 	Environment               string
 	IsDevMode                 bool
+	AgentTLSClientCertFile    string
+	AgentTLSClientKeyFile     string
+	AgentMaxResponseSize      int64
+	AgentLogPayloads          bool
+	ServerMonitorInterval     time.Duration
+	ServerStatusNotifications bool
+	EnrollmentCodeTTL         time.Duration
+	DomainSyncInterval        time.Duration
+	CertInventoryInterval     time.Duration
+	TokenEncryptionKeys       map[string]string
+	TokenEncryptionKeyID      string
+	TokenRotationInterval     time.Duration
+	AgentUpgradeConcurrency   int
+	AgentUpgradeTimeout       time.Duration
+	AcmeDirectoryURL          string
+	AcmeCABundleFile          string
+	AcmeDnsPropagationDelay   time.Duration
+	TelemetryEndpoint         string
+	TelemetryInsecure         bool
+	TelemetryServiceName      string
+	TelemetryExportInterval   time.Duration
 }
 
 func (c *Config) GetVarDirAbsPath() string {
@@ -76,6 +108,66 @@ func GetConfig() (*Config, error) {
 		certAboutToExpireInterval = defaultCertAboutToExpireInterval
 	}
 
+	agentMaxResponseSize := viper.GetInt64("CP_AGENT_MAX_RESPONSE_SIZE_MB")
+
+	if agentMaxResponseSize <= 0 {
+		agentMaxResponseSize = defaultAgentMaxResponseSize
+	}
+
+	serverMonitorInterval := viper.GetInt("CP_SERVER_MONITOR_INTERVAL_SECONDS")
+
+	if serverMonitorInterval <= 0 {
+		serverMonitorInterval = defaultServerMonitorInterval
+	}
+
+	enrollmentCodeTTL := viper.GetInt("CP_ENROLLMENT_CODE_TTL_MINUTES")
+
+	if enrollmentCodeTTL <= 0 {
+		enrollmentCodeTTL = defaultEnrollmentCodeTTL
+	}
+
+	domainSyncInterval := viper.GetInt("CP_DOMAIN_SYNC_INTERVAL_MINUTES")
+
+	if domainSyncInterval <= 0 {
+		domainSyncInterval = defaultDomainSyncInterval
+	}
+
+	certInventoryInterval := viper.GetInt("CP_CERT_INVENTORY_INTERVAL_MINUTES")
+
+	if certInventoryInterval <= 0 {
+		certInventoryInterval = defaultCertInventoryInterval
+	}
+
+	agentUpgradeConcurrency := viper.GetInt("CP_AGENT_UPGRADE_CONCURRENCY")
+
+	if agentUpgradeConcurrency <= 0 {
+		agentUpgradeConcurrency = defaultAgentUpgradeConcurrency
+	}
+
+	agentUpgradeTimeout := viper.GetInt("CP_AGENT_UPGRADE_TIMEOUT_SECONDS")
+
+	if agentUpgradeTimeout <= 0 {
+		agentUpgradeTimeout = defaultAgentUpgradeTimeout
+	}
+
+	acmeDirectoryURL := viper.GetString("CP_ACME_DIRECTORY_URL")
+
+	if acmeDirectoryURL == "" {
+		acmeDirectoryURL = defaultAcmeDirectoryURL
+	}
+
+	telemetryServiceName := viper.GetString("CP_OTEL_SERVICE_NAME")
+
+	if telemetryServiceName == "" {
+		telemetryServiceName = defaultTelemetryServiceName
+	}
+
+	telemetryExportInterval := viper.GetInt("CP_OTEL_EXPORT_INTERVAL_SECONDS")
+
+	if telemetryExportInterval <= 0 {
+		telemetryExportInterval = defaultTelemetryExportInterval
+	}
+
 	conf := Config{
 		DbName:                    viper.GetString("CP_DB_NAME"),
 		PanelHost:                 viper.GetString("CP_HOST"),
@@ -96,8 +188,30 @@ func GetConfig() (*Config, error) {
 		CertRenewalInterval:       time.Duration(certRenewalInterval) * time.Hour,
 		CertAboutToExpireInterval: time.Duration(certAboutToExpireInterval*24) * time.Hour,
 		AllowedHosts:              getAllowedHosts(),
+		TrustedProxies:            getTrustedProxies(),
 		Environment:               environment,
 		IsDevMode:                 environment == developmentEnv,
+		AgentTLSClientCertFile:    viper.GetString("CP_AGENT_TLS_CLIENT_CERT_FILE"),
+		AgentTLSClientKeyFile:     viper.GetString("CP_AGENT_TLS_CLIENT_KEY_FILE"),
+		AgentMaxResponseSize:      agentMaxResponseSize << 20,
+		AgentLogPayloads:          viper.GetBool("CP_AGENT_LOG_PAYLOADS"),
+		ServerMonitorInterval:     time.Duration(serverMonitorInterval) * time.Second,
+		ServerStatusNotifications: viper.GetBool("CP_SERVER_STATUS_NOTIFICATIONS"),
+		EnrollmentCodeTTL:         time.Duration(enrollmentCodeTTL) * time.Minute,
+		DomainSyncInterval:        time.Duration(domainSyncInterval) * time.Minute,
+		CertInventoryInterval:     time.Duration(certInventoryInterval) * time.Minute,
+		TokenEncryptionKeys:       getTokenEncryptionKeys(),
+		TokenEncryptionKeyID:      viper.GetString("CP_TOKEN_ENCRYPTION_KEY_ID"),
+		TokenRotationInterval:     time.Duration(max(viper.GetInt("CP_TOKEN_ROTATION_INTERVAL_DAYS"), 0)*24) * time.Hour,
+		AgentUpgradeConcurrency:   agentUpgradeConcurrency,
+		AgentUpgradeTimeout:       time.Duration(agentUpgradeTimeout) * time.Second,
+		AcmeDirectoryURL:          acmeDirectoryURL,
+		AcmeCABundleFile:          viper.GetString("CP_ACME_CA_BUNDLE_FILE"),
+		AcmeDnsPropagationDelay:   time.Duration(max(viper.GetInt("CP_ACME_DNS_PROPAGATION_SECONDS"), 0)) * time.Second,
+		TelemetryEndpoint:         viper.GetString("CP_OTEL_EXPORTER_ENDPOINT"),
+		TelemetryInsecure:         viper.GetBool("CP_OTEL_EXPORTER_INSECURE"),
+		TelemetryServiceName:      telemetryServiceName,
+		TelemetryExportInterval:   time.Duration(telemetryExportInterval) * time.Second,
 	}
 
 	path, err := getBasePath(environment)
@@ -178,3 +292,32 @@ func getAllowedHosts() []string {
 
 	return result
 }
+
+// getTrustedProxies returns addresses and networks of proxies whose forwarded headers are trusted.
+// The result is nil if no proxy is configured, so client addresses are taken from connections only.
+func getTrustedProxies() []string {
+	var proxies []string
+
+	for _, proxy := range strings.Split(viper.GetString("CP_API_TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return proxies
+}
+
+// getTokenEncryptionKeys parses master keys of server tokens in the format "keyId:base64Key,keyId:base64Key"
+func getTokenEncryptionKeys() map[string]string {
+	keys := map[string]string{}
+
+	for _, pair := range strings.Split(viper.GetString("CP_TOKEN_ENCRYPTION_KEYS"), ",") {
+		keyID, key, found := strings.Cut(strings.TrimSpace(pair), ":")
+
+		if found {
+			keys[strings.TrimSpace(keyID)] = strings.TrimSpace(key)
+		}
+	}
+
+	return keys
+}
@@ -3,9 +3,12 @@ package domain
 import (
 	"backend/internal/app/panel/adapters/api/auth"
 	domainService "backend/internal/app/panel/domain/service"
+	"backend/internal/pkg/agent"
+	"context"
 	"encoding/base64"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -53,14 +56,14 @@ func CreateGetDomainHandler(cAuth auth.Auth, appDomainService domainService.Doma
 		request.ServerGuid = guid
 		request.DomainName = string(decodedDomainName)
 		request.AccountID = user.AccountID
-		domain, err := appDomainService.GetDomain(request)
+		domain, err := appDomainService.GetDomain(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, domainService.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
 			} else if errors.Is(err, domainService.ErrDomainNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
-			} else if errors.Is(err, domainService.ErrAgentConnection) {
+			} else if errors.Is(err, domainService.ErrAgentConnection) || errors.As(err, &agent.TimeoutError{}) {
 				c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
@@ -116,7 +119,7 @@ func CreateGetDomainConfigHandler(cAuth auth.Auth, appService domainService.Doma
 		request.ServerGuid = guid
 		request.DomainName = string(decodedDomainName)
 		request.AccountID = user.AccountID
-		config, err := appService.GetDomainConfig(request)
+		config, err := appService.GetDomainConfig(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, domainService.ErrServerNotFound) {
@@ -249,3 +252,129 @@ func CreateChangeDomainSettingHandler(cAuth auth.Auth, appDomainService domainSe
 		}
 	}
 }
+
+func CreateGetServerDomainsHandler(cAuth auth.Auth, appDomainService domainService.DomainService) func(c *gin.Context) {
+	return createServerInventoryHandler(cAuth, appDomainService.GetServerInventory)
+}
+
+func CreateSyncServerDomainsHandler(cAuth auth.Auth, appDomainService domainService.DomainService) func(c *gin.Context) {
+	return createServerInventoryHandler(cAuth, appDomainService.SyncServerDomains)
+}
+
+func createServerInventoryHandler(
+	cAuth auth.Auth,
+	getInventory func(ctx context.Context, request domainService.ServerDomainsRequest) (*domainService.Inventory, error),
+) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		guid := c.Param("serverId")
+
+		if guid == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server GUID")) // nolint:errcheck
+
+			return
+		}
+
+		inventory, err := getInventory(c.Request.Context(), domainService.ServerDomainsRequest{
+			ServerGuid: guid,
+			AccountID:  user.AccountID,
+		})
+
+		if err != nil {
+			if errors.Is(err, domainService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.As(err, &agent.TimeoutError{}) {
+				c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, inventory)
+	}
+}
+
+func CreateFindDomainChangesHandler(cAuth auth.Auth, appDomainService domainService.DomainService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		guid := c.Param("serverId")
+
+		if guid == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server GUID")) // nolint:errcheck
+
+			return
+		}
+
+		changes, err := appDomainService.FindDomainChanges(domainService.ServerDomainsRequest{
+			ServerGuid: guid,
+			AccountID:  user.AccountID,
+		})
+
+		if err != nil {
+			if errors.Is(err, domainService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"changes": changes})
+	}
+}
+
+// CreateChangeGroupAutoRenewalHandler enables or disables auto renewal of all domains on servers of the group
+func CreateChangeGroupAutoRenewalHandler(cAuth auth.Auth, appDomainService domainService.DomainService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groupID, err := strconv.Atoi(c.Param("groupId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server group ID")) // nolint:errcheck
+
+			return
+		}
+
+		var request domainService.ChangeGroupAutoRenewalRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		request.GroupID = groupID
+		request.AccountID = user.AccountID
+		results, err := appDomainService.ChangeGroupAutoRenewal(c.Request.Context(), request)
+
+		if err != nil {
+			if errors.Is(err, domainService.ErrServerGroupNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"servers": results})
+	}
+}
@@ -0,0 +1,129 @@
+package enrollment
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	serverService "backend/internal/app/panel/server/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/validator.v2"
+)
+
+func CreateFindEnrollmentCodesHandler(cAuth auth.Auth, appEnrollmentService serverService.EnrollmentService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		codes, err := appEnrollmentService.FindEnrollmentCodes(user.AccountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"codes": codes})
+	}
+}
+
+func CreateCreateEnrollmentCodeHandler(cAuth auth.Auth, appEnrollmentService serverService.EnrollmentService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		code, err := appEnrollmentService.CreateEnrollmentCode(serverService.CreateEnrollmentCodeRequest{
+			AccountID: user.AccountID,
+			UserID:    user.ID,
+		})
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"code": code})
+	}
+}
+
+func CreateRevokeEnrollmentCodeHandler(cAuth auth.Auth, appEnrollmentService serverService.EnrollmentService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		codeID, err := strconv.Atoi(c.Param("codeId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid enrollment code ID")) // nolint:errcheck
+
+			return
+		}
+
+		err = appEnrollmentService.RevokeEnrollmentCode(serverService.RevokeEnrollmentCodeRequest{
+			ID:        codeID,
+			AccountID: user.AccountID,
+			UserID:    user.ID,
+		})
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrEnrollmentCodeNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrEnrollmentCodeInactive) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+		}
+	}
+}
+
+// CreateEnrollHandler handles enrollment requests of agents. The endpoint is not authenticated, the enrollment code is the credential.
+func CreateEnrollHandler(appEnrollmentService serverService.EnrollmentService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var request serverService.EnrollRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if err := validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.RemoteIP = c.ClientIP()
+		response, err := appEnrollmentService.Enroll(request)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrInvalidEnrollmentCode) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrInvalidConnectionMode) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrServerClaimAddressMismatch) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrServerAddressTaken) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
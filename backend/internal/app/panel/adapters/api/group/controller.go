@@ -0,0 +1,279 @@
+package group
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	serverService "backend/internal/app/panel/server/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/validator.v2"
+)
+
+func CreateFindServerGroupsHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groups, err := appGroupService.FindServerGroups(user.AccountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"groups": groups})
+	}
+}
+
+func CreateGetServerGroupHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groupID, ok := getGroupID(c)
+
+		if !ok {
+			return
+		}
+
+		group, err := appGroupService.GetServerGroup(serverService.ServerGroupRequest{ID: groupID, AccountID: user.AccountID})
+
+		if err != nil {
+			abortWithGroupError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"group": group})
+	}
+}
+
+// CreateSaveServerGroupHandler creates a new group or updates the group specified in the path
+func CreateSaveServerGroupHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request serverService.SaveServerGroupRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if err := validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		if c.Param("groupId") != "" {
+			groupID, ok := getGroupID(c)
+
+			if !ok {
+				return
+			}
+
+			request.ID = groupID
+		}
+
+		request.AccountID = user.AccountID
+		group, err := appGroupService.SaveServerGroup(request)
+
+		if err != nil {
+			abortWithGroupError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"group": group})
+	}
+}
+
+func CreateRemoveServerGroupHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groupID, ok := getGroupID(c)
+
+		if !ok {
+			return
+		}
+
+		err := appGroupService.RemoveServerGroup(serverService.ServerGroupRequest{ID: groupID, AccountID: user.AccountID})
+
+		if err != nil {
+			abortWithGroupError(c, err)
+		}
+	}
+}
+
+func CreateSetGroupServersHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groupID, ok := getGroupID(c)
+
+		if !ok {
+			return
+		}
+
+		var request serverService.SetGroupServersRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		request.ID = groupID
+		request.AccountID = user.AccountID
+		group, err := appGroupService.SetGroupServers(request)
+
+		if err != nil {
+			abortWithGroupError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"group": group})
+	}
+}
+
+func CreateSetServerTagsHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request serverService.SetServerTagsRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		request.ServerGuid = c.Param("serverId")
+		request.AccountID = user.AccountID
+		tags, err := appGroupService.SetServerTags(request)
+
+		if err != nil {
+			abortWithGroupError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
+
+func CreateChangeGroupCertbotStatusHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groupID, ok := getGroupID(c)
+
+		if !ok {
+			return
+		}
+
+		var request serverService.ChangeGroupCertbotStatusRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		request.ID = groupID
+		request.AccountID = user.AccountID
+		results, err := appGroupService.ChangeGroupCertbotStatus(c.Request.Context(), request)
+
+		if err != nil {
+			abortWithGroupError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"servers": results})
+	}
+}
+
+func CreateCheckGroupHealthHandler(cAuth auth.Auth, appGroupService serverService.GroupService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		groupID, ok := getGroupID(c)
+
+		if !ok {
+			return
+		}
+
+		results, err := appGroupService.CheckGroupHealth(c.Request.Context(), serverService.ServerGroupRequest{ID: groupID, AccountID: user.AccountID})
+
+		if err != nil {
+			abortWithGroupError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"servers": results})
+	}
+}
+
+func getGroupID(c *gin.Context) (int, bool) {
+	groupID, err := strconv.Atoi(c.Param("groupId"))
+
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, errors.New("invalid server group ID")) // nolint:errcheck
+
+		return 0, false
+	}
+
+	return groupID, true
+}
+
+func abortWithGroupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, serverService.ErrServerGroupNotFound), errors.Is(err, serverService.ErrServerNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, serverService.ErrServerGroupNameTaken):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case errors.Is(err, serverService.ErrInvalidTag):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
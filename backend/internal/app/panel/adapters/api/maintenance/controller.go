@@ -0,0 +1,108 @@
+package maintenance
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	serverService "backend/internal/app/panel/server/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/validator.v2"
+)
+
+func CreateFindMaintenanceWindowsHandler(cAuth auth.Auth, appMaintenanceService serverService.MaintenanceService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		windows, err := appMaintenanceService.FindMaintenanceWindows(user.AccountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"windows": windows})
+	}
+}
+
+func CreateCreateMaintenanceWindowsHandler(cAuth auth.Auth, appMaintenanceService serverService.MaintenanceService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request serverService.CreateMaintenanceWindowsRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if err := validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.AccountID = user.AccountID
+		request.UserID = user.ID
+		windows, err := appMaintenanceService.CreateMaintenanceWindows(request)
+
+		if err != nil {
+			abortWithMaintenanceError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"windows": windows})
+	}
+}
+
+func CreateRemoveMaintenanceWindowHandler(cAuth auth.Auth, appMaintenanceService serverService.MaintenanceService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		windowID, err := strconv.Atoi(c.Param("windowId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid maintenance window ID")) // nolint:errcheck
+
+			return
+		}
+
+		err = appMaintenanceService.RemoveMaintenanceWindow(serverService.MaintenanceWindowRequest{
+			ID:        windowID,
+			AccountID: user.AccountID,
+		})
+
+		if err != nil {
+			abortWithMaintenanceError(c, err)
+		}
+	}
+}
+
+func abortWithMaintenanceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, serverService.ErrMaintenanceWindowNotFound),
+		errors.Is(err, serverService.ErrServerGroupNotFound),
+		errors.Is(err, serverService.ErrServerNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, serverService.ErrInvalidMaintenanceWindow), errors.Is(err, serverService.ErrMaintenanceScopeEmpty):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
@@ -2,11 +2,14 @@ package server
 
 import (
 	"backend/internal/app/panel/adapters/api/auth"
+	"backend/internal/app/panel/server/maintenance"
 	"backend/internal/app/panel/server/service"
 	serverService "backend/internal/app/panel/server/service"
+	"backend/internal/pkg/agent"
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gopkg.in/validator.v2"
@@ -20,7 +23,16 @@ func CreateFindAccounServersHandler(cAuth auth.Auth, appServerService serverServ
 			return
 		}
 
-		servers, err := appServerService.FindAccountServers(user.AccountID)
+		var request serverService.FindServersRequest
+
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.AccountID = user.AccountID
+		servers, err := appServerService.FindAccountServers(request)
 
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
@@ -88,12 +100,12 @@ func CreateGetServerDetailsByGuidHandler(cAuth auth.Auth, appServerService serve
 			ServerGuid: guid,
 			AccountID:  user.AccountID,
 		}
-		server, err := appServerService.GetServerDetailsByGuid(request)
+		server, err := appServerService.GetServerDetailsByGuid(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, serverService.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
-			} else if errors.Is(err, serverService.ErrAgentConnection) {
+			} else if errors.Is(err, serverService.ErrAgentConnection) || errors.As(err, &agent.TimeoutError{}) {
 				c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
@@ -218,6 +230,54 @@ func CreateUpdateServerHandler(cAuth auth.Auth, appServerService serverService.S
 	}
 }
 
+// CreateUpdateServerTokenHandler replaces the agent token of the server. The token is write-only and never returned by the API.
+func CreateUpdateServerTokenHandler(cAuth auth.Auth, appServerService serverService.ServerService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		serverID, err := strconv.Atoi(c.Param("serverId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server ID")) // nolint:errcheck
+
+			return
+		}
+
+		var request serverService.UpdateServerTokenRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		request.ID = serverID
+		request.AccountID = user.AccountID
+
+		err = validator.Validate(request)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		err = appServerService.UpdateServerToken(request)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+		}
+	}
+}
+
 func CreateChangeCertbotStatusHandler(cAuth auth.Auth, certService serverService.ServerService) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		user := cAuth.GetCurrentUser(c)
@@ -244,11 +304,13 @@ func CreateChangeCertbotStatusHandler(cAuth auth.Auth, certService serverService
 
 		request.ServerGuid = guid
 		request.AccountId = user.AccountID
-		version, err := certService.ChangeCertbotStatus(request)
+		version, err := certService.ChangeCertbotStatus(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, serverService.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -259,3 +321,207 @@ func CreateChangeCertbotStatusHandler(cAuth auth.Auth, certService serverService
 		c.JSON(http.StatusOK, gin.H{"version": version})
 	}
 }
+
+func CreatePinAgentCertificateHandler(cAuth auth.Auth, appServerService serverService.ServerService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		guid := c.Param("serverId")
+
+		if guid == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server GUID")) // nolint:errcheck
+
+			return
+		}
+
+		var request serverService.PinAgentCertificateRequest
+
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+				return
+			}
+		}
+
+		request.ServerGuid = guid
+		request.AccountID = user.AccountID
+		pin, err := appServerService.PinAgentCertificate(c.Request.Context(), request)
+
+		if err != nil {
+			var fingerprintErr agent.ErrFingerprintMismatch
+
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.As(err, &fingerprintErr) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, pin)
+	}
+}
+
+func CreateGetServerFeaturesHandler(cAuth auth.Auth, appServerService serverService.ServerService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		guid := c.Param("serverId")
+
+		if guid == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server GUID")) // nolint:errcheck
+
+			return
+		}
+
+		request := serverService.GetServerFeaturesRequest{
+			ServerGuid: guid,
+			AccountID:  user.AccountID,
+		}
+		features, err := appServerService.GetServerFeatures(c.Request.Context(), request)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrAgentConnection) || errors.As(err, &agent.TimeoutError{}) {
+				c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"features": features})
+	}
+}
+
+// availabilityPeriods are periods the server availability can be requested for
+var availabilityPeriods = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+func CreateGetServerAvailabilityHandler(cAuth auth.Auth, appServerService serverService.ServerService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		guid := c.Param("serverId")
+
+		if guid == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server GUID")) // nolint:errcheck
+
+			return
+		}
+
+		period, ok := availabilityPeriods[c.DefaultQuery("period", "24h")]
+
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid period, allowed values: 24h, 7d, 30d"})
+
+			return
+		}
+
+		request := serverService.GetServerAvailabilityRequest{
+			ServerGuid: guid,
+			Period:     period,
+			AccountID:  user.AccountID,
+		}
+		availability, err := appServerService.GetServerAvailability(request)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"availability": availability})
+	}
+}
+
+// CreateRotateServerTokenHandler generates a new agent token of the server and replaces it on both the agent and the panel
+func CreateRotateServerTokenHandler(cAuth auth.Auth, appTokenRotationService serverService.TokenRotationService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		result, err := appTokenRotationService.RotateServerToken(c.Request.Context(), serverService.RotateServerTokenRequest{
+			ServerGuid: c.Param("serverId"),
+			AccountID:  user.AccountID,
+		})
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrTokenRotationInProgress) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CreateRotateServerTokensHandler rotates tokens of the listed account servers or of all account servers if none are listed
+func CreateRotateServerTokensHandler(cAuth auth.Auth, appTokenRotationService serverService.TokenRotationService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request serverService.RotateServerTokensRequest
+
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+				return
+			}
+		}
+
+		request.AccountID = user.AccountID
+		results, err := appTokenRotationService.RotateServerTokens(c.Request.Context(), request)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,47 @@
+package tunnel
+
+import (
+	serverService "backend/internal/app/panel/server/service"
+	"backend/internal/pkg/agent"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// CreateTunnelHandler upgrades the request of an agent to the tunnel WebSocket connection.
+// The agent identifies its server with the guid header and authenticates with the signature made with the server token.
+func CreateTunnelHandler(appTunnelService serverService.TunnelService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		server, err := appTunnelService.Authenticate(
+			c.GetHeader(agent.TunnelServerHeader),
+			agent.ReadTunnelSignature(c.Request.Header),
+		)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrTunnelUnauthorized) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrTunnelModeDisabled) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		// the engine takes the address from forwarded headers only if the request comes from a trusted proxy
+		remoteIP := c.ClientIP()
+		wsServer := websocket.Server{
+			// agents are not browsers, so the origin is not checked
+			Handshake: func(*websocket.Config, *http.Request) error {
+				return nil
+			},
+			Handler: func(conn *websocket.Conn) {
+				appTunnelService.ServeTunnel(server, conn, remoteIP)
+			},
+		}
+		wsServer.ServeHTTP(c.Writer, c.Request)
+	}
+}
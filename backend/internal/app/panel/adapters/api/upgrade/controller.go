@@ -0,0 +1,143 @@
+package upgrade
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	serverService "backend/internal/app/panel/server/service"
+	"backend/internal/app/panel/server/upgrade"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/validator.v2"
+)
+
+func CreateFindAgentUpgradesHandler(cAuth auth.Auth, appAgentUpgradeService serverService.AgentUpgradeService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		upgrades, err := appAgentUpgradeService.FindAgentUpgrades(user.AccountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"upgrades": upgrades})
+	}
+}
+
+func CreateCreateAgentUpgradeHandler(cAuth auth.Auth, appAgentUpgradeService serverService.AgentUpgradeService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request serverService.CreateAgentUpgradeRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		if err := validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.AccountID = user.AccountID
+		request.UserID = user.ID
+		agentUpgrade, err := appAgentUpgradeService.CreateAgentUpgrade(request)
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrServerNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrAgentUpgradeNoServers) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"upgrade": agentUpgrade})
+	}
+}
+
+func CreateGetAgentUpgradeHandler(cAuth auth.Auth, appAgentUpgradeService serverService.AgentUpgradeService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		upgradeID, err := strconv.Atoi(c.Param("upgradeId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid agent upgrade ID")) // nolint:errcheck
+
+			return
+		}
+
+		agentUpgrade, err := appAgentUpgradeService.GetAgentUpgrade(serverService.AgentUpgradeRequest{
+			ID:        upgradeID,
+			AccountID: user.AccountID,
+		})
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrAgentUpgradeNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"upgrade": agentUpgrade})
+	}
+}
+
+func CreateCancelAgentUpgradeHandler(cAuth auth.Auth, appAgentUpgradeService serverService.AgentUpgradeService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		upgradeID, err := strconv.Atoi(c.Param("upgradeId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid agent upgrade ID")) // nolint:errcheck
+
+			return
+		}
+
+		err = appAgentUpgradeService.CancelAgentUpgrade(serverService.AgentUpgradeRequest{
+			ID:        upgradeID,
+			AccountID: user.AccountID,
+		})
+
+		if err != nil {
+			if errors.Is(err, serverService.ErrAgentUpgradeNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, serverService.ErrAgentUpgradeFinished) || errors.Is(err, upgrade.ErrUpgradeNotRunning) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"backend/config"
 	"backend/internal/app/panel/adapters/cli/fixture"
 	"backend/internal/app/panel/adapters/cli/migration"
+	"backend/internal/app/panel/adapters/cli/server"
 
 	"github.com/spf13/cobra"
 )
@@ -41,6 +42,13 @@ func GetApp() (*App, error) {
 
 	rootCmd.AddCommand(fixture.GetFixturesCmd(config))
 
+	serversCmd := server.GetServersCmd()
+
+	rootCmd.AddCommand(serversCmd)
+	serversCmd.AddCommand(server.GetReencryptTokensCmd(config))
+	serversCmd.AddCommand(server.GetImportCmd(config))
+	serversCmd.AddCommand(server.GetExportCmd(config))
+
 	return &App{
 		cli: rootCmd,
 	}, err
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"backend/config"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// GetExportCmd returns the command that exports servers. The export contains agent tokens in plaintext.
+func GetExportCmd(config *config.Config) *cobra.Command {
+	var (
+		file      string
+		format    string
+		accountID int
+	)
+
+	var exportCmd = cobra.Command{
+		Use:   "export",
+		Short: "Export servers to a yaml or csv file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := detectFormat(format, file)
+
+			if err != nil {
+				return err
+			}
+
+			service, err := createServerService(config)
+
+			if err != nil {
+				return err
+			}
+
+			servers, err := service.ExportServers(accountID)
+
+			if err != nil {
+				return err
+			}
+
+			records := make([]serverRecord, 0, len(servers))
+
+			for _, server := range servers {
+				records = append(records, serverRecord{
+					Name:        server.Name,
+					Ipv4Address: server.Ipv4Address,
+					Ipv6Address: server.Ipv6Address,
+					AgentPort:   server.AgentPort,
+					Token:       server.Token,
+					AccountID:   server.AccountID,
+				})
+			}
+
+			var writer io.Writer = os.Stdout
+
+			if file != "-" {
+				// the export contains tokens, so the file is readable by the owner only
+				f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+				if err != nil {
+					return err
+				}
+
+				defer f.Close() // nolint:errcheck
+				writer = f
+			}
+
+			return writeRecords(writer, format, records)
+		},
+	}
+
+	exportCmd.Flags().StringVar(&file, "file", "-", "file to export servers to, stdout by default")
+	exportCmd.Flags().StringVar(&format, "format", "", "file format: yaml or csv, detected by the file extension by default")
+	exportCmd.Flags().IntVar(&accountID, "account", 0, "export servers of the account only")
+
+	return &exportCmd
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatYaml = "yaml"
+	formatCsv  = "csv"
+)
+
+var csvHeader = []string{"name", "ipv4_address", "ipv6_address", "agent_port", "token", "account_id"}
+
+type serverRecord struct {
+	Name        string `yaml:"name"`
+	Ipv4Address string `yaml:"ipv4_address,omitempty"`
+	Ipv6Address string `yaml:"ipv6_address,omitempty"`
+	AgentPort   int    `yaml:"agent_port,omitempty"`
+	Token       string `yaml:"token"`
+	AccountID   int    `yaml:"account_id,omitempty"`
+}
+
+// detectFormat returns the explicitly specified format or the one matching the file extension
+func detectFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = formatCsv
+		case ".yaml", ".yml", "":
+			format = formatYaml
+		}
+	}
+
+	if format != formatYaml && format != formatCsv {
+		return "", fmt.Errorf("unsupported format '%s', use %s or %s", format, formatYaml, formatCsv)
+	}
+
+	return format, nil
+}
+
+func readRecords(reader io.Reader, format string) ([]serverRecord, error) {
+	if format == formatCsv {
+		return readCsvRecords(reader)
+	}
+
+	var records []serverRecord
+
+	if err := yaml.NewDecoder(reader).Decode(&records); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid yaml: %v", err)
+	}
+
+	return records, nil
+}
+
+func readCsvRecords(reader io.Reader) ([]serverRecord, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	rows, err := csvReader.ReadAll()
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %v", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+
+	for i, column := range rows[0] {
+		columns[strings.TrimSpace(column)] = i
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("csv header must contain columns: %s", strings.Join(csvHeader, ", "))
+	}
+
+	value := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+
+		return ""
+	}
+
+	var records []serverRecord
+
+	for i, row := range rows[1:] {
+		record := serverRecord{
+			Name:        value(row, "name"),
+			Ipv4Address: value(row, "ipv4_address"),
+			Ipv6Address: value(row, "ipv6_address"),
+			Token:       value(row, "token"),
+		}
+
+		for column, target := range map[string]*int{"agent_port": &record.AgentPort, "account_id": &record.AccountID} {
+			if raw := value(row, column); raw != "" {
+				number, err := strconv.Atoi(raw)
+
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s '%s'", i+2, column, raw)
+				}
+
+				*target = number
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func writeRecords(writer io.Writer, format string, records []serverRecord) error {
+	if format == formatYaml {
+		encoder := yaml.NewEncoder(writer)
+		encoder.SetIndent(2)
+
+		if err := encoder.Encode(records); err != nil {
+			return err
+		}
+
+		return encoder.Close()
+	}
+
+	csvWriter := csv.NewWriter(writer)
+
+	if err := csvWriter.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err := csvWriter.Write([]string{
+			record.Name,
+			record.Ipv4Address,
+			record.Ipv6Address,
+			strconv.Itoa(record.AgentPort),
+			record.Token,
+			strconv.Itoa(record.AccountID),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"backend/config"
+	serverService "backend/internal/app/panel/server/service"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func GetImportCmd(config *config.Config) *cobra.Command {
+	var (
+		file      string
+		format    string
+		accountID int
+		dryRun    bool
+	)
+
+	var importCmd = cobra.Command{
+		Use:   "import",
+		Short: "Import servers from a yaml or csv file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := detectFormat(format, file)
+
+			if err != nil {
+				return err
+			}
+
+			var reader io.Reader = os.Stdin
+
+			if file != "-" {
+				f, err := os.Open(file)
+
+				if err != nil {
+					return err
+				}
+
+				defer f.Close() // nolint:errcheck
+				reader = f
+			}
+
+			records, err := readRecords(reader, format)
+
+			if err != nil {
+				return err
+			}
+
+			requests := make([]serverService.NewServerRequest, 0, len(records))
+
+			for _, record := range records {
+				request := serverService.NewServerRequest{
+					Name:        record.Name,
+					Ipv4Address: record.Ipv4Address,
+					Ipv6Address: record.Ipv6Address,
+					AgentPort:   record.AgentPort,
+					Token:       record.Token,
+					AccountID:   record.AccountID,
+				}
+
+				if request.AgentPort == 0 {
+					request.AgentPort = config.AgentPort
+				}
+
+				if request.AccountID == 0 {
+					request.AccountID = accountID
+				}
+
+				requests = append(requests, request)
+			}
+
+			service, err := createServerService(config)
+
+			if err != nil {
+				return err
+			}
+
+			errs, err := service.ImportServers(requests, dryRun)
+
+			for i, rErr := range errs {
+				if rErr != nil {
+					fmt.Printf("server #%d (%s): %v\n", i+1, requests[i].Name, rErr)
+				}
+			}
+
+			if errors.Is(err, serverService.ErrInvalidImport) {
+				return fmt.Errorf("%v, nothing is imported", err)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				fmt.Printf("dry run: %d servers are valid and can be imported\n", len(requests))
+			} else {
+				fmt.Printf("%d servers are imported\n", len(requests))
+			}
+
+			return nil
+		},
+	}
+
+	importCmd.Flags().StringVar(&file, "file", "-", "file to import servers from, stdin by default")
+	importCmd.Flags().StringVar(&format, "format", "", "file format: yaml or csv, detected by the file extension by default")
+	importCmd.Flags().IntVar(&accountID, "account", 0, "account of servers that have no account specified")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "validate servers without importing them")
+
+	return &importCmd
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"backend/config"
+	"backend/internal/pkg/secret"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// GetReencryptTokensCmd returns the command that encrypts agent tokens of all servers with the active key.
+// Keys the tokens are currently encrypted with must stay configured until the command is finished.
+func GetReencryptTokensCmd(config *config.Config) *cobra.Command {
+	var reencryptCmd = cobra.Command{
+		Use:   "reencrypt-tokens",
+		Short: "Encrypt agent tokens of all servers with the active encryption key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyRing, err := secret.NewKeyRing(config.TokenEncryptionKeys, config.TokenEncryptionKeyID)
+
+			if err != nil {
+				return err
+			}
+
+			if !keyRing.Enabled() {
+				return errors.New("token encryption keys are not configured")
+			}
+
+			storage, err := createServerStorage(config, keyRing)
+
+			if err != nil {
+				return err
+			}
+
+			servers, err := storage.FindAll()
+
+			if err != nil {
+				return err
+			}
+
+			for _, server := range servers {
+				if err = storage.UpdateToken(int(server.ID), server.Token); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("tokens of %d servers are encrypted with key '%s'\n", len(servers), keyRing.ActiveKeyID())
+
+			return nil
+		},
+	}
+
+	return &reencryptCmd
+}
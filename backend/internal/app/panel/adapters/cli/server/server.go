@@ -0,0 +1,17 @@
+package server
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func GetServersCmd() *cobra.Command {
+	var serversCmd = cobra.Command{
+		Use:   "servers",
+		Short: "Manage servers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	return &serversCmd
+}
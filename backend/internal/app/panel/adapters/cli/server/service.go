@@ -0,0 +1,70 @@
+package server
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	serverService "backend/internal/app/panel/server/service"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/db"
+	"backend/internal/pkg/logger"
+	"backend/internal/pkg/secret"
+)
+
+func createServerStorage(config *config.Config, keyRing *secret.KeyRing) (serverStorage.ServerStorage, error) {
+	database, err := db.GetDB(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return serverStorage.NewServerSqlStorage(database, keyRing), nil
+}
+
+func createServerService(config *config.Config) (serverService.ServerService, error) {
+	var service serverService.ServerService
+
+	keyRing, err := secret.NewKeyRing(config.TokenEncryptionKeys, config.TokenEncryptionKeyID)
+
+	if err != nil {
+		return service, err
+	}
+
+	storage, err := createServerStorage(config, keyRing)
+
+	if err != nil {
+		return service, err
+	}
+
+	appLogger, err := logger.NewLogger(config)
+
+	if err != nil {
+		return service, err
+	}
+
+	agentProvider, err := agentprovider.CreateAgentProvider(config, storage, appLogger)
+
+	if err != nil {
+		return service, err
+	}
+
+	database, err := db.GetDB(config)
+
+	if err != nil {
+		return service, err
+	}
+
+	groupStorage := serverStorage.NewServerGroupSqlStorage(database)
+	tagStorage := serverStorage.NewServerTagSqlStorage(database)
+
+	return serverService.NewServerService(
+		config,
+		storage,
+		serverStorage.NewProbeSqlStorage(database),
+		groupStorage,
+		tagStorage,
+		agentProvider,
+		maintenance.CreateChecker(serverStorage.NewMaintenanceSqlStorage(database), groupStorage, tagStorage),
+		appLogger,
+	), nil
+}
@@ -4,12 +4,28 @@ import (
 	"backend/config"
 	"backend/internal/app/panel/domain/provider"
 	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/monitor"
+	serverService "backend/internal/app/panel/server/service"
 	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/app/panel/server/upgrade"
+	userStorage "backend/internal/app/panel/user/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
 	"backend/internal/modules/sslmanager/autorenewal"
 	"backend/internal/modules/sslmanager/autorenewal/logstorage"
 	"backend/internal/modules/sslmanager/autorenewal/logwriter"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/modules/sslmanager/inventory"
+	"backend/internal/modules/sslmanager/inventory/certstorage"
 	"backend/internal/pkg/db"
 	"backend/internal/pkg/logger"
+	"backend/internal/pkg/notification"
+	"backend/internal/pkg/secret"
+	"backend/internal/pkg/telemetry"
+	"context"
+	"fmt"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -21,45 +37,169 @@ type App struct {
 	engine               *gin.Engine
 	db                   *gorm.DB
 	certRenewalScheduler autorenewal.Scheduler
+	agentProvider        *agentprovider.AgentProvider
+	serverMonitor        *monitor.Monitor
+	domainSynchronizer   provider.Synchronizer
+	tokenRotationService serverService.TokenRotationService
+	upgradeOrchestrator  *upgrade.Orchestrator
+	certificateCollector inventory.Collector
+	shutdownTelemetry    telemetry.ShutdownFunc
 }
 
 func (app *App) Run() error {
 	go app.certRenewalScheduler.Run()
+	go app.agentProvider.Run()
+	go app.serverMonitor.Run()
+	go app.domainSynchronizer.Run()
+	go app.tokenRotationService.Run()
+	go app.certificateCollector.Run()
+	app.upgradeOrchestrator.Run()
 
 	return app.engine.Run(app.config.ServerHost)
 }
 
+// Shutdown flushes the telemetry that is not exported yet
+func (app *App) Shutdown(ctx context.Context) error {
+	return app.shutdownTelemetry(ctx)
+}
+
 func GetApp(config *config.Config, logger logger.Logger) (*App, error) {
+	shutdownTelemetry, err := telemetry.Setup(context.Background(), config)
+
+	if err != nil {
+		return nil, err
+	}
+
 	database, err := db.GetDB(config)
 
 	if err != nil {
 		return nil, err
 	}
 
-	engine, err := newEngine(config, logger, database)
+	tokenKeyRing, err := secret.NewKeyRing(config.TokenEncryptionKeys, config.TokenEncryptionKeyID)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption keys: %v", err)
+	}
+
+	if !tokenKeyRing.Enabled() {
+		logger.Warning("token encryption keys are not configured, server agent tokens are stored in plaintext")
+	}
+
+	appServerStorage := serverStorage.NewServerSqlStorage(database, tokenKeyRing)
+	// credentials of DNS providers and certificate authorities and keys of ACME accounts are encrypted with the same keys as agent tokens
+	dnsProviderStorage := dnsstorage.CreateSqlDnsProviderStorage(database, tokenKeyRing)
+	appAgentProvider, err := agentprovider.CreateAgentProvider(config, appServerStorage, logger)
+
+	if err != nil {
+		return nil, err
+	}
+
+	certificateAuthorityStorage := acmestorage.CreateSqlCertificateAuthorityStorage(database, tokenKeyRing)
+	certificateStorage := certstorage.CreateSqlCertificateStorage(database)
+	issuer, err := acmeissuer.CreateIssuer(config, acmestorage.CreateSqlAcmeAccountStorage(database, tokenKeyRing), logger)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maintenanceChecker := maintenance.CreateChecker(
+		serverStorage.NewMaintenanceSqlStorage(database),
+		serverStorage.NewServerGroupSqlStorage(database),
+		serverStorage.NewServerTagSqlStorage(database),
+	)
+	serverMonitor := monitor.CreateMonitor(
+		config,
+		appServerStorage,
+		serverStorage.NewProbeSqlStorage(database),
+		appAgentProvider,
+		maintenanceChecker,
+		logger,
+	)
+
+	tokenRotationService := serverService.NewTokenRotationService(config, appServerStorage, appAgentProvider, logger)
+	upgradeOrchestrator := upgrade.CreateOrchestrator(
+		config,
+		appServerStorage,
+		serverStorage.NewAgentUpgradeSqlStorage(database),
+		appAgentProvider,
+		logger,
+	)
+	engine, err := newEngine(
+		config,
+		logger,
+		database,
+		appServerStorage,
+		serverStorage.NewEnrollmentCodeSqlStorage(database, tokenKeyRing),
+		dnsProviderStorage,
+		certificateAuthorityStorage,
+		certificateStorage,
+		issuer,
+		appAgentProvider,
+		serverMonitor,
+		tokenRotationService,
+		upgradeOrchestrator,
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
 	renewalLogStorage := logstorage.CreateSqlRenewalLogStorage(database)
-	appServerStorage := serverStorage.NewServerSqlStorage(database)
 	appDomainSettingStorage := domainStorage.NewDomainSettingSqlStorage(database)
-	domainProvider := provider.CreateDomainProvider(appServerStorage, logger)
+	domainProvider := provider.CreateDomainProvider(
+		config,
+		appServerStorage,
+		domainStorage.NewDomainSqlStorage(database),
+		appAgentProvider,
+		logger,
+	)
 	certRenewalManager := autorenewal.CreateAutoRenewalManager(
 		appServerStorage,
 		appDomainSettingStorage,
+		dnsProviderStorage,
+		certificateAuthorityStorage,
+		issuer,
 		domainProvider,
+		appAgentProvider,
+		maintenanceChecker,
 		config,
 		logger,
 		logwriter.CreatePersistentLogWriter(renewalLogStorage),
 	)
 
+	domainSynchronizer := provider.CreateSynchronizer(config, appServerStorage, domainProvider, logger)
+
+	// domains of a server that comes back online are synced without waiting for the next sync
+	serverMonitor.Subscribe(func(event monitor.StatusEvent) {
+		if event.Online {
+			go domainSynchronizer.SyncServer(context.Background(), event.ServerID)
+		}
+	})
+
+	if config.ServerStatusNotifications {
+		statusNotifier := monitor.CreateNotifier(
+			userStorage.NewUserSqlStorage(database),
+			notification.EmailNotificationService{Config: config},
+			logger,
+		)
+		serverMonitor.Subscribe(func(event monitor.StatusEvent) {
+			go statusNotifier.Notify(event)
+		})
+	}
+
 	return &App{
 		config:               config,
 		logger:               logger,
 		engine:               engine,
 		db:                   database,
 		certRenewalScheduler: autorenewal.CreateScheduler(config, logger, certRenewalManager),
+		agentProvider:        appAgentProvider,
+		serverMonitor:        serverMonitor,
+		domainSynchronizer:   domainSynchronizer,
+		tokenRotationService: tokenRotationService,
+		upgradeOrchestrator:  upgradeOrchestrator,
+		certificateCollector: inventory.CreateCollector(config, appServerStorage, certificateStorage, appAgentProvider, logger),
+		shutdownTelemetry:    shutdownTelemetry,
 	}, nil
 }
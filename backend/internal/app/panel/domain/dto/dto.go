@@ -1,7 +1,6 @@
 package dto
 
 import (
-	"strings"
 	"time"
 )
 
@@ -37,22 +36,6 @@ type DomainCertificate struct {
 	Issuer         Issuer   `json:"issuer"`
 }
 
-func (c DomainCertificate) IsLetsEncrypt() bool {
-	for _, org := range c.Organization {
-		if strings.Contains(org, "Let's Encrypt") || strings.Contains(org, "good guys") {
-			return true
-		}
-	}
-
-	for _, org := range c.Issuer.Organization {
-		if strings.Contains(org, "Let's Encrypt") || strings.Contains(org, "good guys") {
-			return true
-		}
-	}
-
-	return strings.Contains(c.CN, "Let's Encrypt") || strings.Contains(c.CN, "R3")
-}
-
 func (c DomainCertificate) IsSelfSigned() bool {
 	return c.CN == c.Issuer.CN
 }
@@ -71,3 +54,18 @@ type Issuer struct {
 	CN           string   `json:"cn"`
 	Organization []string `json:"organization"`
 }
+
+// Inventory is the stored list of server domains. Stale is set if the last sync failed or was too long ago.
+type Inventory struct {
+	Domains   []Domain   `json:"domains"`
+	SyncedAt  *time.Time `json:"synced_at"`
+	Stale     bool       `json:"stale"`
+	SyncError string     `json:"sync_error"`
+}
+
+type DomainChange struct {
+	ServerName string    `json:"servername"`
+	WebServer  string    `json:"webserver"`
+	Change     string    `json:"change"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"backend/internal/app/panel/domain/dto"
+	"backend/internal/app/panel/domain/storage"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func createDomainModel(domain dto.Domain) (storage.Domain, error) {
+	domainModel := storage.Domain{
+		ServerName: domain.ServerName,
+		WebServer:  domain.WebServer,
+		FilePath:   domain.FilePath,
+		DocRoot:    domain.DocRoot,
+	}
+
+	if domain.Ssl {
+		domainModel.Ssl = 1
+	}
+
+	aliases, err := json.Marshal(domain.Aliases)
+
+	if err != nil {
+		return domainModel, err
+	}
+
+	addresses, err := json.Marshal(domain.Addresses)
+
+	if err != nil {
+		return domainModel, err
+	}
+
+	certificate, err := json.Marshal(domain.Certificate)
+
+	if err != nil {
+		return domainModel, err
+	}
+
+	domainModel.Aliases = string(aliases)
+	domainModel.Addresses = string(addresses)
+	domainModel.Certificate = string(certificate)
+
+	if domain.Certificate != nil {
+		if validTo, err := time.Parse(time.RFC822Z, domain.Certificate.ValidTo); err == nil {
+			domainModel.CertificateExpiresAt = &validTo
+		}
+	}
+
+	return domainModel, nil
+}
+
+func createDomain(domainModel storage.Domain) (dto.Domain, error) {
+	domain := dto.Domain{
+		ServerName: domainModel.ServerName,
+		WebServer:  domainModel.WebServer,
+		FilePath:   domainModel.FilePath,
+		DocRoot:    domainModel.DocRoot,
+		Ssl:        domainModel.Ssl == 1,
+	}
+
+	if err := unmarshalField(domainModel.Aliases, &domain.Aliases); err != nil {
+		return domain, fmt.Errorf("invalid aliases of domain %s: %v", domainModel.ServerName, err)
+	}
+
+	if err := unmarshalField(domainModel.Addresses, &domain.Addresses); err != nil {
+		return domain, fmt.Errorf("invalid addresses of domain %s: %v", domainModel.ServerName, err)
+	}
+
+	if err := unmarshalField(domainModel.Certificate, &domain.Certificate); err != nil {
+		return domain, fmt.Errorf("invalid certificate of domain %s: %v", domainModel.ServerName, err)
+	}
+
+	return domain, nil
+}
+
+func unmarshalField(value string, target any) error {
+	if value == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(value), target)
+}
+
+// diffDomains returns domains that appeared on or disappeared from the server since the previous sync
+func diffDomains(serverID int, stored, synced []storage.Domain) []storage.DomainChange {
+	var changes []storage.DomainChange
+
+	storedKeys := map[string]bool{}
+	syncedKeys := map[string]bool{}
+
+	for _, domain := range stored {
+		storedKeys[domain.Key()] = true
+	}
+
+	// several virtual hosts may serve the same domain, the change is recorded once for all of them
+	for _, domain := range synced {
+		if !storedKeys[domain.Key()] && !syncedKeys[domain.Key()] {
+			changes = append(changes, createDomainChange(serverID, domain, storage.DomainChangeAdded))
+		}
+
+		syncedKeys[domain.Key()] = true
+	}
+
+	for _, domain := range stored {
+		if !syncedKeys[domain.Key()] {
+			changes = append(changes, createDomainChange(serverID, domain, storage.DomainChangeRemoved))
+			syncedKeys[domain.Key()] = true
+		}
+	}
+
+	return changes
+}
+
+func createDomainChange(serverID int, domain storage.Domain, change string) storage.DomainChange {
+	return storage.DomainChange{
+		ServerID:   serverID,
+		ServerName: domain.ServerName,
+		WebServer:  domain.WebServer,
+		Change:     change,
+	}
+}
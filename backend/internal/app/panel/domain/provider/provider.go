@@ -1,22 +1,46 @@
 package provider
 
 import (
+	"backend/config"
 	"backend/internal/app/panel/domain/dto"
 	"backend/internal/app/panel/domain/factory"
+	"backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
 	serverStorage "backend/internal/app/panel/server/storage"
-	"backend/internal/pkg/agent"
 	"backend/internal/pkg/logger"
+	"backend/internal/pkg/text"
+	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 var ErrServerNotFound = errors.New("server not found")
 
+// staleSyncIntervals is the number of missed sync intervals after which the inventory of a server is stale
+const staleSyncIntervals = 2
+
 type DomainProvider struct {
+	config        *config.Config
 	serverStorage serverStorage.ServerStorage
+	domainStorage storage.DomainStorage
+	agentProvider *agentprovider.AgentProvider
 	logger        logger.Logger
 }
 
-func (p DomainProvider) GetServerDomains(serverGuid string) ([]dto.Domain, error) {
+// GetServerDomains returns stored domains of the server
+func (p DomainProvider) GetServerDomains(ctx context.Context, serverGuid string) ([]dto.Domain, error) {
+	inventory, err := p.GetServerInventory(ctx, serverGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory.Domains, nil
+}
+
+// GetServerInventory returns stored domains of the server. Domains of a server that was never synced are synced on demand.
+func (p DomainProvider) GetServerInventory(ctx context.Context, serverGuid string) (*dto.Inventory, error) {
 	serverModel, err := p.serverStorage.FindByGuid(serverGuid)
 
 	if err != nil {
@@ -27,42 +51,174 @@ func (p DomainProvider) GetServerDomains(serverGuid string) ([]dto.Domain, error
 		return nil, ErrServerNotFound
 	}
 
-	nAgent, err := agent.NewAgent(
-		serverModel.Ipv4Address,
-		serverModel.Ipv6Address,
-		serverModel.Token,
-		serverModel.AgentPort,
-		p.logger,
-	)
+	domainSync, err := p.domainStorage.FindSync(int(serverModel.ID))
 
 	if err != nil {
 		return nil, err
 	}
 
-	vhosts, err := nAgent.GetVhosts()
+	if domainSync == nil || domainSync.SyncedAt == nil {
+		if _, err = p.SyncServerDomains(ctx, serverModel); err != nil {
+			return nil, err
+		}
+
+		if domainSync, err = p.domainStorage.FindSync(int(serverModel.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	domainModels, err := p.domainStorage.FindAllByServerID(int(serverModel.ID))
 
 	if err != nil {
 		return nil, err
 	}
 
-	domains := []dto.Domain{}
+	domains := make([]dto.Domain, 0, len(domainModels))
 
-	for _, vhost := range vhosts {
-		domain := factory.CreateDomain(vhost)
+	for _, domainModel := range domainModels {
+		domain, err := createDomain(domainModel)
 
-		if domain == nil {
-			continue
+		if err != nil {
+			return nil, err
 		}
 
-		domains = append(domains, *domain)
+		domains = append(domains, domain)
+	}
+
+	inventory := &dto.Inventory{Domains: domains}
+
+	if domainSync != nil {
+		inventory.SyncedAt = domainSync.SyncedAt
+		inventory.SyncError = domainSync.Error
+		inventory.Stale = p.isStale(domainSync)
+	}
+
+	return inventory, nil
+}
+
+// SyncServerDomains fetches virtual hosts from the agent, replaces stored domains of the server and records appeared and disappeared domains
+func (p DomainProvider) SyncServerDomains(ctx context.Context, server *serverStorage.Server) ([]dto.Domain, error) {
+	now := time.Now()
+	domains, err := p.fetchServerDomains(ctx, server)
+
+	if err != nil {
+		if saveErr := p.domainStorage.SaveSyncError(int(server.ID), now, text.Truncate(err.Error(), 1024)); saveErr != nil {
+			p.logger.Error(saveErr.Error())
+		}
+
+		return nil, err
+	}
+
+	domainModels := make([]storage.Domain, 0, len(domains))
+
+	for _, domain := range domains {
+		domainModel, err := createDomainModel(domain)
+
+		if err != nil {
+			return nil, err
+		}
+
+		domainModels = append(domainModels, domainModel)
+	}
+
+	domainSync, err := p.domainStorage.FindSync(int(server.ID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []storage.DomainChange
+
+	// all domains are new on the first sync, they are not recorded as changes
+	if domainSync != nil && domainSync.SyncedAt != nil {
+		storedModels, err := p.domainStorage.FindAllByServerID(int(server.ID))
+
+		if err != nil {
+			return nil, err
+		}
+
+		changes = diffDomains(int(server.ID), storedModels, domainModels)
+	}
+
+	if err = p.domainStorage.ReplaceServerDomains(int(server.ID), domainModels, changes, now); err != nil {
+		return nil, fmt.Errorf("failed to save domains of server %s: %v", server.Name, err)
+	}
+
+	for _, change := range changes {
+		p.logger.Info(fmt.Sprintf("domain %s (%s) %s on server %s", change.ServerName, change.WebServer, change.Change, server.Name))
+	}
+
+	return domains, nil
+}
+
+// GetServerDomainChanges returns the latest domains that appeared on or disappeared from the server, most recent first
+func (p DomainProvider) GetServerDomainChanges(serverID int, limit int) ([]dto.DomainChange, error) {
+	changeModels, err := p.domainStorage.FindChangesByServerID(serverID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]dto.DomainChange, 0, len(changeModels))
+
+	for _, changeModel := range changeModels {
+		changes = append(changes, dto.DomainChange{
+			ServerName: changeModel.ServerName,
+			WebServer:  changeModel.WebServer,
+			Change:     changeModel.Change,
+			CreatedAt:  changeModel.CreatedAt,
+		})
+	}
+
+	return changes, nil
+}
+
+func (p DomainProvider) fetchServerDomains(ctx context.Context, server *serverStorage.Server) ([]dto.Domain, error) {
+	nAgent, err := p.agentProvider.GetAgent(server)
+
+	if err != nil {
+		return nil, err
+	}
+
+	vhosts, err := nAgent.GetVhosts(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []dto.Domain{}
+
+	// a domain is often served by several virtual hosts of the same web server, e.g. for http and https,
+	// each of them is kept, since they have own config files, document roots and certificates
+	for _, vhost := range vhosts {
+		if domain := factory.CreateDomain(vhost); domain != nil {
+			domains = append(domains, *domain)
+		}
 	}
 
 	return domains, nil
 }
 
-func CreateDomainProvider(serverStorage serverStorage.ServerStorage, logger logger.Logger) DomainProvider {
+func (p DomainProvider) isStale(domainSync *storage.DomainSync) bool {
+	if domainSync.Error != "" || domainSync.SyncedAt == nil {
+		return true
+	}
+
+	return time.Since(*domainSync.SyncedAt) > staleSyncIntervals*p.config.DomainSyncInterval
+}
+
+func CreateDomainProvider(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	domainStorage storage.DomainStorage,
+	agentProvider *agentprovider.AgentProvider,
+	logger logger.Logger,
+) DomainProvider {
 	return DomainProvider{
+		config:        config,
 		serverStorage: serverStorage,
+		domainStorage: domainStorage,
+		agentProvider: agentProvider,
 		logger:        logger,
 	}
 }
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"backend/config"
+	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const testToken = "test-token"
+
+func TestSyncServerDomains(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{ServerName: "example.com", WebServer: "nginx", FilePath: "/etc/nginx/sites-enabled/example.com", DocRoot: "/var/www/example", Aliases: []string{"www.example.com"}},
+		{ServerName: "example.com", WebServer: "nginx", FilePath: "/etc/nginx/sites-enabled/example.com-ssl", DocRoot: "/var/www/example-ssl", Ssl: true, Certificate: &agentintegration.Certificate{CN: "example.com"}},
+		{ServerName: "old.com", WebServer: "nginx"},
+	})
+
+	cfg := &config.Config{DomainSyncInterval: 15 * time.Minute}
+	sStorage := testutil.NewServerMemoryStorage()
+	dStorage := testutil.NewDomainMemoryStorage()
+	agentProvider, err := agentprovider.CreateAgentProvider(cfg, sStorage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip, port := fAgent.Address()
+	server := &serverStorage.Server{Name: "test", Ipv4Address: ip, AgentPort: port, Token: testToken, AccountID: 1}
+
+	if err = sStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	domainProvider := CreateDomainProvider(cfg, sStorage, dStorage, agentProvider, logger.NewNopLogger())
+	domains, err := domainProvider.GetServerDomains(context.Background(), server.Guid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(domains) != 3 {
+		t.Fatalf("expected a domain per virtual host, got %+v", domains)
+	}
+
+	plain, secure := domains[0], domains[1]
+
+	if plain.Ssl || plain.FilePath != "/etc/nginx/sites-enabled/example.com" || plain.DocRoot != "/var/www/example" || len(plain.Aliases) != 1 {
+		t.Errorf("unexpected http virtual host of example.com: %+v", plain)
+	}
+
+	if !secure.Ssl || secure.FilePath != "/etc/nginx/sites-enabled/example.com-ssl" || secure.DocRoot != "/var/www/example-ssl" || secure.Certificate == nil {
+		t.Errorf("unexpected https virtual host of example.com: %+v", secure)
+	}
+
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{ServerName: "example.com", WebServer: "nginx"},
+		{ServerName: "new.com", WebServer: "apache"},
+	})
+
+	if _, err = domainProvider.SyncServerDomains(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := domainProvider.GetServerDomainChanges(int(server.ID), 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || changes[0].ServerName != "old.com" || changes[0].Change != domainStorage.DomainChangeRemoved ||
+		changes[1].ServerName != "new.com" || changes[1].Change != domainStorage.DomainChangeAdded {
+		t.Fatalf("unexpected domain changes: %+v", changes)
+	}
+
+	fAgent.Close()
+
+	if _, err = domainProvider.SyncServerDomains(context.Background(), server); err == nil {
+		t.Fatal("expected sync of an offline server to fail")
+	}
+
+	inventory, err := domainProvider.GetServerInventory(context.Background(), server.Guid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inventory.Domains) != 2 || !inventory.Stale || inventory.SyncError == "" {
+		t.Fatalf("expected stale inventory of the offline server, got %+v", inventory)
+	}
+}
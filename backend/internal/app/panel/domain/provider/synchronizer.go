@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"backend/config"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	syncWorkersCount = 10
+	syncTimeout      = 30 * time.Second
+)
+
+// Synchronizer periodically syncs the domain inventory of all servers
+type Synchronizer struct {
+	config         *config.Config
+	serverStorage  serverStorage.ServerStorage
+	domainProvider DomainProvider
+	logger         logger.Logger
+}
+
+func (s Synchronizer) Run() {
+	for range time.Tick(s.config.DomainSyncInterval) {
+		s.SyncAll(context.Background())
+	}
+}
+
+// SyncAll syncs domains of all servers and waits until all syncs are finished
+func (s Synchronizer) SyncAll(ctx context.Context) {
+	servers, err := s.serverStorage.FindAll()
+
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("domain sync failed: %v", err))
+
+		return
+	}
+
+	jobs := make(chan serverStorage.Server, len(servers))
+
+	for _, server := range servers {
+		jobs <- server
+	}
+
+	close(jobs)
+
+	var wg sync.WaitGroup
+
+	for range min(len(servers), syncWorkersCount) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for server := range jobs {
+				s.syncServer(ctx, &server)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// SyncServer syncs domains of the server with the specified ID
+func (s Synchronizer) SyncServer(ctx context.Context, serverID uint) {
+	server, err := s.serverStorage.FindByID(int(serverID))
+
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("domain sync of server with ID %d failed: %v", serverID, err))
+
+		return
+	}
+
+	if server != nil {
+		s.syncServer(ctx, server)
+	}
+}
+
+func (s Synchronizer) syncServer(ctx context.Context, server *serverStorage.Server) {
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+
+	if _, err := s.domainProvider.SyncServerDomains(ctx, server); err != nil {
+		s.logger.Debug(fmt.Sprintf("domain sync of server %s failed: %v", server.Name, err))
+	}
+}
+
+func CreateSynchronizer(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	domainProvider DomainProvider,
+	logger logger.Logger,
+) Synchronizer {
+	return Synchronizer{
+		config:         config,
+		serverStorage:  serverStorage,
+		domainProvider: domainProvider,
+		logger:         logger,
+	}
+}
@@ -1,5 +1,24 @@
 package service
 
+import (
+	"backend/internal/app/panel/domain/dto"
+	"backend/internal/app/panel/server/maintenance"
+)
+
+// Domain is the domain with the maintenance windows in effect now that apply to it
+type Domain struct {
+	dto.Domain
+
+	Maintenance []maintenance.Window `json:"maintenance,omitempty"`
+}
+
+// Inventory is the stored list of server domains with the maintenance windows that apply to them
+type Inventory struct {
+	dto.Inventory
+
+	Domains []Domain `json:"domains"`
+}
+
 type DomainSetting struct {
 	ID           int    `json:"id"`
 	SettingName  string `json:"settingname"`
@@ -20,6 +39,11 @@ type DomainRequest struct {
 	AccountID  int
 }
 
+type ServerDomainsRequest struct {
+	ServerGuid string
+	AccountID  int
+}
+
 type DomainCertificateRequest struct {
 	ServerGuid string
 	DomainName string
@@ -39,3 +63,17 @@ type ChangeDomainSettingRequest struct {
 	SettingValue string `json:"settingvalue"`
 	AccountID    int
 }
+
+type ChangeGroupAutoRenewalRequest struct {
+	GroupID   int
+	Enabled   bool `json:"enabled"`
+	AccountID int
+}
+
+// ServerDomainsResult lists domains of the server a group operation has been applied to
+type ServerDomainsResult struct {
+	ServerGuid string   `json:"guid"`
+	ServerName string   `json:"name"`
+	Domains    []string `json:"domains"`
+	Error      string   `json:"error,omitempty"`
+}
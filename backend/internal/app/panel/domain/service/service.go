@@ -5,11 +5,17 @@ import (
 	"backend/internal/app/panel/domain/dto"
 	"backend/internal/app/panel/domain/provider"
 	"backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/scope"
 	serverStorage "backend/internal/app/panel/server/storage"
 	"backend/internal/pkg/agent"
 	"backend/internal/pkg/logger"
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 
 	"github.com/r2dtools/agentintegration"
 )
@@ -17,17 +23,26 @@ import (
 var ErrServerNotFound = errors.New("server not found")
 var ErrDomainNotFound = errors.New("domain not found")
 var ErrAgentConnection = errors.New("failed to connect to the server agent")
+var ErrServerGroupNotFound = errors.New("server group not found")
+
+const (
+	domainChangesLimit = 100
+	renewalSettingName = "renewal"
+)
 
 type DomainService struct {
 	config         *config.Config
 	settingStorage storage.DomainSettingStorage
 	serverStorage  serverStorage.ServerStorage
 	domainProvider provider.DomainProvider
+	agentProvider  *agentprovider.AgentProvider
+	scopeResolver  scope.Resolver
+	maintenance    maintenance.Checker
 	logger         logger.Logger
 }
 
-func (s DomainService) GetDomain(request DomainRequest) (dto.Domain, error) {
-	var rDomain dto.Domain
+func (s DomainService) GetDomain(ctx context.Context, request DomainRequest) (Domain, error) {
+	var rDomain Domain
 
 	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
 
@@ -39,16 +54,26 @@ func (s DomainService) GetDomain(request DomainRequest) (dto.Domain, error) {
 		return rDomain, ErrServerNotFound
 	}
 
-	domains, err := s.domainProvider.GetServerDomains(request.ServerGuid)
+	domains, err := s.domainProvider.GetServerDomains(ctx, request.ServerGuid)
 
 	if err == provider.ErrServerNotFound {
 		return rDomain, ErrServerNotFound
 	}
 
+	if err != nil {
+		return rDomain, err
+	}
+
 	for _, domain := range domains {
 		if domain.ServerName == request.DomainName {
 			if request.WebServer == "" || request.WebServer == domain.WebServer {
-				return domain, nil
+				windows, err := s.maintenance.ServerWindows(serverModel)
+
+				if err != nil {
+					return rDomain, err
+				}
+
+				return CreateDomain(domain, windows), nil
 			}
 		}
 	}
@@ -56,7 +81,59 @@ func (s DomainService) GetDomain(request DomainRequest) (dto.Domain, error) {
 	return rDomain, ErrDomainNotFound
 }
 
-func (s DomainService) GetDomainConfig(request DomainConfigRequest) (string, error) {
+// GetServerInventory returns stored domains of the server with the staleness of the inventory
+func (s DomainService) GetServerInventory(ctx context.Context, request ServerDomainsRequest) (*Inventory, error) {
+	serverModel, err := s.findServer(request.ServerGuid, request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := s.domainProvider.GetServerInventory(ctx, request.ServerGuid)
+
+	if err == provider.ErrServerNotFound {
+		return nil, ErrServerNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := s.maintenance.ServerWindows(serverModel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Inventory{Inventory: *inventory, Domains: CreateDomains(inventory.Domains, windows)}, nil
+}
+
+// SyncServerDomains syncs domains of the server on demand and returns the updated inventory
+func (s DomainService) SyncServerDomains(ctx context.Context, request ServerDomainsRequest) (*Inventory, error) {
+	serverModel, err := s.findServer(request.ServerGuid, request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.domainProvider.SyncServerDomains(ctx, serverModel); err != nil {
+		return nil, err
+	}
+
+	return s.GetServerInventory(ctx, request)
+}
+
+func (s DomainService) FindDomainChanges(request ServerDomainsRequest) ([]dto.DomainChange, error) {
+	serverModel, err := s.findServer(request.ServerGuid, request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.domainProvider.GetServerDomainChanges(int(serverModel.ID), domainChangesLimit)
+}
+
+func (s DomainService) GetDomainConfig(ctx context.Context, request DomainConfigRequest) (string, error) {
 	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
 
 	if err != nil {
@@ -73,7 +150,7 @@ func (s DomainService) GetDomainConfig(request DomainConfigRequest) (string, err
 		return "", err
 	}
 
-	config, err := nAgent.GetVhostConfig(agentintegration.VirtualHostConfigRequestData{
+	config, err := nAgent.GetVhostConfig(ctx, agentintegration.VirtualHostConfigRequestData{
 		WebServer:  request.WebServer,
 		ServerName: request.DomainName,
 	})
@@ -122,39 +199,101 @@ func (s DomainService) ChangeDomainSettings(request ChangeDomainSettingRequest)
 		return ErrServerNotFound
 	}
 
-	settingModel, err := s.settingStorage.FindByDomain(request.DomainName, request.ServerGuid, request.SettingName)
+	return s.setDomainSetting(request.DomainName, request.ServerGuid, request.SettingName, request.SettingValue)
+}
+
+// ChangeGroupAutoRenewal enables or disables auto renewal of every known domain on every server of the group
+func (s DomainService) ChangeGroupAutoRenewal(ctx context.Context, request ChangeGroupAutoRenewalRequest) ([]ServerDomainsResult, error) {
+	servers, err := s.scopeResolver.Resolve(request.AccountID, scope.Scope{GroupIDs: []int{request.GroupID}})
 
 	if err != nil {
-		return fmt.Errorf("error while searching setting %s for domain %s", request.SettingName, request.DomainName)
+		if errors.Is(err, scope.ErrGroupNotFound) {
+			return nil, ErrServerGroupNotFound
+		}
+
+		return nil, err
+	}
+
+	value := strconv.FormatBool(request.Enabled)
+	results := []ServerDomainsResult{}
+
+	for _, server := range servers {
+		result := ServerDomainsResult{
+			ServerGuid: server.Guid,
+			ServerName: server.Name,
+			Domains:    []string{},
+		}
+		domains, err := s.domainProvider.GetServerDomains(ctx, server.Guid)
+
+		if err == nil {
+			for _, domain := range domains {
+				// the domain may be served by several virtual hosts
+				if slices.Contains(result.Domains, domain.ServerName) {
+					continue
+				}
+
+				if err = s.setDomainSetting(domain.ServerName, server.Guid, renewalSettingName, value); err != nil {
+					break
+				}
+
+				result.Domains = append(result.Domains, domain.ServerName)
+			}
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	s.logger.Info(fmt.Sprintf("auto renewal changed to %s for server group %d, account: %d", value, request.GroupID, request.AccountID))
+
+	return results, nil
+}
+
+func (s DomainService) setDomainSetting(domainName, serverGuid, settingName, settingValue string) error {
+	settingModel, err := s.settingStorage.FindByDomain(domainName, serverGuid, settingName)
+
+	if err != nil {
+		return fmt.Errorf("error while searching setting %s for domain %s", settingName, domainName)
 	}
 
 	if settingModel == nil {
 		err = s.settingStorage.Create(
-			request.DomainName,
-			request.ServerGuid,
-			request.SettingName,
-			request.SettingValue,
+			domainName,
+			serverGuid,
+			settingName,
+			settingValue,
 		)
 	} else {
-		settingModel.SettingValue = request.SettingValue
+		settingModel.SettingValue = settingValue
 		err = s.settingStorage.Save(settingModel)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to change setting %s: %v", request.SettingName, err)
+		return fmt.Errorf("failed to change setting %s: %v", settingName, err)
 	}
 
 	return nil
 }
 
+func (s DomainService) findServer(serverGuid string, accountID int) (*serverStorage.Server, error) {
+	serverModel, err := s.serverStorage.FindByGuid(serverGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(accountID) {
+		return nil, ErrServerNotFound
+	}
+
+	return serverModel, nil
+}
+
 func (s DomainService) getServerAgent(server *serverStorage.Server) (*agent.Agent, error) {
-	return agent.NewAgent(
-		server.Ipv4Address,
-		server.Ipv6Address,
-		server.Token,
-		server.AgentPort,
-		s.logger,
-	)
+	return s.agentProvider.GetAgent(server)
 }
 
 func createDomainSetting(settingModel storage.DomainSetting) DomainSetting {
@@ -165,11 +304,30 @@ func createDomainSetting(settingModel storage.DomainSetting) DomainSetting {
 	}
 }
 
+// CreateDomain returns the domain with the windows that apply to it
+func CreateDomain(domain dto.Domain, windows []maintenance.Window) Domain {
+	return Domain{Domain: domain, Maintenance: maintenance.DomainWindows(windows, domain.ServerName)}
+}
+
+// CreateDomains returns the domains with the windows that apply to each of them
+func CreateDomains(domains []dto.Domain, windows []maintenance.Window) []Domain {
+	rDomains := make([]Domain, 0, len(domains))
+
+	for _, domain := range domains {
+		rDomains = append(rDomains, CreateDomain(domain, windows))
+	}
+
+	return rDomains
+}
+
 func NewDomainService(
 	config *config.Config,
 	settingStorage storage.DomainSettingStorage,
 	serverStorage serverStorage.ServerStorage,
 	domainProvider provider.DomainProvider,
+	agentProvider *agentprovider.AgentProvider,
+	scopeResolver scope.Resolver,
+	maintenanceChecker maintenance.Checker,
 	logger logger.Logger,
 ) DomainService {
 	return DomainService{
@@ -177,6 +335,9 @@ func NewDomainService(
 		settingStorage: settingStorage,
 		serverStorage:  serverStorage,
 		domainProvider: domainProvider,
+		agentProvider:  agentProvider,
+		scopeResolver:  scopeResolver,
+		maintenance:    maintenanceChecker,
 		logger:         logger,
 	}
 }
@@ -0,0 +1,61 @@
+package storage
+
+import "time"
+
+const (
+	DomainChangeAdded   = "added"
+	DomainChangeRemoved = "removed"
+)
+
+// Domain is a virtual host of a server as reported by the agent during the last domain sync.
+// Aliases, addresses and certificate are stored as JSON.
+type Domain struct {
+	ID                   int `gorm:"AUTO_INCREMENT;primary_key"`
+	ServerID             int
+	ServerName           string `gorm:"size:255"`
+	WebServer            string `gorm:"size:32"`
+	FilePath             string `gorm:"size:1024"`
+	DocRoot              string `gorm:"size:1024"`
+	Aliases              string
+	Addresses            string
+	Ssl                  uint8
+	Certificate          string
+	CertificateExpiresAt *time.Time
+	SyncedAt             time.Time
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// Key identifies the domain on the server, the same server name may be served by several web servers.
+// Several virtual hosts of one web server, e.g. for http and https, are stored as separate domains with the same key.
+func (d Domain) Key() string {
+	return d.WebServer + "/" + d.ServerName
+}
+
+// DomainSync is the state of domain sync of a server
+type DomainSync struct {
+	ServerID    int `gorm:"primary_key;autoIncrement:false"`
+	SyncedAt    *time.Time
+	AttemptedAt time.Time
+	Error       string `gorm:"size:1024"`
+}
+
+// DomainChange records a domain that appeared on or disappeared from a server between two syncs
+type DomainChange struct {
+	ID         int `gorm:"AUTO_INCREMENT;primary_key"`
+	ServerID   int
+	ServerName string `gorm:"size:255"`
+	WebServer  string `gorm:"size:32"`
+	Change     string `gorm:"size:16"`
+	CreatedAt  time.Time
+}
+
+type DomainStorage interface {
+	FindAllByServerID(serverID int) ([]Domain, error)
+	FindSync(serverID int) (*DomainSync, error)
+	FindChangesByServerID(serverID int, limit int) ([]DomainChange, error)
+	// ReplaceServerDomains replaces stored domains of the server with the synced ones and records the changes
+	ReplaceServerDomains(serverID int, domains []Domain, changes []DomainChange, syncedAt time.Time) error
+	// SaveSyncError records the failed sync attempt, previously synced domains are kept
+	SaveSyncError(serverID int, attemptedAt time.Time, syncErr string) error
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type sqlDomainStorage struct {
+	db *gorm.DB
+}
+
+func (s sqlDomainStorage) FindAllByServerID(serverID int) ([]Domain, error) {
+	var domains []Domain
+	err := s.db.Where("server_id = ?", serverID).Order("server_name ASC, id ASC").Find(&domains).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find domains of server with ID %d: %v", serverID, err)
+	}
+
+	return domains, nil
+}
+
+func (s sqlDomainStorage) FindSync(serverID int) (*DomainSync, error) {
+	var domainSync DomainSync
+	err := s.db.Where("server_id = ?", serverID).First(&domainSync).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find domain sync of server with ID %d: %v", serverID, err)
+	}
+
+	return &domainSync, nil
+}
+
+func (s sqlDomainStorage) FindChangesByServerID(serverID int, limit int) ([]DomainChange, error) {
+	var changes []DomainChange
+	err := s.db.Where("server_id = ?", serverID).Order("id DESC").Limit(limit).Find(&changes).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find domain changes of server with ID %d: %v", serverID, err)
+	}
+
+	return changes, nil
+}
+
+func (s sqlDomainStorage) ReplaceServerDomains(serverID int, domains []Domain, changes []DomainChange, syncedAt time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var stored []Domain
+
+		if err := tx.Where("server_id = ?", serverID).Find(&stored).Error; err != nil {
+			return err
+		}
+
+		// virtual hosts of the same domain reuse its stored rows in order
+		storedIDs := make(map[string][]int, len(stored))
+
+		for _, domain := range stored {
+			storedIDs[domain.Key()] = append(storedIDs[domain.Key()], domain.ID)
+		}
+
+		for _, domain := range domains {
+			domain.ServerID = serverID
+			domain.SyncedAt = syncedAt
+
+			if ids := storedIDs[domain.Key()]; len(ids) != 0 {
+				domain.ID = ids[0]
+				storedIDs[domain.Key()] = ids[1:]
+			}
+
+			if err := tx.Save(&domain).Error; err != nil {
+				return err
+			}
+		}
+
+		removedIDs := []int{}
+
+		for _, ids := range storedIDs {
+			removedIDs = append(removedIDs, ids...)
+		}
+
+		if len(removedIDs) != 0 {
+			if err := tx.Delete(&Domain{}, removedIDs).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(changes) != 0 {
+			if err := tx.Create(&changes).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&DomainSync{
+			ServerID:    serverID,
+			SyncedAt:    &syncedAt,
+			AttemptedAt: syncedAt,
+		}).Error
+	})
+}
+
+func (s sqlDomainStorage) SaveSyncError(serverID int, attemptedAt time.Time, syncErr string) error {
+	err := s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"attempted_at", "error"}),
+	}).Create(&DomainSync{
+		ServerID:    serverID,
+		AttemptedAt: attemptedAt,
+		Error:       syncErr,
+	}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to save domain sync error of server with ID %d: %v", serverID, err)
+	}
+
+	return nil
+}
+
+func NewDomainSqlStorage(db *gorm.DB) DomainStorage {
+	return sqlDomainStorage{db: db}
+}
+
+func (*Domain) TableName() string {
+	return "domains"
+}
+
+func (*DomainSync) TableName() string {
+	return "domain_syncs"
+}
+
+func (*DomainChange) TableName() string {
+	return "domain_changes"
+}
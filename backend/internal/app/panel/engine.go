@@ -7,21 +7,36 @@ import (
 	accountApi "backend/internal/app/panel/adapters/api/account"
 	authApi "backend/internal/app/panel/adapters/api/auth"
 	domainApi "backend/internal/app/panel/adapters/api/domain"
+	enrollmentApi "backend/internal/app/panel/adapters/api/enrollment"
+	groupApi "backend/internal/app/panel/adapters/api/group"
+	maintenanceApi "backend/internal/app/panel/adapters/api/maintenance"
 	serverApi "backend/internal/app/panel/adapters/api/server"
+	tunnelApi "backend/internal/app/panel/adapters/api/tunnel"
+	upgradeApi "backend/internal/app/panel/adapters/api/upgrade"
 	userApi "backend/internal/app/panel/adapters/api/user"
 	authAccount "backend/internal/app/panel/auth/account"
 	authService "backend/internal/app/panel/auth/service"
 	domainProvider "backend/internal/app/panel/domain/provider"
 	domainService "backend/internal/app/panel/domain/service"
 	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/monitor"
+	"backend/internal/app/panel/server/scope"
 	serverService "backend/internal/app/panel/server/service"
 	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/app/panel/server/upgrade"
 	userService "backend/internal/app/panel/user/service"
 	userStorage "backend/internal/app/panel/user/storage"
 	"backend/internal/modules"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
 	"backend/internal/modules/sslmanager/autorenewal/logstorage"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/modules/sslmanager/inventory/certstorage"
 	"backend/internal/pkg/logger"
 	"backend/internal/pkg/notification"
+	"fmt"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
@@ -29,20 +44,48 @@ import (
 	"gorm.io/gorm"
 )
 
-func newEngine(
-	config *config.Config,
-	logger logger.Logger,
-	database *gorm.DB,
-) (*gin.Engine, error) {
+// createEngine creates the engine with the middlewares all routes share
+func createEngine(config *config.Config) (*gin.Engine, error) {
 	engine := gin.New()
+
+	// client addresses are checked by unauthenticated agent endpoints, so forwarded headers are trusted only from configured proxies
+	if err := engine.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+
 	engine.Use(gin.Logger(), gin.Recovery())
-	engine.Use(gzip.Gzip(gzip.DefaultCompression))
+	// the agent tunnel is a hijacked WebSocket connection, which must not be compressed
+	engine.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/v1/agent/tunnel"})))
 
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AddAllowHeaders("Authorization")
 	corsConfig.AllowAllOrigins = true
 	engine.Use(cors.New(corsConfig))
 
+	return engine, nil
+}
+
+func newEngine(
+	config *config.Config,
+	logger logger.Logger,
+	database *gorm.DB,
+	appServerStorage serverStorage.ServerStorage,
+	appEnrollmentCodeStorage serverStorage.EnrollmentCodeStorage,
+	appDnsProviderStorage dnsstorage.DnsProviderStorage,
+	appCertificateAuthorityStorage acmestorage.CertificateAuthorityStorage,
+	appCertificateStorage certstorage.CertificateStorage,
+	appIssuer *acmeissuer.Issuer,
+	appAgentProvider *agentprovider.AgentProvider,
+	appServerMonitor *monitor.Monitor,
+	appTokenRotationService serverService.TokenRotationService,
+	appUpgradeOrchestrator *upgrade.Orchestrator,
+) (*gin.Engine, error) {
+	engine, err := createEngine(config)
+
+	if err != nil {
+		return nil, err
+	}
+
 	emailNotifocation := notification.EmailNotificationService{
 		Config: config,
 	}
@@ -55,13 +98,54 @@ func newEngine(
 	appUserStorage := userStorage.NewUserSqlStorage(database)
 	appUserService := userService.NewUserService(appUserStorage)
 
-	appServerStorage := serverStorage.NewServerSqlStorage(database)
-	appServerSevice := serverService.NewServerService(config, appServerStorage, logger)
+	appProbeStorage := serverStorage.NewProbeSqlStorage(database)
+	appServerGroupStorage := serverStorage.NewServerGroupSqlStorage(database)
+	appServerTagStorage := serverStorage.NewServerTagSqlStorage(database)
+	appMaintenanceStorage := serverStorage.NewMaintenanceSqlStorage(database)
+	appMaintenanceChecker := maintenance.CreateChecker(appMaintenanceStorage, appServerGroupStorage, appServerTagStorage)
+	appServerSevice := serverService.NewServerService(
+		config,
+		appServerStorage,
+		appProbeStorage,
+		appServerGroupStorage,
+		appServerTagStorage,
+		appAgentProvider,
+		appMaintenanceChecker,
+		logger,
+	)
 
-	appDomainProvider := domainProvider.CreateDomainProvider(appServerStorage, logger)
+	appScopeResolver := scope.CreateResolver(appServerStorage, appServerGroupStorage, appServerTagStorage)
+	appGroupService := serverService.NewGroupService(
+		appServerStorage,
+		appServerGroupStorage,
+		appServerTagStorage,
+		appScopeResolver,
+		appAgentProvider,
+		appServerMonitor,
+		appMaintenanceChecker,
+		logger,
+	)
+	appMaintenanceService := serverService.NewMaintenanceService(appMaintenanceStorage, appScopeResolver, logger)
+
+	appEnrollmentService := serverService.NewEnrollmentService(config, appServerStorage, appEnrollmentCodeStorage, appAgentProvider, logger)
+	appTunnelService := serverService.NewTunnelService(config, appServerStorage, appAgentProvider, logger)
+
+	appAgentUpgradeStorage := serverStorage.NewAgentUpgradeSqlStorage(database)
+	appAgentUpgradeService := serverService.NewAgentUpgradeService(config, appServerStorage, appAgentUpgradeStorage, appUpgradeOrchestrator, logger)
 
 	appDomainSettingStorage := domainStorage.NewDomainSettingSqlStorage(database)
-	appDomainSevice := domainService.NewDomainService(config, appDomainSettingStorage, appServerStorage, appDomainProvider, logger)
+	appDomainStorage := domainStorage.NewDomainSqlStorage(database)
+	appDomainProvider := domainProvider.CreateDomainProvider(config, appServerStorage, appDomainStorage, appAgentProvider, logger)
+	appDomainSevice := domainService.NewDomainService(
+		config,
+		appDomainSettingStorage,
+		appServerStorage,
+		appDomainProvider,
+		appAgentProvider,
+		appScopeResolver,
+		appMaintenanceChecker,
+		logger,
+	)
 
 	certRenewalLogStorage := logstorage.CreateSqlRenewalLogStorage(database)
 
@@ -85,6 +169,8 @@ func newEngine(
 		v1.POST("/confirm", authApi.CreateConfirmEmailHandler(appAuthService))
 		v1.POST("/recover", authApi.CreateRecoverPasswordHandler(appAuthService))
 		v1.POST("/reset", authApi.CreateResetPasswordHandler(appAuthService))
+		v1.POST("/agent/enroll", enrollmentApi.CreateEnrollHandler(appEnrollmentService))
+		v1.GET("/agent/tunnel", tunnelApi.CreateTunnelHandler(appTunnelService))
 
 		userGroup := v1.Group("users")
 		{
@@ -110,15 +196,25 @@ func newEngine(
 			serverGroup.GET("", serverApi.CreateFindAccounServersHandler(appAuth, appServerSevice))
 			serverGroup.POST("", serverApi.CreateAddServerHandler(appAuth, appServerSevice))
 			serverGroup.POST("/:serverId", serverApi.CreateUpdateServerHandler(appAuth, appServerSevice))
+			serverGroup.POST("/:serverId/token", serverApi.CreateUpdateServerTokenHandler(appAuth, appServerSevice))
+			serverGroup.POST("/:serverId/token/rotate", serverApi.CreateRotateServerTokenHandler(appAuth, appTokenRotationService))
 			serverGroup.DELETE("/:serverId", serverApi.CreateRemoveServerHandler(appAuth, appServerSevice))
 			serverGroup.GET("/:serverId", serverApi.CreateGetServerByGuidHandler(appAuth, appServerSevice))
 			serverGroup.GET("/:serverId/details", serverApi.CreateGetServerDetailsByGuidHandler(appAuth, appServerSevice))
+			serverGroup.GET("/:serverId/features", serverApi.CreateGetServerFeaturesHandler(appAuth, appServerSevice))
+			serverGroup.GET("/:serverId/availability", serverApi.CreateGetServerAvailabilityHandler(appAuth, appServerSevice))
+			serverGroup.POST("/:serverId/tags", groupApi.CreateSetServerTagsHandler(appAuth, appGroupService))
 
 			serverSettingGroup := serverGroup.Group("/:serverId/settings")
 			{
 				serverSettingGroup.POST("/certbot-status", serverApi.CreateChangeCertbotStatusHandler(appAuth, appServerSevice))
+				serverSettingGroup.POST("/tls-pin", serverApi.CreatePinAgentCertificateHandler(appAuth, appServerSevice))
 			}
 
+			serverGroup.GET("/:serverId/domains", domainApi.CreateGetServerDomainsHandler(appAuth, appDomainSevice))
+			serverGroup.POST("/:serverId/domains/sync", domainApi.CreateSyncServerDomainsHandler(appAuth, appDomainSevice))
+			serverGroup.GET("/:serverId/domains/changes", domainApi.CreateFindDomainChangesHandler(appAuth, appDomainSevice))
+
 			domainGroup := serverGroup.Group("/:serverId/domain/:domainName")
 			{
 				domainGroup.GET("", domainApi.CreateGetDomainHandler(appAuth, appDomainSevice))
@@ -128,6 +224,51 @@ func newEngine(
 			}
 		}
 
+		serverGroupGroup := v1.Group("server-groups")
+		{
+			serverGroupGroup.Use(authMiddleware.MiddlewareFunc())
+			serverGroupGroup.GET("", groupApi.CreateFindServerGroupsHandler(appAuth, appGroupService))
+			serverGroupGroup.POST("", groupApi.CreateSaveServerGroupHandler(appAuth, appGroupService))
+			serverGroupGroup.GET("/:groupId", groupApi.CreateGetServerGroupHandler(appAuth, appGroupService))
+			serverGroupGroup.POST("/:groupId", groupApi.CreateSaveServerGroupHandler(appAuth, appGroupService))
+			serverGroupGroup.DELETE("/:groupId", groupApi.CreateRemoveServerGroupHandler(appAuth, appGroupService))
+			serverGroupGroup.POST("/:groupId/servers", groupApi.CreateSetGroupServersHandler(appAuth, appGroupService))
+			serverGroupGroup.POST("/:groupId/auto-renewal", domainApi.CreateChangeGroupAutoRenewalHandler(appAuth, appDomainSevice))
+			serverGroupGroup.POST("/:groupId/certbot-status", groupApi.CreateChangeGroupCertbotStatusHandler(appAuth, appGroupService))
+			serverGroupGroup.POST("/:groupId/health-check", groupApi.CreateCheckGroupHealthHandler(appAuth, appGroupService))
+		}
+
+		enrollmentCodeGroup := v1.Group("enrollment-codes")
+		{
+			enrollmentCodeGroup.Use(authMiddleware.MiddlewareFunc())
+			enrollmentCodeGroup.GET("", enrollmentApi.CreateFindEnrollmentCodesHandler(appAuth, appEnrollmentService))
+			enrollmentCodeGroup.POST("", enrollmentApi.CreateCreateEnrollmentCodeHandler(appAuth, appEnrollmentService))
+			enrollmentCodeGroup.DELETE("/:codeId", enrollmentApi.CreateRevokeEnrollmentCodeHandler(appAuth, appEnrollmentService))
+		}
+
+		tokenRotationGroup := v1.Group("token-rotations")
+		{
+			tokenRotationGroup.Use(authMiddleware.MiddlewareFunc())
+			tokenRotationGroup.POST("", serverApi.CreateRotateServerTokensHandler(appAuth, appTokenRotationService))
+		}
+
+		agentUpgradeGroup := v1.Group("agent-upgrades")
+		{
+			agentUpgradeGroup.Use(authMiddleware.MiddlewareFunc())
+			agentUpgradeGroup.GET("", upgradeApi.CreateFindAgentUpgradesHandler(appAuth, appAgentUpgradeService))
+			agentUpgradeGroup.POST("", upgradeApi.CreateCreateAgentUpgradeHandler(appAuth, appAgentUpgradeService))
+			agentUpgradeGroup.GET("/:upgradeId", upgradeApi.CreateGetAgentUpgradeHandler(appAuth, appAgentUpgradeService))
+			agentUpgradeGroup.POST("/:upgradeId/cancel", upgradeApi.CreateCancelAgentUpgradeHandler(appAuth, appAgentUpgradeService))
+		}
+
+		maintenanceWindowGroup := v1.Group("maintenance-windows")
+		{
+			maintenanceWindowGroup.Use(authMiddleware.MiddlewareFunc())
+			maintenanceWindowGroup.GET("", maintenanceApi.CreateFindMaintenanceWindowsHandler(appAuth, appMaintenanceService))
+			maintenanceWindowGroup.POST("", maintenanceApi.CreateCreateMaintenanceWindowsHandler(appAuth, appMaintenanceService))
+			maintenanceWindowGroup.DELETE("/:windowId", maintenanceApi.CreateRemoveMaintenanceWindowHandler(appAuth, appMaintenanceService))
+		}
+
 		settingGroup := v1.Group("settings")
 		{
 			settingGroup.Use(authMiddleware.MiddlewareFunc())
@@ -144,6 +285,12 @@ func newEngine(
 				appServerStorage,
 				appDomainSettingStorage,
 				certRenewalLogStorage,
+				appDnsProviderStorage,
+				appCertificateAuthorityStorage,
+				appCertificateStorage,
+				appIssuer,
+				appAgentProvider,
+				appMaintenanceChecker,
 				logger,
 			)
 		}
@@ -0,0 +1,142 @@
+package panel
+
+import (
+	"backend/config"
+	enrollmentApi "backend/internal/app/panel/adapters/api/enrollment"
+	tunnelApi "backend/internal/app/panel/adapters/api/tunnel"
+	"backend/internal/app/panel/server/agentprovider"
+	serverService "backend/internal/app/panel/server/service"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestEnrollIgnoresForwardedAddressOfUntrustedClients(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		status         int
+	}{
+		{"no trusted proxies", nil, http.StatusForbidden},
+		{"another proxy", []string{"192.0.2.10"}, http.StatusForbidden},
+		{"trusted proxy", []string{"192.0.2.0/24"}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{AgentPort: 60150, EnrollmentCodeTTL: time.Hour, TrustedProxies: test.trustedProxies}
+			storage := testutil.NewServerMemoryStorage()
+			provider, err := agentprovider.CreateAgentProvider(cfg, storage, logger.NewNopLogger())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			service := serverService.NewEnrollmentService(cfg, storage, testutil.NewEnrollmentCodeMemoryStorage(storage), provider, logger.NewNopLogger())
+			server := &serverStorage.Server{Name: "web", Ipv4Address: "10.0.0.5", Token: "token", AccountID: 1}
+
+			if err = storage.Save(server); err != nil {
+				t.Fatal(err)
+			}
+
+			code, err := service.CreateEnrollmentCode(serverService.CreateEnrollmentCodeRequest{AccountID: 1, UserID: 1})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			engine, err := createEngine(cfg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			engine.POST("/v1/agent/enroll", enrollmentApi.CreateEnrollHandler(service))
+
+			body := fmt.Sprintf(`{"code":%q,"ipv4_address":"10.0.0.5"}`, code.Code)
+			request := httptest.NewRequest(http.MethodPost, "/v1/agent/enroll", strings.NewReader(body))
+			request.RemoteAddr = "192.0.2.1:40000"
+			// the client claims to connect from the server address
+			request.Header.Set("X-Forwarded-For", "10.0.0.5")
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestTunnelIgnoresForwardedAddressOfUntrustedClients(t *testing.T) {
+	cfg := &config.Config{}
+	storage := testutil.NewServerMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(cfg, storage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &serverStorage.Server{Name: "nat", Token: "token", ConnectionMode: serverStorage.ConnectionModeTunnel, AccountID: 1}
+
+	if err = storage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := createEngine(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.GET("/v1/agent/tunnel", tunnelApi.CreateTunnelHandler(serverService.NewTunnelService(cfg, storage, provider, logger.NewNopLogger())))
+	endpoint := httptest.NewServer(engine)
+	defer endpoint.Close()
+
+	wsConfig, err := websocket.NewConfig("ws"+strings.TrimPrefix(endpoint.URL, "http")+"/v1/agent/tunnel", "http://localhost/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := agent.SignTunnel(server.Guid, "token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsConfig.Header.Set(agent.TunnelServerHeader, server.Guid)
+	signature.SetHeaders(wsConfig.Header)
+	// the agent claims to connect from another address
+	wsConfig.Header.Set("X-Forwarded-For", "203.0.113.7")
+	conn, err := websocket.DialConfig(wsConfig)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close() // nolint:errcheck
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for provider.Tunnels().Get(server.ID) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel is not registered")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if remoteIP := provider.Tunnels().Get(server.ID).RemoteIP(); remoteIP != "127.0.0.1" {
+		t.Errorf("expected the tunnel to be opened from the connection address, got %s", remoteIP)
+	}
+}
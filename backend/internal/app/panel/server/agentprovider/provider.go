@@ -0,0 +1,255 @@
+package agentprovider
+
+import (
+	"backend/config"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/logger"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const idleEvictionInterval = 30 * time.Second
+
+type registryEntry struct {
+	agent *agent.Agent
+	// key identifies connection parameters the agent was created with
+	key string
+}
+
+// AgentProvider is a registry of server agents keyed by server ID.
+// Agents keep pooled connections, so the same agent is shared by all callers until the server connection parameters change.
+type AgentProvider struct {
+	serverStorage     serverStorage.ServerStorage
+	clientCertificate *tls.Certificate
+	maxResponseSize   int64
+	logPayloads       bool
+	logger            logger.Logger
+	// tunnels are open tunnels of agents in the tunnel connection mode
+	tunnels *agent.TunnelRegistry
+
+	mu     sync.Mutex
+	agents map[uint]*registryEntry
+}
+
+func (p *AgentProvider) GetAgent(server *serverStorage.Server) (*agent.Agent, error) {
+	key := getConnectionKey(server)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.agents[server.ID]; ok {
+		if entry.key == key {
+			return entry.agent, nil
+		}
+
+		entry.agent.Close()
+		delete(p.agents, server.ID)
+	}
+
+	sAgent, err := p.createAgent(server, p.getTLSConfig(server))
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.agents[server.ID] = &registryEntry{agent: sAgent, key: key}
+
+	return sAgent, nil
+}
+
+// Invalidate closes pooled connections of the server agent and removes it from the registry
+func (p *AgentProvider) Invalidate(serverID uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.agents[serverID]; ok {
+		entry.agent.Close()
+		delete(p.agents, serverID)
+	}
+}
+
+// Run periodically evicts idle connections of all registered agents
+func (p *AgentProvider) Run() {
+	for range time.Tick(idleEvictionInterval) {
+		p.mu.Lock()
+
+		for _, entry := range p.agents {
+			entry.agent.EvictIdleConnections()
+		}
+
+		p.mu.Unlock()
+	}
+}
+
+// CreateAgentWithToken creates an agent of the server authenticated with the token instead of the server one.
+// The agent is not registered, the caller must close it.
+func (p *AgentProvider) CreateAgentWithToken(server *serverStorage.Server, token string) (*agent.Agent, error) {
+	tokenServer := *server
+	tokenServer.Token = token
+
+	return p.createAgent(&tokenServer, p.getTLSConfig(&tokenServer))
+}
+
+// ProbeCertificate returns the fingerprint of the certificate presented by the agent, so the operator can confirm it
+func (p *AgentProvider) ProbeCertificate(ctx context.Context, server *serverStorage.Server) (string, error) {
+	if server.TlsEnabled != 1 {
+		return "", fmt.Errorf("TLS is not enabled for server %s", server.Name)
+	}
+
+	if server.UsesTunnel() {
+		return "", fmt.Errorf("server %s is connected through the agent tunnel", server.Name)
+	}
+
+	return agent.ProbeFingerprint(ctx, server.Ipv4Address, server.Ipv6Address, server.AgentPort, p.clientCertificate)
+}
+
+// PinCertificate stores the fingerprint confirmed by the operator if the agent still presents that certificate.
+// Only the TLS handshake is done, the server token is not sent to the agent before its certificate is pinned.
+func (p *AgentProvider) PinCertificate(ctx context.Context, server *serverStorage.Server, confirmedFingerprint string) (string, error) {
+	presented, err := p.ProbeCertificate(ctx, server)
+
+	if err != nil {
+		return "", err
+	}
+
+	confirmedFingerprint = agent.NormalizeFingerprint(confirmedFingerprint)
+
+	if presented != confirmedFingerprint {
+		return "", agent.ErrFingerprintMismatch{
+			Expected: confirmedFingerprint,
+			Actual:   presented,
+		}
+	}
+
+	if err = p.serverStorage.UpdateTlsFingerprint(int(server.ID), presented); err != nil {
+		return "", err
+	}
+
+	server.TlsFingerprint = presented
+	p.Invalidate(server.ID)
+
+	return presented, nil
+}
+
+func (p *AgentProvider) getTLSConfig(server *serverStorage.Server) *agent.TLSConfig {
+	if server.TlsEnabled != 1 {
+		return nil
+	}
+
+	serverID := server.ID
+	serverName := server.Name
+
+	return &agent.TLSConfig{
+		Fingerprint:       server.TlsFingerprint,
+		ClientCertificate: p.clientCertificate,
+		OnFirstUse: func(fingerprint string) error {
+			return p.pinFingerprint(serverID, serverName, fingerprint)
+		},
+	}
+}
+
+// Tunnels returns the registry of open agent tunnels
+func (p *AgentProvider) Tunnels() *agent.TunnelRegistry {
+	return p.tunnels
+}
+
+func (p *AgentProvider) createAgent(server *serverStorage.Server, tlsConfig *agent.TLSConfig) (*agent.Agent, error) {
+	serverID, serverName := server.ID, server.Name
+	options := agent.Options{
+		ServerID:        serverID,
+		TLS:             tlsConfig,
+		MaxResponseSize: p.maxResponseSize,
+		SignRequests:    server.SignedRequests == 1,
+		LogPayloads:     p.logPayloads,
+		// the family is stored with the server, so agents created anew keep dialing the working family first
+		PreferredFamily: server.PreferredFamily,
+		OnPreferredFamilyChange: func(family string) {
+			if err := p.serverStorage.UpdatePreferredFamily(int(serverID), family); err != nil {
+				p.logger.Error(fmt.Sprintf("failed to store preferred address family of server %s: %v", serverName, err))
+			}
+		},
+	}
+
+	// the tunnel is already authenticated and encrypted by the panel TLS, so TLS to the agent is not used
+	if server.UsesTunnel() {
+		options.TLS = nil
+		options.Tunnels = p.tunnels
+	}
+
+	return agent.NewAgent(
+		server.Ipv4Address,
+		server.Ipv6Address,
+		server.Token,
+		server.AgentPort,
+		options,
+		p.logger,
+	)
+}
+
+func (p *AgentProvider) pinFingerprint(serverID uint, serverName, fingerprint string) error {
+	serverModel, err := p.serverStorage.FindByID(int(serverID))
+
+	if err != nil {
+		return err
+	}
+
+	if serverModel == nil {
+		return fmt.Errorf("server with ID %d not found", serverID)
+	}
+
+	if serverModel.TlsFingerprint != "" && serverModel.TlsFingerprint != fingerprint {
+		return agent.ErrFingerprintMismatch{
+			Expected: serverModel.TlsFingerprint,
+			Actual:   fingerprint,
+		}
+	}
+
+	if err = p.serverStorage.UpdateTlsFingerprint(int(serverID), fingerprint); err != nil {
+		return err
+	}
+
+	p.logger.Info(fmt.Sprintf("agent certificate pinned, server: %s, fingerprint: %s", serverName, fingerprint))
+
+	return nil
+}
+
+func getConnectionKey(server *serverStorage.Server) string {
+	return fmt.Sprintf(
+		"%s|%s|%s|%d|%s|%d|%s|%d",
+		server.ConnectionMode,
+		server.Ipv4Address,
+		server.Ipv6Address,
+		server.AgentPort,
+		server.Token,
+		server.TlsEnabled,
+		server.TlsFingerprint,
+		server.SignedRequests,
+	)
+}
+
+func CreateAgentProvider(config *config.Config, serverStorage serverStorage.ServerStorage, logger logger.Logger) (*AgentProvider, error) {
+	provider := &AgentProvider{
+		serverStorage:   serverStorage,
+		maxResponseSize: config.AgentMaxResponseSize,
+		logPayloads:     config.AgentLogPayloads,
+		logger:          logger,
+		tunnels:         agent.NewTunnelRegistry(),
+		agents:          map[uint]*registryEntry{},
+	}
+
+	if config.AgentTLSClientCertFile != "" || config.AgentTLSClientKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.AgentTLSClientCertFile, config.AgentTLSClientKeyFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not load agent TLS client certificate: %v", err)
+		}
+
+		provider.clientCertificate = &certificate
+	}
+
+	return provider, nil
+}
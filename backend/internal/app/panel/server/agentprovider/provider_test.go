@@ -0,0 +1,72 @@
+package agentprovider
+
+import (
+	"backend/config"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"testing"
+)
+
+func TestPreferredFamilyIsStoredWithServer(t *testing.T) {
+	fAgent, err := fakeagent.Start("token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	ip, port := fAgent.Address()
+	storage := testutil.NewServerMemoryStorage()
+	// the agent does not listen on the IPv6 address the server prefers
+	server := &serverStorage.Server{Name: "dual", Ipv4Address: ip, Ipv6Address: "::1", AgentPort: port, Token: "token", AccountID: 1}
+
+	if err = storage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = storage.UpdatePreferredFamily(int(server.ID), agent.FamilyIPv6); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err = storage.FindByID(int(server.ID))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := CreateAgentProvider(&config.Config{}, storage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverAgent, err := provider.GetAgent(server)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = serverAgent.GetServerData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stale model saved afterwards keeps the stored family
+	if err = storage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := storage.FindByID(int(server.ID))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.PreferredFamily != agent.FamilyIPv4 {
+		t.Errorf("expected the preferred family %s to be stored, got %q", agent.FamilyIPv4, stored.PreferredFamily)
+	}
+}
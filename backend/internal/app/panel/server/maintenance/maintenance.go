@@ -0,0 +1,194 @@
+// Package maintenance tells whether servers and their domains are in maintenance.
+// Auto-renewal, health alerts and mutating operations are suppressed during maintenance unless they are forced.
+package maintenance
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrInMaintenance = errors.New("server is in maintenance")
+
+// Window is an active or scheduled maintenance window of a server, a server group or servers with a tag.
+// DomainName is empty if the window covers whole servers.
+type Window struct {
+	ID         int        `json:"id"`
+	ServerGuid string     `json:"server_guid,omitempty"`
+	GroupID    int        `json:"group_id,omitempty"`
+	Tag        string     `json:"tag,omitempty"`
+	DomainName string     `json:"domain"`
+	Reason     string     `json:"reason"`
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+	CreatedBy  int        `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Error reports the maintenance window that blocks an operation. It matches ErrInMaintenance.
+type Error struct {
+	Window Window
+}
+
+func (e Error) Error() string {
+	subject := "server"
+
+	if e.Window.DomainName != "" {
+		subject = "domain " + e.Window.DomainName
+	}
+
+	message := subject + " is in maintenance"
+
+	if e.Window.EndsAt != nil {
+		message += " until " + e.Window.EndsAt.UTC().Format(time.RFC3339)
+	}
+
+	if e.Window.Reason != "" {
+		message += ": " + e.Window.Reason
+	}
+
+	return message + ", the operation must be forced"
+}
+
+func (e Error) Is(target error) bool {
+	return target == ErrInMaintenance
+}
+
+type Checker struct {
+	storage      serverStorage.MaintenanceStorage
+	groupStorage serverStorage.ServerGroupStorage
+	tagStorage   serverStorage.ServerTagStorage
+}
+
+// ActiveWindows returns windows in effect now keyed by server ID, domain windows included.
+// Group and tag windows apply to servers that are members of the group or have the tag at the time of the check.
+func (c Checker) ActiveWindows(servers []serverStorage.Server) (map[uint][]Window, error) {
+	var (
+		serverIDs  []uint
+		accountIDs []uint
+	)
+
+	for _, server := range servers {
+		serverIDs = append(serverIDs, server.ID)
+
+		if !slices.Contains(accountIDs, server.AccountID) {
+			accountIDs = append(accountIDs, server.AccountID)
+		}
+	}
+
+	windows := map[uint][]Window{}
+	windowModels, err := c.storage.FindActiveByAccountIDs(accountIDs, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(windowModels) == 0 {
+		return windows, nil
+	}
+
+	groupIDs, err := c.groupStorage.FindGroupIDsByServerIDs(serverIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := c.tagStorage.FindByServerIDs(serverIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers {
+		for _, windowModel := range windowModels {
+			if windowModel.AccountID != server.AccountID {
+				continue
+			}
+
+			if (windowModel.ServerID != nil && *windowModel.ServerID == server.ID) ||
+				(windowModel.GroupID != nil && slices.Contains(groupIDs[server.ID], *windowModel.GroupID)) ||
+				(windowModel.Tag != "" && slices.Contains(tags[server.ID], windowModel.Tag)) {
+				windows[server.ID] = append(windows[server.ID], CreateWindow(windowModel))
+			}
+		}
+	}
+
+	return windows, nil
+}
+
+// ServerWindows returns windows of the server in effect now, domain windows included
+func (c Checker) ServerWindows(server *serverStorage.Server) ([]Window, error) {
+	windows, err := c.ActiveWindows([]serverStorage.Server{*server})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return windows[server.ID], nil
+}
+
+// Check returns Error if the server is in maintenance. Windows of the domain are checked too unless domainName is empty.
+func (c Checker) Check(server *serverStorage.Server, domainName string) error {
+	windows, err := c.ServerWindows(server)
+
+	if err != nil {
+		return fmt.Errorf("could not check maintenance of server %s: %v", server.Name, err)
+	}
+
+	if windows = DomainWindows(windows, domainName); len(windows) > 0 {
+		return Error{Window: windows[0]}
+	}
+
+	return nil
+}
+
+// DomainWindows returns windows that apply to the domain: the server-wide ones and the ones of the domain.
+// Only server-wide windows are returned if domainName is empty.
+func DomainWindows(windows []Window, domainName string) []Window {
+	var domainWindows []Window
+
+	for _, window := range windows {
+		if window.DomainName == "" || (domainName != "" && window.DomainName == domainName) {
+			domainWindows = append(domainWindows, window)
+		}
+	}
+
+	return domainWindows
+}
+
+func CreateWindow(window serverStorage.MaintenanceWindow) Window {
+	rWindow := Window{
+		ID:         int(window.ID),
+		Tag:        window.Tag,
+		DomainName: window.DomainName,
+		Reason:     window.Reason,
+		StartsAt:   window.StartsAt,
+		EndsAt:     window.EndsAt,
+		CreatedBy:  int(window.CreatedBy),
+		CreatedAt:  window.CreatedAt,
+	}
+
+	if window.ServerID != nil {
+		rWindow.ServerGuid = serverStorage.GetServerGUIDByID(int(*window.ServerID))
+	}
+
+	if window.GroupID != nil {
+		rWindow.GroupID = int(*window.GroupID)
+	}
+
+	return rWindow
+}
+
+func CreateChecker(
+	storage serverStorage.MaintenanceStorage,
+	groupStorage serverStorage.ServerGroupStorage,
+	tagStorage serverStorage.ServerTagStorage,
+) Checker {
+	return Checker{
+		storage:      storage,
+		groupStorage: groupStorage,
+		tagStorage:   tagStorage,
+	}
+}
@@ -0,0 +1,213 @@
+package monitor
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"backend/internal/pkg/text"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkersCount = 10
+	probeTimeout        = 10 * time.Second
+	probeRetention      = 30 * 24 * time.Hour
+)
+
+// StatusEvent is emitted when a server goes offline or comes back online
+type StatusEvent struct {
+	ServerID   uint
+	ServerName string
+	AccountID  uint
+	Online     bool
+	// Error is the probe error of a server that went offline
+	Error string
+	// Maintenance is set if the server is in maintenance, alerts about such servers are suppressed
+	Maintenance bool
+	Time        time.Time
+}
+
+type StatusListener func(event StatusEvent)
+
+// Monitor periodically probes server agents, keeps server status up to date and records availability history
+type Monitor struct {
+	config        *config.Config
+	serverStorage serverStorage.ServerStorage
+	probeStorage  serverStorage.ProbeStorage
+	agentProvider *agentprovider.AgentProvider
+	maintenance   maintenance.Checker
+	logger        logger.Logger
+
+	mu        sync.Mutex
+	listeners []StatusListener
+}
+
+// Subscribe registers the listener of server status transitions. Listeners are called synchronously by the monitor.
+func (m *Monitor) Subscribe(listener StatusListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listeners = append(m.listeners, listener)
+}
+
+func (m *Monitor) Run() {
+	for range time.Tick(m.config.ServerMonitorInterval) {
+		m.ProbeAll(context.Background())
+
+		if err := m.probeStorage.RemoveOlderThan(time.Now().Add(-probeRetention)); err != nil {
+			m.logger.Error(fmt.Sprintf("failed to remove outdated server probes: %v", err))
+		}
+	}
+}
+
+// ProbeAll probes all servers and waits until all probes are finished
+func (m *Monitor) ProbeAll(ctx context.Context) {
+	servers, err := m.serverStorage.FindAll()
+
+	if err != nil {
+		m.logger.Error(fmt.Sprintf("server monitoring failed: %v", err))
+
+		return
+	}
+
+	m.Probe(ctx, servers)
+}
+
+// Probe probes the servers without waiting for the next monitoring round and returns probes in the order of servers
+func (m *Monitor) Probe(ctx context.Context, servers []serverStorage.Server) []serverStorage.ServerProbe {
+	probes := make([]serverStorage.ServerProbe, len(servers))
+	jobs := make(chan int, len(servers))
+
+	for i := range servers {
+		jobs <- i
+	}
+
+	close(jobs)
+
+	var wg sync.WaitGroup
+
+	for range min(len(servers), defaultWorkersCount) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				probes[i] = m.probe(ctx, servers[i])
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return probes
+}
+
+func (m *Monitor) probe(ctx context.Context, server serverStorage.Server) serverStorage.ServerProbe {
+	// the probe time is set before saving, so events carry it even if the probe is not saved
+	now := time.Now()
+	probe := serverStorage.ServerProbe{ServerID: server.ID, CreatedAt: now}
+	status := serverStorage.ServerStatus{
+		AgentVersion: server.AgentVersion,
+		OsCode:       server.OsCode,
+		OsVersion:    server.OsVersion,
+	}
+
+	sAgent, err := m.agentProvider.GetAgent(&server)
+
+	if err == nil {
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		start := time.Now()
+		data, dataErr := sAgent.GetServerData(probeCtx)
+		probe.LatencyMs = int(time.Since(start).Milliseconds())
+		cancel()
+
+		if dataErr == nil {
+			status.AgentVersion = data.AgentVersion
+			status.OsCode = data.Platform
+			status.OsVersion = data.PlatformVersion
+		}
+
+		err = dataErr
+	}
+
+	if err == nil {
+		probe.IsOnline = 1
+		status.IsActive = 1
+	} else {
+		probe.Error = text.Truncate(err.Error(), 1024)
+		m.logger.Debug(fmt.Sprintf("server %s is offline: %v", server.Name, err))
+	}
+
+	if err = m.probeStorage.Create(&probe); err != nil {
+		m.logger.Error(fmt.Sprintf("failed to save probe of server %s: %v", server.Name, err))
+	}
+
+	if err = m.serverStorage.UpdateStatus(int(server.ID), status); err != nil {
+		m.logger.Error(fmt.Sprintf("failed to update status of server %s: %v", server.Name, err))
+	}
+
+	if server.IsActive != status.IsActive {
+		event := StatusEvent{
+			ServerID:   server.ID,
+			ServerName: server.Name,
+			AccountID:  server.AccountID,
+			Online:     status.IsActive == 1,
+			Error:      probe.Error,
+			Time:       now,
+		}
+
+		// a server in maintenance is expected to go offline, so its status changes are not alerted
+		if err = m.maintenance.Check(&server, ""); errors.Is(err, maintenance.ErrInMaintenance) {
+			event.Maintenance = true
+		} else if err != nil {
+			m.logger.Error(err.Error())
+		}
+
+		m.emit(event)
+	}
+
+	return probe
+}
+
+func (m *Monitor) emit(event StatusEvent) {
+	m.mu.Lock()
+	listeners := append([]StatusListener{}, m.listeners...)
+	m.mu.Unlock()
+
+	if event.Maintenance {
+		m.logger.Info(fmt.Sprintf("server %s in maintenance changed status, online: %t", event.ServerName, event.Online))
+	} else if event.Online {
+		m.logger.Info(fmt.Sprintf("server %s is back online", event.ServerName))
+	} else {
+		m.logger.Warning(fmt.Sprintf("server %s went offline: %s", event.ServerName, event.Error))
+	}
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+func CreateMonitor(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	probeStorage serverStorage.ProbeStorage,
+	agentProvider *agentprovider.AgentProvider,
+	maintenanceChecker maintenance.Checker,
+	logger logger.Logger,
+) *Monitor {
+	return &Monitor{
+		config:        config,
+		serverStorage: serverStorage,
+		probeStorage:  probeStorage,
+		agentProvider: agentProvider,
+		maintenance:   maintenanceChecker,
+		logger:        logger,
+	}
+}
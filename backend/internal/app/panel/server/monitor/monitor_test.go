@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const testToken = "test-token"
+
+// failingProbeStorage fails to save probes
+type failingProbeStorage struct {
+	serverStorage.ProbeStorage
+}
+
+func (s failingProbeStorage) Create(*serverStorage.ServerProbe) error {
+	return errors.New("database is not available")
+}
+
+func TestProbeAll(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fAgent.SetServerData(agentintegration.ServerData{
+		Platform:        "debian",
+		PlatformVersion: "12",
+		AgentVersion:    "1.2.0",
+	})
+
+	sStorage := testutil.NewServerMemoryStorage()
+	probeStorage := testutil.NewProbeMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(&config.Config{}, sStorage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip, port := fAgent.Address()
+	server := &serverStorage.Server{
+		Name:        "test",
+		Ipv4Address: ip,
+		AgentPort:   port,
+		Token:       testToken,
+		AccountID:   1,
+	}
+
+	if err = sStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []StatusEvent
+
+	maintenanceStorage := testutil.NewMaintenanceMemoryStorage()
+	monitor := CreateMonitor(
+		&config.Config{},
+		sStorage,
+		probeStorage,
+		provider,
+		maintenance.CreateChecker(maintenanceStorage, testutil.NewServerGroupMemoryStorage(), testutil.NewServerTagMemoryStorage()),
+		logger.NewNopLogger(),
+	)
+	monitor.Subscribe(func(event StatusEvent) {
+		events = append(events, event)
+	})
+	monitor.ProbeAll(context.Background())
+
+	stored, _ := sStorage.FindByID(int(server.ID))
+
+	if stored.IsActive != 1 || stored.AgentVersion != "1.2.0" || stored.OsCode != "debian" || stored.OsVersion != "12" {
+		t.Errorf("server status is not updated: %+v", stored)
+	}
+
+	if len(events) != 1 || !events[0].Online {
+		t.Fatalf("expected online event, got %+v", events)
+	}
+
+	if events[0].Maintenance {
+		t.Error("server is not in maintenance")
+	}
+
+	maintenanceStorage.Create(&serverStorage.MaintenanceWindow{ServerID: &server.ID, AccountID: 1}) // nolint:errcheck
+	fAgent.Close()
+	monitor.ProbeAll(context.Background())
+
+	stored, _ = sStorage.FindByID(int(server.ID))
+
+	if stored.IsActive != 0 || stored.AgentVersion != "1.2.0" {
+		t.Errorf("server must be inactive and keep agent data: %+v", stored)
+	}
+
+	if len(events) != 2 || events[1].Online || events[1].Error == "" || events[1].ServerID != server.ID {
+		t.Fatalf("expected offline event, got %+v", events)
+	}
+
+	if !events[1].Maintenance {
+		t.Error("offline event of a server in maintenance must be marked")
+	}
+
+	monitor.ProbeAll(context.Background())
+
+	if len(events) != 2 {
+		t.Errorf("event must be emitted only on status transition, got %d events", len(events))
+	}
+
+	probes, _ := probeStorage.FindByServerID(int(server.ID), time.Now().Add(-time.Hour))
+
+	if len(probes) != 3 || probes[0].IsOnline != 1 || probes[1].IsOnline != 0 || probes[2].IsOnline != 0 {
+		t.Errorf("unexpected probes: %+v", probes)
+	}
+}
+
+func TestProbeEventTimeIfProbeIsNotSaved(t *testing.T) {
+	sStorage := testutil.NewServerMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(&config.Config{}, sStorage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent port is closed, so the active server goes offline
+	server := &serverStorage.Server{Name: "test", Ipv4Address: "127.0.0.1", AgentPort: 1, Token: testToken, IsActive: 1}
+
+	if err = sStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []StatusEvent
+
+	monitor := CreateMonitor(
+		&config.Config{},
+		sStorage,
+		failingProbeStorage{testutil.NewProbeMemoryStorage()},
+		provider,
+		maintenance.CreateChecker(testutil.NewMaintenanceMemoryStorage(), testutil.NewServerGroupMemoryStorage(), testutil.NewServerTagMemoryStorage()),
+		logger.NewNopLogger(),
+	)
+	monitor.Subscribe(func(event StatusEvent) {
+		events = append(events, event)
+	})
+	start := time.Now()
+	monitor.ProbeAll(context.Background())
+
+	if len(events) != 1 || events[0].Online || events[0].Time.Before(start) {
+		t.Fatalf("expected offline event with the probe time, got %+v", events)
+	}
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	userStorage "backend/internal/app/panel/user/storage"
+	"backend/internal/pkg/logger"
+	"fmt"
+	"time"
+)
+
+const statusEmailTemplate = "server-status-email-template"
+
+// EmailSender sends email notifications rendered from templates
+type EmailSender interface {
+	CreateAndSendHtmlNotification(name, tplPath, email, subject string, data interface{}) error
+}
+
+// Notifier emails the account owner when a server goes offline or comes back online
+type Notifier struct {
+	userStorage userStorage.UserStorage
+	sender      EmailSender
+	logger      logger.Logger
+}
+
+// Notify sends the notification about the status event. Status changes of servers in maintenance are not notified.
+func (n *Notifier) Notify(event StatusEvent) {
+	if event.Maintenance {
+		return
+	}
+
+	owner, err := n.userStorage.FindAccountOwner(int(event.AccountID))
+
+	if err != nil {
+		n.logger.Error(fmt.Sprintf("failed to notify about status of server %s: %v", event.ServerName, err))
+
+		return
+	}
+
+	if owner == nil || !owner.IsActive() {
+		return
+	}
+
+	subject := fmt.Sprintf("Server %s is offline", event.ServerName)
+
+	if event.Online {
+		subject = fmt.Sprintf("Server %s is back online", event.ServerName)
+	}
+
+	data := struct {
+		ServerName string
+		Online     bool
+		Error      string
+		Time       string
+	}{
+		ServerName: event.ServerName,
+		Online:     event.Online,
+		Error:      event.Error,
+		Time:       event.Time.UTC().Format(time.RFC1123),
+	}
+
+	err = n.sender.CreateAndSendHtmlNotification("serverStatus", statusEmailTemplate, owner.Email, subject, data)
+
+	if err != nil {
+		n.logger.Error(fmt.Sprintf("failed to notify about status of server %s: %v", event.ServerName, err))
+	}
+}
+
+func CreateNotifier(userStorage userStorage.UserStorage, sender EmailSender, logger logger.Logger) *Notifier {
+	return &Notifier{
+		userStorage: userStorage,
+		sender:      sender,
+		logger:      logger,
+	}
+}
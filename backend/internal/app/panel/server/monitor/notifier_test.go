@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	userStorage "backend/internal/app/panel/user/storage"
+	"backend/internal/pkg/logger"
+	"testing"
+	"time"
+)
+
+type testEmail struct {
+	recipient string
+	subject   string
+}
+
+type testEmailSender struct {
+	emails []testEmail
+}
+
+func (s *testEmailSender) CreateAndSendHtmlNotification(name, tplPath, email, subject string, data interface{}) error {
+	s.emails = append(s.emails, testEmail{recipient: email, subject: subject})
+
+	return nil
+}
+
+type testUserStorage struct {
+	userStorage.UserStorage
+	owners map[int]*userStorage.User
+}
+
+func (s testUserStorage) FindAccountOwner(accountID int) (*userStorage.User, error) {
+	return s.owners[accountID], nil
+}
+
+func TestNotifierNotify(t *testing.T) {
+	users := testUserStorage{owners: map[int]*userStorage.User{
+		1: {Email: "owner@example.com", Active: 1, AccountOwner: 1, AccountID: 1},
+		2: {Email: "inactive@example.com", AccountOwner: 1, AccountID: 2},
+	}}
+
+	tests := []struct {
+		name    string
+		event   StatusEvent
+		subject string
+	}{
+		{"offline", StatusEvent{ServerName: "web", AccountID: 1, Error: "timeout"}, "Server web is offline"},
+		{"back online", StatusEvent{ServerName: "web", AccountID: 1, Online: true}, "Server web is back online"},
+		{"maintenance", StatusEvent{ServerName: "web", AccountID: 1, Maintenance: true}, ""},
+		{"inactive owner", StatusEvent{ServerName: "web", AccountID: 2}, ""},
+		{"no owner", StatusEvent{ServerName: "web", AccountID: 3}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sender := &testEmailSender{}
+			test.event.Time = time.Now()
+			CreateNotifier(users, sender, logger.NewNopLogger()).Notify(test.event)
+
+			if test.subject == "" {
+				if len(sender.emails) != 0 {
+					t.Fatalf("expected no notification, got %+v", sender.emails)
+				}
+
+				return
+			}
+
+			if len(sender.emails) != 1 || sender.emails[0].subject != test.subject || sender.emails[0].recipient != "owner@example.com" {
+				t.Fatalf("expected notification %q to the owner, got %+v", test.subject, sender.emails)
+			}
+		})
+	}
+}
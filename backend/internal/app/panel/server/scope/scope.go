@@ -0,0 +1,148 @@
+// Package scope selects account servers by GUIDs, groups and tags.
+// It is used by features that apply to a set of servers, such as group operations and maintenance windows.
+package scope
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("server group not found")
+	ErrServerNotFound = errors.New("server not found")
+)
+
+// Scope selects servers that are listed, belong to any of the groups or have any of the tags.
+// An empty scope selects all account servers.
+type Scope struct {
+	ServerGuids []string `json:"servers"`
+	GroupIDs    []int    `json:"groups"`
+	Tags        []string `json:"tags"`
+}
+
+func (s Scope) IsEmpty() bool {
+	return len(s.ServerGuids) == 0 && len(s.GroupIDs) == 0 && len(s.Tags) == 0
+}
+
+type Resolver struct {
+	serverStorage serverStorage.ServerStorage
+	groupStorage  serverStorage.ServerGroupStorage
+	tagStorage    serverStorage.ServerTagStorage
+}
+
+// Resolve returns account servers selected by the scope. Servers and groups of the scope must belong to the account.
+func (r Resolver) Resolve(accountID int, scope Scope) ([]serverStorage.Server, error) {
+	servers, err := r.serverStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if scope.IsEmpty() {
+		return servers, nil
+	}
+
+	selected, err := r.selectServerIDs(accountID, scope, servers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(servers, func(server serverStorage.Server) bool {
+		_, ok := selected[server.ID]
+
+		return !ok
+	}), nil
+}
+
+// Contains reports whether the scope selects the account server
+func (r Resolver) Contains(accountID int, scope Scope, serverID uint) (bool, error) {
+	servers, err := r.Resolve(accountID, scope)
+
+	if err != nil {
+		return false, err
+	}
+
+	return slices.ContainsFunc(servers, func(server serverStorage.Server) bool {
+		return server.ID == serverID
+	}), nil
+}
+
+func (r Resolver) selectServerIDs(accountID int, scope Scope, servers []serverStorage.Server) (map[uint]struct{}, error) {
+	selected := map[uint]struct{}{}
+	serverIDs := make([]uint, 0, len(servers))
+	guids := map[string]uint{}
+
+	for _, server := range servers {
+		serverIDs = append(serverIDs, server.ID)
+		guids[server.Guid] = server.ID
+	}
+
+	for _, guid := range scope.ServerGuids {
+		serverID, ok := guids[guid]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrServerNotFound, guid)
+		}
+
+		selected[serverID] = struct{}{}
+	}
+
+	for _, groupID := range scope.GroupIDs {
+		group, err := r.groupStorage.FindByID(groupID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if group == nil || group.AccountID != uint(accountID) {
+			return nil, fmt.Errorf("%w: %d", ErrGroupNotFound, groupID)
+		}
+
+		members, err := r.groupStorage.FindServerIDs(groupID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, serverID := range members {
+			selected[serverID] = struct{}{}
+		}
+	}
+
+	if len(scope.Tags) == 0 {
+		return selected, nil
+	}
+
+	tags, err := r.tagStorage.FindByServerIDs(serverIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for serverID, serverTags := range tags {
+		for _, tag := range scope.Tags {
+			if slices.Contains(serverTags, tag) {
+				selected[serverID] = struct{}{}
+
+				break
+			}
+		}
+	}
+
+	return selected, nil
+}
+
+func CreateResolver(
+	serverStorage serverStorage.ServerStorage,
+	groupStorage serverStorage.ServerGroupStorage,
+	tagStorage serverStorage.ServerTagStorage,
+) Resolver {
+	return Resolver{
+		serverStorage: serverStorage,
+		groupStorage:  groupStorage,
+		tagStorage:    tagStorage,
+	}
+}
@@ -0,0 +1,113 @@
+package scope
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/testutil"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// testEnv holds the resolver under test with its storages and servers of two accounts
+type testEnv struct {
+	resolver     Resolver
+	servers      []serverStorage.Server
+	groupStorage serverStorage.ServerGroupStorage
+	tagStorage   serverStorage.ServerTagStorage
+}
+
+func createTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	storage := testutil.NewServerMemoryStorage()
+	groupStorage := testutil.NewServerGroupMemoryStorage()
+	tagStorage := testutil.NewServerTagMemoryStorage()
+	var servers []serverStorage.Server
+
+	for i, accountID := range []uint{1, 1, 1, 2} {
+		server := serverStorage.Server{
+			Name:        fmt.Sprintf("server-%d", i),
+			Ipv4Address: fmt.Sprintf("10.0.0.%d", i+1),
+			AgentPort:   60150,
+			Token:       "test-token",
+			AccountID:   accountID,
+		}
+
+		if err := storage.Save(&server); err != nil {
+			t.Fatal(err)
+		}
+
+		servers = append(servers, server)
+	}
+
+	return testEnv{
+		resolver:     CreateResolver(storage, groupStorage, tagStorage),
+		servers:      servers,
+		groupStorage: groupStorage,
+		tagStorage:   tagStorage,
+	}
+}
+
+func getNames(servers []serverStorage.Server) []string {
+	var names []string
+
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func TestResolveSelectsUnionOfServersGroupsAndTags(t *testing.T) {
+	env := createTestEnv(t)
+	resolver, servers, groupStorage, tagStorage := env.resolver, env.servers, env.groupStorage, env.tagStorage
+	group := &serverStorage.ServerGroup{AccountID: 1, Name: "web"}
+	groupStorage.Save(group)                                       // nolint:errcheck
+	groupStorage.SetServers(int(group.ID), []uint{servers[0].ID})  // nolint:errcheck
+	tagStorage.SetServerTags(int(servers[1].ID), []string{"prod"}) // nolint:errcheck
+	tagStorage.SetServerTags(int(servers[3].ID), []string{"prod"}) // nolint:errcheck
+
+	selected, err := resolver.Resolve(1, Scope{GroupIDs: []int{int(group.ID)}, Tags: []string{"prod"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := getNames(selected); !slices.Equal(names, []string{"server-0", "server-1"}) {
+		t.Fatalf("unexpected servers: %v", names)
+	}
+
+	all, err := resolver.Resolve(1, Scope{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 3 {
+		t.Fatalf("expected empty scope to select all account servers, got %d", len(all))
+	}
+}
+
+func TestResolveRejectsForeignGroupsAndServers(t *testing.T) {
+	env := createTestEnv(t)
+	resolver, servers, groupStorage := env.resolver, env.servers, env.groupStorage
+	group := &serverStorage.ServerGroup{AccountID: 2, Name: "web"}
+	groupStorage.Save(group) // nolint:errcheck
+
+	if _, err := resolver.Resolve(1, Scope{GroupIDs: []int{int(group.ID)}}); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("expected group not found error, got %v", err)
+	}
+
+	if _, err := resolver.Resolve(1, Scope{ServerGuids: []string{servers[3].Guid}}); !errors.Is(err, ErrServerNotFound) {
+		t.Fatalf("expected server not found error, got %v", err)
+	}
+
+	contains, err := resolver.Contains(1, Scope{ServerGuids: []string{servers[2].Guid}}, servers[2].ID)
+
+	if err != nil || !contains {
+		t.Fatalf("expected scope to contain the server, got %v, %v", contains, err)
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	enrollmentCodeLength = 16
+
+	EnrollmentCodeActive  = "active"
+	EnrollmentCodeUsed    = "used"
+	EnrollmentCodeRevoked = "revoked"
+	EnrollmentCodeExpired = "expired"
+)
+
+var (
+	ErrInvalidEnrollmentCode      = errors.New("enrollment code is invalid, expired or already used")
+	ErrEnrollmentCodeNotFound     = errors.New("enrollment code not found")
+	ErrEnrollmentCodeInactive     = errors.New("enrollment code is already used or revoked")
+	ErrServerAddressTaken         = errors.New("server with the specified address is registered in another account")
+	ErrServerClaimAddressMismatch = errors.New("server can be claimed only by the agent connecting from its address")
+)
+
+// EnrollmentService lets agents register themselves with single-use enrollment codes issued per account
+type EnrollmentService struct {
+	config                *config.Config
+	serverStorage         serverStorage.ServerStorage
+	enrollmentCodeStorage serverStorage.EnrollmentCodeStorage
+	agentProvider         *agentprovider.AgentProvider
+	logger                logger.Logger
+}
+
+func (s EnrollmentService) CreateEnrollmentCode(request CreateEnrollmentCodeRequest) (*NewEnrollmentCode, error) {
+	code, err := generateToken(enrollmentCodeLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codeModel := &serverStorage.EnrollmentCode{
+		AccountID: uint(request.AccountID),
+		CodeHash:  hashEnrollmentCode(code),
+		CreatedBy: uint(request.UserID),
+		ExpiresAt: time.Now().Add(s.config.EnrollmentCodeTTL),
+	}
+
+	if err = s.enrollmentCodeStorage.Create(codeModel); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf("enrollment code %d created, account: %d, user: %d", codeModel.ID, request.AccountID, request.UserID))
+
+	return &NewEnrollmentCode{
+		EnrollmentCode: createEnrollmentCode(codeModel),
+		Code:           code,
+	}, nil
+}
+
+func (s EnrollmentService) FindEnrollmentCodes(accountID int) ([]EnrollmentCode, error) {
+	codeModels, err := s.enrollmentCodeStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get account %d enrollment codes", accountID)
+	}
+
+	codes := []EnrollmentCode{}
+
+	for _, codeModel := range codeModels {
+		codes = append(codes, createEnrollmentCode(&codeModel))
+	}
+
+	return codes, nil
+}
+
+func (s EnrollmentService) RevokeEnrollmentCode(request RevokeEnrollmentCodeRequest) error {
+	codeModel, err := s.enrollmentCodeStorage.FindByID(request.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if codeModel == nil || codeModel.AccountID != uint(request.AccountID) {
+		return ErrEnrollmentCodeNotFound
+	}
+
+	revoked, err := s.enrollmentCodeStorage.Revoke(request.ID, uint(request.UserID), time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return ErrEnrollmentCodeInactive
+	}
+
+	s.logger.Info(fmt.Sprintf("enrollment code %d revoked, account: %d, user: %d", request.ID, request.AccountID, request.UserID))
+
+	return nil
+}
+
+// Enroll registers the agent presenting the code. A server with the same address is claimed, otherwise a new one is created.
+// A server is claimed only if the agent connects from its address.
+// Agents in the tunnel mode always get a new server, since servers behind NAT may share addresses.
+// The returned token is generated for the server and replaces any token the server had before.
+func (s EnrollmentService) Enroll(request EnrollRequest) (*EnrollResponse, error) {
+	now := time.Now()
+	connectionMode, err := getConnectionMode(request.ConnectionMode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codeModel, err := s.enrollmentCodeStorage.FindByHash(hashEnrollmentCode(request.Code))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if codeModel == nil || !codeModel.IsActive(now) {
+		s.logger.Warning(fmt.Sprintf("enrollment with an invalid code from %s", request.RemoteIP))
+
+		return nil, ErrInvalidEnrollmentCode
+	}
+
+	// the address the agent connected from is used if the agent does not report its addresses
+	if request.Ipv4Address == "" && request.Ipv6Address == "" {
+		if ip := net.ParseIP(request.RemoteIP); ip != nil && ip.To4() != nil {
+			request.Ipv4Address = request.RemoteIP
+		} else {
+			request.Ipv6Address = request.RemoteIP
+		}
+	}
+
+	var serverModel *serverStorage.Server
+
+	if connectionMode == serverStorage.ConnectionModeDirect {
+		serverModel, err = s.serverStorage.FindByIP(request.Ipv4Address, request.Ipv6Address)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if serverModel != nil && serverModel.AccountID != codeModel.AccountID {
+		return nil, ErrServerAddressTaken
+	}
+
+	// the reported addresses are not trusted, so only the agent running at the server address may claim the server
+	if serverModel != nil && !isServerAddress(serverModel, request.RemoteIP) {
+		s.logger.Warning(fmt.Sprintf("server %s is claimed by an agent connecting from %s", serverModel.Name, request.RemoteIP))
+
+		return nil, ErrServerClaimAddressMismatch
+	}
+
+	token, err := generateToken(serverTokenLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil {
+		name := request.HostName
+
+		if name == "" {
+			name = request.Ipv4Address
+		}
+
+		if name == "" {
+			name = request.Ipv6Address
+		}
+
+		serverModel = &serverStorage.Server{
+			Name:        name,
+			Ipv4Address: request.Ipv4Address,
+			Ipv6Address: request.Ipv6Address,
+			AccountID:   codeModel.AccountID,
+		}
+	}
+
+	agentPort := request.AgentPort
+
+	if agentPort == 0 {
+		agentPort = s.config.AgentPort
+	}
+
+	serverModel.AgentPort = agentPort
+	serverModel.Token = token
+	serverModel.AgentVersion = request.AgentVersion
+	serverModel.OsCode = request.OsCode
+	serverModel.OsVersion = request.OsVersion
+	serverModel.IsRegistered = 1
+	serverModel.ConnectionMode = connectionMode
+
+	enrolled, err := s.enrollmentCodeStorage.Enroll(int(codeModel.ID), request.RemoteIP, now, serverModel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !enrolled {
+		return nil, ErrInvalidEnrollmentCode
+	}
+
+	s.agentProvider.Invalidate(serverModel.ID)
+
+	s.logger.Info(fmt.Sprintf(
+		"server %s enrolled with code %d, account: %d, remote address: %s",
+		serverModel.Name,
+		codeModel.ID,
+		codeModel.AccountID,
+		request.RemoteIP,
+	))
+
+	return &EnrollResponse{
+		ServerGuid: serverModel.Guid,
+		Token:      token,
+	}, nil
+}
+
+func isServerAddress(server *serverStorage.Server, address string) bool {
+	ip := net.ParseIP(address)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, serverAddress := range []string{server.Ipv4Address, server.Ipv6Address} {
+		if serverIP := net.ParseIP(serverAddress); serverIP != nil && serverIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashEnrollmentCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func createEnrollmentCode(code *serverStorage.EnrollmentCode) EnrollmentCode {
+	enrollmentCode := EnrollmentCode{
+		ID:        int(code.ID),
+		Status:    EnrollmentCodeActive,
+		CreatedBy: int(code.CreatedBy),
+		CreatedAt: code.CreatedAt,
+		ExpiresAt: code.ExpiresAt,
+		UsedAt:    code.UsedAt,
+		UsedIP:    code.UsedIP,
+		RevokedAt: code.RevokedAt,
+	}
+
+	if code.ServerID != nil {
+		serverID := int(*code.ServerID)
+		enrollmentCode.ServerID = &serverID
+	}
+
+	if code.RevokedBy != nil {
+		revokedBy := int(*code.RevokedBy)
+		enrollmentCode.RevokedBy = &revokedBy
+	}
+
+	switch {
+	case code.UsedAt != nil:
+		enrollmentCode.Status = EnrollmentCodeUsed
+	case code.RevokedAt != nil:
+		enrollmentCode.Status = EnrollmentCodeRevoked
+	case !time.Now().Before(code.ExpiresAt):
+		enrollmentCode.Status = EnrollmentCodeExpired
+	}
+
+	return enrollmentCode
+}
+
+func NewEnrollmentService(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	enrollmentCodeStorage serverStorage.EnrollmentCodeStorage,
+	agentProvider *agentprovider.AgentProvider,
+	logger logger.Logger,
+) EnrollmentService {
+	return EnrollmentService{
+		config:                config,
+		serverStorage:         serverStorage,
+		enrollmentCodeStorage: enrollmentCodeStorage,
+		agentProvider:         agentProvider,
+		logger:                logger,
+	}
+}
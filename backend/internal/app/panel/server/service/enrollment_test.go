@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnrollCodeIsSingleUse(t *testing.T) {
+	env := createTestEnv(t)
+	service, storage := env.enrollmentService(), env.serverStorage
+	code, err := service.CreateEnrollmentCode(CreateEnrollmentCodeRequest{AccountID: 1, UserID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := service.Enroll(EnrollRequest{Code: code.Code, HostName: "web-1", RemoteIP: "10.0.0.5"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := storage.FindByGuid(response.ServerGuid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server == nil || server.Ipv4Address != "10.0.0.5" || server.IsRegistered != 1 || server.Token != response.Token {
+		t.Fatalf("unexpected enrolled server: %+v", server)
+	}
+
+	_, err = service.Enroll(EnrollRequest{Code: code.Code, RemoteIP: "10.0.0.6"})
+
+	if !errors.Is(err, ErrInvalidEnrollmentCode) {
+		t.Fatalf("expected invalid code error on reuse, got %v", err)
+	}
+}
+
+func TestEnrollClaimsExistingServer(t *testing.T) {
+	env := createTestEnv(t)
+	service := env.enrollmentService()
+	server := env.addServer(t, "10.0.0.5", 60150)
+	code, err := service.CreateEnrollmentCode(CreateEnrollmentCodeRequest{AccountID: 1, UserID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := service.Enroll(EnrollRequest{Code: code.Code, Ipv4Address: "10.0.0.5", RemoteIP: "10.0.0.5"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.ServerGuid != server.Guid || response.Token == testToken {
+		t.Fatalf("expected server %s to be claimed with a new token, got %+v", server.Guid, response)
+	}
+
+	other, err := service.CreateEnrollmentCode(CreateEnrollmentCodeRequest{AccountID: 2, UserID: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Enroll(EnrollRequest{Code: other.Code, Ipv4Address: "10.0.0.5", RemoteIP: "10.0.0.5"})
+
+	if !errors.Is(err, ErrServerAddressTaken) {
+		t.Fatalf("expected address taken error, got %v", err)
+	}
+}
+
+func TestEnrollWithRevokedCode(t *testing.T) {
+	service := createTestEnv(t).enrollmentService()
+	code, err := service.CreateEnrollmentCode(CreateEnrollmentCodeRequest{AccountID: 1, UserID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.RevokeEnrollmentCode(RevokeEnrollmentCodeRequest{ID: int(code.ID), AccountID: 1, UserID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Enroll(EnrollRequest{Code: code.Code, RemoteIP: "10.0.0.5"})
+
+	if !errors.Is(err, ErrInvalidEnrollmentCode) {
+		t.Fatalf("expected invalid code error, got %v", err)
+	}
+}
+
+func TestEnrollRefusesClaimFromAnotherAddress(t *testing.T) {
+	env := createTestEnv(t)
+	service, storage := env.enrollmentService(), env.serverStorage
+	server := env.addServer(t, "10.0.0.5", 60150)
+	code, err := service.CreateEnrollmentCode(CreateEnrollmentCodeRequest{AccountID: 1, UserID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Enroll(EnrollRequest{Code: code.Code, Ipv4Address: "10.0.0.5", RemoteIP: "10.0.0.9"})
+
+	if !errors.Is(err, ErrServerClaimAddressMismatch) {
+		t.Fatalf("expected claim address mismatch error, got %v", err)
+	}
+
+	stored, err := storage.FindByID(int(server.ID))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Token != testToken {
+		t.Fatalf("expected the token of server %s to be kept", server.Guid)
+	}
+
+	// the refused code is not spent
+	if _, err = service.Enroll(EnrollRequest{Code: code.Code, Ipv4Address: "10.0.0.5", RemoteIP: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,59 +1,93 @@
 package service
 
 import (
-	domainDto "backend/internal/app/panel/domain/dto"
+	domainService "backend/internal/app/panel/domain/service"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/scope"
 	"time"
 )
 
 type Server struct {
-	ID           int       `json:"id"`
-	Guid         string    `json:"guid"`
-	Name         string    `json:"name"`
-	OsCode       string    `json:"os_code"`
-	OsVersion    string    `json:"os_version"`
-	Ipv4Address  string    `json:"ipv4_address"`
-	Ipv6Address  string    `json:"ipv6_address"`
-	AgentVersion string    `json:"agent_version"`
-	AgentPort    int       `json:"agent_port"`
-	IsActive     int       `json:"is_active"`
-	IsRegistered int       `json:"is_registered"`
-	AccountID    int       `json:"account_id"`
-	CreatedAt    time.Time `json:"created_at"`
-	Token        string    `json:"token"`
+	ID             int                  `json:"id"`
+	Guid           string               `json:"guid"`
+	Name           string               `json:"name"`
+	OsCode         string               `json:"os_code"`
+	OsVersion      string               `json:"os_version"`
+	Ipv4Address    string               `json:"ipv4_address"`
+	Ipv6Address    string               `json:"ipv6_address"`
+	AgentVersion   string               `json:"agent_version"`
+	AgentPort      int                  `json:"agent_port"`
+	IsActive       int                  `json:"is_active"`
+	IsRegistered   int                  `json:"is_registered"`
+	TlsEnabled     int                  `json:"tls_enabled"`
+	TlsFingerprint string               `json:"tls_fingerprint"`
+	SignedRequests int                  `json:"signed_requests"`
+	ConnectionMode string               `json:"connection_mode"`
+	TokenRotatedAt *time.Time           `json:"token_rotated_at"`
+	Tags           []string             `json:"tags"`
+	Groups         []int                `json:"groups"`
+	Maintenance    []maintenance.Window `json:"maintenance"`
+	AccountID      int                  `json:"account_id"`
+	CreatedAt      time.Time            `json:"created_at"`
 }
 
 type ServerDetails struct {
 	Server
 
-	HostName       string             `json:"hostname"`
-	Os             string             `json:"os"`
-	PlatformFamily string             `json:"platform_family"`
-	KernelVersion  string             `json:"kernal_version"`
-	KernelArch     string             `json:"kernal_arch"`
-	Virtualization string             `json:"virtualization"`
-	Uptime         uint64             `json:"uptime"`
-	BootTime       uint64             `json:"boottime"`
-	Domains        []domainDto.Domain `json:"domains"`
-	Settings       map[string]string  `json:"settings"`
+	HostName         string                 `json:"hostname"`
+	Os               string                 `json:"os"`
+	PlatformFamily   string                 `json:"platform_family"`
+	KernelVersion    string                 `json:"kernal_version"`
+	KernelArch       string                 `json:"kernal_arch"`
+	Virtualization   string                 `json:"virtualization"`
+	Uptime           uint64                 `json:"uptime"`
+	BootTime         uint64                 `json:"boottime"`
+	Domains          []domainService.Domain `json:"domains"`
+	Settings         map[string]string      `json:"settings"`
+	CircuitBreaker   string                 `json:"circuit_breaker"`
+	ConnectedAddress string                 `json:"connected_address"`
+	AddressFamily    string                 `json:"address_family"`
 }
 
 type NewServerRequest struct {
-	Name        string `json:"name" validate:"nonzero"`
-	Ipv4Address string `json:"ipv4_address"`
-	Ipv6Address string `json:"ipv6_address"`
-	AgentPort   int    `json:"agent_port" validate:"nonzero"`
-	Token       string `json:"token" validate:"nonzero"`
+	Name           string `json:"name" validate:"nonzero"`
+	Ipv4Address    string `json:"ipv4_address"`
+	Ipv6Address    string `json:"ipv6_address"`
+	AgentPort      int    `json:"agent_port" validate:"nonzero"`
+	Token          string `json:"token" validate:"nonzero"`
+	TlsEnabled     bool   `json:"tls_enabled"`
+	SignedRequests bool   `json:"signed_requests"`
+	ConnectionMode string `json:"connection_mode"`
+	AccountID      int
+}
+
+// ExportedServer contains the agent token and is never returned by the API
+type ExportedServer struct {
+	Name        string
+	Ipv4Address string
+	Ipv6Address string
+	AgentPort   int
+	Token       string
 	AccountID   int
 }
 
 type UpdateServerRequest struct {
-	ID          int    `json:"id" validate:"nonzero"`
-	Name        string `json:"name" validate:"nonzero"`
-	Ipv4Address string `json:"ipv4_address"`
-	Ipv6Address string `json:"ipv6_address"`
-	AgentPort   int    `json:"agent_port" validate:"nonzero"`
-	Token       string `json:"token" validate:"nonzero"`
-	AccountId   int
+	ID             int    `json:"id" validate:"nonzero"`
+	Name           string `json:"name" validate:"nonzero"`
+	Ipv4Address    string `json:"ipv4_address"`
+	Ipv6Address    string `json:"ipv6_address"`
+	AgentPort      int    `json:"agent_port" validate:"nonzero"`
+	TlsEnabled     bool   `json:"tls_enabled"`
+	SignedRequests bool   `json:"signed_requests"`
+	ConnectionMode string `json:"connection_mode"`
+	AccountId      int
+}
+
+// UpdateServerTokenRequest replaces the agent token. Tokens are never returned by the API.
+type UpdateServerTokenRequest struct {
+	ID        int    `json:"id" validate:"nonzero"`
+	Token     string `json:"token" validate:"nonzero"`
+	AccountID int
 }
 
 type RemoveServerRequest struct {
@@ -74,5 +108,234 @@ type FindServerByGuid struct {
 type ChangeCretbotStatusRequest struct {
 	ServerGuid string
 	Value      bool `json:"value"`
+	Force      bool `json:"force"`
 	AccountId  int
 }
+
+type PinAgentCertificateRequest struct {
+	ServerGuid string
+	// Fingerprint is the presented fingerprint confirmed by the operator, the certificate is only probed if it is empty
+	Fingerprint string `json:"fingerprint"`
+	AccountID   int
+}
+
+type AgentCertificatePin struct {
+	Fingerprint string `json:"fingerprint"`
+	Pinned      bool   `json:"pinned"`
+}
+
+type GetServerFeaturesRequest struct {
+	ServerGuid string
+	AccountID  int
+}
+
+type ServerFeatures struct {
+	AgentVersion    string          `json:"agent_version"`
+	ProtocolVersion int             `json:"protocol_version"`
+	Commands        []string        `json:"commands"`
+	Features        map[string]bool `json:"features"`
+}
+
+type GetServerAvailabilityRequest struct {
+	ServerGuid string
+	Period     time.Duration
+	AccountID  int
+}
+
+type ServerAvailability struct {
+	UptimePercentage float64    `json:"uptime_percentage"`
+	ProbesCount      int        `json:"probes_count"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	Outages          []Outage   `json:"outages"`
+}
+
+type Outage struct {
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	// Duration is in seconds. The duration of an ongoing outage is counted until now.
+	Duration int64  `json:"duration"`
+	Error    string `json:"error"`
+}
+
+type CreateEnrollmentCodeRequest struct {
+	AccountID int
+	UserID    int
+}
+
+type RevokeEnrollmentCodeRequest struct {
+	ID        int
+	AccountID int
+	UserID    int
+}
+
+type EnrollmentCode struct {
+	ID        int        `json:"id"`
+	Status    string     `json:"status"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	UsedIP    string     `json:"used_ip"`
+	ServerID  *int       `json:"server_id"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	RevokedBy *int       `json:"revoked_by"`
+}
+
+// NewEnrollmentCode contains the plain code. It is returned only once, when the code is created.
+type NewEnrollmentCode struct {
+	EnrollmentCode
+
+	Code string `json:"code"`
+}
+
+type EnrollRequest struct {
+	Code         string `json:"code" validate:"nonzero"`
+	HostName     string `json:"hostname"`
+	Ipv4Address  string `json:"ipv4_address"`
+	Ipv6Address  string `json:"ipv6_address"`
+	AgentPort    int    `json:"agent_port"`
+	AgentVersion string `json:"agent_version"`
+	OsCode       string `json:"os_code"`
+	OsVersion    string `json:"os_version"`
+	// ConnectionMode is "tunnel" for agents that connect to the panel instead of accepting connections
+	ConnectionMode string `json:"connection_mode"`
+	RemoteIP       string
+}
+
+type EnrollResponse struct {
+	ServerGuid string `json:"server_guid"`
+	Token      string `json:"token"`
+}
+
+type RotateServerTokenRequest struct {
+	ServerGuid string
+	AccountID  int
+}
+
+type RotateServerTokensRequest struct {
+	ServerGuids []string `json:"servers"`
+	AccountID   int
+}
+
+type TokenRotationResult struct {
+	ServerGuid string     `json:"guid"`
+	ServerName string     `json:"name"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type CreateAgentUpgradeRequest struct {
+	Version          string   `json:"version" validate:"nonzero,max=64"`
+	ServerGuids      []string `json:"servers"`
+	Concurrency      int      `json:"concurrency" validate:"min=0"`
+	FailureThreshold int      `json:"failure_threshold" validate:"min=0"`
+	AccountID        int
+	UserID           int
+}
+
+type AgentUpgradeRequest struct {
+	ID        int
+	AccountID int
+}
+
+type AgentUpgrade struct {
+	ID               int                  `json:"id"`
+	TargetVersion    string               `json:"target_version"`
+	Concurrency      int                  `json:"concurrency"`
+	FailureThreshold int                  `json:"failure_threshold"`
+	Status           string               `json:"status"`
+	Error            string               `json:"error"`
+	Progress         map[string]int       `json:"progress"`
+	Servers          []AgentUpgradeServer `json:"servers,omitempty"`
+	CreatedBy        int                  `json:"created_by"`
+	CreatedAt        time.Time            `json:"created_at"`
+	FinishedAt       *time.Time           `json:"finished_at"`
+}
+
+type AgentUpgradeServer struct {
+	ServerGuid      string     `json:"guid"`
+	ServerName      string     `json:"name"`
+	Batch           int        `json:"batch"`
+	Status          string     `json:"status"`
+	PreviousVersion string     `json:"previous_version"`
+	Version         string     `json:"version"`
+	Error           string     `json:"error"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+}
+
+type FindServersRequest struct {
+	Tags      []string `form:"tag"`
+	GroupID   int      `form:"group"`
+	AccountID int
+}
+
+type ServerGroup struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Servers     []string  `json:"servers"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type SaveServerGroupRequest struct {
+	ID          int
+	Name        string `json:"name" validate:"nonzero,max=64"`
+	Description string `json:"description" validate:"max=255"`
+	AccountID   int
+}
+
+type ServerGroupRequest struct {
+	ID        int
+	AccountID int
+}
+
+type SetGroupServersRequest struct {
+	ID          int
+	ServerGuids []string `json:"servers"`
+	AccountID   int
+}
+
+type SetServerTagsRequest struct {
+	ServerGuid string
+	Tags       []string `json:"tags"`
+	AccountID  int
+}
+
+type ChangeGroupCertbotStatusRequest struct {
+	ID        int
+	Value     bool `json:"value"`
+	Force     bool `json:"force"`
+	AccountID int
+}
+
+// ServerOperationResult is the result of a group operation on a single server
+type ServerOperationResult struct {
+	ServerGuid string `json:"guid"`
+	ServerName string `json:"name"`
+	Error      string `json:"error,omitempty"`
+}
+
+type ServerHealth struct {
+	ServerGuid string `json:"guid"`
+	ServerName string `json:"name"`
+	IsOnline   bool   `json:"is_online"`
+	LatencyMs  int    `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type CreateMaintenanceWindowsRequest struct {
+	scope.Scope
+
+	DomainName string     `json:"domain" validate:"max=255"`
+	Reason     string     `json:"reason" validate:"max=255"`
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+	AccountID  int
+	UserID     int
+}
+
+type MaintenanceWindowRequest struct {
+	ID        int
+	AccountID int
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/monitor"
+	"backend/internal/app/panel/server/scope"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+// testEnv holds memory storages and the agent provider the services under test are created with
+type testEnv struct {
+	config                *config.Config
+	serverStorage         serverStorage.ServerStorage
+	probeStorage          serverStorage.ProbeStorage
+	groupStorage          serverStorage.ServerGroupStorage
+	tagStorage            serverStorage.ServerTagStorage
+	maintenanceStorage    serverStorage.MaintenanceStorage
+	enrollmentCodeStorage serverStorage.EnrollmentCodeStorage
+	provider              *agentprovider.AgentProvider
+	maintenance           maintenance.Checker
+}
+
+func createTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	cfg := &config.Config{AgentPort: 60150, EnrollmentCodeTTL: time.Hour}
+	storage := testutil.NewServerMemoryStorage()
+	groupStorage := testutil.NewServerGroupMemoryStorage()
+	tagStorage := testutil.NewServerTagMemoryStorage()
+	maintenanceStorage := testutil.NewMaintenanceMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(cfg, storage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testEnv{
+		config:                cfg,
+		serverStorage:         storage,
+		probeStorage:          testutil.NewProbeMemoryStorage(),
+		groupStorage:          groupStorage,
+		tagStorage:            tagStorage,
+		maintenanceStorage:    maintenanceStorage,
+		enrollmentCodeStorage: testutil.NewEnrollmentCodeMemoryStorage(storage),
+		provider:              provider,
+		maintenance:           maintenance.CreateChecker(maintenanceStorage, groupStorage, tagStorage),
+	}
+}
+
+func (e testEnv) serverService() ServerService {
+	return NewServerService(
+		e.config,
+		e.serverStorage,
+		e.probeStorage,
+		e.groupStorage,
+		e.tagStorage,
+		e.provider,
+		e.maintenance,
+		logger.NewNopLogger(),
+	)
+}
+
+func (e testEnv) groupService() GroupService {
+	return NewGroupService(
+		e.serverStorage,
+		e.groupStorage,
+		e.tagStorage,
+		e.resolver(),
+		e.provider,
+		monitor.CreateMonitor(e.config, e.serverStorage, e.probeStorage, e.provider, e.maintenance, logger.NewNopLogger()),
+		e.maintenance,
+		logger.NewNopLogger(),
+	)
+}
+
+func (e testEnv) enrollmentService() EnrollmentService {
+	return NewEnrollmentService(e.config, e.serverStorage, e.enrollmentCodeStorage, e.provider, logger.NewNopLogger())
+}
+
+func (e testEnv) tokenRotationService() TokenRotationService {
+	return NewTokenRotationService(e.config, e.serverStorage, e.provider, logger.NewNopLogger())
+}
+
+func (e testEnv) tunnelService() TunnelService {
+	return NewTunnelService(e.config, e.serverStorage, e.provider, logger.NewNopLogger())
+}
+
+func (e testEnv) maintenanceService() MaintenanceService {
+	return NewMaintenanceService(e.maintenanceStorage, e.resolver(), logger.NewNopLogger())
+}
+
+func (e testEnv) resolver() scope.Resolver {
+	return scope.CreateResolver(e.serverStorage, e.groupStorage, e.tagStorage)
+}
+
+func (e testEnv) addServer(t *testing.T, ip string, port int) *serverStorage.Server {
+	t.Helper()
+
+	server := &serverStorage.Server{
+		Name:        "test",
+		Ipv4Address: ip,
+		AgentPort:   port,
+		Token:       testToken,
+		AccountID:   1,
+	}
+
+	if err := e.serverStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
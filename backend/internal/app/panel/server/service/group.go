@@ -0,0 +1,358 @@
+package service
+
+import (
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/monitor"
+	"backend/internal/app/panel/server/scope"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const (
+	groupWorkersCount = 5
+	maxTagLength      = 64
+)
+
+var (
+	ErrServerGroupNotFound  = errors.New("server group not found")
+	ErrServerGroupNameTaken = errors.New("server group with the specified name already exists")
+	ErrInvalidTag           = errors.New("tag may contain only lowercase letters, digits and the characters . _ : -")
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]*$`)
+
+// GroupService manages server groups and tags and runs operations on every server of a group
+type GroupService struct {
+	serverStorage serverStorage.ServerStorage
+	groupStorage  serverStorage.ServerGroupStorage
+	tagStorage    serverStorage.ServerTagStorage
+	scopeResolver scope.Resolver
+	agentProvider *agentprovider.AgentProvider
+	monitor       *monitor.Monitor
+	maintenance   maintenance.Checker
+	logger        logger.Logger
+}
+
+func (s GroupService) FindServerGroups(accountID int) ([]ServerGroup, error) {
+	groupModels, err := s.groupStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get account %d server groups", accountID)
+	}
+
+	groups := []ServerGroup{}
+
+	for _, groupModel := range groupModels {
+		group, err := s.createServerGroup(&groupModel)
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, *group)
+	}
+
+	return groups, nil
+}
+
+func (s GroupService) GetServerGroup(request ServerGroupRequest) (*ServerGroup, error) {
+	groupModel, err := s.findGroup(request.ID, request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createServerGroup(groupModel)
+}
+
+// SaveServerGroup creates a new group or renames the existing one
+func (s GroupService) SaveServerGroup(request SaveServerGroupRequest) (*ServerGroup, error) {
+	groupModel := &serverStorage.ServerGroup{AccountID: uint(request.AccountID)}
+
+	if request.ID != 0 {
+		var err error
+
+		if groupModel, err = s.findGroup(request.ID, request.AccountID); err != nil {
+			return nil, err
+		}
+	}
+
+	name := strings.TrimSpace(request.Name)
+	sameNameGroup, err := s.groupStorage.FindByName(request.AccountID, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sameNameGroup != nil && sameNameGroup.ID != groupModel.ID {
+		return nil, ErrServerGroupNameTaken
+	}
+
+	groupModel.Name = name
+	groupModel.Description = request.Description
+
+	if err = s.groupStorage.Save(groupModel); err != nil {
+		return nil, fmt.Errorf("failed to save server group: %v", err)
+	}
+
+	s.logger.Info(fmt.Sprintf("server group %s saved, account: %d", groupModel.Name, request.AccountID))
+
+	return s.createServerGroup(groupModel)
+}
+
+func (s GroupService) RemoveServerGroup(request ServerGroupRequest) error {
+	groupModel, err := s.findGroup(request.ID, request.AccountID)
+
+	if err != nil {
+		return err
+	}
+
+	if err = s.groupStorage.Remove(groupModel); err != nil {
+		return fmt.Errorf("failed to remove server group: %v", err)
+	}
+
+	s.logger.Info(fmt.Sprintf("server group %s removed, account: %d", groupModel.Name, request.AccountID))
+
+	return nil
+}
+
+// SetGroupServers replaces servers of the group
+func (s GroupService) SetGroupServers(request SetGroupServersRequest) (*ServerGroup, error) {
+	groupModel, err := s.findGroup(request.ID, request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serverIDs := []uint{}
+
+	if len(request.ServerGuids) != 0 {
+		servers, err := s.scopeResolver.Resolve(request.AccountID, scope.Scope{ServerGuids: request.ServerGuids})
+
+		if err != nil {
+			if errors.Is(err, scope.ErrServerNotFound) {
+				return nil, fmt.Errorf("%w: %v", ErrServerNotFound, err)
+			}
+
+			return nil, err
+		}
+
+		for _, server := range servers {
+			serverIDs = append(serverIDs, server.ID)
+		}
+	}
+
+	if err = s.groupStorage.SetServers(int(groupModel.ID), serverIDs); err != nil {
+		return nil, err
+	}
+
+	return s.createServerGroup(groupModel)
+}
+
+// SetServerTags replaces tags of the server. Tags are lowercased and deduplicated.
+func (s GroupService) SetServerTags(request SetServerTagsRequest) ([]string, error) {
+	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(request.AccountID) {
+		return nil, ErrServerNotFound
+	}
+
+	tags, err := normalizeTags(request.Tags)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.tagStorage.SetServerTags(int(serverModel.ID), tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ChangeGroupCertbotStatus changes the certbot status on every server of the group. Servers in maintenance are skipped unless forced.
+func (s GroupService) ChangeGroupCertbotStatus(ctx context.Context, request ChangeGroupCertbotStatusRequest) ([]ServerOperationResult, error) {
+	servers, err := s.FindGroupServers(ServerGroupRequest{ID: request.ID, AccountID: request.AccountID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return runOnServers(servers, func(server *serverStorage.Server) error {
+		if err := checkMaintenance(s.maintenance, server, request.Force, s.logger); err != nil {
+			return err
+		}
+
+		sAgent, err := s.agentProvider.GetAgent(server)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = sAgent.ChangeCertbotStatus(ctx, agentintegration.ChangeCertbotStatusRequestData{Value: request.Value})
+
+		return err
+	}), nil
+}
+
+// CheckGroupHealth probes every server of the group immediately. Probes are recorded in the availability history.
+func (s GroupService) CheckGroupHealth(ctx context.Context, request ServerGroupRequest) ([]ServerHealth, error) {
+	servers, err := s.FindGroupServers(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	probes := s.monitor.Probe(ctx, servers)
+	results := make([]ServerHealth, 0, len(servers))
+
+	for i, probe := range probes {
+		results = append(results, ServerHealth{
+			ServerGuid: servers[i].Guid,
+			ServerName: servers[i].Name,
+			IsOnline:   probe.IsOnline == 1,
+			LatencyMs:  probe.LatencyMs,
+			Error:      probe.Error,
+		})
+	}
+
+	return results, nil
+}
+
+// FindGroupServers returns servers that belong to the account group
+func (s GroupService) FindGroupServers(request ServerGroupRequest) ([]serverStorage.Server, error) {
+	servers, err := s.scopeResolver.Resolve(request.AccountID, scope.Scope{GroupIDs: []int{request.ID}})
+
+	if errors.Is(err, scope.ErrGroupNotFound) {
+		return nil, ErrServerGroupNotFound
+	}
+
+	return servers, err
+}
+
+func (s GroupService) findGroup(id, accountID int) (*serverStorage.ServerGroup, error) {
+	groupModel, err := s.groupStorage.FindByID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if groupModel == nil || groupModel.AccountID != uint(accountID) {
+		return nil, ErrServerGroupNotFound
+	}
+
+	return groupModel, nil
+}
+
+func (s GroupService) createServerGroup(groupModel *serverStorage.ServerGroup) (*ServerGroup, error) {
+	serverIDs, err := s.groupStorage.FindServerIDs(int(groupModel.ID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	group := &ServerGroup{
+		ID:          int(groupModel.ID),
+		Name:        groupModel.Name,
+		Description: groupModel.Description,
+		Servers:     []string{},
+		CreatedAt:   groupModel.CreatedAt,
+	}
+
+	for _, serverID := range serverIDs {
+		group.Servers = append(group.Servers, serverStorage.GetServerGUIDByID(int(serverID)))
+	}
+
+	return group, nil
+}
+
+// runOnServers runs the operation on the servers concurrently and returns results in the order of servers
+func runOnServers(servers []serverStorage.Server, operation func(server *serverStorage.Server) error) []ServerOperationResult {
+	results := make([]ServerOperationResult, len(servers))
+	jobs := make(chan int, len(servers))
+
+	for i := range servers {
+		jobs <- i
+	}
+
+	close(jobs)
+
+	var wg sync.WaitGroup
+
+	for range min(len(servers), groupWorkersCount) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				results[i] = ServerOperationResult{
+					ServerGuid: servers[i].Guid,
+					ServerName: servers[i].Name,
+				}
+
+				if err := operation(&servers[i]); err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+
+		normalized = append(normalized, tag)
+	}
+
+	slices.Sort(normalized)
+
+	return slices.Compact(normalized), nil
+}
+
+func NewGroupService(
+	serverStorage serverStorage.ServerStorage,
+	groupStorage serverStorage.ServerGroupStorage,
+	tagStorage serverStorage.ServerTagStorage,
+	scopeResolver scope.Resolver,
+	agentProvider *agentprovider.AgentProvider,
+	monitor *monitor.Monitor,
+	maintenanceChecker maintenance.Checker,
+	logger logger.Logger,
+) GroupService {
+	return GroupService{
+		serverStorage: serverStorage,
+		groupStorage:  groupStorage,
+		tagStorage:    tagStorage,
+		scopeResolver: scopeResolver,
+		agentProvider: agentProvider,
+		monitor:       monitor,
+		maintenance:   maintenanceChecker,
+		logger:        logger,
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFindAccountServersFiltersByGroupAndTags(t *testing.T) {
+	env := createTestEnv(t)
+	groupService, serverService := env.groupService(), env.serverService()
+	web := env.addServer(t, "10.0.0.1", 60150)
+	db := env.addServer(t, "10.0.0.2", 60150)
+	env.addServer(t, "10.0.0.3", 60150)
+
+	group, err := groupService.SaveServerGroup(SaveServerGroupRequest{Name: "production", AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = groupService.SetGroupServers(SetGroupServersRequest{ID: group.ID, ServerGuids: []string{web.Guid, db.Guid}, AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := groupService.SetServerTags(SetServerTagsRequest{ServerGuid: web.Guid, Tags: []string{" Nginx", "eu-west", "nginx"}, AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tags, []string{"eu-west", "nginx"}) {
+		t.Fatalf("expected tags to be normalized, got %v", tags)
+	}
+
+	servers, err := serverService.FindAccountServers(FindServersRequest{GroupID: group.ID, AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 2 {
+		t.Fatalf("expected 2 servers in the group, got %d", len(servers))
+	}
+
+	servers, err = serverService.FindAccountServers(FindServersRequest{GroupID: group.ID, Tags: []string{"nginx", "eu-west"}, AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 1 || servers[0].Guid != web.Guid || !slices.Equal(servers[0].Groups, []int{group.ID}) {
+		t.Fatalf("expected only the tagged server, got %+v", servers)
+	}
+}
+
+func TestServerGroupValidation(t *testing.T) {
+	env := createTestEnv(t)
+	groupService := env.groupService()
+	server := env.addServer(t, "10.0.0.1", 60150)
+
+	if _, err := groupService.SaveServerGroup(SaveServerGroupRequest{Name: "web", AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := groupService.SaveServerGroup(SaveServerGroupRequest{Name: "web", AccountID: 1}); !errors.Is(err, ErrServerGroupNameTaken) {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+
+	if _, err := groupService.SetServerTags(SetServerTagsRequest{ServerGuid: server.Guid, Tags: []string{"bad tag"}, AccountID: 1}); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("expected invalid tag error, got %v", err)
+	}
+
+	if _, err := groupService.FindGroupServers(ServerGroupRequest{ID: 1, AccountID: 2}); !errors.Is(err, ErrServerGroupNotFound) {
+		t.Fatalf("expected foreign group to be hidden, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"fmt"
+
+	"gopkg.in/validator.v2"
+)
+
+var ErrInvalidImport = errors.New("some of the imported servers are invalid")
+
+// ImportServers adds servers in bulk with the same rules as AddServer. All servers are validated first
+// and nothing is imported if any of them is invalid. The returned errors are indexed like the requests.
+func (s ServerService) ImportServers(requests []NewServerRequest, dryRun bool) ([]error, error) {
+	errs := make([]error, len(requests))
+	invalid := false
+	addresses := map[string]int{}
+
+	for i, request := range requests {
+		err := validator.Validate(request)
+
+		if err == nil {
+			err = s.validateNewServer(request)
+		}
+
+		// servers in the import must not share addresses too
+		for _, address := range []string{request.Ipv4Address, request.Ipv6Address} {
+			if address == "" {
+				continue
+			}
+
+			if index, ok := addresses[address]; ok && err == nil {
+				err = fmt.Errorf("address %s is already used by server #%d of the import", address, index+1)
+			}
+
+			addresses[address] = i
+		}
+
+		if err != nil {
+			errs[i] = err
+			invalid = true
+		}
+	}
+
+	if invalid {
+		return errs, ErrInvalidImport
+	}
+
+	if dryRun {
+		return errs, nil
+	}
+
+	for i, request := range requests {
+		if err := s.AddServer(request); err != nil {
+			errs[i] = err
+
+			return errs, fmt.Errorf("failed to import server #%d, %d servers are imported: %v", i+1, i, err)
+		}
+
+		s.logger.Info(fmt.Sprintf("server %s imported to account %d", request.Name, request.AccountID))
+	}
+
+	return errs, nil
+}
+
+// ExportServers returns servers with their agent tokens. Servers of all accounts are exported if accountID is zero.
+func (s ServerService) ExportServers(accountID int) ([]ExportedServer, error) {
+	var (
+		serverModels []serverStorage.Server
+		err          error
+	)
+
+	if accountID == 0 {
+		serverModels, err = s.serverStorage.FindAll()
+	} else {
+		serverModels, err = s.serverStorage.FindAllByAccountID(accountID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]ExportedServer, 0, len(serverModels))
+
+	for _, serverModel := range serverModels {
+		servers = append(servers, ExportedServer{
+			Name:        serverModel.Name,
+			Ipv4Address: serverModel.Ipv4Address,
+			Ipv6Address: serverModel.Ipv6Address,
+			AgentPort:   serverModel.AgentPort,
+			Token:       serverModel.Token,
+			AccountID:   int(serverModel.AccountID),
+		})
+	}
+
+	return servers, nil
+}
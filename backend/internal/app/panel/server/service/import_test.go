@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestImportServers(t *testing.T) {
+	env := createTestEnv(t)
+	service, storage := env.serverService(), env.serverStorage
+	env.addServer(t, "10.0.0.1", 60150)
+
+	requests := []NewServerRequest{
+		{Name: "web-1", Ipv4Address: "10.0.0.2", AgentPort: 60150, Token: testToken, AccountID: 1},
+		{Name: "web-2", Ipv4Address: "10.0.0.2", AgentPort: 60150, Token: testToken, AccountID: 1},
+		{Name: "web-3", Ipv4Address: "10.0.0.1", AgentPort: 60150, Token: testToken, AccountID: 1},
+		{Name: "web-4", Ipv4Address: "10.0.0.4", AgentPort: 60150, AccountID: 1},
+	}
+
+	errs, err := service.ImportServers(requests, false)
+
+	if !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("expected invalid import error, got %v", err)
+	}
+
+	if errs[0] != nil || errs[1] == nil || errs[2] == nil || errs[3] == nil {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	if servers, _ := storage.FindAll(); len(servers) != 1 {
+		t.Fatalf("expected nothing to be imported, got %d servers", len(servers))
+	}
+
+	if _, err = service.ImportServers(requests[:1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	if servers, _ := storage.FindAll(); len(servers) != 1 {
+		t.Fatalf("expected nothing to be imported on dry run, got %d servers", len(servers))
+	}
+
+	if _, err = service.ImportServers(requests[:1], false); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := service.ExportServers(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exported) != 2 || exported[0].Token != testToken {
+		t.Fatalf("unexpected exported servers: %+v", exported)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/scope"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMaintenanceWindowNotFound = errors.New("maintenance window not found")
+	ErrInvalidMaintenanceWindow  = errors.New("maintenance window must end in the future and after it starts")
+	ErrMaintenanceScopeEmpty     = errors.New("servers, groups or tags of the maintenance must be specified")
+)
+
+// MaintenanceService schedules maintenance windows of account servers and their domains
+type MaintenanceService struct {
+	maintenanceStorage serverStorage.MaintenanceStorage
+	scopeResolver      scope.Resolver
+	logger             logger.Logger
+}
+
+// FindMaintenanceWindows returns active and scheduled maintenance windows of the account
+func (s MaintenanceService) FindMaintenanceWindows(accountID int) ([]maintenance.Window, error) {
+	windowModels, err := s.maintenanceStorage.FindAllByAccountID(accountID, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	windows := []maintenance.Window{}
+
+	for _, windowModel := range windowModels {
+		windows = append(windows, maintenance.CreateWindow(windowModel))
+	}
+
+	return windows, nil
+}
+
+// CreateMaintenanceWindows creates a window for every server, group and tag of the scope.
+// Group and tag windows are resolved when maintenance is checked, so they apply to servers added to the group or tagged later.
+func (s MaintenanceService) CreateMaintenanceWindows(request CreateMaintenanceWindowsRequest) ([]maintenance.Window, error) {
+	if request.Scope.IsEmpty() {
+		return nil, ErrMaintenanceScopeEmpty
+	}
+
+	if request.EndsAt != nil {
+		if !request.EndsAt.After(time.Now()) || (request.StartsAt != nil && !request.EndsAt.After(*request.StartsAt)) {
+			return nil, ErrInvalidMaintenanceWindow
+		}
+	}
+
+	// servers and groups of the scope must belong to the account
+	if _, err := s.scopeResolver.Resolve(request.AccountID, request.Scope); err != nil {
+		if errors.Is(err, scope.ErrServerNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrServerNotFound, err)
+		}
+
+		if errors.Is(err, scope.ErrGroupNotFound) {
+			return nil, ErrServerGroupNotFound
+		}
+
+		return nil, err
+	}
+
+	window := serverStorage.MaintenanceWindow{
+		AccountID:  uint(request.AccountID),
+		DomainName: request.DomainName,
+		Reason:     request.Reason,
+		StartsAt:   request.StartsAt,
+		EndsAt:     request.EndsAt,
+		CreatedBy:  uint(request.UserID),
+	}
+	var windowModels []serverStorage.MaintenanceWindow
+
+	for _, guid := range request.ServerGuids {
+		serverID, err := serverStorage.GetServerIDByGUID(guid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		id := uint(serverID)
+		serverWindow := window
+		serverWindow.ServerID = &id
+		windowModels = append(windowModels, serverWindow)
+	}
+
+	for _, groupID := range request.GroupIDs {
+		id := uint(groupID)
+		groupWindow := window
+		groupWindow.GroupID = &id
+		windowModels = append(windowModels, groupWindow)
+	}
+
+	for _, tag := range request.Tags {
+		tagWindow := window
+		tagWindow.Tag = tag
+		windowModels = append(windowModels, tagWindow)
+	}
+
+	windows := []maintenance.Window{}
+
+	for _, windowModel := range windowModels {
+		if err := s.maintenanceStorage.Create(&windowModel); err != nil {
+			return nil, fmt.Errorf("could not create maintenance window: %v", err)
+		}
+
+		windows = append(windows, maintenance.CreateWindow(windowModel))
+	}
+
+	s.logger.Info(fmt.Sprintf(
+		"maintenance windows created, account: %d, user: %d, windows: %d, domain: %q",
+		request.AccountID,
+		request.UserID,
+		len(windows),
+		request.DomainName,
+	))
+
+	return windows, nil
+}
+
+// RemoveMaintenanceWindow ends the window, so the server or the domain is not in maintenance anymore
+func (s MaintenanceService) RemoveMaintenanceWindow(request MaintenanceWindowRequest) error {
+	windowModel, err := s.maintenanceStorage.FindByID(request.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if windowModel == nil || windowModel.AccountID != uint(request.AccountID) {
+		return ErrMaintenanceWindowNotFound
+	}
+
+	if err = s.maintenanceStorage.Remove(request.ID); err != nil {
+		return fmt.Errorf("failed to remove maintenance window: %v", err)
+	}
+
+	s.logger.Info(fmt.Sprintf("maintenance window %d removed, account: %d", request.ID, request.AccountID))
+
+	return nil
+}
+
+func NewMaintenanceService(
+	maintenanceStorage serverStorage.MaintenanceStorage,
+	scopeResolver scope.Resolver,
+	logger logger.Logger,
+) MaintenanceService {
+	return MaintenanceService{
+		maintenanceStorage: maintenanceStorage,
+		scopeResolver:      scopeResolver,
+		logger:             logger,
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/app/panel/server/scope"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	env := createTestEnv(t)
+	service, checker := env.maintenanceService(), env.maintenance
+	web := env.addServer(t, "10.0.0.1", 60150)
+	db := env.addServer(t, "10.0.0.2", 60150)
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	if _, err := service.CreateMaintenanceWindows(CreateMaintenanceWindowsRequest{AccountID: 1}); !errors.Is(err, ErrMaintenanceScopeEmpty) {
+		t.Errorf("expected empty scope error, got %v", err)
+	}
+
+	request := CreateMaintenanceWindowsRequest{
+		Scope:     scope.Scope{ServerGuids: []string{web.Guid}},
+		EndsAt:    &past,
+		AccountID: 1,
+	}
+
+	if _, err := service.CreateMaintenanceWindows(request); !errors.Is(err, ErrInvalidMaintenanceWindow) {
+		t.Errorf("expected invalid window error, got %v", err)
+	}
+
+	request.EndsAt = &future
+	request.DomainName = "example.com"
+	windows, err := service.CreateMaintenanceWindows(request)
+
+	if err != nil || len(windows) != 1 {
+		t.Fatalf("expected a single window, got %v, %v", windows, err)
+	}
+
+	if err = checker.Check(web, "example.com"); !errors.Is(err, maintenance.ErrInMaintenance) {
+		t.Errorf("expected the domain to be in maintenance, got %v", err)
+	}
+
+	if err = checker.Check(web, "another.com"); err != nil {
+		t.Errorf("expected another domain not to be in maintenance, got %v", err)
+	}
+
+	if err = checker.Check(db, "example.com"); err != nil {
+		t.Errorf("expected another server not to be in maintenance, got %v", err)
+	}
+
+	err = service.RemoveMaintenanceWindow(MaintenanceWindowRequest{ID: windows[0].ID, AccountID: 2})
+
+	if !errors.Is(err, ErrMaintenanceWindowNotFound) {
+		t.Errorf("expected window of another account not to be found, got %v", err)
+	}
+
+	if err = service.RemoveMaintenanceWindow(MaintenanceWindowRequest{ID: windows[0].ID, AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = checker.Check(web, "example.com"); err != nil {
+		t.Errorf("expected the domain not to be in maintenance after removal, got %v", err)
+	}
+}
+
+func TestMaintenanceWindowsOfGroupsAndTagsAreResolvedOnCheck(t *testing.T) {
+	env := createTestEnv(t)
+	service, checker := env.maintenanceService(), env.maintenance
+	storage, groupStorage, tagStorage := env.serverStorage, env.groupStorage, env.tagStorage
+	web := env.addServer(t, "10.0.0.1", 60150)
+	db := env.addServer(t, "10.0.0.2", 60150)
+	group := &serverStorage.ServerGroup{AccountID: 1, Name: "web"}
+
+	if err := groupStorage.Save(group); err != nil {
+		t.Fatal(err)
+	}
+
+	request := CreateMaintenanceWindowsRequest{
+		Scope:     scope.Scope{GroupIDs: []int{int(group.ID)}, Tags: []string{"db"}},
+		AccountID: 1,
+	}
+	windows, err := service.CreateMaintenanceWindows(request)
+
+	if err != nil || len(windows) != 2 {
+		t.Fatalf("expected a group and a tag window, got %v, %v", windows, err)
+	}
+
+	if err = checker.Check(web, ""); err != nil {
+		t.Errorf("expected the server outside the group not to be in maintenance, got %v", err)
+	}
+
+	if err = groupStorage.SetServers(int(group.ID), []uint{web.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tagStorage.SetServerTags(int(db.ID), []string{"db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = checker.Check(web, ""); !errors.Is(err, maintenance.ErrInMaintenance) {
+		t.Errorf("expected the server added to the group to be in maintenance, got %v", err)
+	}
+
+	if err = checker.Check(db, ""); !errors.Is(err, maintenance.ErrInMaintenance) {
+		t.Errorf("expected the tagged server to be in maintenance, got %v", err)
+	}
+
+	other := env.addServer(t, "10.0.0.3", 60150)
+	other.AccountID = 2
+
+	if err = storage.Save(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tagStorage.SetServerTags(int(other.ID), []string{"db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = checker.Check(other, ""); err != nil {
+		t.Errorf("expected the tag window not to apply to another account, got %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	rotationWorkersCount   = 5
+	rotationTimeout        = time.Minute
+	rotationRollbackTimout = 30 * time.Second
+	rotationCheckInterval  = time.Hour
+)
+
+var ErrTokenRotationInProgress = errors.New("token rotation of the server is already in progress")
+
+// TokenRotationService replaces agent tokens without locking the panel out of the agent.
+// The new token is staged on the agent over the current channel, confirmed with a request authenticated by it,
+// stored and only then committed on the agent. Every failed step rolls the previous ones back.
+type TokenRotationService struct {
+	config        *config.Config
+	serverStorage serverStorage.ServerStorage
+	agentProvider *agentprovider.AgentProvider
+	logger        logger.Logger
+	rotating      *rotationLocks
+}
+
+type rotationLocks struct {
+	mu      sync.Mutex
+	servers map[uint]struct{}
+}
+
+func (l *rotationLocks) lock(serverID uint) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.servers[serverID]; ok {
+		return false
+	}
+
+	l.servers[serverID] = struct{}{}
+
+	return true
+}
+
+func (l *rotationLocks) unlock(serverID uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.servers, serverID)
+}
+
+func (s TokenRotationService) RotateServerToken(ctx context.Context, request RotateServerTokenRequest) (*TokenRotationResult, error) {
+	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(request.AccountID) {
+		return nil, ErrServerNotFound
+	}
+
+	if err = s.rotate(ctx, serverModel); err != nil {
+		return nil, err
+	}
+
+	return createTokenRotationResult(serverModel, nil), nil
+}
+
+// RotateServerTokens rotates tokens of the account servers. Tokens of all account servers are rotated if no servers are specified.
+func (s TokenRotationService) RotateServerTokens(ctx context.Context, request RotateServerTokensRequest) ([]TokenRotationResult, error) {
+	serverModels, err := s.serverStorage.FindAllByAccountID(request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(request.ServerGuids) != 0 {
+		serversByGuid := map[string]serverStorage.Server{}
+
+		for _, serverModel := range serverModels {
+			serversByGuid[serverModel.Guid] = serverModel
+		}
+
+		serverModels = serverModels[:0]
+
+		for _, guid := range request.ServerGuids {
+			serverModel, ok := serversByGuid[guid]
+
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrServerNotFound, guid)
+			}
+
+			serverModels = append(serverModels, serverModel)
+		}
+	}
+
+	return s.rotateAll(ctx, serverModels), nil
+}
+
+// RotateExpiredTokens rotates tokens of online servers that were not rotated within the configured interval
+func (s TokenRotationService) RotateExpiredTokens(ctx context.Context) {
+	serverModels, err := s.serverStorage.FindAll()
+
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("scheduled token rotation failed: %v", err))
+
+		return
+	}
+
+	var expired []serverStorage.Server
+
+	for _, serverModel := range serverModels {
+		rotatedAt := serverModel.CreatedAt
+
+		if serverModel.TokenRotatedAt != nil {
+			rotatedAt = *serverModel.TokenRotatedAt
+		}
+
+		if serverModel.IsActive == 1 && time.Since(rotatedAt) > s.config.TokenRotationInterval {
+			expired = append(expired, serverModel)
+		}
+	}
+
+	for _, result := range s.rotateAll(ctx, expired) {
+		if result.Error != "" {
+			s.logger.Warning(fmt.Sprintf("scheduled token rotation of server %s failed: %s", result.ServerName, result.Error))
+		}
+	}
+}
+
+// Run rotates expired tokens periodically if the rotation interval is configured
+func (s TokenRotationService) Run() {
+	if s.config.TokenRotationInterval <= 0 {
+		return
+	}
+
+	for range time.Tick(rotationCheckInterval) {
+		s.RotateExpiredTokens(context.Background())
+	}
+}
+
+func (s TokenRotationService) rotateAll(ctx context.Context, serverModels []serverStorage.Server) []TokenRotationResult {
+	results := make([]TokenRotationResult, len(serverModels))
+	jobs := make(chan int, len(serverModels))
+
+	for i := range serverModels {
+		jobs <- i
+	}
+
+	close(jobs)
+
+	var wg sync.WaitGroup
+
+	for range min(len(serverModels), rotationWorkersCount) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				err := s.rotate(ctx, &serverModels[i])
+				results[i] = *createTokenRotationResult(&serverModels[i], err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func (s TokenRotationService) rotate(ctx context.Context, serverModel *serverStorage.Server) (err error) {
+	if !s.rotating.lock(serverModel.ID) {
+		return ErrTokenRotationInProgress
+	}
+
+	defer s.rotating.unlock(serverModel.ID)
+
+	ctx, cancel := context.WithTimeout(ctx, rotationTimeout)
+	defer cancel()
+
+	previousToken := serverModel.Token
+	previousRotatedAt := serverModel.TokenRotatedAt
+	token, err := generateToken(serverTokenLength)
+
+	if err != nil {
+		return err
+	}
+
+	currentAgent, err := s.agentProvider.GetAgent(serverModel)
+
+	if err != nil {
+		return err
+	}
+
+	if err = currentAgent.StageToken(ctx, token); err != nil {
+		return fmt.Errorf("agent did not accept the new token: %w", err)
+	}
+
+	// the staged token is discarded if any of the next steps fails
+	abort := func(cause error) error {
+		rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rotationRollbackTimout)
+		defer cancel()
+
+		rollbackAgent, err := s.agentProvider.CreateAgentWithToken(serverModel, previousToken)
+
+		if err == nil {
+			defer rollbackAgent.Close()
+			err = rollbackAgent.AbortToken(rollbackCtx)
+		}
+
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("failed to discard the staged token of server %s: %v", serverModel.Name, err))
+
+			return fmt.Errorf("%w, the staged token could not be discarded: %v", cause, err)
+		}
+
+		return cause
+	}
+
+	newAgent, err := s.agentProvider.CreateAgentWithToken(serverModel, token)
+
+	if err != nil {
+		return abort(err)
+	}
+
+	defer newAgent.Close()
+
+	if _, err = newAgent.GetServerData(ctx); err != nil {
+		return abort(fmt.Errorf("agent did not confirm the new token: %w", err))
+	}
+
+	now := time.Now()
+
+	if err = s.serverStorage.RotateToken(int(serverModel.ID), token, &now); err != nil {
+		return abort(err)
+	}
+
+	s.agentProvider.Invalidate(serverModel.ID)
+
+	if err = newAgent.CommitToken(ctx); err != nil {
+		err = fmt.Errorf("agent did not commit the new token: %w", err)
+
+		if restoreErr := s.serverStorage.RotateToken(int(serverModel.ID), previousToken, previousRotatedAt); restoreErr != nil {
+			// the agent still accepts both tokens, so the panel keeps working with the new one
+			s.logger.Error(fmt.Sprintf("failed to restore the previous token of server %s: %v", serverModel.Name, restoreErr))
+
+			return err
+		}
+
+		s.agentProvider.Invalidate(serverModel.ID)
+
+		return abort(err)
+	}
+
+	serverModel.Token = token
+	serverModel.TokenRotatedAt = &now
+	s.logger.Info(fmt.Sprintf("token of server %s rotated", serverModel.Name))
+
+	return nil
+}
+
+func createTokenRotationResult(serverModel *serverStorage.Server, err error) *TokenRotationResult {
+	result := &TokenRotationResult{
+		ServerGuid: serverModel.Guid,
+		ServerName: serverModel.Name,
+		RotatedAt:  serverModel.TokenRotatedAt,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func NewTokenRotationService(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	agentProvider *agentprovider.AgentProvider,
+	logger logger.Logger,
+) TokenRotationService {
+	return TokenRotationService{
+		config:        config,
+		serverStorage: serverStorage,
+		agentProvider: agentProvider,
+		logger:        logger,
+		rotating:      &rotationLocks{servers: map[uint]struct{}{}},
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"backend/internal/pkg/agent/fakeagent"
+	"context"
+	"testing"
+)
+
+func TestRotateServerToken(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+	fAgent.EnableTokenRotation()
+
+	env := createTestEnv(t)
+	service, storage := env.tokenRotationService(), env.serverStorage
+	ip, port := fAgent.Address()
+	server := env.addServer(t, ip, port)
+
+	result, err := service.RotateServerToken(context.Background(), RotateServerTokenRequest{ServerGuid: server.Guid, AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := storage.FindByID(int(server.ID))
+	token, staged := fAgent.Token()
+
+	if stored.Token == testToken || stored.Token != token || staged != "" {
+		t.Fatalf("expected the new token to be committed, panel: %s, agent: %s, staged: %s", stored.Token, token, staged)
+	}
+
+	if result.RotatedAt == nil || stored.TokenRotatedAt == nil {
+		t.Fatal("expected rotation time to be recorded")
+	}
+}
+
+func TestRotateServerTokenRollsBackUnconfirmedToken(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+	fAgent.EnableTokenRotation()
+	fAgent.Handle("getserverdata", func(request fakeagent.Request) fakeagent.Reply {
+		if request.AuthToken != testToken {
+			return fakeagent.Reply{Error: "unknown token"}
+		}
+
+		return fakeagent.Reply{Data: map[string]any{}}
+	})
+
+	env := createTestEnv(t)
+	service, storage := env.tokenRotationService(), env.serverStorage
+	ip, port := fAgent.Address()
+	server := env.addServer(t, ip, port)
+
+	if _, err = service.RotateServerToken(context.Background(), RotateServerTokenRequest{ServerGuid: server.Guid, AccountID: 1}); err == nil {
+		t.Fatal("expected rotation to fail")
+	}
+
+	stored, _ := storage.FindByID(int(server.ID))
+	token, staged := fAgent.Token()
+
+	if stored.Token != testToken || token != testToken || staged != "" || stored.TokenRotatedAt != nil {
+		t.Fatalf("expected the previous token to be kept, panel: %s, agent: %s, staged: %s", stored.Token, token, staged)
+	}
+
+	if len(fAgent.CommandRequests("token.abort")) != 1 {
+		t.Fatal("expected the staged token to be discarded")
+	}
+}
+
+func TestRotateServerTokensOfAllAccountServers(t *testing.T) {
+	env := createTestEnv(t)
+	service := env.tokenRotationService()
+	var agents []*fakeagent.Agent
+
+	for range 3 {
+		fAgent, err := fakeagent.Start(testToken)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer fAgent.Close()
+		fAgent.EnableTokenRotation()
+		ip, port := fAgent.Address()
+		env.addServer(t, ip, port)
+		agents = append(agents, fAgent)
+	}
+
+	results, err := service.RotateServerTokens(context.Background(), RotateServerTokensRequest{AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(agents) {
+		t.Fatalf("expected %d results, got %d", len(agents), len(results))
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			t.Fatalf("rotation of server %s failed: %s", result.ServerGuid, result.Error)
+		}
+	}
+}
+
+func TestUpdateServerTokenKeepsRotationTime(t *testing.T) {
+	env := createTestEnv(t)
+	server := env.addServer(t, "10.0.0.1", 60150)
+
+	if err := env.serverService().UpdateServerToken(UpdateServerTokenRequest{ID: int(server.ID), Token: "manual-token", AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := env.serverStorage.FindByID(int(server.ID))
+
+	if stored.Token != "manual-token" {
+		t.Fatalf("expected the token to be updated, got %s", stored.Token)
+	}
+
+	if stored.TokenRotatedAt != nil {
+		t.Fatal("expected a token set by hand not to be recorded as a rotation")
+	}
+}
@@ -4,45 +4,117 @@ import (
 	"backend/config"
 	"backend/internal/app/panel/domain/dto"
 	domainFactory "backend/internal/app/panel/domain/factory"
+	domainService "backend/internal/app/panel/domain/service"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
 	serverStorage "backend/internal/app/panel/server/storage"
 	"backend/internal/pkg/agent"
 	"backend/internal/pkg/logger"
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/r2dtools/agentintegration"
 )
 
 const (
 	serverTokenLength = 24
+	maxRecentOutages  = 20
 )
 
 var ErrServerNotFound = errors.New("server not found")
 var ErrAgentConnection = errors.New("failed to connect to the server agent")
+var ErrInvalidConnectionMode = errors.New("connection mode must be direct or tunnel")
+
+// panelFeatures maps panel features to the agent commands they require
+var panelFeatures = map[string][]string{
+	"server.certbot":        {"changecertbotstatus"},
+	"domain.config":         {"getvhostconfig"},
+	"certificate.issue":     {"certificates.issue"},
+	"certificate.upload":    {"certificates.upload"},
+	"certificate.assign":    {"certificates.domainassign"},
+	"certificate.commondir": {"certificates.commondirstatus", "certificates.changecommondirstatus"},
+	"certificate.storage": {
+		"certificates.storagecertificates",
+		"certificates.storagecertupload",
+		"certificates.storagecertdownload",
+		"certificates.storagecertremove",
+	},
+}
 
 type ServerService struct {
 	config        *config.Config
 	serverStorage serverStorage.ServerStorage
+	probeStorage  serverStorage.ProbeStorage
+	groupStorage  serverStorage.ServerGroupStorage
+	tagStorage    serverStorage.ServerTagStorage
+	agentProvider *agentprovider.AgentProvider
+	maintenance   maintenance.Checker
 	logger        logger.Logger
 }
 
-func (s ServerService) FindAccountServers(accountID int) ([]Server, error) {
+// FindAccountServers returns account servers that belong to the group and have all the tags of the request
+func (s ServerService) FindAccountServers(request FindServersRequest) ([]Server, error) {
 	var servers []Server
-	serverModels, err := s.serverStorage.FindAllByAccountID(accountID)
+	serverModels, err := s.serverStorage.FindAllByAccountID(request.AccountID)
+
+	if err != nil {
+		return servers, fmt.Errorf("could not get account %d servers", request.AccountID)
+	}
+
+	serverIDs := make([]uint, 0, len(serverModels))
+
+	for _, serverModel := range serverModels {
+		serverIDs = append(serverIDs, serverModel.ID)
+	}
+
+	tags, err := s.tagStorage.FindByServerIDs(serverIDs)
+
+	if err != nil {
+		return servers, err
+	}
+
+	groupIDs, err := s.groupStorage.FindGroupIDsByServerIDs(serverIDs)
+
+	if err != nil {
+		return servers, err
+	}
+
+	windows, err := s.maintenance.ActiveWindows(serverModels)
 
 	if err != nil {
-		return servers, fmt.Errorf("could not get account %d servers", accountID)
+		return servers, err
 	}
 
 	for _, serverModel := range serverModels {
-		servers = append(servers, *createServer(&serverModel))
+		server := createServer(&serverModel)
+		server.Tags = tags[serverModel.ID]
+		server.Maintenance = windows[serverModel.ID]
+		server.Groups = []int{}
+
+		for _, groupID := range groupIDs[serverModel.ID] {
+			server.Groups = append(server.Groups, int(groupID))
+		}
+
+		if request.GroupID != 0 && !slices.Contains(server.Groups, request.GroupID) {
+			continue
+		}
+
+		if !containsAll(server.Tags, request.Tags) {
+			continue
+		}
+
+		servers = append(servers, *server)
 	}
 
 	return servers, nil
 }
 
-func (s ServerService) GetServerDetailsByGuid(request GetServerDetailsRequest) (*ServerDetails, error) {
+func (s ServerService) GetServerDetailsByGuid(ctx context.Context, request GetServerDetailsRequest) (*ServerDetails, error) {
 	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
 
 	if err != nil {
@@ -59,12 +131,17 @@ func (s ServerService) GetServerDetailsByGuid(request GetServerDetailsRequest) (
 		return nil, err
 	}
 
-	data, err := nAgent.GetServerData()
+	data, err := nAgent.GetServerData(ctx)
 	connErr := agent.ConnectionError{}
+	fingerprintErr := agent.ErrFingerprintMismatch{}
 
 	if err != nil {
 		s.logger.Debug(err.Error())
 
+		if errors.As(err, &fingerprintErr) {
+			return nil, fingerprintErr
+		}
+
 		if errors.As(err, &connErr) {
 			serverModel.IsActive = 0
 			s.serverStorage.Save(serverModel) // nolint:errcheck
@@ -86,7 +163,13 @@ func (s ServerService) GetServerDetailsByGuid(request GetServerDetailsRequest) (
 		return nil, err
 	}
 
-	vhosts, err := nAgent.GetVhosts()
+	vhosts, err := nAgent.GetVhosts(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := s.maintenance.ServerWindows(serverModel)
 
 	if err != nil {
 		return nil, err
@@ -102,13 +185,93 @@ func (s ServerService) GetServerDetailsByGuid(request GetServerDetailsRequest) (
 		KernelArch:     data.KernelArch,
 		Uptime:         data.Uptime,
 		BootTime:       data.BootTime,
-		Domains:        createDomains(vhosts),
+		Domains:        domainService.CreateDomains(createDomains(vhosts), windows),
 		Settings:       data.Settings,
+		CircuitBreaker: nAgent.BreakerState(),
 	}
+	serverDetails.ConnectedAddress, serverDetails.AddressFamily = nAgent.ConnectedAddress()
+	serverDetails.Maintenance = windows
 
 	return &serverDetails, nil
 }
 
+// GetServerAvailability calculates server availability for the period from the history of monitor probes
+func (s ServerService) GetServerAvailability(request GetServerAvailabilityRequest) (*ServerAvailability, error) {
+	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(request.AccountID) {
+		return nil, ErrServerNotFound
+	}
+
+	probes, err := s.probeStorage.FindByServerID(int(serverModel.ID), time.Now().Add(-request.Period))
+
+	if err != nil {
+		return nil, err
+	}
+
+	lastOnlineProbe, err := s.probeStorage.FindLastOnline(int(serverModel.ID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	availability := ServerAvailability{
+		ProbesCount: len(probes),
+		Outages:     []Outage{},
+	}
+
+	if lastOnlineProbe != nil {
+		availability.LastSeenAt = &lastOnlineProbe.CreatedAt
+	}
+
+	var (
+		onlineCount int
+		outage      *Outage
+	)
+
+	for _, probe := range probes {
+		if probe.IsOnline == 1 {
+			onlineCount++
+
+			if outage != nil {
+				endedAt := probe.CreatedAt
+				outage.EndedAt = &endedAt
+				outage.Duration = int64(endedAt.Sub(outage.StartedAt).Seconds())
+				availability.Outages = append(availability.Outages, *outage)
+				outage = nil
+			}
+
+			continue
+		}
+
+		if outage == nil {
+			outage = &Outage{
+				StartedAt: probe.CreatedAt,
+				Error:     probe.Error,
+			}
+		}
+	}
+
+	if outage != nil {
+		outage.Duration = int64(time.Since(outage.StartedAt).Seconds())
+		availability.Outages = append(availability.Outages, *outage)
+	}
+
+	if len(probes) > 0 {
+		availability.UptimePercentage = math.Round(float64(onlineCount)/float64(len(probes))*10000) / 100
+	}
+
+	// the most recent outages go first
+	slices.Reverse(availability.Outages)
+	availability.Outages = availability.Outages[:min(len(availability.Outages), maxRecentOutages)]
+
+	return &availability, nil
+}
+
 func (s ServerService) FindServerByGuid(request FindServerByGuid) (*Server, error) {
 	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
 
@@ -120,7 +283,13 @@ func (s ServerService) FindServerByGuid(request FindServerByGuid) (*Server, erro
 		return nil, ErrServerNotFound
 	}
 
-	return createServer(serverModel), nil
+	server := createServer(serverModel)
+
+	if server.Maintenance, err = s.maintenance.ServerWindows(serverModel); err != nil {
+		return nil, err
+	}
+
+	return server, nil
 }
 
 func (s ServerService) RemoveServer(request RemoveServerRequest) error {
@@ -134,30 +303,31 @@ func (s ServerService) RemoveServer(request RemoveServerRequest) error {
 		return ErrServerNotFound
 	}
 
-	return s.serverStorage.Remove(serverModel)
-}
-
-func (s ServerService) AddServer(request NewServerRequest) error {
-	if request.Ipv4Address == "" && request.Ipv6Address == "" {
-		return errors.New("ipv4 address must be specified")
+	if err = s.serverStorage.Remove(serverModel); err != nil {
+		return err
 	}
 
-	count, err := s.serverStorage.FindCountByIP(request.Ipv4Address, request.Ipv6Address, nil)
+	s.agentProvider.Invalidate(serverModel.ID)
 
-	if err != nil {
+	return nil
+}
+
+func (s ServerService) AddServer(request NewServerRequest) error {
+	if err := s.validateNewServer(request); err != nil {
 		return err
 	}
 
-	if count > 0 {
-		return errors.New("server with the specified ipv4 address already exists")
-	}
+	connectionMode, _ := getConnectionMode(request.ConnectionMode)
 
 	serverModel := &serverStorage.Server{
-		Name:        request.Name,
-		Ipv4Address: request.Ipv4Address,
-		Ipv6Address: request.Ipv6Address,
-		AgentPort:   request.AgentPort,
-		Token:       request.Token,
+		Name:           request.Name,
+		Ipv4Address:    request.Ipv4Address,
+		Ipv6Address:    request.Ipv6Address,
+		AgentPort:      request.AgentPort,
+		Token:          request.Token,
+		TlsEnabled:     boolToUint8(request.TlsEnabled),
+		SignedRequests: boolToUint8(request.SignedRequests),
+		ConnectionMode: connectionMode,
 	}
 	guid, err := generateToken(serverTokenLength)
 
@@ -179,19 +349,52 @@ func (s ServerService) AddServer(request NewServerRequest) error {
 	return s.serverStorage.Save(serverModel)
 }
 
-func (s ServerService) UpdateServer(request UpdateServerRequest) error {
-	if request.Ipv4Address == "" && request.Ipv6Address == "" {
+func (s ServerService) validateNewServer(request NewServerRequest) error {
+	connectionMode, err := getConnectionMode(request.ConnectionMode)
+
+	if err != nil {
+		return err
+	}
+
+	return s.validateServerAddress(connectionMode, request.Ipv4Address, request.Ipv6Address, nil)
+}
+
+// validateServerAddress requires a unique address of a server the panel connects to.
+// Agents in the tunnel mode connect to the panel themselves, their addresses are informational
+// and private addresses of servers behind different NATs may be the same.
+func (s ServerService) validateServerAddress(connectionMode, ipv4, ipv6 string, excludeIds []int) error {
+	if connectionMode == serverStorage.ConnectionModeTunnel {
+		return nil
+	}
+
+	if ipv4 == "" && ipv6 == "" {
 		return errors.New("ipv4 address must be specified")
 	}
 
-	count, err := s.serverStorage.FindCountByIP(request.Ipv4Address, request.Ipv6Address, []int{request.ID})
+	count, err := s.serverStorage.FindCountByIP(ipv4, ipv6, excludeIds)
 
 	if err != nil {
 		return err
 	}
 
 	if count > 0 {
-		return errors.New("server with the specified ipv4address already exists")
+		return errors.New("server with the specified ipv4 address already exists")
+	}
+
+	return nil
+}
+
+func (s ServerService) UpdateServer(request UpdateServerRequest) error {
+	connectionMode, err := getConnectionMode(request.ConnectionMode)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.validateServerAddress(connectionMode, request.Ipv4Address, request.Ipv6Address, []int{request.ID})
+
+	if err != nil {
+		return err
 	}
 
 	serverModel, err := s.serverStorage.FindByID(request.ID)
@@ -204,10 +407,18 @@ func (s ServerService) UpdateServer(request UpdateServerRequest) error {
 		return ErrServerNotFound
 	}
 
+	connectionChanged := serverModel.Ipv4Address != request.Ipv4Address ||
+		serverModel.Ipv6Address != request.Ipv6Address ||
+		serverModel.TlsEnabled != boolToUint8(request.TlsEnabled) ||
+		serverModel.SignedRequests != boolToUint8(request.SignedRequests) ||
+		serverModel.UsesTunnel() != (connectionMode == serverStorage.ConnectionModeTunnel)
+
 	serverModel.Name = request.Name
+	serverModel.ConnectionMode = connectionMode
 	serverModel.Ipv4Address = request.Ipv4Address
 	serverModel.Ipv6Address = request.Ipv6Address
-	serverModel.Token = request.Token
+	serverModel.TlsEnabled = boolToUint8(request.TlsEnabled)
+	serverModel.SignedRequests = boolToUint8(request.SignedRequests)
 
 	agentPort := request.AgentPort
 
@@ -215,12 +426,42 @@ func (s ServerService) UpdateServer(request UpdateServerRequest) error {
 		agentPort = s.config.AgentPort
 	}
 
+	connectionChanged = connectionChanged || serverModel.AgentPort != agentPort
 	serverModel.AgentPort = agentPort
 
-	return s.serverStorage.Save(serverModel)
+	if err = s.serverStorage.Save(serverModel); err != nil {
+		return err
+	}
+
+	if connectionChanged {
+		s.agentProvider.Invalidate(serverModel.ID)
+	}
+
+	return nil
+}
+
+func (s ServerService) UpdateServerToken(request UpdateServerTokenRequest) error {
+	serverModel, err := s.serverStorage.FindByID(request.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(request.AccountID) {
+		return ErrServerNotFound
+	}
+
+	// a token set by hand is not a rotation, the rotation time is changed only by the token rotator
+	if err = s.serverStorage.UpdateToken(request.ID, request.Token); err != nil {
+		return err
+	}
+
+	s.agentProvider.Invalidate(serverModel.ID)
+
+	return nil
 }
 
-func (s ServerService) ChangeCertbotStatus(request ChangeCretbotStatusRequest) (string, error) {
+func (s ServerService) ChangeCertbotStatus(ctx context.Context, request ChangeCretbotStatusRequest) (string, error) {
 	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
 
 	if err != nil {
@@ -231,6 +472,10 @@ func (s ServerService) ChangeCertbotStatus(request ChangeCretbotStatusRequest) (
 		return "", ErrServerNotFound
 	}
 
+	if err = checkMaintenance(s.maintenance, serverModel, request.Force, s.logger); err != nil {
+		return "", err
+	}
+
 	nAgent, err := s.getServerAgent(serverModel)
 
 	if err != nil {
@@ -241,7 +486,7 @@ func (s ServerService) ChangeCertbotStatus(request ChangeCretbotStatusRequest) (
 		Value: request.Value,
 	}
 
-	responseData, err := nAgent.ChangeCertbotStatus(requestData)
+	responseData, err := nAgent.ChangeCertbotStatus(ctx, requestData)
 
 	if err != nil {
 		return "", err
@@ -250,25 +495,148 @@ func (s ServerService) ChangeCertbotStatus(request ChangeCretbotStatusRequest) (
 	return responseData.Version, nil
 }
 
+func (s ServerService) GetServerFeatures(ctx context.Context, request GetServerFeaturesRequest) (*ServerFeatures, error) {
+	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(request.AccountID) {
+		return nil, ErrServerNotFound
+	}
+
+	nAgent, err := s.getServerAgent(serverModel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities, err := nAgent.Capabilities(ctx)
+
+	if err != nil {
+		if errors.As(err, &agent.ConnectionError{}) {
+			return nil, ErrAgentConnection
+		}
+
+		return nil, err
+	}
+
+	features := map[string]bool{}
+
+	for feature, commands := range panelFeatures {
+		supported := true
+
+		for _, command := range commands {
+			if !capabilities.SupportsCommand(command) {
+				supported = false
+
+				break
+			}
+		}
+
+		features[feature] = supported
+	}
+
+	return &ServerFeatures{
+		AgentVersion:    capabilities.AgentVersion,
+		ProtocolVersion: capabilities.ProtocolVersion,
+		Commands:        capabilities.Commands,
+		Features:        features,
+	}, nil
+}
+
+// PinAgentCertificate returns the fingerprint of the certificate presented by the agent for the operator to confirm.
+// The certificate is pinned once the operator sends the confirmed fingerprint back.
+func (s ServerService) PinAgentCertificate(ctx context.Context, request PinAgentCertificateRequest) (*AgentCertificatePin, error) {
+	serverModel, err := s.serverStorage.FindByGuid(request.ServerGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil || serverModel.AccountID != uint(request.AccountID) {
+		return nil, ErrServerNotFound
+	}
+
+	if request.Fingerprint == "" {
+		fingerprint, err := s.agentProvider.ProbeCertificate(ctx, serverModel)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &AgentCertificatePin{Fingerprint: fingerprint}, nil
+	}
+
+	fingerprint, err := s.agentProvider.PinCertificate(ctx, serverModel, request.Fingerprint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &AgentCertificatePin{Fingerprint: fingerprint, Pinned: true}, nil
+}
+
 func createServer(server *serverStorage.Server) *Server {
+	connectionMode := serverStorage.ConnectionModeDirect
+
+	if server.UsesTunnel() {
+		connectionMode = serverStorage.ConnectionModeTunnel
+	}
+
 	return &Server{
-		ID:           int(server.ID),
-		Guid:         server.Guid,
-		Name:         server.Name,
-		OsCode:       server.OsCode,
-		OsVersion:    server.OsVersion,
-		Ipv4Address:  server.Ipv4Address,
-		Ipv6Address:  server.Ipv6Address,
-		AgentVersion: server.AgentVersion,
-		AgentPort:    server.AgentPort,
-		IsActive:     int(server.IsActive),
-		IsRegistered: int(server.IsRegistered),
-		AccountID:    int(server.AccountID),
-		CreatedAt:    server.CreatedAt,
-		Token:        server.Token,
+		ID:             int(server.ID),
+		Guid:           server.Guid,
+		Name:           server.Name,
+		OsCode:         server.OsCode,
+		OsVersion:      server.OsVersion,
+		Ipv4Address:    server.Ipv4Address,
+		Ipv6Address:    server.Ipv6Address,
+		AgentVersion:   server.AgentVersion,
+		AgentPort:      server.AgentPort,
+		IsActive:       int(server.IsActive),
+		IsRegistered:   int(server.IsRegistered),
+		TlsEnabled:     int(server.TlsEnabled),
+		TlsFingerprint: server.TlsFingerprint,
+		SignedRequests: int(server.SignedRequests),
+		ConnectionMode: connectionMode,
+		TokenRotatedAt: server.TokenRotatedAt,
+		AccountID:      int(server.AccountID),
+		CreatedAt:      server.CreatedAt,
+	}
+}
+
+// getConnectionMode validates the requested connection mode, the direct mode is the default one
+func getConnectionMode(mode string) (string, error) {
+	switch mode {
+	case "", serverStorage.ConnectionModeDirect:
+		return serverStorage.ConnectionModeDirect, nil
+	case serverStorage.ConnectionModeTunnel:
+		return serverStorage.ConnectionModeTunnel, nil
+	default:
+		return "", ErrInvalidConnectionMode
 	}
 }
 
+func containsAll(values, required []string) bool {
+	for _, value := range required {
+		if !slices.Contains(values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func boolToUint8(value bool) uint8 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
 func generateToken(length int) (string, error) {
 	b := make([]byte, length)
 	_, err := rand.Read(b)
@@ -281,13 +649,20 @@ func generateToken(length int) (string, error) {
 }
 
 func (s ServerService) getServerAgent(server *serverStorage.Server) (*agent.Agent, error) {
-	return agent.NewAgent(
-		server.Ipv4Address,
-		server.Ipv6Address,
-		server.Token,
-		server.AgentPort,
-		s.logger,
-	)
+	return s.agentProvider.GetAgent(server)
+}
+
+// checkMaintenance returns the maintenance error of an operation that changes the server unless the operation is forced
+func checkMaintenance(checker maintenance.Checker, server *serverStorage.Server, force bool, logger logger.Logger) error {
+	err := checker.Check(server, "")
+
+	if errors.Is(err, maintenance.ErrInMaintenance) && force {
+		logger.Info(fmt.Sprintf("operation is forced during maintenance, server: %s", server.Name))
+
+		return nil
+	}
+
+	return err
 }
 
 func createDomains(vhosts []agentintegration.VirtualHost) []dto.Domain {
@@ -306,10 +681,24 @@ func createDomains(vhosts []agentintegration.VirtualHost) []dto.Domain {
 	return domains
 }
 
-func NewServerService(config *config.Config, serverStorage serverStorage.ServerStorage, logger logger.Logger) ServerService {
+func NewServerService(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	probeStorage serverStorage.ProbeStorage,
+	groupStorage serverStorage.ServerGroupStorage,
+	tagStorage serverStorage.ServerTagStorage,
+	agentProvider *agentprovider.AgentProvider,
+	maintenanceChecker maintenance.Checker,
+	logger logger.Logger,
+) ServerService {
 	return ServerService{
 		config:        config,
 		serverStorage: serverStorage,
+		probeStorage:  probeStorage,
+		groupStorage:  groupStorage,
+		tagStorage:    tagStorage,
+		agentProvider: agentProvider,
+		maintenance:   maintenanceChecker,
 		logger:        logger,
 	}
 }
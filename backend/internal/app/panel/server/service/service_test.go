@@ -0,0 +1,195 @@
+package service
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent/fakeagent"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+func TestGetServerDetailsByGuid(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	fAgent.SetServerData(agentintegration.ServerData{
+		HostName:        "example",
+		Platform:        "debian",
+		PlatformVersion: "12",
+		AgentVersion:    "1.2.0",
+	})
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{ServerName: "example.com", WebServer: "nginx"},
+		{ServerName: "localhost", WebServer: "nginx"},
+	})
+
+	env := createTestEnv(t)
+	service, storage := env.serverService(), env.serverStorage
+	ip, port := fAgent.Address()
+	server := env.addServer(t, ip, port)
+
+	details, err := service.GetServerDetailsByGuid(context.Background(), GetServerDetailsRequest{
+		ServerGuid: server.Guid,
+		AccountID:  1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.HostName != "example" || details.AgentVersion != "1.2.0" || details.IsActive != 1 {
+		t.Errorf("unexpected server details: %+v", details)
+	}
+
+	if len(details.Domains) != 1 || details.Domains[0].ServerName != "example.com" {
+		t.Errorf("unexpected domains: %+v", details.Domains)
+	}
+
+	stored, _ := storage.FindByID(int(server.ID))
+
+	if stored.OsCode != "debian" || stored.OsVersion != "12" || stored.IsActive != 1 {
+		t.Errorf("server is not updated: %+v", stored)
+	}
+}
+
+func TestGetServerDetailsByGuidAgentOffline(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := createTestEnv(t)
+	service, storage := env.serverService(), env.serverStorage
+	ip, port := fAgent.Address()
+	server := env.addServer(t, ip, port)
+	server.IsActive = 1
+	storage.Save(server) // nolint:errcheck
+	fAgent.Close()
+
+	_, err = service.GetServerDetailsByGuid(context.Background(), GetServerDetailsRequest{
+		ServerGuid: server.Guid,
+		AccountID:  1,
+	})
+
+	if !errors.Is(err, ErrAgentConnection) {
+		t.Fatalf("expected agent connection error, got %v", err)
+	}
+
+	stored, _ := storage.FindByID(int(server.ID))
+
+	if stored.IsActive != 0 {
+		t.Error("server must be marked as inactive")
+	}
+}
+
+func TestGetServerDetailsByGuidInvalidToken(t *testing.T) {
+	fAgent, err := fakeagent.Start("another-token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	env := createTestEnv(t)
+	service := env.serverService()
+	ip, port := fAgent.Address()
+	server := env.addServer(t, ip, port)
+
+	_, err = service.GetServerDetailsByGuid(context.Background(), GetServerDetailsRequest{
+		ServerGuid: server.Guid,
+		AccountID:  1,
+	})
+
+	if err == nil || err.Error() != "invalid token" {
+		t.Fatalf("expected invalid token error, got %v", err)
+	}
+}
+
+func TestGetServerDetailsByGuidSignedRequests(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	fAgent.SetVhosts([]agentintegration.VirtualHost{})
+	env := createTestEnv(t)
+	service, storage := env.serverService(), env.serverStorage
+	ip, port := fAgent.Address()
+	server := env.addServer(t, ip, port)
+	server.SignedRequests = 1
+	storage.Save(server) // nolint:errcheck
+
+	_, err = service.GetServerDetailsByGuid(context.Background(), GetServerDetailsRequest{
+		ServerGuid: server.Guid,
+		AccountID:  1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, request := range fAgent.Requests() {
+		if !request.Signed || request.Token != "" {
+			t.Errorf("request %s must be signed and must not contain the token", request.Command)
+		}
+	}
+}
+
+func TestGetServerAvailability(t *testing.T) {
+	env := createTestEnv(t)
+	service, probeStorage := env.serverService(), env.probeStorage
+	server := env.addServer(t, "127.0.0.1", 60150)
+	start := time.Now().Add(-time.Hour)
+
+	for i, isOnline := range []uint8{1, 1, 0, 0, 1, 1, 1, 0} {
+		probeStorage.Create(&serverStorage.ServerProbe{ // nolint:errcheck
+			ServerID:  server.ID,
+			IsOnline:  isOnline,
+			Error:     "connection refused",
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	availability, err := service.GetServerAvailability(GetServerAvailabilityRequest{
+		ServerGuid: server.Guid,
+		Period:     24 * time.Hour,
+		AccountID:  1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if availability.ProbesCount != 8 || availability.UptimePercentage != 62.5 {
+		t.Errorf("unexpected availability: %+v", availability)
+	}
+
+	if availability.LastSeenAt == nil || !availability.LastSeenAt.Equal(start.Add(6*time.Minute)) {
+		t.Errorf("unexpected last seen time: %v", availability.LastSeenAt)
+	}
+
+	if len(availability.Outages) != 2 {
+		t.Fatalf("expected two outages, got %+v", availability.Outages)
+	}
+
+	if ongoing := availability.Outages[0]; ongoing.EndedAt != nil || !ongoing.StartedAt.Equal(start.Add(7*time.Minute)) {
+		t.Errorf("unexpected ongoing outage: %+v", ongoing)
+	}
+
+	if ended := availability.Outages[1]; ended.EndedAt == nil || ended.Duration != 120 {
+		t.Errorf("unexpected ended outage: %+v", ended)
+	}
+}
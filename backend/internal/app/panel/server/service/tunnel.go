@@ -0,0 +1,93 @@
+package service
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/logger"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+var (
+	ErrTunnelUnauthorized = errors.New("invalid server or signature")
+	ErrTunnelModeDisabled = errors.New("server is not in the tunnel connection mode")
+)
+
+// TunnelService accepts tunnels opened by agents of servers in the tunnel connection mode
+type TunnelService struct {
+	config        *config.Config
+	serverStorage serverStorage.ServerStorage
+	agentProvider *agentprovider.AgentProvider
+	logger        logger.Logger
+	// nonces of accepted tunnel signatures, a replayed signature is rejected
+	nonces *agent.NonceCache
+}
+
+// Authenticate returns the server the agent opens the tunnel for if the signature is made with the server token
+func (s TunnelService) Authenticate(serverGuid string, signature agent.TunnelSignature) (*serverStorage.Server, error) {
+	if serverGuid == "" {
+		return nil, ErrTunnelUnauthorized
+	}
+
+	serverModel, err := s.serverStorage.FindByGuid(serverGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serverModel == nil {
+		return nil, ErrTunnelUnauthorized
+	}
+
+	now := time.Now()
+
+	if err = signature.Verify(serverModel.Guid, serverModel.Token, now); err != nil {
+		return nil, ErrTunnelUnauthorized
+	}
+
+	if !s.nonces.Add(signature.Nonce, now) {
+		return nil, ErrTunnelUnauthorized
+	}
+
+	if !serverModel.UsesTunnel() {
+		return nil, ErrTunnelModeDisabled
+	}
+
+	return serverModel, nil
+}
+
+// ServeTunnel registers the tunnel of the server and serves it until it is closed.
+// A tunnel opened again by the same agent replaces the previous one.
+func (s TunnelService) ServeTunnel(serverModel *serverStorage.Server, conn *websocket.Conn, remoteIP string) {
+	tunnel := agent.NewTunnel(conn, remoteIP, s.config.AgentMaxResponseSize)
+	tunnels := s.agentProvider.Tunnels()
+	tunnels.Register(serverModel.ID, tunnel)
+	// the agent may have been restarted or upgraded, so its cached capabilities and circuit breaker are reset
+	s.agentProvider.Invalidate(serverModel.ID)
+	s.logger.Info(fmt.Sprintf("agent tunnel of server %s opened from %s", serverModel.Name, tunnel.RemoteIP()))
+
+	tunnel.Serve()
+
+	tunnels.Remove(serverModel.ID, tunnel)
+	s.logger.Info(fmt.Sprintf("agent tunnel of server %s closed", serverModel.Name))
+}
+
+func NewTunnelService(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	agentProvider *agentprovider.AgentProvider,
+	logger logger.Logger,
+) TunnelService {
+	return TunnelService{
+		config:        config,
+		serverStorage: serverStorage,
+		agentProvider: agentProvider,
+		logger:        logger,
+		nonces:        agent.NewNonceCache(),
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/agent/fakeagent"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+	"golang.org/x/net/websocket"
+)
+
+// startTestTunnelEndpoint serves the tunnel service like the panel API does
+func startTestTunnelEndpoint(t *testing.T, service TunnelService) string {
+	t.Helper()
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server, err := service.Authenticate(r.Header.Get(agent.TunnelServerHeader), agent.ReadTunnelSignature(r.Header))
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+
+			return
+		}
+
+		websocket.Server{
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(conn *websocket.Conn) {
+				service.ServeTunnel(server, conn, "")
+			},
+		}.ServeHTTP(w, r)
+	}))
+	t.Cleanup(endpoint.Close)
+
+	return "ws" + strings.TrimPrefix(endpoint.URL, "http")
+}
+
+func TestTunnelServerDetails(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	fAgent.SetServerData(agentintegration.ServerData{HostName: "behind-nat", AgentVersion: "1.3.0"})
+	fAgent.SetVhosts([]agentintegration.VirtualHost{{ServerName: "example.com", WebServer: "nginx"}})
+
+	env := createTestEnv(t)
+	service, storage, provider := env.serverService(), env.serverStorage, env.provider
+	server := &serverStorage.Server{
+		Name:           "nat",
+		Ipv4Address:    "192.168.1.10",
+		Token:          testToken,
+		ConnectionMode: serverStorage.ConnectionModeTunnel,
+		AccountID:      1,
+	}
+	storage.Save(server) // nolint:errcheck
+
+	request := GetServerDetailsRequest{ServerGuid: server.Guid, AccountID: 1}
+
+	if _, err = service.GetServerDetailsByGuid(context.Background(), request); !errors.Is(err, ErrAgentConnection) {
+		t.Fatalf("expected agent connection error without a tunnel, got %v", err)
+	}
+
+	url := startTestTunnelEndpoint(t, env.tunnelService())
+
+	if err = fAgent.DialTunnel(url, server.Guid); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for provider.Tunnels().Get(server.ID) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel is not registered")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	details, err := service.GetServerDetailsByGuid(context.Background(), request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.HostName != "behind-nat" || details.ConnectionMode != serverStorage.ConnectionModeTunnel {
+		t.Errorf("unexpected server details: %+v", details)
+	}
+
+	if len(details.Domains) != 1 || details.ConnectedAddress != "127.0.0.1" {
+		t.Errorf("unexpected domains or connected address: %+v, %s", details.Domains, details.ConnectedAddress)
+	}
+}
+
+func TestTunnelAuthentication(t *testing.T) {
+	env := createTestEnv(t)
+	service, storage := env.tunnelService(), env.serverStorage
+	tunnelServer := &serverStorage.Server{Name: "nat", Token: testToken, ConnectionMode: serverStorage.ConnectionModeTunnel}
+	directServer := &serverStorage.Server{Name: "direct", Ipv4Address: "10.0.0.1", Token: testToken}
+	storage.Save(tunnelServer) // nolint:errcheck
+	storage.Save(directServer) // nolint:errcheck
+
+	sign := func(serverGuid, token string) agent.TunnelSignature {
+		signature, err := agent.SignTunnel(serverGuid, token)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return *signature
+	}
+
+	if _, err := service.Authenticate(tunnelServer.Guid, sign(tunnelServer.Guid, "another-token")); !errors.Is(err, ErrTunnelUnauthorized) {
+		t.Errorf("expected unauthorized error for an invalid token, got %v", err)
+	}
+
+	// a signature of one server can not open the tunnel of another server with the same token
+	if _, err := service.Authenticate(tunnelServer.Guid, sign(directServer.Guid, testToken)); !errors.Is(err, ErrTunnelUnauthorized) {
+		t.Errorf("expected unauthorized error for a signature of another server, got %v", err)
+	}
+
+	if _, err := service.Authenticate(directServer.Guid, sign(directServer.Guid, testToken)); !errors.Is(err, ErrTunnelModeDisabled) {
+		t.Errorf("expected tunnel mode error for a direct server, got %v", err)
+	}
+
+	signature := sign(tunnelServer.Guid, testToken)
+
+	if server, err := service.Authenticate(tunnelServer.Guid, signature); err != nil || server.ID != tunnelServer.ID {
+		t.Errorf("expected the tunnel server, got %v, %v", server, err)
+	}
+
+	if _, err := service.Authenticate(tunnelServer.Guid, signature); !errors.Is(err, ErrTunnelUnauthorized) {
+		t.Errorf("expected unauthorized error for a replayed signature, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"backend/config"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/app/panel/server/upgrade"
+	"backend/internal/pkg/logger"
+	"errors"
+	"fmt"
+)
+
+const defaultUpgradeFailureThreshold = 1
+
+var (
+	ErrAgentUpgradeNotFound  = errors.New("agent upgrade not found")
+	ErrAgentUpgradeNoServers = errors.New("there are no servers to upgrade")
+	ErrAgentUpgradeFinished  = errors.New("agent upgrade is already finished")
+)
+
+// AgentUpgradeService creates agent upgrades of account servers and reports their progress.
+// Upgrades are executed by the upgrade orchestrator in background.
+type AgentUpgradeService struct {
+	config         *config.Config
+	serverStorage  serverStorage.ServerStorage
+	upgradeStorage serverStorage.AgentUpgradeStorage
+	orchestrator   *upgrade.Orchestrator
+	logger         logger.Logger
+}
+
+// CreateAgentUpgrade starts the upgrade of the listed account servers or of all account servers if none are listed
+func (s AgentUpgradeService) CreateAgentUpgrade(request CreateAgentUpgradeRequest) (*AgentUpgrade, error) {
+	serverModels, err := s.findServers(request.AccountID, request.ServerGuids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(serverModels) == 0 {
+		return nil, ErrAgentUpgradeNoServers
+	}
+
+	upgradeModel := &serverStorage.AgentUpgrade{
+		AccountID:        uint(request.AccountID),
+		TargetVersion:    request.Version,
+		Concurrency:      request.Concurrency,
+		FailureThreshold: request.FailureThreshold,
+		Status:           serverStorage.AgentUpgradePending,
+		CreatedBy:        uint(request.UserID),
+	}
+
+	if upgradeModel.Concurrency == 0 {
+		upgradeModel.Concurrency = s.config.AgentUpgradeConcurrency
+	}
+
+	if upgradeModel.FailureThreshold == 0 {
+		upgradeModel.FailureThreshold = defaultUpgradeFailureThreshold
+	}
+
+	upgradeServers := make([]serverStorage.AgentUpgradeServer, 0, len(serverModels))
+
+	for i, serverModel := range serverModels {
+		upgradeServers = append(upgradeServers, serverStorage.AgentUpgradeServer{
+			ServerID:        serverModel.ID,
+			Batch:           i / upgradeModel.Concurrency,
+			Status:          serverStorage.AgentUpgradeServerPending,
+			PreviousVersion: serverModel.AgentVersion,
+		})
+	}
+
+	if err = s.upgradeStorage.Create(upgradeModel, upgradeServers); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(fmt.Sprintf(
+		"agent upgrade %d to version %s created, account: %d, user: %d, servers: %d",
+		upgradeModel.ID,
+		upgradeModel.TargetVersion,
+		request.AccountID,
+		request.UserID,
+		len(upgradeServers),
+	))
+	s.orchestrator.Start(upgradeModel.ID)
+
+	return s.createAgentUpgrade(upgradeModel, upgradeServers, false), nil
+}
+
+func (s AgentUpgradeService) FindAgentUpgrades(accountID int) ([]AgentUpgrade, error) {
+	upgradeModels, err := s.upgradeStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get account %d agent upgrades", accountID)
+	}
+
+	upgrades := []AgentUpgrade{}
+
+	for _, upgradeModel := range upgradeModels {
+		upgradeServers, err := s.upgradeStorage.FindServers(int(upgradeModel.ID))
+
+		if err != nil {
+			return nil, err
+		}
+
+		upgrades = append(upgrades, *s.createAgentUpgrade(&upgradeModel, upgradeServers, false))
+	}
+
+	return upgrades, nil
+}
+
+// GetAgentUpgrade returns the upgrade along with the progress of every server
+func (s AgentUpgradeService) GetAgentUpgrade(request AgentUpgradeRequest) (*AgentUpgrade, error) {
+	upgradeModel, err := s.findUpgrade(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeServers, err := s.upgradeStorage.FindServers(int(upgradeModel.ID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createAgentUpgrade(upgradeModel, upgradeServers, true), nil
+}
+
+// CancelAgentUpgrade stops the upgrade after servers that are being upgraded are finished
+func (s AgentUpgradeService) CancelAgentUpgrade(request AgentUpgradeRequest) error {
+	upgradeModel, err := s.findUpgrade(request)
+
+	if err != nil {
+		return err
+	}
+
+	if upgradeModel.IsFinished() {
+		return ErrAgentUpgradeFinished
+	}
+
+	return s.orchestrator.Cancel(upgradeModel.ID)
+}
+
+func (s AgentUpgradeService) findUpgrade(request AgentUpgradeRequest) (*serverStorage.AgentUpgrade, error) {
+	upgradeModel, err := s.upgradeStorage.FindByID(request.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if upgradeModel == nil || upgradeModel.AccountID != uint(request.AccountID) {
+		return nil, ErrAgentUpgradeNotFound
+	}
+
+	return upgradeModel, nil
+}
+
+func (s AgentUpgradeService) findServers(accountID int, guids []string) ([]serverStorage.Server, error) {
+	if len(guids) == 0 {
+		return s.serverStorage.FindAllByAccountID(accountID)
+	}
+
+	var serverModels []serverStorage.Server
+
+	for _, guid := range guids {
+		serverModel, err := s.serverStorage.FindByGuid(guid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if serverModel == nil || serverModel.AccountID != uint(accountID) {
+			return nil, fmt.Errorf("%w: %s", ErrServerNotFound, guid)
+		}
+
+		serverModels = append(serverModels, *serverModel)
+	}
+
+	return serverModels, nil
+}
+
+func (s AgentUpgradeService) createAgentUpgrade(
+	upgradeModel *serverStorage.AgentUpgrade,
+	upgradeServers []serverStorage.AgentUpgradeServer,
+	withServers bool,
+) *AgentUpgrade {
+	upgrade := &AgentUpgrade{
+		ID:               int(upgradeModel.ID),
+		TargetVersion:    upgradeModel.TargetVersion,
+		Concurrency:      upgradeModel.Concurrency,
+		FailureThreshold: upgradeModel.FailureThreshold,
+		Status:           upgradeModel.Status,
+		Error:            upgradeModel.Error,
+		Progress:         map[string]int{},
+		CreatedBy:        int(upgradeModel.CreatedBy),
+		CreatedAt:        upgradeModel.CreatedAt,
+		FinishedAt:       upgradeModel.FinishedAt,
+	}
+
+	for _, upgradeServer := range upgradeServers {
+		upgrade.Progress[upgradeServer.Status]++
+
+		if !withServers {
+			continue
+		}
+
+		server := AgentUpgradeServer{
+			ServerGuid:      serverStorage.GetServerGUIDByID(int(upgradeServer.ServerID)),
+			Batch:           upgradeServer.Batch,
+			Status:          upgradeServer.Status,
+			PreviousVersion: upgradeServer.PreviousVersion,
+			Version:         upgradeServer.Version,
+			Error:           upgradeServer.Error,
+			StartedAt:       upgradeServer.StartedAt,
+			FinishedAt:      upgradeServer.FinishedAt,
+		}
+
+		if serverModel, err := s.serverStorage.FindByID(int(upgradeServer.ServerID)); err == nil && serverModel != nil {
+			server.ServerName = serverModel.Name
+		}
+
+		upgrade.Servers = append(upgrade.Servers, server)
+	}
+
+	return upgrade
+}
+
+func NewAgentUpgradeService(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	upgradeStorage serverStorage.AgentUpgradeStorage,
+	orchestrator *upgrade.Orchestrator,
+	logger logger.Logger,
+) AgentUpgradeService {
+	return AgentUpgradeService{
+		config:         config,
+		serverStorage:  serverStorage,
+		upgradeStorage: upgradeStorage,
+		orchestrator:   orchestrator,
+		logger:         logger,
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import "time"
+
+const (
+	AgentUpgradePending   = "pending"
+	AgentUpgradeRunning   = "running"
+	AgentUpgradeCompleted = "completed"
+	AgentUpgradeFailed    = "failed"
+	AgentUpgradeCancelled = "cancelled"
+)
+
+const (
+	AgentUpgradeServerPending   = "pending"
+	AgentUpgradeServerUpgrading = "upgrading"
+	AgentUpgradeServerSucceeded = "succeeded"
+	AgentUpgradeServerFailed    = "failed"
+	AgentUpgradeServerSkipped   = "skipped"
+)
+
+// AgentUpgrade is a rollout of the agent version to account servers in batches of Concurrency servers.
+// The rollout stops once FailureThreshold servers fail to upgrade.
+type AgentUpgrade struct {
+	ID               uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID        uint
+	TargetVersion    string `gorm:"size:64"`
+	Concurrency      int
+	FailureThreshold int
+	Status           string `gorm:"size:16"`
+	Error            string `gorm:"size:1024"`
+	CreatedBy        uint
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	FinishedAt       *time.Time
+}
+
+func (u AgentUpgrade) IsFinished() bool {
+	return u.Status == AgentUpgradeCompleted || u.Status == AgentUpgradeFailed || u.Status == AgentUpgradeCancelled
+}
+
+// AgentUpgradeServer is the upgrade progress of a single server
+type AgentUpgradeServer struct {
+	ID              uint `gorm:"AUTO_INCREMENT;primary_key"`
+	UpgradeID       uint
+	ServerID        uint
+	Batch           int
+	Status          string `gorm:"size:16"`
+	PreviousVersion string `gorm:"size:64"`
+	Version         string `gorm:"size:64"`
+	Error           string `gorm:"size:1024"`
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+}
+
+type AgentUpgradeStorage interface {
+	// Create saves the upgrade along with its servers
+	Create(upgrade *AgentUpgrade, servers []AgentUpgradeServer) error
+	FindByID(id int) (*AgentUpgrade, error)
+	FindAllByAccountID(accountID int) ([]AgentUpgrade, error)
+	FindAllByStatus(status string) ([]AgentUpgrade, error)
+	// FindServers returns servers of the upgrade ordered by batch
+	FindServers(upgradeID int) ([]AgentUpgradeServer, error)
+	UpdateStatus(id int, status, message string, finishedAt *time.Time) error
+	SaveServer(server *AgentUpgradeServer) error
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type agentUpgradeSqlStorage struct {
+	db *gorm.DB
+}
+
+func (s agentUpgradeSqlStorage) Create(upgrade *AgentUpgrade, servers []AgentUpgradeServer) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(upgrade).Error; err != nil {
+			return fmt.Errorf("could not create agent upgrade: %v", err)
+		}
+
+		for i := range servers {
+			servers[i].UpgradeID = upgrade.ID
+		}
+
+		if len(servers) == 0 {
+			return nil
+		}
+
+		if err := tx.Create(&servers).Error; err != nil {
+			return fmt.Errorf("could not create servers of agent upgrade: %v", err)
+		}
+
+		return nil
+	})
+}
+
+func (s agentUpgradeSqlStorage) FindByID(id int) (*AgentUpgrade, error) {
+	var upgrade AgentUpgrade
+	err := s.db.Where("id = ?", id).First(&upgrade).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find agent upgrade with ID %d: %v", id, err)
+	}
+
+	return &upgrade, nil
+}
+
+func (s agentUpgradeSqlStorage) FindAllByAccountID(accountID int) ([]AgentUpgrade, error) {
+	var upgrades []AgentUpgrade
+	err := s.db.Where("account_id = ?", accountID).Order("id desc").Find(&upgrades).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return upgrades, nil
+}
+
+func (s agentUpgradeSqlStorage) FindAllByStatus(status string) ([]AgentUpgrade, error) {
+	var upgrades []AgentUpgrade
+	err := s.db.Where("status = ?", status).Order("id asc").Find(&upgrades).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return upgrades, nil
+}
+
+func (s agentUpgradeSqlStorage) FindServers(upgradeID int) ([]AgentUpgradeServer, error) {
+	var servers []AgentUpgradeServer
+	err := s.db.Where("upgrade_id = ?", upgradeID).Order("batch asc, id asc").Find(&servers).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find servers of agent upgrade with ID %d: %v", upgradeID, err)
+	}
+
+	return servers, nil
+}
+
+func (s agentUpgradeSqlStorage) UpdateStatus(id int, status, message string, finishedAt *time.Time) error {
+	return s.db.Model(&AgentUpgrade{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       message,
+		"finished_at": finishedAt,
+	}).Error
+}
+
+func (s agentUpgradeSqlStorage) SaveServer(server *AgentUpgradeServer) error {
+	return s.db.Save(server).Error
+}
+
+func NewAgentUpgradeSqlStorage(db *gorm.DB) AgentUpgradeStorage {
+	return agentUpgradeSqlStorage{
+		db: db,
+	}
+}
+
+func (*AgentUpgrade) TableName() string {
+	return "agent_upgrades"
+}
+
+func (*AgentUpgradeServer) TableName() string {
+	return "agent_upgrade_servers"
+}
@@ -0,0 +1,34 @@
+package storage
+
+import "time"
+
+// EnrollmentCode allows an agent to register itself in the account. Only the hash of the code is stored.
+type EnrollmentCode struct {
+	ID        uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID uint
+	CodeHash  string `gorm:"size:64"`
+	CreatedBy uint
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	UsedIP    string `gorm:"size:64"`
+	ServerID  *uint
+	RevokedAt *time.Time
+	RevokedBy *uint
+	CreatedAt time.Time
+}
+
+func (c EnrollmentCode) IsActive(now time.Time) bool {
+	return c.UsedAt == nil && c.RevokedAt == nil && now.Before(c.ExpiresAt)
+}
+
+type EnrollmentCodeStorage interface {
+	Create(code *EnrollmentCode) error
+	FindByID(id int) (*EnrollmentCode, error)
+	FindByHash(codeHash string) (*EnrollmentCode, error)
+	FindAllByAccountID(accountID int) ([]EnrollmentCode, error)
+	// Enroll marks the active code as used and saves the enrolled server with its token in one transaction.
+	// It returns false and saves nothing if the code has been used, revoked or expired meanwhile.
+	Enroll(id int, ip string, now time.Time, server *Server) (bool, error)
+	// Revoke revokes the active code. It returns false if the code has been used or revoked already.
+	Revoke(id int, userID uint, now time.Time) (bool, error)
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"backend/internal/pkg/secret"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var errEnrollmentCodeInactive = errors.New("enrollment code is not active")
+
+type enrollmentCodeSqlStorage struct {
+	db      *gorm.DB
+	keyRing *secret.KeyRing
+}
+
+func (s enrollmentCodeSqlStorage) Create(code *EnrollmentCode) error {
+	return s.db.Create(code).Error
+}
+
+func (s enrollmentCodeSqlStorage) FindByID(id int) (*EnrollmentCode, error) {
+	return s.findOne("id = ?", id)
+}
+
+func (s enrollmentCodeSqlStorage) FindByHash(codeHash string) (*EnrollmentCode, error) {
+	return s.findOne("code_hash = ?", codeHash)
+}
+
+func (s enrollmentCodeSqlStorage) FindAllByAccountID(accountID int) ([]EnrollmentCode, error) {
+	var codes []EnrollmentCode
+	err := s.db.Where("account_id = ?", accountID).Order("id desc").Find(&codes).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s enrollmentCodeSqlStorage) Enroll(id int, ip string, now time.Time, server *Server) (bool, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&EnrollmentCode{}).
+			Where("id = ?", id).
+			Where("used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now).
+			Updates(map[string]interface{}{
+				"used_at": now,
+				"used_ip": ip,
+			})
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to redeem enrollment code with ID %d: %v", id, result.Error)
+		}
+
+		if result.RowsAffected != 1 {
+			return errEnrollmentCodeInactive
+		}
+
+		servers := NewServerSqlStorage(tx, s.keyRing)
+
+		if err := servers.Save(server); err != nil {
+			return err
+		}
+
+		// the token of a claimed server is not changed by Save
+		if err := servers.RotateToken(int(server.ID), server.Token, &now); err != nil {
+			return err
+		}
+
+		return tx.Model(&EnrollmentCode{}).Where("id = ?", id).Update("server_id", server.ID).Error
+	})
+
+	if errors.Is(err, errEnrollmentCodeInactive) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s enrollmentCodeSqlStorage) Revoke(id int, userID uint, now time.Time) (bool, error) {
+	result := s.db.Model(&EnrollmentCode{}).
+		Where("id = ?", id).
+		Where("used_at IS NULL AND revoked_at IS NULL").
+		Updates(map[string]interface{}{
+			"revoked_at": now,
+			"revoked_by": userID,
+		})
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to revoke enrollment code with ID %d: %v", id, result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (s enrollmentCodeSqlStorage) findOne(query string, args ...interface{}) (*EnrollmentCode, error) {
+	var code EnrollmentCode
+	err := s.db.Where(query, args...).First(&code).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find enrollment code: %v", err)
+	}
+
+	return &code, nil
+}
+
+func NewEnrollmentCodeSqlStorage(db *gorm.DB, keyRing *secret.KeyRing) EnrollmentCodeStorage {
+	return enrollmentCodeSqlStorage{
+		db:      db,
+		keyRing: keyRing,
+	}
+}
+
+func (*EnrollmentCode) TableName() string {
+	return "enrollment_codes"
+}
@@ -0,0 +1,43 @@
+package storage
+
+import "time"
+
+// ServerGroup is a named set of account servers. A server may belong to any number of groups.
+type ServerGroup struct {
+	ID          uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID   uint
+	Name        string `gorm:"size:64"`
+	Description string `gorm:"size:255"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type ServerGroupMember struct {
+	GroupID  uint `gorm:"primary_key"`
+	ServerID uint `gorm:"primary_key"`
+}
+
+type ServerTag struct {
+	ServerID uint   `gorm:"primary_key"`
+	Tag      string `gorm:"primary_key;size:64"`
+}
+
+type ServerGroupStorage interface {
+	FindByID(id int) (*ServerGroup, error)
+	FindByName(accountID int, name string) (*ServerGroup, error)
+	FindAllByAccountID(accountID int) ([]ServerGroup, error)
+	Save(group *ServerGroup) error
+	Remove(group *ServerGroup) error
+	FindServerIDs(groupID int) ([]uint, error)
+	// SetServers replaces members of the group
+	SetServers(groupID int, serverIDs []uint) error
+	// FindGroupIDsByServerIDs returns IDs of groups the servers belong to keyed by server ID
+	FindGroupIDsByServerIDs(serverIDs []uint) (map[uint][]uint, error)
+}
+
+type ServerTagStorage interface {
+	// FindByServerIDs returns sorted tags of the servers keyed by server ID
+	FindByServerIDs(serverIDs []uint) (map[uint][]string, error)
+	// SetServerTags replaces tags of the server
+	SetServerTags(serverID int, tags []string) error
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type serverGroupSqlStorage struct {
+	db *gorm.DB
+}
+
+func (s serverGroupSqlStorage) FindByID(id int) (*ServerGroup, error) {
+	return s.findOne("id = ?", id)
+}
+
+func (s serverGroupSqlStorage) FindByName(accountID int, name string) (*ServerGroup, error) {
+	return s.findOne("account_id = ? AND name = ?", accountID, name)
+}
+
+func (s serverGroupSqlStorage) FindAllByAccountID(accountID int) ([]ServerGroup, error) {
+	var groups []ServerGroup
+	err := s.db.Where("account_id = ?", accountID).Order("name asc").Find(&groups).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (s serverGroupSqlStorage) Save(group *ServerGroup) error {
+	return s.db.Save(group).Error
+}
+
+func (s serverGroupSqlStorage) Remove(group *ServerGroup) error {
+	return s.db.Delete(group).Error
+}
+
+func (s serverGroupSqlStorage) FindServerIDs(groupID int) ([]uint, error) {
+	var serverIDs []uint
+	err := s.db.Model(&ServerGroupMember{}).Where("group_id = ?", groupID).Order("server_id asc").Pluck("server_id", &serverIDs).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find servers of group with ID %d: %v", groupID, err)
+	}
+
+	return serverIDs, nil
+}
+
+func (s serverGroupSqlStorage) SetServers(groupID int, serverIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&ServerGroupMember{}).Error; err != nil {
+			return fmt.Errorf("could not remove servers of group with ID %d: %v", groupID, err)
+		}
+
+		if len(serverIDs) == 0 {
+			return nil
+		}
+
+		members := make([]ServerGroupMember, 0, len(serverIDs))
+
+		for _, serverID := range serverIDs {
+			members = append(members, ServerGroupMember{GroupID: uint(groupID), ServerID: serverID})
+		}
+
+		if err := tx.Create(&members).Error; err != nil {
+			return fmt.Errorf("could not add servers to group with ID %d: %v", groupID, err)
+		}
+
+		return nil
+	})
+}
+
+func (s serverGroupSqlStorage) FindGroupIDsByServerIDs(serverIDs []uint) (map[uint][]uint, error) {
+	groupIDs := map[uint][]uint{}
+
+	if len(serverIDs) == 0 {
+		return groupIDs, nil
+	}
+
+	var members []ServerGroupMember
+	err := s.db.Where("server_id IN ?", serverIDs).Order("group_id asc").Find(&members).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find groups of servers: %v", err)
+	}
+
+	for _, member := range members {
+		groupIDs[member.ServerID] = append(groupIDs[member.ServerID], member.GroupID)
+	}
+
+	return groupIDs, nil
+}
+
+func (s serverGroupSqlStorage) findOne(query string, args ...interface{}) (*ServerGroup, error) {
+	var group ServerGroup
+	err := s.db.Where(query, args...).First(&group).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find server group: %v", err)
+	}
+
+	return &group, nil
+}
+
+func NewServerGroupSqlStorage(db *gorm.DB) ServerGroupStorage {
+	return serverGroupSqlStorage{
+		db: db,
+	}
+}
+
+func (*ServerGroup) TableName() string {
+	return "server_groups"
+}
+
+func (*ServerGroupMember) TableName() string {
+	return "server_group_members"
+}
+
+type serverTagSqlStorage struct {
+	db *gorm.DB
+}
+
+func (s serverTagSqlStorage) FindByServerIDs(serverIDs []uint) (map[uint][]string, error) {
+	tags := map[uint][]string{}
+
+	if len(serverIDs) == 0 {
+		return tags, nil
+	}
+
+	var serverTags []ServerTag
+	err := s.db.Where("server_id IN ?", serverIDs).Order("tag asc").Find(&serverTags).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find tags of servers: %v", err)
+	}
+
+	for _, serverTag := range serverTags {
+		tags[serverTag.ServerID] = append(tags[serverTag.ServerID], serverTag.Tag)
+	}
+
+	return tags, nil
+}
+
+func (s serverTagSqlStorage) SetServerTags(serverID int, tags []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("server_id = ?", serverID).Delete(&ServerTag{}).Error; err != nil {
+			return fmt.Errorf("could not remove tags of server with ID %d: %v", serverID, err)
+		}
+
+		if len(tags) == 0 {
+			return nil
+		}
+
+		serverTags := make([]ServerTag, 0, len(tags))
+
+		for _, tag := range tags {
+			serverTags = append(serverTags, ServerTag{ServerID: uint(serverID), Tag: tag})
+		}
+
+		if err := tx.Create(&serverTags).Error; err != nil {
+			return fmt.Errorf("could not add tags to server with ID %d: %v", serverID, err)
+		}
+
+		return nil
+	})
+}
+
+func NewServerTagSqlStorage(db *gorm.DB) ServerTagStorage {
+	return serverTagSqlStorage{
+		db: db,
+	}
+}
+
+func (*ServerTag) TableName() string {
+	return "server_tags"
+}
@@ -0,0 +1,40 @@
+package storage
+
+import "time"
+
+// MaintenanceWindow suppresses auto-renewal, health alerts and mutating operations on the server or a single domain of it.
+// The window applies to the server, to members of the group or to account servers with the tag, whichever is set.
+// A window without the start time starts immediately and a window without the end time lasts until it is removed.
+type MaintenanceWindow struct {
+	ID         uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID  uint
+	ServerID   *uint
+	GroupID    *uint
+	Tag        string `gorm:"size:64"`
+	DomainName string `gorm:"size:255"`
+	Reason     string `gorm:"size:255"`
+	StartsAt   *time.Time
+	EndsAt     *time.Time
+	CreatedBy  uint
+	CreatedAt  time.Time
+}
+
+// IsActive reports whether the window is in effect at the time
+func (w MaintenanceWindow) IsActive(now time.Time) bool {
+	return (w.StartsAt == nil || !w.StartsAt.After(now)) && (w.EndsAt == nil || w.EndsAt.After(now))
+}
+
+// IsServerWide reports whether the window covers all domains of the server
+func (w MaintenanceWindow) IsServerWide() bool {
+	return w.DomainName == ""
+}
+
+type MaintenanceStorage interface {
+	Create(window *MaintenanceWindow) error
+	FindByID(id int) (*MaintenanceWindow, error)
+	// FindAllByAccountID returns windows of the account that have not ended at the time, scheduled ones included
+	FindAllByAccountID(accountID int, now time.Time) ([]MaintenanceWindow, error)
+	// FindActiveByAccountIDs returns windows of the accounts in effect at the time
+	FindActiveByAccountIDs(accountIDs []uint, now time.Time) ([]MaintenanceWindow, error)
+	Remove(id int) error
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type maintenanceSqlStorage struct {
+	db *gorm.DB
+}
+
+func (s maintenanceSqlStorage) Create(window *MaintenanceWindow) error {
+	return s.db.Create(window).Error
+}
+
+func (s maintenanceSqlStorage) FindByID(id int) (*MaintenanceWindow, error) {
+	var window MaintenanceWindow
+	err := s.db.Where("id = ?", id).First(&window).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find maintenance window with ID %d: %v", id, err)
+	}
+
+	return &window, nil
+}
+
+func (s maintenanceSqlStorage) FindAllByAccountID(accountID int, now time.Time) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	err := s.db.Where("account_id = ?", accountID).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Order("id asc").
+		Find(&windows).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find maintenance windows of account %d: %v", accountID, err)
+	}
+
+	return windows, nil
+}
+
+func (s maintenanceSqlStorage) FindActiveByAccountIDs(accountIDs []uint, now time.Time) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+
+	if len(accountIDs) == 0 {
+		return windows, nil
+	}
+
+	err := s.db.Where("account_id IN ?", accountIDs).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Order("id asc").
+		Find(&windows).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find active maintenance windows: %v", err)
+	}
+
+	return windows, nil
+}
+
+func (s maintenanceSqlStorage) Remove(id int) error {
+	return s.db.Where("id = ?", id).Delete(&MaintenanceWindow{}).Error
+}
+
+func NewMaintenanceSqlStorage(db *gorm.DB) MaintenanceStorage {
+	return maintenanceSqlStorage{
+		db: db,
+	}
+}
+
+func (*MaintenanceWindow) TableName() string {
+	return "maintenance_windows"
+}
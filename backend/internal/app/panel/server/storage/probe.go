@@ -0,0 +1,22 @@
+package storage
+
+import "time"
+
+// ServerProbe is a result of a single agent availability check
+type ServerProbe struct {
+	ID        uint `gorm:"AUTO_INCREMENT;primary_key"`
+	ServerID  uint
+	IsOnline  uint8
+	LatencyMs int
+	Error     string `gorm:"size:1024"`
+	CreatedAt time.Time
+}
+
+type ProbeStorage interface {
+	Create(probe *ServerProbe) error
+	// FindByServerID returns probes of the server created after since ordered by creation time
+	FindByServerID(serverID int, since time.Time) ([]ServerProbe, error)
+	// FindLastOnline returns the latest successful probe of the server
+	FindLastOnline(serverID int) (*ServerProbe, error)
+	RemoveOlderThan(before time.Time) error
+}
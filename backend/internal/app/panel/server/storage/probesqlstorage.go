@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type probeSqlStorage struct {
+	db *gorm.DB
+}
+
+func (s probeSqlStorage) Create(probe *ServerProbe) error {
+	return s.db.Create(probe).Error
+}
+
+func (s probeSqlStorage) FindByServerID(serverID int, since time.Time) ([]ServerProbe, error) {
+	var probes []ServerProbe
+	err := s.db.Where("server_id = ?", serverID).
+		Where("created_at > ?", since).
+		Order("created_at ASC").
+		Find(&probes).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("could not find probes of server with ID %d: %v", serverID, err)
+	}
+
+	return probes, nil
+}
+
+func (s probeSqlStorage) FindLastOnline(serverID int) (*ServerProbe, error) {
+	var probe ServerProbe
+	err := s.db.Where("server_id = ?", serverID).
+		Where("is_online = 1").
+		Order("created_at DESC").
+		First(&probe).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find last online probe of server with ID %d: %v", serverID, err)
+	}
+
+	return &probe, nil
+}
+
+func (s probeSqlStorage) RemoveOlderThan(before time.Time) error {
+	return s.db.Where("created_at < ?", before).Delete(&ServerProbe{}).Error
+}
+
+func NewProbeSqlStorage(db *gorm.DB) ProbeStorage {
+	return probeSqlStorage{
+		db: db,
+	}
+}
+
+func (*ServerProbe) TableName() string {
+	return "server_probes"
+}
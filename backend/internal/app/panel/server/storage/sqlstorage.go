@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"backend/internal/pkg/secret"
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -13,8 +15,10 @@ func (s *Server) AfterFind(tx *gorm.DB) (err error) {
 	return
 }
 
+// sqlStorage keeps agent tokens encrypted with the key ring, models returned by the storage contain decrypted tokens
 type sqlStorage struct {
-	db *gorm.DB
+	db      *gorm.DB
+	keyRing *secret.KeyRing
 }
 
 func (s sqlStorage) FindByID(id int) (*Server, error) {
@@ -29,6 +33,10 @@ func (s sqlStorage) FindByID(id int) (*Server, error) {
 		return nil, fmt.Errorf("could not find server with ID %d: %v", id, err)
 	}
 
+	if err = s.decryptToken(&server); err != nil {
+		return nil, err
+	}
+
 	return &server, nil
 }
 
@@ -50,7 +58,7 @@ func (s sqlStorage) FindAllByAccountID(accountID int) ([]Server, error) {
 		return nil, err
 	}
 
-	return servers, nil
+	return servers, s.decryptTokens(servers)
 }
 
 func (s sqlStorage) FindAll() ([]Server, error) {
@@ -61,15 +69,90 @@ func (s sqlStorage) FindAll() ([]Server, error) {
 		return nil, err
 	}
 
-	return servers, nil
+	return servers, s.decryptTokens(servers)
 }
 
+// Save saves the server. The pinned TLS fingerprint and the token of an existing server are only changed
+// by UpdateTlsFingerprint and RotateToken so that a stale server model can not overwrite them.
 func (s sqlStorage) Save(server *Server) error {
+	token := server.Token
+	encryptedToken, err := s.keyRing.Encrypt(token)
+
+	if err != nil {
+		return fmt.Errorf("could not encrypt server token: %v", err)
+	}
+
+	server.Token = encryptedToken
+	defer func() { server.Token = token }()
+
 	if server.ID == 0 {
 		return s.db.Create(server).Error
 	}
 
-	return s.db.Save(server).Error
+	// a stale model must not overwrite the token, the pin or the preferred family updated meanwhile
+	return s.db.Omit("TlsFingerprint", "Token", "TokenRotatedAt", "PreferredFamily").Save(server).Error
+}
+
+// UpdateToken encrypts the agent token of the server with the active key, the rotation time is kept
+func (s sqlStorage) UpdateToken(id int, token string) error {
+	return s.updateToken(id, token, map[string]interface{}{})
+}
+
+// RotateToken replaces the agent token of the server and its rotation time in a single update
+func (s sqlStorage) RotateToken(id int, token string, rotatedAt *time.Time) error {
+	return s.updateToken(id, token, map[string]interface{}{"token_rotated_at": rotatedAt})
+}
+
+func (s sqlStorage) updateToken(id int, token string, fields map[string]interface{}) error {
+	encryptedToken, err := s.keyRing.Encrypt(token)
+
+	if err != nil {
+		return fmt.Errorf("could not encrypt server token: %v", err)
+	}
+
+	fields["token"] = encryptedToken
+	err = s.db.Model(&Server{}).Where("id = ?", id).Updates(fields).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to update token of server with ID %d: %v", id, err)
+	}
+
+	return nil
+}
+
+func (s sqlStorage) UpdateTlsFingerprint(id int, fingerprint string) error {
+	err := s.db.Model(&Server{}).Where("id = ?", id).Update("tls_fingerprint", fingerprint).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to update TLS fingerprint of server with ID %d: %v", id, err)
+	}
+
+	return nil
+}
+
+func (s sqlStorage) UpdatePreferredFamily(id int, family string) error {
+	err := s.db.Model(&Server{}).Where("id = ?", id).Update("preferred_family", family).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to update preferred address family of server with ID %d: %v", id, err)
+	}
+
+	return nil
+}
+
+func (s sqlStorage) UpdateStatus(id int, status ServerStatus) error {
+	err := s.db.Model(&Server{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"is_active":     status.IsActive,
+		"agent_version": status.AgentVersion,
+		"os_code":       status.OsCode,
+		"os_version":    status.OsVersion,
+	}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to update status of server with ID %d: %v", id, err)
+	}
+
+	return nil
 }
 
 func (s sqlStorage) Remove(server *Server) error {
@@ -110,9 +193,65 @@ func (s sqlStorage) FindCountByIP(ipv4, ipv6 string, excludeIds []int) (int, err
 	return int(count), err
 }
 
-func NewServerSqlStorage(db *gorm.DB) ServerStorage {
+func (s sqlStorage) FindByIP(ipv4, ipv6 string) (*Server, error) {
+	if ipv4 == "" && ipv6 == "" {
+		return nil, errors.New("ipv4 or ipv6 must be specified")
+	}
+
+	var server Server
+	db := s.db
+
+	if ipv4 != "" {
+		db = db.Where("ipv4_address = ?", ipv4)
+	}
+
+	if ipv6 != "" {
+		db = db.Or("ipv6_address = ?", ipv6)
+	}
+
+	err := s.db.Where(db).First(&server).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find server by IP address: %v", err)
+	}
+
+	if err = s.decryptToken(&server); err != nil {
+		return nil, err
+	}
+
+	return &server, nil
+}
+
+func (s sqlStorage) decryptToken(server *Server) error {
+	token, err := s.keyRing.Decrypt(server.Token)
+
+	if err != nil {
+		return fmt.Errorf("could not decrypt token of server with ID %d: %v", server.ID, err)
+	}
+
+	server.Token = token
+
+	return nil
+}
+
+func (s sqlStorage) decryptTokens(servers []Server) error {
+	for i := range servers {
+		if err := s.decryptToken(&servers[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewServerSqlStorage(db *gorm.DB, keyRing *secret.KeyRing) ServerStorage {
 	return sqlStorage{
-		db: db,
+		db:      db,
+		keyRing: keyRing,
 	}
 }
 
@@ -10,22 +10,49 @@ import (
 
 const guidPrefix = "server_guid_prefix"
 
+const (
+	// ConnectionModeDirect is the mode of servers the panel connects to at the agent address and port
+	ConnectionModeDirect = "direct"
+	// ConnectionModeTunnel is the mode of servers whose agents open a tunnel to the panel, e.g. behind NAT
+	ConnectionModeTunnel = "tunnel"
+)
+
 type Server struct {
-	ID           uint      `gorm:"AUTO_INCREMENT;primary_key" json:"id"`
-	Guid         string    `gorm:"-" json:"guid"`
-	Name         string    `gorm:"size:64" json:"name"`
-	OsCode       string    `gorm:"size:64" json:"os_code"`
-	OsVersion    string    `gorm:"size:64" json:"os_version"`
-	Ipv4Address  string    `gorm:"size:64" json:"ipv4_address"`
-	Ipv6Address  string    `gorm:"size:256" json:"ipv6_address"`
-	AgentVersion string    `gorm:"size:64" json:"agent_version"`
-	AgentPort    int       `json:"agent_port"`
-	Token        string    `gorm:"size:512" json:"token"`
-	IsActive     uint8     `json:"is_active"`
-	IsRegistered uint8     `json:"is_registered"`
-	AccountID    uint      `json:"account_id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID             uint   `gorm:"AUTO_INCREMENT;primary_key" json:"id"`
+	Guid           string `gorm:"-" json:"guid"`
+	Name           string `gorm:"size:64" json:"name"`
+	OsCode         string `gorm:"size:64" json:"os_code"`
+	OsVersion      string `gorm:"size:64" json:"os_version"`
+	Ipv4Address    string `gorm:"size:64" json:"ipv4_address"`
+	Ipv6Address    string `gorm:"size:256" json:"ipv6_address"`
+	AgentVersion   string `gorm:"size:64" json:"agent_version"`
+	AgentPort      int    `json:"agent_port"`
+	Token          string `gorm:"size:512" json:"-"`
+	IsActive       uint8  `json:"is_active"`
+	IsRegistered   uint8  `json:"is_registered"`
+	TlsEnabled     uint8  `json:"tls_enabled"`
+	TlsFingerprint string `gorm:"size:128" json:"tls_fingerprint"`
+	SignedRequests uint8  `json:"signed_requests"`
+	ConnectionMode string `gorm:"size:16" json:"connection_mode"`
+	// PreferredFamily is the address family of the last successful connection to the agent
+	PreferredFamily string     `gorm:"size:8" json:"preferred_family"`
+	TokenRotatedAt  *time.Time `json:"token_rotated_at"`
+	AccountID       uint       `json:"account_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// UsesTunnel reports whether the panel reaches the server agent through the tunnel opened by the agent
+func (s *Server) UsesTunnel() bool {
+	return s.ConnectionMode == ConnectionModeTunnel
+}
+
+// ServerStatus is the agent state reported by the server
+type ServerStatus struct {
+	IsActive     uint8
+	AgentVersion string
+	OsCode       string
+	OsVersion    string
 }
 
 type ServerStorage interface {
@@ -34,7 +61,16 @@ type ServerStorage interface {
 	FindByID(id int) (*Server, error)
 	FindByGuid(guid string) (*Server, error)
 	FindCountByIP(ipv4, ipv6 string, excludeIds []int) (int, error)
+	FindByIP(ipv4, ipv6 string) (*Server, error)
+	// Save creates the server with its token or updates an existing one. The token, its rotation time,
+	// the pinned TLS fingerprint and the preferred address family of an existing server are not updated,
+	// since they are changed only by UpdateToken, RotateToken, UpdateTlsFingerprint and UpdatePreferredFamily.
 	Save(*Server) error
+	UpdateTlsFingerprint(id int, fingerprint string) error
+	UpdatePreferredFamily(id int, family string) error
+	UpdateToken(id int, token string) error
+	RotateToken(id int, token string, rotatedAt *time.Time) error
+	UpdateStatus(id int, status ServerStatus) error
 	Remove(*Server) error
 }
 
@@ -0,0 +1,361 @@
+package upgrade
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/logger"
+	"backend/internal/pkg/text"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	serverDataTimeout   = 10 * time.Second
+	maxErrorLength      = 1024
+)
+
+var ErrUpgradeNotRunning = errors.New("agent upgrade is not running")
+
+// Orchestrator rolls agent upgrades out in batches. Servers of a batch are upgraded concurrently
+// and the next batch is started only after the installed version of every server in the batch is verified.
+type Orchestrator struct {
+	config         *config.Config
+	serverStorage  serverStorage.ServerStorage
+	upgradeStorage serverStorage.AgentUpgradeStorage
+	agentProvider  *agentprovider.AgentProvider
+	logger         logger.Logger
+	pollInterval   time.Duration
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+}
+
+// Run resumes upgrades interrupted by the panel restart
+func (o *Orchestrator) Run() {
+	for _, status := range []string{serverStorage.AgentUpgradeRunning, serverStorage.AgentUpgradePending} {
+		upgrades, err := o.upgradeStorage.FindAllByStatus(status)
+
+		if err != nil {
+			o.logger.Error(fmt.Sprintf("failed to resume agent upgrades: %v", err))
+
+			return
+		}
+
+		for _, upgrade := range upgrades {
+			o.Start(upgrade.ID)
+		}
+	}
+}
+
+// Start executes the upgrade in background
+func (o *Orchestrator) Start(upgradeID uint) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	o.mu.Lock()
+
+	if _, ok := o.running[upgradeID]; ok {
+		o.mu.Unlock()
+		cancel()
+
+		return
+	}
+
+	o.running[upgradeID] = cancel
+	o.mu.Unlock()
+
+	go func() {
+		defer o.release(upgradeID)
+
+		if err := o.Execute(ctx, upgradeID); err != nil {
+			o.logger.Error(fmt.Sprintf("agent upgrade %d failed: %v", upgradeID, err))
+		}
+	}()
+}
+
+// Cancel stops the running upgrade. Servers that are being upgraded are finished, the remaining ones are skipped.
+func (o *Orchestrator) Cancel(upgradeID uint) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cancel, ok := o.running[upgradeID]
+
+	if !ok {
+		return ErrUpgradeNotRunning
+	}
+
+	cancel()
+
+	return nil
+}
+
+// Execute runs the upgrade and waits until it is finished. The upgrade is cancelled when ctx is done.
+func (o *Orchestrator) Execute(ctx context.Context, upgradeID uint) error {
+	upgrade, err := o.upgradeStorage.FindByID(int(upgradeID))
+
+	if err != nil {
+		return err
+	}
+
+	if upgrade == nil {
+		return fmt.Errorf("agent upgrade with ID %d not found", upgradeID)
+	}
+
+	if upgrade.IsFinished() {
+		return nil
+	}
+
+	if err = o.upgradeStorage.UpdateStatus(int(upgrade.ID), serverStorage.AgentUpgradeRunning, "", nil); err != nil {
+		return err
+	}
+
+	serverModels, err := o.upgradeStorage.FindServers(int(upgrade.ID))
+
+	if err != nil {
+		return err
+	}
+
+	servers := make([]*serverStorage.AgentUpgradeServer, len(serverModels))
+
+	for i := range serverModels {
+		servers[i] = &serverModels[i]
+	}
+
+	o.logger.Info(fmt.Sprintf("agent upgrade %d to version %s started", upgrade.ID, upgrade.TargetVersion))
+
+	failures := 0
+
+	for _, batch := range groupByBatch(servers) {
+		if failures >= upgrade.FailureThreshold {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return o.finish(upgrade, servers, serverStorage.AgentUpgradeCancelled, "upgrade cancelled")
+		}
+
+		var wg sync.WaitGroup
+
+		for _, server := range batch {
+			if server.Status == serverStorage.AgentUpgradeServerSucceeded || server.Status == serverStorage.AgentUpgradeServerFailed {
+				continue
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				// servers that are being upgraded are not interrupted by the cancellation
+				o.upgradeServer(context.WithoutCancel(ctx), upgrade, server)
+			}()
+		}
+
+		wg.Wait()
+
+		for _, server := range batch {
+			if server.Status == serverStorage.AgentUpgradeServerFailed {
+				failures++
+			}
+		}
+	}
+
+	if failures >= upgrade.FailureThreshold {
+		return o.finish(upgrade, servers, serverStorage.AgentUpgradeFailed, fmt.Sprintf("%d servers failed to upgrade", failures))
+	}
+
+	return o.finish(upgrade, servers, serverStorage.AgentUpgradeCompleted, "")
+}
+
+func (o *Orchestrator) upgradeServer(ctx context.Context, upgrade *serverStorage.AgentUpgrade, upgradeServer *serverStorage.AgentUpgradeServer) {
+	startedAt := time.Now()
+	upgradeServer.Status = serverStorage.AgentUpgradeServerUpgrading
+	upgradeServer.StartedAt = &startedAt
+	upgradeServer.Error = ""
+	o.saveServer(upgradeServer)
+
+	version, err := o.upgradeAgent(ctx, upgrade.TargetVersion, upgradeServer)
+	finishedAt := time.Now()
+	upgradeServer.Version = version
+	upgradeServer.FinishedAt = &finishedAt
+	upgradeServer.Status = serverStorage.AgentUpgradeServerSucceeded
+
+	if err != nil {
+		upgradeServer.Status = serverStorage.AgentUpgradeServerFailed
+		upgradeServer.Error = text.Truncate(err.Error(), maxErrorLength)
+		o.logger.Warning(fmt.Sprintf("agent upgrade of server with ID %d failed: %v", upgradeServer.ServerID, err))
+	}
+
+	o.saveServer(upgradeServer)
+}
+
+// upgradeAgent upgrades the server agent and returns the version it reports afterwards
+func (o *Orchestrator) upgradeAgent(ctx context.Context, version string, upgradeServer *serverStorage.AgentUpgradeServer) (string, error) {
+	server, err := o.serverStorage.FindByID(int(upgradeServer.ServerID))
+
+	if err != nil {
+		return "", err
+	}
+
+	if server == nil {
+		return "", errors.New("server not found")
+	}
+
+	sAgent, err := o.agentProvider.GetAgent(server)
+
+	if err != nil {
+		return "", err
+	}
+
+	dataCtx, cancel := context.WithTimeout(ctx, serverDataTimeout)
+	data, err := sAgent.GetServerData(dataCtx)
+	cancel()
+
+	if err != nil {
+		return "", fmt.Errorf("agent is not available: %w", err)
+	}
+
+	if upgradeServer.PreviousVersion == "" {
+		upgradeServer.PreviousVersion = data.AgentVersion
+	}
+
+	if data.AgentVersion == version {
+		return version, nil
+	}
+
+	if err = sAgent.Upgrade(ctx, version); err != nil {
+		return data.AgentVersion, err
+	}
+
+	return o.waitForVersion(ctx, server, version)
+}
+
+// waitForVersion polls the restarted agent until it reports the version or the upgrade timeout is exceeded
+func (o *Orchestrator) waitForVersion(ctx context.Context, server *serverStorage.Server, version string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.config.AgentUpgradeTimeout)
+	defer cancel()
+
+	var reported string
+
+	for {
+		// connections and capabilities of the agent that is restarted are stale
+		o.agentProvider.Invalidate(server.ID)
+		current, err := o.getVersion(ctx, server)
+
+		// the last poll may be interrupted by the timeout, so the version reported before is kept
+		if err == nil {
+			reported = current
+		}
+
+		if reported == version {
+			return reported, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if reported == "" && err != nil {
+				return reported, fmt.Errorf("agent did not come back online within %v: %w", o.config.AgentUpgradeTimeout, err)
+			}
+
+			return reported, fmt.Errorf("agent reports version %s instead of %s", reported, version)
+		case <-time.After(o.pollInterval):
+		}
+	}
+}
+
+func (o *Orchestrator) getVersion(ctx context.Context, server *serverStorage.Server) (string, error) {
+	sAgent, err := o.agentProvider.GetAgent(server)
+
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, serverDataTimeout)
+	defer cancel()
+
+	data, err := sAgent.GetServerData(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	status := serverStorage.ServerStatus{
+		IsActive:     1,
+		AgentVersion: data.AgentVersion,
+		OsCode:       data.Platform,
+		OsVersion:    data.PlatformVersion,
+	}
+
+	if err = o.serverStorage.UpdateStatus(int(server.ID), status); err != nil {
+		o.logger.Error(fmt.Sprintf("failed to update status of server %s: %v", server.Name, err))
+	}
+
+	return data.AgentVersion, nil
+}
+
+func (o *Orchestrator) finish(upgrade *serverStorage.AgentUpgrade, servers []*serverStorage.AgentUpgradeServer, status, message string) error {
+	for _, server := range servers {
+		if server.Status == serverStorage.AgentUpgradeServerPending {
+			server.Status = serverStorage.AgentUpgradeServerSkipped
+			o.saveServer(server)
+		}
+	}
+
+	finishedAt := time.Now()
+	o.logger.Info(fmt.Sprintf("agent upgrade %d to version %s finished: %s", upgrade.ID, upgrade.TargetVersion, status))
+
+	return o.upgradeStorage.UpdateStatus(int(upgrade.ID), status, message, &finishedAt)
+}
+
+func (o *Orchestrator) saveServer(server *serverStorage.AgentUpgradeServer) {
+	if err := o.upgradeStorage.SaveServer(server); err != nil {
+		o.logger.Error(fmt.Sprintf("failed to save agent upgrade progress of server with ID %d: %v", server.ServerID, err))
+	}
+}
+
+func (o *Orchestrator) release(upgradeID uint) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if cancel, ok := o.running[upgradeID]; ok {
+		cancel()
+		delete(o.running, upgradeID)
+	}
+}
+
+// groupByBatch groups servers ordered by batch
+func groupByBatch(servers []*serverStorage.AgentUpgradeServer) [][]*serverStorage.AgentUpgradeServer {
+	var batches [][]*serverStorage.AgentUpgradeServer
+
+	for i, server := range servers {
+		if i == 0 || server.Batch != servers[i-1].Batch {
+			batches = append(batches, nil)
+		}
+
+		batches[len(batches)-1] = append(batches[len(batches)-1], server)
+	}
+
+	return batches
+}
+
+func CreateOrchestrator(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	upgradeStorage serverStorage.AgentUpgradeStorage,
+	agentProvider *agentprovider.AgentProvider,
+	logger logger.Logger,
+) *Orchestrator {
+	return &Orchestrator{
+		config:         config,
+		serverStorage:  serverStorage,
+		upgradeStorage: upgradeStorage,
+		agentProvider:  agentProvider,
+		logger:         logger,
+		pollInterval:   defaultPollInterval,
+		running:        map[uint]context.CancelFunc{},
+	}
+}
@@ -0,0 +1,193 @@
+package upgrade
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+type testEnv struct {
+	orchestrator   *Orchestrator
+	serverStorage  serverStorage.ServerStorage
+	upgradeStorage serverStorage.AgentUpgradeStorage
+}
+
+func createTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	cfg := &config.Config{AgentUpgradeTimeout: time.Second}
+	storage := testutil.NewServerMemoryStorage()
+	upgradeStorage := testutil.NewAgentUpgradeMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(cfg, storage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orchestrator := CreateOrchestrator(cfg, storage, upgradeStorage, provider, logger.NewNopLogger())
+	orchestrator.pollInterval = 10 * time.Millisecond
+
+	return testEnv{
+		orchestrator:   orchestrator,
+		serverStorage:  storage,
+		upgradeStorage: upgradeStorage,
+	}
+}
+
+func (e testEnv) addServer(t *testing.T, fAgent *fakeagent.Agent) *serverStorage.Server {
+	t.Helper()
+
+	ip, port := fAgent.Address()
+	server := &serverStorage.Server{
+		Name:        "test",
+		Ipv4Address: ip,
+		AgentPort:   port,
+		Token:       testToken,
+		AccountID:   1,
+	}
+
+	if err := e.serverStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func (e testEnv) createUpgrade(t *testing.T, servers []*serverStorage.Server, concurrency, failureThreshold int) *serverStorage.AgentUpgrade {
+	t.Helper()
+
+	upgrade := &serverStorage.AgentUpgrade{
+		AccountID:        1,
+		TargetVersion:    "2.0.0",
+		Concurrency:      concurrency,
+		FailureThreshold: failureThreshold,
+		Status:           serverStorage.AgentUpgradePending,
+	}
+	var upgradeServers []serverStorage.AgentUpgradeServer
+
+	for i, server := range servers {
+		upgradeServers = append(upgradeServers, serverStorage.AgentUpgradeServer{
+			ServerID: server.ID,
+			Batch:    i / concurrency,
+			Status:   serverStorage.AgentUpgradeServerPending,
+		})
+	}
+
+	if err := e.upgradeStorage.Create(upgrade, upgradeServers); err != nil {
+		t.Fatal(err)
+	}
+
+	return upgrade
+}
+
+func startAgent(t *testing.T) *fakeagent.Agent {
+	t.Helper()
+
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(fAgent.Close)
+	fAgent.EnableUpgrade("1.0.0")
+
+	return fAgent
+}
+
+func TestExecuteUpgradesServersInBatches(t *testing.T) {
+	env := createTestEnv(t)
+	var servers []*serverStorage.Server
+
+	for range 3 {
+		servers = append(servers, env.addServer(t, startAgent(t)))
+	}
+
+	upgrade := env.createUpgrade(t, servers, 2, 1)
+
+	if err := env.orchestrator.Execute(context.Background(), upgrade.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	upgrade, _ = env.upgradeStorage.FindByID(int(upgrade.ID))
+
+	if upgrade.Status != serverStorage.AgentUpgradeCompleted {
+		t.Fatalf("expected upgrade to be completed, got %s: %s", upgrade.Status, upgrade.Error)
+	}
+
+	upgradeServers, _ := env.upgradeStorage.FindServers(int(upgrade.ID))
+
+	for _, upgradeServer := range upgradeServers {
+		if upgradeServer.Status != serverStorage.AgentUpgradeServerSucceeded || upgradeServer.PreviousVersion != "1.0.0" || upgradeServer.Version != "2.0.0" {
+			t.Fatalf("unexpected server upgrade progress: %+v", upgradeServer)
+		}
+
+		server, _ := env.serverStorage.FindByID(int(upgradeServer.ServerID))
+
+		if server.AgentVersion != "2.0.0" {
+			t.Fatalf("expected server agent version to be updated, got %s", server.AgentVersion)
+		}
+	}
+}
+
+func TestExecuteStopsOnFailureThreshold(t *testing.T) {
+	env := createTestEnv(t)
+	failingAgent := startAgent(t)
+	failingAgent.RespondError("agent.upgrade", "package not found")
+	servers := []*serverStorage.Server{env.addServer(t, failingAgent)}
+
+	for range 2 {
+		servers = append(servers, env.addServer(t, startAgent(t)))
+	}
+
+	upgrade := env.createUpgrade(t, servers, 1, 1)
+
+	if err := env.orchestrator.Execute(context.Background(), upgrade.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	upgrade, _ = env.upgradeStorage.FindByID(int(upgrade.ID))
+
+	if upgrade.Status != serverStorage.AgentUpgradeFailed {
+		t.Fatalf("expected upgrade to fail, got %s", upgrade.Status)
+	}
+
+	upgradeServers, _ := env.upgradeStorage.FindServers(int(upgrade.ID))
+	expected := []string{
+		serverStorage.AgentUpgradeServerFailed,
+		serverStorage.AgentUpgradeServerSkipped,
+		serverStorage.AgentUpgradeServerSkipped,
+	}
+
+	for i, upgradeServer := range upgradeServers {
+		if upgradeServer.Status != expected[i] {
+			t.Fatalf("expected server %d to be %s, got %s", i, expected[i], upgradeServer.Status)
+		}
+	}
+}
+
+func TestExecuteFailsIfVersionIsNotReported(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent := startAgent(t)
+	// the agent accepts the upgrade but keeps running the previous version
+	fAgent.Respond("agent.upgrade", nil)
+	upgrade := env.createUpgrade(t, []*serverStorage.Server{env.addServer(t, fAgent)}, 1, 1)
+
+	if err := env.orchestrator.Execute(context.Background(), upgrade.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	upgradeServers, _ := env.upgradeStorage.FindServers(int(upgrade.ID))
+
+	if upgradeServers[0].Status != serverStorage.AgentUpgradeServerFailed || upgradeServers[0].Version != "1.0.0" {
+		t.Fatalf("expected verification to fail, got %+v", upgradeServers[0])
+	}
+}
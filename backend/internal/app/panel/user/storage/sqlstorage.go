@@ -41,6 +41,21 @@ func (s *sqlStorage) FindByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+func (s *sqlStorage) FindAccountOwner(accountID int) (*User, error) {
+	var user User
+	err := s.db.Preload("Account").First(&user, "account_id = ? AND account_owner = 1", accountID).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find owner of account %d: %w", accountID, err)
+	}
+
+	return &user, nil
+}
+
 func (s *sqlStorage) FindAll() ([]*User, error) {
 	users := []*User{}
 
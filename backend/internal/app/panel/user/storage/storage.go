@@ -58,5 +58,6 @@ type UserStorage interface {
 	FindAll() ([]*User, error)
 	FindById(id int) (*User, error)
 	FindByEmail(email string) (*User, error)
+	FindAccountOwner(accountID int) (*User, error)
 	Save(user *User) error
 }
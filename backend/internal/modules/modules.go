@@ -3,9 +3,15 @@ package modules
 import (
 	"backend/internal/app/panel/adapters/api/auth"
 	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
 	serverStorage "backend/internal/app/panel/server/storage"
 	sslManagerModule "backend/internal/modules/sslmanager"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
 	"backend/internal/modules/sslmanager/autorenewal/logstorage"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/modules/sslmanager/inventory/certstorage"
 	"backend/internal/pkg/logger"
 
 	jwt "github.com/appleboy/gin-jwt/v2"
@@ -21,6 +27,12 @@ func InitModulesRouter(
 	appServerStorage serverStorage.ServerStorage,
 	appDomainSettingStorage domainStorage.DomainSettingStorage,
 	certRenewalLogStorage logstorage.RenewalLogStorage,
+	dnsProviderStorage dnsstorage.DnsProviderStorage,
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage,
+	certificateStorage certstorage.CertificateStorage,
+	issuer *acmeissuer.Issuer,
+	appAgentProvider *agentprovider.AgentProvider,
+	appMaintenanceChecker maintenance.Checker,
 	logger logger.Logger,
 ) {
 	certificatesGroup := group.Group("certificates")
@@ -32,7 +44,30 @@ func InitModulesRouter(
 			appServerStorage,
 			appDomainSettingStorage,
 			certRenewalLogStorage,
+			dnsProviderStorage,
+			certificateAuthorityStorage,
+			issuer,
+			appAgentProvider,
+			appMaintenanceChecker,
 			logger,
 		)
 	}
+
+	dnsProvidersGroup := group.Group("dns-providers")
+	{
+		dnsProvidersGroup.Use(authMiddleware.MiddlewareFunc())
+		sslManagerModule.InitDnsProviderRouter(dnsProvidersGroup, cAuth, dnsProviderStorage, logger)
+	}
+
+	certificateAuthoritiesGroup := group.Group("certificate-authorities")
+	{
+		certificateAuthoritiesGroup.Use(authMiddleware.MiddlewareFunc())
+		sslManagerModule.InitCertificateAuthorityRouter(certificateAuthoritiesGroup, cAuth, certificateAuthorityStorage, logger)
+	}
+
+	certificateInventoryGroup := group.Group("certificate-inventory")
+	{
+		certificateInventoryGroup.Use(authMiddleware.MiddlewareFunc())
+		sslManagerModule.InitInventoryRouter(certificateInventoryGroup, cAuth, appServerStorage, certificateStorage)
+	}
 }
@@ -0,0 +1,268 @@
+package acmeissuer
+
+import (
+	"backend/config"
+	"backend/internal/modules/sslmanager/acmestorage"
+	"backend/internal/modules/sslmanager/agent"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/pkg/acme"
+	"backend/internal/pkg/dns"
+	"backend/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const (
+	// CertbotClient issues certificates with certbot on the server
+	CertbotClient = "certbot"
+	// PanelClient issues certificates with the ACME client of the panel
+	PanelClient = "panel"
+
+	// certNamePrefix distinguishes storage certificates issued by the panel
+	certNamePrefix = "panel-"
+)
+
+var ErrInvalidClient = errors.New("invalid issue client")
+
+func IsValidClient(client string) bool {
+	return client == CertbotClient || client == PanelClient
+}
+
+// CertName returns the name of the storage certificate issued by the panel for the subject
+func CertName(subject string) string {
+	return certNamePrefix + strings.ReplaceAll(subject, "*", "wildcard")
+}
+
+type IssueRequest struct {
+	AccountID uint
+	Email     string
+	// ServerName and WebServer identify the virtual host the certificate is issued for
+	ServerName string
+	WebServer  string
+	// Subjects are names of the certificate, the first one is the common name
+	Subjects      []string
+	ChallengeType string
+	// DnsProvider solves the DNS-01 challenge, it is required for the dns challenge type
+	DnsProvider *dnsstorage.DnsProvider
+	// CertificateAuthority issues the certificate, nil means the default authority of the panel
+	CertificateAuthority *acmestorage.CertificateAuthority
+	Assign               bool
+}
+
+// Issuer obtains certificates with the ACME client of the panel and deploys them to servers with agents.
+// The agent serves HTTP-01 challenge tokens and stores issued certificates, so the server does not need certbot.
+type Issuer struct {
+	acmeAccountStorage  acmestorage.AcmeAccountStorage
+	directoryURL        string
+	httpClient          *http.Client
+	dnsPropagationDelay time.Duration
+	logger              logger.Logger
+	// mu prevents concurrent registration of the same account by renewal workers
+	mu sync.Mutex
+}
+
+func (i *Issuer) Issue(ctx context.Context, certificateAgent *agent.CertificateAgent, request IssueRequest) (*agentintegration.Certificate, error) {
+	subjects := request.Subjects
+
+	if len(subjects) == 0 {
+		subjects = []string{request.ServerName}
+	}
+
+	solver, err := i.createSolver(certificateAgent, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := i.getClient(ctx, request.AccountID, request.Email, request.CertificateAuthority)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := client.Obtain(ctx, subjects, solver)
+
+	if err != nil {
+		return nil, err
+	}
+
+	certName := CertName(subjects[0])
+	storageCert, err := certificateAgent.UploadPemCertificateToStorage(ctx, &agentintegration.CertificateUploadRequestData{
+		ServerName:     request.ServerName,
+		WebServer:      request.WebServer,
+		CertName:       certName,
+		PemCertificate: string(cert.PrivateKey) + "\n" + string(cert.Chain),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("could not upload certificate to the server: %w", err)
+	}
+
+	i.logger.Info(fmt.Sprintf("certificate %s is issued by the panel, domain: %s, expires: %s", certName, request.ServerName, cert.Leaf.NotAfter.Format(time.RFC3339)))
+
+	if !request.Assign {
+		return storageCert, nil
+	}
+
+	storageType, err := findStorageType(ctx, certificateAgent, certName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return certificateAgent.AssignCertificateToDomain(ctx, &agentintegration.CertificateAssignRequestData{
+		ServerName:  request.ServerName,
+		WebServer:   request.WebServer,
+		CertName:    certName,
+		StorageType: storageType,
+	})
+}
+
+// getClient returns the client of the ACME account of the panel account at the certificate authority.
+// The account is registered on first use.
+func (i *Issuer) getClient(ctx context.Context, accountID uint, email string, ca *acmestorage.CertificateAuthority) (*acme.Client, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	directoryURL := i.directoryURL
+	var eab *acme.ExternalAccountBinding
+	var preferredChain string
+
+	if ca != nil {
+		directoryURL = ca.DirectoryURL
+		eab = ca.ExternalAccountBinding()
+		preferredChain = ca.PreferredChain
+	}
+
+	account, err := i.acmeAccountStorage.FindByDirectoryURL(int(accountID), directoryURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if account != nil {
+		key, err := acme.ParseKey([]byte(account.PrivateKey))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid key of acme account %d: %v", account.ID, err)
+		}
+
+		client := acme.NewClient(directoryURL, key, account.URI, i.httpClient)
+		client.PreferredChain = preferredChain
+
+		return client, nil
+	}
+
+	key, err := acme.GenerateKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := acme.NewClient(directoryURL, key, "", i.httpClient)
+	client.PreferredChain = preferredChain
+	uri, err := client.Register(ctx, email, eab)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyPem, err := acme.EncodeKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	account = &acmestorage.AcmeAccount{
+		AccountID:    accountID,
+		DirectoryURL: directoryURL,
+		Email:        email,
+		PrivateKey:   string(keyPem),
+		URI:          uri,
+	}
+
+	if err = i.acmeAccountStorage.Save(account); err != nil {
+		return nil, fmt.Errorf("could not save acme account: %v", err)
+	}
+
+	i.logger.Info(fmt.Sprintf("acme account is registered, account: %d, directory: %s", accountID, directoryURL))
+
+	return client, nil
+}
+
+func (i *Issuer) createSolver(certificateAgent *agent.CertificateAgent, request IssueRequest) (acme.Solver, error) {
+	switch request.ChallengeType {
+	case acme.DnsChallengeType:
+		if request.DnsProvider == nil {
+			return nil, errors.New("dns provider is required for the dns challenge")
+		}
+
+		settings, err := request.DnsProvider.GetSettings()
+
+		if err != nil {
+			return nil, err
+		}
+
+		provider, err := dns.CreateProvider(request.DnsProvider.Type, settings)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return acme.DnsSolver{Provider: provider, PropagationDelay: i.dnsPropagationDelay}, nil
+	case acme.HttpChallengeType, "":
+		return agent.HttpChallengeSolver{
+			Agent:      certificateAgent,
+			ServerName: request.ServerName,
+			WebServer:  request.WebServer,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported challenge type: %s", request.ChallengeType)
+	}
+}
+
+// findStorageType returns the storage the agent uploaded the certificate to
+func findStorageType(ctx context.Context, certificateAgent *agent.CertificateAgent, certName string) (string, error) {
+	certificates, err := certificateAgent.GetStorageCertificates(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	for name := range certificates {
+		storageType, storageCertName, found := strings.Cut(name, "__")
+
+		if found && storageCertName == certName {
+			return storageType, nil
+		}
+	}
+
+	return "", fmt.Errorf("uploaded certificate %s is not found in the storage", certName)
+}
+
+func CreateIssuer(
+	config *config.Config,
+	acmeAccountStorage acmestorage.AcmeAccountStorage,
+	logger logger.Logger,
+) (*Issuer, error) {
+	httpClient, err := acme.NewHTTPClient(config.AcmeCABundleFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		acmeAccountStorage:  acmeAccountStorage,
+		directoryURL:        config.AcmeDirectoryURL,
+		httpClient:          httpClient,
+		dnsPropagationDelay: config.AcmeDnsPropagationDelay,
+		logger:              logger,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package acmestorage
+
+import (
+	"backend/internal/pkg/acme"
+	"time"
+)
+
+// CertificateAuthority is an ACME certificate authority configured by an account, e.g. ZeroSSL or an internal ACME server
+type CertificateAuthority struct {
+	ID           uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID    uint
+	Name         string `gorm:"size:64"`
+	DirectoryURL string `gorm:"size:255"`
+	EabKeyID     string `gorm:"size:255"`
+	// EabHmacKey is the base64url encoded MAC key of the external account binding
+	EabHmacKey string
+	// PreferredChain is the common name of the topmost issuer of the preferred alternate chain
+	PreferredChain string `gorm:"size:255"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// ExternalAccountBinding returns the binding of the ACME account or nil if the authority does not require it
+func (ca *CertificateAuthority) ExternalAccountBinding() *acme.ExternalAccountBinding {
+	if ca.EabKeyID == "" {
+		return nil
+	}
+
+	return &acme.ExternalAccountBinding{KeyID: ca.EabKeyID, HmacKey: ca.EabHmacKey}
+}
+
+type CertificateAuthorityStorage interface {
+	FindByID(id int) (*CertificateAuthority, error)
+	FindByName(accountID int, name string) (*CertificateAuthority, error)
+	FindAllByAccountID(accountID int) ([]CertificateAuthority, error)
+	Save(ca *CertificateAuthority) error
+	Remove(ca *CertificateAuthority) error
+}
@@ -0,0 +1,97 @@
+package acmestorage
+
+import (
+	"backend/internal/pkg/secret"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SqlCertificateAuthorityStorage stores MAC keys of external account bindings encrypted with the key ring
+type SqlCertificateAuthorityStorage struct {
+	db      *gorm.DB
+	keyRing *secret.KeyRing
+}
+
+func (s *SqlCertificateAuthorityStorage) FindByID(id int) (*CertificateAuthority, error) {
+	return s.findOne("id = ?", id)
+}
+
+func (s *SqlCertificateAuthorityStorage) FindByName(accountID int, name string) (*CertificateAuthority, error) {
+	return s.findOne("account_id = ? AND name = ?", accountID, name)
+}
+
+func (s *SqlCertificateAuthorityStorage) FindAllByAccountID(accountID int) ([]CertificateAuthority, error) {
+	var authorities []CertificateAuthority
+	err := s.db.Where("account_id = ?", accountID).Order("name asc").Find(&authorities).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range authorities {
+		if err = s.decryptHmacKey(&authorities[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return authorities, nil
+}
+
+func (s *SqlCertificateAuthorityStorage) Save(ca *CertificateAuthority) error {
+	hmacKey := ca.EabHmacKey
+	encryptedKey, err := s.keyRing.Encrypt(hmacKey)
+
+	if err != nil {
+		return fmt.Errorf("could not encrypt eab hmac key: %v", err)
+	}
+
+	ca.EabHmacKey = encryptedKey
+	defer func() { ca.EabHmacKey = hmacKey }()
+
+	return s.db.Save(ca).Error
+}
+
+func (s *SqlCertificateAuthorityStorage) Remove(ca *CertificateAuthority) error {
+	return s.db.Delete(ca).Error
+}
+
+func (s *SqlCertificateAuthorityStorage) findOne(query string, args ...interface{}) (*CertificateAuthority, error) {
+	var ca CertificateAuthority
+	err := s.db.Where(query, args...).First(&ca).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find certificate authority: %v", err)
+	}
+
+	if err = s.decryptHmacKey(&ca); err != nil {
+		return nil, err
+	}
+
+	return &ca, nil
+}
+
+func (s *SqlCertificateAuthorityStorage) decryptHmacKey(ca *CertificateAuthority) error {
+	hmacKey, err := s.keyRing.Decrypt(ca.EabHmacKey)
+
+	if err != nil {
+		return fmt.Errorf("could not decrypt eab hmac key of certificate authority with ID %d: %v", ca.ID, err)
+	}
+
+	ca.EabHmacKey = hmacKey
+
+	return nil
+}
+
+func CreateSqlCertificateAuthorityStorage(db *gorm.DB, keyRing *secret.KeyRing) *SqlCertificateAuthorityStorage {
+	return &SqlCertificateAuthorityStorage{db: db, keyRing: keyRing}
+}
+
+func (*CertificateAuthority) TableName() string {
+	return "certificate_authorities"
+}
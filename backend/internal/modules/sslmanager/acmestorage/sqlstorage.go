@@ -0,0 +1,60 @@
+package acmestorage
+
+import (
+	"backend/internal/pkg/secret"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SqlAcmeAccountStorage stores private keys of accounts encrypted with the key ring
+type SqlAcmeAccountStorage struct {
+	db      *gorm.DB
+	keyRing *secret.KeyRing
+}
+
+func (s *SqlAcmeAccountStorage) FindByDirectoryURL(accountID int, directoryURL string) (*AcmeAccount, error) {
+	var account AcmeAccount
+	err := s.db.Where("account_id = ? AND directory_url = ?", accountID, directoryURL).First(&account).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find acme account: %v", err)
+	}
+
+	privateKey, err := s.keyRing.Decrypt(account.PrivateKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt key of acme account with ID %d: %v", account.ID, err)
+	}
+
+	account.PrivateKey = privateKey
+
+	return &account, nil
+}
+
+func (s *SqlAcmeAccountStorage) Save(account *AcmeAccount) error {
+	privateKey := account.PrivateKey
+	encryptedKey, err := s.keyRing.Encrypt(privateKey)
+
+	if err != nil {
+		return fmt.Errorf("could not encrypt acme account key: %v", err)
+	}
+
+	account.PrivateKey = encryptedKey
+	defer func() { account.PrivateKey = privateKey }()
+
+	return s.db.Save(account).Error
+}
+
+func CreateSqlAcmeAccountStorage(db *gorm.DB, keyRing *secret.KeyRing) *SqlAcmeAccountStorage {
+	return &SqlAcmeAccountStorage{db: db, keyRing: keyRing}
+}
+
+func (*AcmeAccount) TableName() string {
+	return "acme_accounts"
+}
@@ -0,0 +1,23 @@
+package acmestorage
+
+import "time"
+
+// AcmeAccount is an account of the panel ACME client at a certificate authority.
+// Every panel account has its own ACME account per directory.
+type AcmeAccount struct {
+	ID           uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID    uint
+	DirectoryURL string `gorm:"size:255"`
+	Email        string `gorm:"size:255"`
+	// PrivateKey is the PEM encoded key the requests of the account are signed with
+	PrivateKey string
+	// URI is the account URL at the certificate authority
+	URI       string `gorm:"size:255"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type AcmeAccountStorage interface {
+	FindByDirectoryURL(accountID int, directoryURL string) (*AcmeAccount, error)
+	Save(account *AcmeAccount) error
+}
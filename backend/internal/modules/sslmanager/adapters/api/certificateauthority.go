@@ -0,0 +1,118 @@
+package adapters
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	"backend/internal/modules/sslmanager/service"
+	"backend/internal/pkg/acme"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/validator.v2"
+)
+
+func CreateFindCertificateAuthoritiesHandler(cAuth auth.Auth, caService service.CertificateAuthorityService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		authorities, err := caService.FindCertificateAuthorities(user.AccountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"authorities": authorities})
+	}
+}
+
+func CreateSaveCertificateAuthorityHandler(cAuth auth.Auth, caService service.CertificateAuthorityService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request service.SaveCertificateAuthorityRequest
+
+		if caID := c.Param("caId"); caID != "" {
+			id, err := strconv.Atoi(caID)
+
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, errors.New("invalid certificate authority ID")) // nolint:errcheck
+
+				return
+			}
+
+			request.ID = id
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if err := validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.AccountID = user.AccountID
+		ca, err := caService.SaveCertificateAuthority(request)
+
+		if err != nil {
+			abortWithCertificateAuthorityError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"authority": ca})
+	}
+}
+
+func CreateRemoveCertificateAuthorityHandler(cAuth auth.Auth, caService service.CertificateAuthorityService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		caID, err := strconv.Atoi(c.Param("caId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid certificate authority ID")) // nolint:errcheck
+
+			return
+		}
+
+		err = caService.RemoveCertificateAuthority(service.CertificateAuthorityRequest{ID: caID, AccountID: user.AccountID})
+
+		if err != nil {
+			abortWithCertificateAuthorityError(c, err)
+		}
+	}
+}
+
+func abortWithCertificateAuthorityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCertificateAuthorityNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrCertificateAuthorityNameUsed):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrInvalidDirectoryURL), errors.Is(err, service.ErrInvalidExternalAccountBinding),
+		errors.Is(err, acme.ErrInvalidEabHmacKey):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
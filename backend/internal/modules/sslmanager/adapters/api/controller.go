@@ -2,11 +2,16 @@ package adapters
 
 import (
 	"backend/internal/app/panel/adapters/api/auth"
+	"backend/internal/app/panel/server/maintenance"
+	"backend/internal/modules/sslmanager/acmeissuer"
 	"backend/internal/modules/sslmanager/service"
+	"backend/internal/pkg/acme"
+	"backend/internal/pkg/agent"
 	"encoding/base64"
 	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -64,11 +69,22 @@ func CreateIssueCertificateHandler(cAuth auth.Auth, certService service.Certific
 		request.DomainName = domainName
 		request.AccountID = user.AccountID
 
-		cert, err := certService.IssueCertificate(request)
+		cert, err := certService.IssueCertificate(c.Request.Context(), request)
 
 		if err != nil {
-			if errors.Is(err, service.ErrServerNotFound) {
+			if errors.Is(err, service.ErrServerNotFound) || errors.Is(err, service.ErrDnsProviderNotFound) ||
+				errors.Is(err, service.ErrCertificateAuthorityNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, service.ErrDnsProviderRequired) || errors.Is(err, service.ErrInvalidChallengeType) ||
+				errors.Is(err, service.ErrWildcardRequiresDnsChallenge) || errors.Is(err, acme.ErrInvalidSubject) ||
+				errors.Is(err, acmeissuer.ErrInvalidClient) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else if errors.As(err, &agent.TimeoutError{}) {
+				c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"message": err.Error()})
+			} else if errors.As(err, &agent.ErrUnsupportedCommand{}) {
+				c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -125,7 +141,7 @@ func CreateGetCommonDirStatusHandler(cAuth auth.Auth, certService service.Certif
 		request.ServerGuid = guid
 		request.DomainName = domainName
 		request.AccountID = user.AccountID
-		response, err := certService.GetCommonDirStatus(request)
+		response, err := certService.GetCommonDirStatus(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
@@ -186,11 +202,13 @@ func CreateChangeCommonDirStatusHandler(cAuth auth.Auth, certService service.Cer
 		request.DomainName = domainName
 		request.ServerGuid = guid
 		request.AccountID = user.AccountID
-		err = certService.ChangeCommonDirStatus(request)
+		err = certService.ChangeCommonDirStatus(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -244,11 +262,13 @@ func CreateAssignCertificateHandler(cAuth auth.Auth, certService service.Certifi
 		request.DomainName = domainName
 		request.AccountID = user.AccountID
 
-		_, err = certService.AssignCertificate(request)
+		_, err = certService.AssignCertificate(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -295,17 +315,21 @@ func CreateUploadCertificateHandler(cAuth auth.Auth, certService service.Certifi
 		requestData.ServerName = serverName
 		requestData.WebServer = webServer
 
+		force, _ := strconv.ParseBool(c.PostForm("force"))
 		request := service.UploadCertificateRequest{
 			ServerGuid: guid,
 			AccountID:  user.AccountID,
 			Data:       requestData,
+			Force:      force,
 		}
 
-		cert, err := certService.UploadCertificate(request)
+		cert, err := certService.UploadCertificate(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -352,17 +376,21 @@ func CreateUploadCertificateToStorageHandler(cAuth auth.Auth, certService servic
 			return
 		}
 
+		force, _ := strconv.ParseBool(c.PostForm("force"))
 		request := service.UploadCertificateToStorageRequest{
 			ServerGuid:     guid,
 			CertName:       certName,
 			PemCertificate: string(pemFileBytes),
+			Force:          force,
 			AccountID:      user.AccountID,
 		}
-		_, err = certService.UploadCertificateToStorage(request)
+		_, err = certService.UploadCertificateToStorage(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -409,7 +437,7 @@ func CreateDownloadCertificateFromStorageHandler(cAuth auth.Auth, certService se
 			Storage:    requestData.Storage,
 			AccountID:  user.AccountID,
 		}
-		certData, err := certService.DownloadCertificateFromStorage(request)
+		certData, err := certService.DownloadCertificateFromStorage(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
@@ -445,7 +473,7 @@ func CreateGetStorageCertificatesHandler(cAuth auth.Auth, certService service.Ce
 		}
 
 		request := service.CertificatesRequest{Guid: guid, AccountID: user.AccountID}
-		certs, err := certService.GetStorageCertificates(request)
+		certs, err := certService.GetStorageCertificates(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
@@ -513,6 +541,7 @@ func CreateRemoveCertificateFromStorageHandler(cAuth auth.Auth, certService serv
 		requestData := struct {
 			CertName string
 			Storage  string
+			Force    bool
 		}{}
 
 		if err := c.ShouldBindJSON(&requestData); err != nil {
@@ -525,17 +554,70 @@ func CreateRemoveCertificateFromStorageHandler(cAuth auth.Auth, certService serv
 			ServerGuid: guid,
 			CertName:   requestData.CertName,
 			Storage:    requestData.Storage,
+			Force:      requestData.Force,
 			AccountID:  user.AccountID,
 		}
-		err := certService.RemoveCertificateFromStorage(request)
+		err := certService.RemoveCertificateFromStorage(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+		}
+	}
+}
+
+func CreateAssignMatchingCertificateHandler(cAuth auth.Auth, certService service.CertificateService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		guid := c.Param("serverId")
+
+		if guid == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid server GUID")) // nolint:errcheck
+
+			return
+		}
+
+		var request service.AssignMatchingCertificateRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if request.CertName == "" {
+			c.AbortWithError(http.StatusBadRequest, errors.New("certificate name is missed")) // nolint:errcheck
+
+			return
+		}
+
+		request.ServerGuid = guid
+		request.AccountID = user.AccountID
+		results, err := certService.AssignMatchingCertificate(c.Request.Context(), request)
+
+		if err != nil {
+			if errors.Is(err, service.ErrServerNotFound) || errors.Is(err, service.ErrCertificateNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
+
+			return
 		}
+
+		c.JSON(http.StatusOK, gin.H{"domains": results})
 	}
 }
 
@@ -577,11 +659,13 @@ func CreateAddSelfSignCertificateToStorageHandler(cAuth auth.Auth, certService s
 
 		request.ServerGuid = guid
 		request.AccountID = user.AccountID
-		_, err := certService.CreateSelfSignCertificate(request)
+		_, err := certService.CreateSelfSignCertificate(c.Request.Context(), request)
 
 		if err != nil {
 			if errors.Is(err, service.ErrServerNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else if errors.Is(err, maintenance.ErrInMaintenance) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
 			} else {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 			}
@@ -0,0 +1,158 @@
+package adapters
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	"backend/internal/modules/sslmanager/service"
+	"backend/internal/pkg/dns"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/validator.v2"
+)
+
+func CreateFindDnsProvidersHandler(cAuth auth.Auth, dnsProviderService service.DnsProviderService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		providers, err := dnsProviderService.FindDnsProviders(user.AccountID)
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"providers": providers, "types": dns.Types()})
+	}
+}
+
+func CreateSaveDnsProviderHandler(cAuth auth.Auth, dnsProviderService service.DnsProviderService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request service.SaveDnsProviderRequest
+
+		if providerID := c.Param("providerId"); providerID != "" {
+			id, err := strconv.Atoi(providerID)
+
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, errors.New("invalid dns provider ID")) // nolint:errcheck
+
+				return
+			}
+
+			request.ID = id
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if err := validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.AccountID = user.AccountID
+		provider, err := dnsProviderService.SaveDnsProvider(request)
+
+		if err != nil {
+			abortWithDnsProviderError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"provider": provider})
+	}
+}
+
+func CreateRemoveDnsProviderHandler(cAuth auth.Auth, dnsProviderService service.DnsProviderService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		providerID, err := strconv.Atoi(c.Param("providerId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid dns provider ID")) // nolint:errcheck
+
+			return
+		}
+
+		err = dnsProviderService.RemoveDnsProvider(service.DnsProviderRequest{ID: providerID, AccountID: user.AccountID})
+
+		if err != nil {
+			abortWithDnsProviderError(c, err)
+		}
+	}
+}
+
+func CreateCheckDnsProviderHandler(cAuth auth.Auth, dnsProviderService service.DnsProviderService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		providerID, err := strconv.Atoi(c.Param("providerId"))
+
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, errors.New("invalid dns provider ID")) // nolint:errcheck
+
+			return
+		}
+
+		var request service.CheckDnsProviderRequest
+
+		if err = c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err) // nolint:errcheck
+
+			return
+		}
+
+		if err = validator.Validate(request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.ID = providerID
+		request.AccountID = user.AccountID
+
+		if err = dnsProviderService.CheckDnsProvider(c.Request.Context(), request); err != nil {
+			abortWithDnsProviderError(c, err)
+		}
+	}
+}
+
+func abortWithDnsProviderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDnsProviderNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrDnsProviderNameUsed):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case errors.Is(err, dns.ErrInvalidSettings), errors.Is(err, dns.ErrUnknownProviderType):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	case errors.Is(err, service.ErrDnsProviderCheckFailed):
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"message": err.Error()})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
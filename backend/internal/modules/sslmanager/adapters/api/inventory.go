@@ -0,0 +1,93 @@
+package adapters
+
+import (
+	"backend/internal/app/panel/adapters/api/auth"
+	"backend/internal/modules/sslmanager/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreateFindInventoryByDomainHandler(cAuth auth.Auth, inventoryService service.InventoryService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		certificates, err := inventoryService.FindByDomain(service.InventoryDomainRequest{
+			DomainName: c.Param("domainName"),
+			AccountID:  user.AccountID,
+		})
+
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"certificates": certificates})
+	}
+}
+
+func CreateFindInventoryByFingerprintHandler(cAuth auth.Auth, inventoryService service.InventoryService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		certificate, err := inventoryService.FindByFingerprint(service.InventoryFingerprintRequest{
+			Fingerprint: c.Param("fingerprint"),
+			AccountID:   user.AccountID,
+		})
+
+		if err != nil {
+			if errors.Is(err, service.ErrInventoryCertificateNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"certificate": certificate})
+	}
+}
+
+func CreateFindExpiringInventoryHandler(cAuth auth.Auth, inventoryService service.InventoryService) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user := cAuth.GetCurrentUser(c)
+
+		if user == nil {
+			return
+		}
+
+		var request service.InventoryExpiringRequest
+
+		if err := c.ShouldBindQuery(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		request.AccountID = user.AccountID
+		certificates, err := inventoryService.FindExpiring(request)
+
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidExpiringRange) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			}
+
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"certificates": certificates})
+	}
+}
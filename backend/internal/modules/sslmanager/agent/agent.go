@@ -1,6 +1,9 @@
 package agent
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 
 	serverAgent "backend/internal/pkg/agent"
@@ -11,14 +14,78 @@ import (
 
 const (
 	HttpChallenge = "http"
+	DnsChallenge  = "dns"
+	// DnsProviderParam is the issue request param with the type of the DNS provider that solves the DNS-01 challenge.
+	// Settings of the provider are passed in the params prefixed with the type, e.g. rfc2136_nameserver.
+	DnsProviderParam = "dnsprovider"
+
+	// ACME server params of the issue request are named after certbot options
+	ServerParam         = "server"
+	EabKeyIDParam       = "eab-kid"
+	EabHmacKeyParam     = "eab-hmac-key"
+	PreferredChainParam = "preferred-chain"
+
+	// IssuedCertificateSetting is the domain setting that identifies the certificate the panel issued for the domain.
+	// The recorded client and certificate authority of the domain apply only while that certificate is installed.
+	IssuedCertificateSetting = "issuedcert"
 )
 
+// GetIssuedCertificateKey identifies the certificate by its issuer and validity period.
+// The key is hashed to fit domain settings.
+func GetIssuedCertificateKey(issuerCN, validFrom, validTo string) string {
+	hash := sha256.Sum256([]byte(issuerCN + "|" + validFrom + "|" + validTo))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// DnsChallengeParams adds the DNS provider and its settings to the additional params of the issue request
+func DnsChallengeParams(params map[string]string, providerType string, settings map[string]string) map[string]string {
+	result := make(map[string]string, len(params)+len(settings)+1)
+
+	for name, value := range params {
+		result[name] = value
+	}
+
+	result[DnsProviderParam] = providerType
+
+	for name, value := range settings {
+		result[providerType+"_"+name] = value
+	}
+
+	return result
+}
+
+// CertificateAuthorityParams adds the ACME directory, the external account binding and the preferred chain
+// of the certificate authority to the additional params of the issue request. Empty values are not added.
+func CertificateAuthorityParams(params map[string]string, directoryURL, eabKeyID, eabHmacKey, preferredChain string) map[string]string {
+	result := make(map[string]string, len(params)+4)
+
+	for name, value := range params {
+		result[name] = value
+	}
+
+	caParams := map[string]string{
+		ServerParam:         directoryURL,
+		EabKeyIDParam:       eabKeyID,
+		EabHmacKeyParam:     eabHmacKey,
+		PreferredChainParam: preferredChain,
+	}
+
+	for name, value := range caParams {
+		if value != "" {
+			result[name] = value
+		}
+	}
+
+	return result
+}
+
 type CertificateAgent struct {
 	serverAgent *serverAgent.Agent
 }
 
-func (a *CertificateAgent) Issue(certData agentintegration.CertificateIssueRequestData) (*agentintegration.Certificate, error) {
-	data, err := a.serverAgent.Request("certificates.issue", certData)
+func (a *CertificateAgent) Issue(ctx context.Context, certData agentintegration.CertificateIssueRequestData) (*agentintegration.Certificate, error) {
+	data, err := a.serverAgent.Request(ctx, "certificates.issue", certData)
 
 	if err != nil {
 		return nil, err
@@ -27,8 +94,8 @@ func (a *CertificateAgent) Issue(certData agentintegration.CertificateIssueReque
 	return getCertificate(data)
 }
 
-func (a *CertificateAgent) Upload(certData *agentintegration.CertificateUploadRequestData) (*agentintegration.Certificate, error) {
-	data, err := a.serverAgent.Request("certificates.upload", certData)
+func (a *CertificateAgent) Upload(ctx context.Context, certData *agentintegration.CertificateUploadRequestData) (*agentintegration.Certificate, error) {
+	data, err := a.serverAgent.Request(ctx, "certificates.upload", certData)
 
 	if err != nil {
 		return nil, err
@@ -37,8 +104,8 @@ func (a *CertificateAgent) Upload(certData *agentintegration.CertificateUploadRe
 	return getCertificate(data)
 }
 
-func (a *CertificateAgent) AssignCertificateToDomain(certData *agentintegration.CertificateAssignRequestData) (*agentintegration.Certificate, error) {
-	data, err := a.serverAgent.Request("certificates.domainassign", certData)
+func (a *CertificateAgent) AssignCertificateToDomain(ctx context.Context, certData *agentintegration.CertificateAssignRequestData) (*agentintegration.Certificate, error) {
+	data, err := a.serverAgent.Request(ctx, "certificates.domainassign", certData)
 
 	if err != nil {
 		return nil, err
@@ -47,8 +114,20 @@ func (a *CertificateAgent) AssignCertificateToDomain(certData *agentintegration.
 	return getCertificate(data)
 }
 
-func (a *CertificateAgent) UploadPemCertificateToStorage(certData *agentintegration.CertificateUploadRequestData) (*agentintegration.Certificate, error) {
-	data, err := a.serverAgent.Request("certificates.storagecertupload", certData)
+func (a *CertificateAgent) PresentHttpChallenge(ctx context.Context, data serverAgent.HttpChallengeRequestData) error {
+	return a.serverAgent.PresentHttpChallenge(ctx, data)
+}
+
+func (a *CertificateAgent) CleanUpHttpChallenge(ctx context.Context, data serverAgent.HttpChallengeRequestData) error {
+	return a.serverAgent.CleanUpHttpChallenge(ctx, data)
+}
+
+func (a *CertificateAgent) GetVhosts(ctx context.Context) ([]agentintegration.VirtualHost, error) {
+	return a.serverAgent.GetVhosts(ctx)
+}
+
+func (a *CertificateAgent) UploadPemCertificateToStorage(ctx context.Context, certData *agentintegration.CertificateUploadRequestData) (*agentintegration.Certificate, error) {
+	data, err := a.serverAgent.Request(ctx, "certificates.storagecertupload", certData)
 
 	if err != nil {
 		return nil, err
@@ -57,15 +136,15 @@ func (a *CertificateAgent) UploadPemCertificateToStorage(certData *agentintegrat
 	return getCertificate(data)
 }
 
-func (a *CertificateAgent) RemoveCertificateFromStorage(request agentintegration.CertificateRemoveRequestData) error {
-	_, err := a.serverAgent.Request("certificates.storagecertremove", request)
+func (a *CertificateAgent) RemoveCertificateFromStorage(ctx context.Context, request agentintegration.CertificateRemoveRequestData) error {
+	_, err := a.serverAgent.Request(ctx, "certificates.storagecertremove", request)
 
 	return err
 }
 
-func (a *CertificateAgent) GetStorageCertificates() (map[string]*agentintegration.Certificate, error) {
+func (a *CertificateAgent) GetStorageCertificates(ctx context.Context) (map[string]*agentintegration.Certificate, error) {
 	certificates := map[string]*agentintegration.Certificate{}
-	data, err := a.serverAgent.Request("certificates.storagecertificates", nil)
+	data, err := a.serverAgent.Request(ctx, "certificates.storagecertificates", nil)
 
 	if err != nil {
 		return nil, err
@@ -85,27 +164,27 @@ func (a *CertificateAgent) GetStorageCertificates() (map[string]*agentintegratio
 	return response.Certificates, nil
 }
 
-func (a *CertificateAgent) DownloadtStorageCertificate(request agentintegration.CertificateDownloadRequestData) (*agentintegration.CertificateDownloadResponseData, error) {
-	data, err := a.serverAgent.Request("certificates.storagecertdownload", request)
-
-	if err != nil {
-		return nil, err
-	}
-
+func (a *CertificateAgent) DownloadtStorageCertificate(ctx context.Context, request agentintegration.CertificateDownloadRequestData) (*agentintegration.CertificateDownloadResponseData, error) {
 	var certData agentintegration.CertificateDownloadResponseData
-	err = mapstructure.Decode(data, &certData)
 
-	if err != nil {
-		return nil, fmt.Errorf("invalid certificate name list data: %v", err)
+	if err := a.serverAgent.RequestInto(ctx, "certificates.storagecertdownload", request, &certData); err != nil {
+		return nil, err
 	}
 
 	return &certData, nil
 }
 
-func (a *CertificateAgent) GetCommonDirStatus(request agentintegration.CommonDirStatusRequestData) (agentintegration.CommonDirStatusResponseData, error) {
+func (a *CertificateAgent) DownloadVhostCertificate(ctx context.Context, serverName, webServer string) (*agentintegration.CertificateDownloadResponseData, error) {
+	return a.serverAgent.DownloadVhostCertificate(ctx, serverAgent.VhostCertificateDownloadRequestData{
+		ServerName: serverName,
+		WebServer:  webServer,
+	})
+}
+
+func (a *CertificateAgent) GetCommonDirStatus(ctx context.Context, request agentintegration.CommonDirStatusRequestData) (agentintegration.CommonDirStatusResponseData, error) {
 	var responsse agentintegration.CommonDirStatusResponseData
 
-	data, err := a.serverAgent.Request("certificates.commondirstatus", request)
+	data, err := a.serverAgent.Request(ctx, "certificates.commondirstatus", request)
 
 	if err != nil {
 		return responsse, err
@@ -120,8 +199,8 @@ func (a *CertificateAgent) GetCommonDirStatus(request agentintegration.CommonDir
 	return responsse, nil
 }
 
-func (a *CertificateAgent) ChangeCommonDirStatus(request agentintegration.CommonDirChangeStatusRequestData) error {
-	_, err := a.serverAgent.Request("certificates.changecommondirstatus", request)
+func (a *CertificateAgent) ChangeCommonDirStatus(ctx context.Context, request agentintegration.CommonDirChangeStatusRequestData) error {
+	_, err := a.serverAgent.Request(ctx, "certificates.changecommondirstatus", request)
 
 	return err
 }
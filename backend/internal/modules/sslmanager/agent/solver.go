@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"backend/internal/pkg/acme"
+	serverAgent "backend/internal/pkg/agent"
+	"context"
+)
+
+// HttpChallengeSolver solves the HTTP-01 challenge with the agent of the server that hosts the domain
+type HttpChallengeSolver struct {
+	Agent *CertificateAgent
+	// ServerName and WebServer identify the virtual host the agent serves challenge tokens from
+	ServerName string
+	WebServer  string
+}
+
+func (s HttpChallengeSolver) ChallengeType() string {
+	return acme.HTTP01
+}
+
+func (s HttpChallengeSolver) Present(ctx context.Context, domain, token, keyAuthorization string) error {
+	return s.Agent.PresentHttpChallenge(ctx, s.createRequestData(token, keyAuthorization))
+}
+
+func (s HttpChallengeSolver) CleanUp(ctx context.Context, domain, token, keyAuthorization string) error {
+	return s.Agent.CleanUpHttpChallenge(ctx, s.createRequestData(token, keyAuthorization))
+}
+
+func (s HttpChallengeSolver) createRequestData(token, keyAuthorization string) serverAgent.HttpChallengeRequestData {
+	return serverAgent.HttpChallengeRequestData{
+		ServerName:       s.ServerName,
+		WebServer:        s.WebServer,
+		Token:            token,
+		KeyAuthorization: keyAuthorization,
+	}
+}
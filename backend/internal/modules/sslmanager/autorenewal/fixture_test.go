@@ -0,0 +1,124 @@
+package autorenewal
+
+import (
+	"backend/config"
+	domainProvider "backend/internal/app/panel/domain/provider"
+	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+type renewLog struct {
+	serverID       uint
+	successDomains []string
+	failedDomains  map[string]error
+}
+
+type recordingLogWriter struct {
+	mu   sync.Mutex
+	logs []renewLog
+}
+
+func (w *recordingLogWriter) WriteLog(serverID uint, successDomains []string, failedDomains map[string]error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.logs = append(w.logs, renewLog{serverID, successDomains, failedDomains})
+
+	return nil
+}
+
+// testEnv holds memory storages and the agent provider the renewal manager under test is created with
+type testEnv struct {
+	config             *config.Config
+	serverStorage      serverStorage.ServerStorage
+	settingStorage     domainStorage.DomainSettingStorage
+	dnsProviderStorage dnsstorage.DnsProviderStorage
+	caStorage          acmestorage.CertificateAuthorityStorage
+	maintenanceStorage serverStorage.MaintenanceStorage
+	provider           *agentprovider.AgentProvider
+	maintenance        maintenance.Checker
+	logWriter          *recordingLogWriter
+}
+
+func createTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	cfg := &config.Config{CertAboutToExpireInterval: 14 * 24 * time.Hour}
+	storage := testutil.NewServerMemoryStorage()
+	groupStorage := testutil.NewServerGroupMemoryStorage()
+	tagStorage := testutil.NewServerTagMemoryStorage()
+	maintenanceStorage := testutil.NewMaintenanceMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(cfg, storage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testEnv{
+		config:             cfg,
+		serverStorage:      storage,
+		settingStorage:     testutil.NewDomainSettingMemoryStorage(),
+		dnsProviderStorage: testutil.CreateMemoryDnsProviderStorage(),
+		caStorage:          testutil.CreateMemoryCertificateAuthorityStorage(),
+		maintenanceStorage: maintenanceStorage,
+		provider:           provider,
+		maintenance:        maintenance.CreateChecker(maintenanceStorage, groupStorage, tagStorage),
+		logWriter:          &recordingLogWriter{},
+	}
+}
+
+// runManager runs the renewal once. Certificates are renewed with the panel ACME client, if the issuer is set.
+func (e testEnv) runManager(issuer *acmeissuer.Issuer) {
+	manager := CreateAutoRenewalManager(
+		e.serverStorage,
+		e.settingStorage,
+		e.dnsProviderStorage,
+		e.caStorage,
+		issuer,
+		domainProvider.CreateDomainProvider(e.config, e.serverStorage, testutil.NewDomainMemoryStorage(), e.provider, logger.NewNopLogger()),
+		e.provider,
+		e.maintenance,
+		e.config,
+		logger.NewNopLogger(),
+		e.logWriter,
+	)
+
+	releaser := make(chan struct{}, 1)
+	releaser <- struct{}{}
+	manager.Run(context.Background(), releaser)
+}
+
+// startAgent starts the fake agent, which is closed with the test, and adds its server
+func (e testEnv) startAgent(t *testing.T) (*fakeagent.Agent, *serverStorage.Server) {
+	t.Helper()
+
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(fAgent.Close)
+	ip, port := fAgent.Address()
+	server := &serverStorage.Server{Name: "test", Ipv4Address: ip, AgentPort: port, Token: testToken, AccountID: 1}
+
+	if err = e.serverStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	return fAgent, server
+}
@@ -6,12 +6,21 @@ import (
 	"backend/internal/app/panel/domain/provider"
 	domainProvider "backend/internal/app/panel/domain/provider"
 	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
 	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
 	"backend/internal/modules/sslmanager/agent"
+	"backend/internal/modules/sslmanager/dnsstorage"
 	"backend/internal/pkg/acme"
-	serverAgent "backend/internal/pkg/agent"
 	"backend/internal/pkg/logger"
+	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/r2dtools/agentintegration"
 )
@@ -24,28 +33,38 @@ const (
 	defaultWorkersCount = 10
 )
 
+// letsEncryptIntermediate matches common names of Let's Encrypt intermediates, e.g. R3, R11 or E6
+var letsEncryptIntermediate = regexp.MustCompile(`^[RE][0-9]+$`)
+
 type RenewResult struct {
 	ServerID       uint
 	ServerName     string
 	SuccessDomains []string
 	FailedDomains  map[string]error
 	Err            error
+	// InMaintenance is set if the server is skipped because of maintenance
+	InMaintenance bool
 }
 
 type AutoRenewalManager struct {
-	config               *config.Config
-	serverStorage        serverStorage.ServerStorage
-	domainSettingStorage domainStorage.DomainSettingStorage
-	domainProvider       domainProvider.DomainProvider
-	logger               logger.Logger
-	renewLogWriter       RenewLogWriter
+	config                      *config.Config
+	serverStorage               serverStorage.ServerStorage
+	domainSettingStorage        domainStorage.DomainSettingStorage
+	dnsProviderStorage          dnsstorage.DnsProviderStorage
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage
+	issuer                      *acmeissuer.Issuer
+	domainProvider              domainProvider.DomainProvider
+	agentProvider               *agentprovider.AgentProvider
+	maintenance                 maintenance.Checker
+	logger                      logger.Logger
+	renewLogWriter              RenewLogWriter
 }
 
 type BlockReleaser interface {
 	Release()
 }
 
-func (a AutoRenewalManager) Run(releaser <-chan struct{}) {
+func (a AutoRenewalManager) Run(ctx context.Context, releaser <-chan struct{}) {
 	defer func() {
 		<-releaser
 	}()
@@ -77,7 +96,7 @@ func (a AutoRenewalManager) Run(releaser <-chan struct{}) {
 	workersCount := min(serversCount, defaultWorkersCount)
 
 	for range workersCount {
-		go a.renewWorker(jobs, results)
+		go a.renewWorker(ctx, jobs, results)
 	}
 
 	for range serversCount {
@@ -89,6 +108,10 @@ func (a AutoRenewalManager) Run(releaser <-chan struct{}) {
 			continue
 		}
 
+		if result.InMaintenance {
+			continue
+		}
+
 		err = a.renewLogWriter.WriteLog(result.ServerID, result.SuccessDomains, result.FailedDomains)
 
 		if err != nil {
@@ -100,15 +123,34 @@ func (a AutoRenewalManager) Run(releaser <-chan struct{}) {
 }
 
 func (a AutoRenewalManager) renewWorker(
+	ctx context.Context,
 	servers <-chan serverStorage.Server,
 	results chan<- RenewResult,
 ) {
 	for server := range servers {
-		domains, err := a.domainProvider.GetServerDomains(server.Guid)
 		result := RenewResult{
 			ServerID:   server.ID,
 			ServerName: server.Name,
 		}
+		windows, err := a.maintenance.ServerWindows(&server)
+
+		if err != nil {
+			result.Err = err
+			results <- result
+
+			continue
+		}
+
+		if len(maintenance.DomainWindows(windows, "")) > 0 {
+			a.logger.Info(fmt.Sprintf("skip renewal, server %s is in maintenance", server.Name))
+			result.InMaintenance = true
+			results <- result
+
+			continue
+		}
+
+		// the renewal needs the agent anyway, so domains are synced to renew certificates the agent currently serves
+		domains, err := a.domainProvider.SyncServerDomains(ctx, &server)
 
 		if err != nil {
 			result.Err = err
@@ -119,13 +161,7 @@ func (a AutoRenewalManager) renewWorker(
 
 		a.logger.Debug(fmt.Sprintf("found %d domains on server %s", len(domains), server.Name))
 
-		sAgent, err := serverAgent.NewAgent(
-			server.Ipv4Address,
-			server.Ipv6Address,
-			server.Token,
-			server.AgentPort,
-			a.logger,
-		)
+		sAgent, err := a.agentProvider.GetAgent(&server)
 
 		if err != nil {
 			result.Err = err
@@ -138,6 +174,8 @@ func (a AutoRenewalManager) renewWorker(
 
 		succeededDomains := []string{}
 		failedDomains := map[string]error{}
+		// a certificate served by several domains, e.g. a wildcard one, is renewed once
+		renewedCerts := map[string]string{}
 
 		for _, domain := range domains {
 			domainName := domain.ServerName
@@ -149,6 +187,12 @@ func (a AutoRenewalManager) renewWorker(
 				continue
 			}
 
+			if len(maintenance.DomainWindows(windows, domainName)) > 0 {
+				a.logger.Info(fmt.Sprintf("skip renewal, domain %s of server %s is in maintenance", domainName, server.Name))
+
+				continue
+			}
+
 			var email string
 
 			setting, err := a.domainSettingStorage.FindByDomain(domainName, server.Guid, "renewal")
@@ -175,12 +219,46 @@ func (a AutoRenewalManager) renewWorker(
 				email = cert.EmailAddresses[0]
 			}
 
-			if !cert.IsLetsEncrypt() {
-				a.logger.Debug(fmt.Sprintf("skip renewal for domain %s: not Let`s Encrypt certificate", domainName))
+			issuedSetting, err := a.domainSettingStorage.FindByDomain(domainName, server.Guid, agent.IssuedCertificateSetting)
+
+			if err != nil {
+				failedDomains[domainName] = err
+
+				continue
+			}
+
+			// a certificate installed in place of the issued one, e.g. a commercial one, is renewed only
+			// if it is issued by Let's Encrypt, the default authority of certbot
+			issued := issuedSetting != nil &&
+				issuedSetting.SettingValue == agent.GetIssuedCertificateKey(cert.Issuer.CN, cert.ValidFrom, cert.ValidTo)
+
+			if !issued && !isLetsEncrypt(cert) {
+				a.logger.Debug(fmt.Sprintf("skip renewal for domain %s: certificate is not issued by the panel or Let`s Encrypt", domainName))
 
 				continue
 			}
 
+			var clientSetting, caSetting *domainStorage.DomainSetting
+
+			// the recorded client and certificate authority do not apply to a replaced certificate.
+			// Certificates issued before the key of the issued certificate was recorded keep using them.
+			if issued || issuedSetting == nil {
+				if clientSetting, err = a.domainSettingStorage.FindByDomain(domainName, server.Guid, "issueclient"); err != nil {
+					failedDomains[domainName] = err
+
+					continue
+				}
+
+				if caSetting, err = a.domainSettingStorage.FindByDomain(domainName, server.Guid, "ca"); err != nil {
+					failedDomains[domainName] = err
+
+					continue
+				}
+			}
+
+			// certificates issued by the panel come from the certificate authority of the panel ACME client
+			issuedByPanel := clientSetting != nil && clientSetting.SettingValue == acmeissuer.PanelClient
+
 			isAboutToExpire, err := cert.IsAboutToExpire(a.config.CertAboutToExpireInterval)
 
 			if err != nil {
@@ -195,7 +273,15 @@ func (a AutoRenewalManager) renewWorker(
 				continue
 			}
 
-			err = issueCert(certificateAgent, email, domain)
+			certKey := getCertificateKey(cert)
+
+			if renewedDomain, ok := renewedCerts[certKey]; ok {
+				a.logger.Debug(fmt.Sprintf("skip renewal for domain %s: certificate is renewed with domain %s", domainName, renewedDomain))
+
+				continue
+			}
+
+			renewedCert, err := a.issueCert(ctx, certificateAgent, &server, email, domain, issuedByPanel, caSetting)
 
 			if err != nil {
 				failedDomains[domainName] = err
@@ -203,6 +289,11 @@ func (a AutoRenewalManager) renewWorker(
 				continue
 			}
 
+			if err = a.saveRenewalSettings(&server, domainName, renewedCert, issuedByPanel, caSetting); err != nil {
+				a.logger.Error(fmt.Sprintf("could not record renewed certificate of domain %s: %v", domainName, err))
+			}
+
+			renewedCerts[certKey] = domainName
 			succeededDomains = append(succeededDomains, domainName)
 		}
 
@@ -213,33 +304,270 @@ func (a AutoRenewalManager) renewWorker(
 	}
 }
 
-func issueCert(certificateAgent *agent.CertificateAgent, email string, domain dto.Domain) error {
-	_, err := certificateAgent.Issue(agentintegration.CertificateIssueRequestData{
-		Email:         email,
-		ServerName:    domain.Certificate.CN,
-		WebServer:     domain.WebServer,
-		ChallengeType: acme.HttpChallengeType,
-		Subjects:      domain.Certificate.DNSNames,
-		Assign:        true,
+// issueCert renews the certificate with the client, the certificate authority, the subjects, the challenge type
+// and the DNS provider it was issued with.
+// Certificates issued before challenge types were kept are renewed with the HTTP-01 challenge,
+// except wildcard ones, which can be renewed only with the DNS-01 challenge.
+func (a AutoRenewalManager) issueCert(
+	ctx context.Context,
+	certificateAgent *agent.CertificateAgent,
+	server *serverStorage.Server,
+	email string,
+	domain dto.Domain,
+	issuedByPanel bool,
+	caSetting *domainStorage.DomainSetting,
+) (*agentintegration.Certificate, error) {
+	challengeType := acme.HttpChallengeType
+	var dnsProvider *dnsstorage.DnsProvider
+
+	ca, err := a.findCertificateAuthority(server, domain.ServerName, caSetting)
+
+	if err != nil {
+		return nil, err
+	}
+
+	setting, err := a.domainSettingStorage.FindByDomain(domain.ServerName, server.Guid, "challengetype")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if setting != nil && setting.SettingValue == acme.DnsChallengeType {
+		challengeType = acme.DnsChallengeType
+
+		if dnsProvider, err = a.findDnsProvider(server, domain.ServerName); err != nil {
+			return nil, err
+		}
+	} else if isWildcard(domain.Certificate) {
+		return nil, fmt.Errorf("wildcard certificate of domain %s can be renewed only with the dns challenge", domain.ServerName)
+	}
+
+	// the common name of a wildcard certificate is not a domain of the server
+	serverName := domain.Certificate.CN
+
+	if acme.IsWildcard(serverName) {
+		serverName = domain.ServerName
+	}
+
+	if issuedByPanel {
+		return a.issuer.Issue(ctx, certificateAgent, acmeissuer.IssueRequest{
+			AccountID:            server.AccountID,
+			Email:                email,
+			ServerName:           serverName,
+			WebServer:            domain.WebServer,
+			Subjects:             getSubjects(domain.Certificate),
+			ChallengeType:        challengeType,
+			DnsProvider:          dnsProvider,
+			CertificateAuthority: ca,
+			Assign:               true,
+		})
+	}
+
+	var params map[string]string
+
+	if dnsProvider != nil {
+		settings, err := dnsProvider.GetSettings()
+
+		if err != nil {
+			return nil, err
+		}
+
+		params = agent.DnsChallengeParams(nil, dnsProvider.Type, settings)
+	}
+
+	if ca != nil {
+		params = agent.CertificateAuthorityParams(params, ca.DirectoryURL, ca.EabKeyID, ca.EabHmacKey, ca.PreferredChain)
+	}
+
+	return certificateAgent.Issue(ctx, agentintegration.CertificateIssueRequestData{
+		Email:            email,
+		ServerName:       serverName,
+		WebServer:        domain.WebServer,
+		ChallengeType:    challengeType,
+		Subjects:         domain.Certificate.DNSNames,
+		AdditionalParams: params,
+		Assign:           true,
 	})
+}
+
+// saveRenewalSettings records the client, the certificate authority and the key of the renewed certificate,
+// so the certificate is renewed the same way next time
+func (a AutoRenewalManager) saveRenewalSettings(
+	server *serverStorage.Server,
+	domainName string,
+	cert *agentintegration.Certificate,
+	issuedByPanel bool,
+	caSetting *domainStorage.DomainSetting,
+) error {
+	if cert == nil {
+		return nil
+	}
+
+	client := acmeissuer.CertbotClient
+
+	if issuedByPanel {
+		client = acmeissuer.PanelClient
+	}
+
+	caID := "0"
+
+	if caSetting != nil && caSetting.SettingValue != "" {
+		caID = caSetting.SettingValue
+	}
+
+	settings := map[string]string{
+		"issueclient":                  client,
+		"ca":                           caID,
+		agent.IssuedCertificateSetting: agent.GetIssuedCertificateKey(cert.Issuer.CN, cert.ValidFrom, cert.ValidTo),
+	}
+
+	for name, value := range settings {
+		setting, err := a.domainSettingStorage.FindByDomain(domainName, server.Guid, name)
+
+		if err != nil {
+			return err
+		}
+
+		if setting == nil {
+			err = a.domainSettingStorage.Create(domainName, server.Guid, name, value)
+		} else {
+			setting.SettingValue = value
+			err = a.domainSettingStorage.Save(setting)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a AutoRenewalManager) findDnsProvider(server *serverStorage.Server, domainName string) (*dnsstorage.DnsProvider, error) {
+	setting, err := a.domainSettingStorage.FindByDomain(domainName, server.Guid, "dnsprovider")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if setting == nil || setting.SettingValue == "" {
+		return nil, fmt.Errorf("dns provider of domain %s is not set", domainName)
+	}
+
+	providerID, err := strconv.Atoi(setting.SettingValue)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns provider of domain %s: %v", domainName, err)
+	}
+
+	provider, err := a.dnsProviderStorage.FindByID(providerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if provider == nil || provider.AccountID != server.AccountID {
+		return nil, fmt.Errorf("dns provider of domain %s not found", domainName)
+	}
+
+	return provider, nil
+}
+
+// findCertificateAuthority returns the certificate authority the domain certificate is issued by,
+// nil means the default authority of the client
+func (a AutoRenewalManager) findCertificateAuthority(
+	server *serverStorage.Server,
+	domainName string,
+	setting *domainStorage.DomainSetting,
+) (*acmestorage.CertificateAuthority, error) {
+	if setting == nil || setting.SettingValue == "" || setting.SettingValue == "0" {
+		return nil, nil
+	}
+
+	caID, err := strconv.Atoi(setting.SettingValue)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate authority of domain %s: %v", domainName, err)
+	}
+
+	ca, err := a.certificateAuthorityStorage.FindByID(caID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ca == nil || ca.AccountID != server.AccountID {
+		return nil, fmt.Errorf("certificate authority of domain %s not found", domainName)
+	}
+
+	return ca, nil
+}
+
+// isLetsEncrypt reports whether the certificate is issued by Let's Encrypt.
+// Only the issuer is checked, subject names of the certificate are chosen by its owner.
+func isLetsEncrypt(cert *dto.DomainCertificate) bool {
+	for _, org := range cert.Issuer.Organization {
+		if strings.Contains(org, "Let's Encrypt") || strings.Contains(org, "good guys") {
+			return true
+		}
+	}
+
+	return strings.Contains(cert.Issuer.CN, "Let's Encrypt") || letsEncryptIntermediate.MatchString(cert.Issuer.CN)
+}
+
+// isWildcard reports whether the certificate covers a wildcard domain. Such a certificate can be renewed only with the DNS challenge.
+func isWildcard(cert *dto.DomainCertificate) bool {
+	return acme.IsWildcard(cert.CN) || acme.HasWildcard(cert.DNSNames)
+}
+
+// getSubjects returns names of the certificate with the common name first
+func getSubjects(cert *dto.DomainCertificate) []string {
+	subjects := []string{}
+
+	if cert.CN != "" {
+		subjects = append(subjects, cert.CN)
+	}
+
+	for _, name := range cert.DNSNames {
+		if name != cert.CN {
+			subjects = append(subjects, name)
+		}
+	}
+
+	return subjects
+}
+
+func getCertificateKey(cert *dto.DomainCertificate) string {
+	names := slices.Clone(cert.DNSNames)
+	slices.Sort(names)
 
-	return err
+	return cert.CN + "|" + strings.Join(names, ",") + "|" + cert.ValidTo
 }
 
 func CreateAutoRenewalManager(
 	serverStorage serverStorage.ServerStorage,
 	domainSettingStorage domainStorage.DomainSettingStorage,
+	dnsProviderStorage dnsstorage.DnsProviderStorage,
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage,
+	issuer *acmeissuer.Issuer,
 	domainProvider provider.DomainProvider,
+	agentProvider *agentprovider.AgentProvider,
+	maintenanceChecker maintenance.Checker,
 	config *config.Config,
 	logger logger.Logger,
 	renewLogWriter RenewLogWriter,
 ) AutoRenewalManager {
 	return AutoRenewalManager{
-		serverStorage:        serverStorage,
-		domainProvider:       domainProvider,
-		domainSettingStorage: domainSettingStorage,
-		config:               config,
-		logger:               logger,
-		renewLogWriter:       renewLogWriter,
+		serverStorage:               serverStorage,
+		domainProvider:              domainProvider,
+		agentProvider:               agentProvider,
+		maintenance:                 maintenanceChecker,
+		domainSettingStorage:        domainSettingStorage,
+		dnsProviderStorage:          dnsProviderStorage,
+		certificateAuthorityStorage: certificateAuthorityStorage,
+		issuer:                      issuer,
+		config:                      config,
+		logger:                      logger,
+		renewLogWriter:              renewLogWriter,
 	}
 }
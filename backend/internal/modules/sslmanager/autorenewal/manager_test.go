@@ -0,0 +1,316 @@
+package autorenewal
+
+import (
+	"backend/config"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
+	"backend/internal/modules/sslmanager/agent"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/pkg/acme/fakeacme"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+func TestRunRenewsExpiringCertificates(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	letsEncrypt := agentintegration.Issuer{CN: "R3", Organization: []string{"Let's Encrypt"}}
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{
+			ServerName: "expiring.com",
+			WebServer:  "nginx",
+			Certificate: &agentintegration.Certificate{
+				CN:             "expiring.com",
+				DNSNames:       []string{"expiring.com", "www.expiring.com"},
+				EmailAddresses: []string{"admin@expiring.com"},
+				ValidTo:        time.Now().Add(24 * time.Hour).Format(time.RFC822Z),
+				Issuer:         letsEncrypt,
+			},
+		},
+		{
+			ServerName: "actual.com",
+			WebServer:  "nginx",
+			Certificate: &agentintegration.Certificate{
+				CN:      "actual.com",
+				ValidTo: time.Now().Add(60 * 24 * time.Hour).Format(time.RFC822Z),
+				Issuer:  letsEncrypt,
+			},
+		},
+		{
+			ServerName: "disabled.com",
+			WebServer:  "nginx",
+			Certificate: &agentintegration.Certificate{
+				CN:      "disabled.com",
+				ValidTo: time.Now().Add(24 * time.Hour).Format(time.RFC822Z),
+				Issuer:  letsEncrypt,
+			},
+		},
+	})
+	fAgent.SetIssueResult(&agentintegration.Certificate{CN: "expiring.com"})
+
+	for _, domainName := range []string{"expiring.com", "actual.com"} {
+		env.settingStorage.Create(domainName, server.Guid, "renewal", "true") // nolint:errcheck
+	}
+
+	env.settingStorage.Create("disabled.com", server.Guid, "renewal", "false") // nolint:errcheck
+
+	env.runManager(nil)
+
+	if len(env.logWriter.logs) != 1 {
+		t.Fatalf("expected one renewal log, got %d", len(env.logWriter.logs))
+	}
+
+	log := env.logWriter.logs[0]
+
+	if log.serverID != server.ID || len(log.failedDomains) != 0 ||
+		len(log.successDomains) != 1 || log.successDomains[0] != "expiring.com" {
+		t.Errorf("unexpected renewal log: %+v", log)
+	}
+
+	requests := fAgent.CommandRequests("certificates.issue")
+
+	if len(requests) != 1 {
+		t.Fatalf("expected one issue request, got %d", len(requests))
+	}
+
+	var requestData agentintegration.CertificateIssueRequestData
+
+	if err := requests[0].Decode(&requestData); err != nil {
+		t.Fatal(err)
+	}
+
+	if requestData.ServerName != "expiring.com" || requestData.Email != "admin@expiring.com" ||
+		requestData.ChallengeType != "http" || !requestData.Assign || len(requestData.Subjects) != 2 {
+		t.Errorf("unexpected issue request: %+v", requestData)
+	}
+}
+
+func TestRunReportsUnreachableServer(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, _ := env.startAgent(t)
+	fAgent.Close()
+
+	env.runManager(nil)
+
+	if len(env.logWriter.logs) != 0 {
+		t.Errorf("renewal log must not be written for unreachable server: %+v", env.logWriter.logs)
+	}
+}
+
+func TestRunSkipsServersInMaintenance(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	endsAt := time.Now().Add(time.Hour)
+	env.maintenanceStorage.Create(&serverStorage.MaintenanceWindow{ServerID: &server.ID, AccountID: server.AccountID, EndsAt: &endsAt}) // nolint:errcheck
+
+	env.runManager(nil)
+
+	if len(fAgent.Requests()) != 0 || len(env.logWriter.logs) != 0 {
+		t.Errorf("server in maintenance must not be renewed, requests: %d, logs: %+v", len(fAgent.Requests()), env.logWriter.logs)
+	}
+}
+
+func TestRunRenewsWithDnsChallenge(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	// both domains serve the same wildcard certificate, which must be renewed once
+	wildcard := &agentintegration.Certificate{
+		CN:       "*.internal.com",
+		DNSNames: []string{"*.internal.com", "internal.com"},
+		ValidTo:  time.Now().Add(24 * time.Hour).Format(time.RFC822Z),
+		Issuer:   agentintegration.Issuer{CN: "R3", Organization: []string{"Let's Encrypt"}},
+	}
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{ServerName: "internal.com", WebServer: "nginx", Certificate: wildcard},
+		{ServerName: "www.internal.com", WebServer: "nginx", Certificate: wildcard},
+	})
+	fAgent.SetIssueResult(&agentintegration.Certificate{CN: "internal.com"})
+
+	dnsProvider := &dnsstorage.DnsProvider{AccountID: 1, Name: "primary", Type: "rfc2136"}
+
+	if err := dnsProvider.SetSettings(map[string]string{"nameserver": "10.0.0.53"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env.dnsProviderStorage.Save(dnsProvider) // nolint:errcheck
+
+	settings := map[string]string{
+		"renewal":       "true",
+		"challengetype": "dns",
+		"dnsprovider":   strconv.Itoa(int(dnsProvider.ID)),
+	}
+
+	for name, value := range settings {
+		env.settingStorage.Create("internal.com", server.Guid, name, value) // nolint:errcheck
+	}
+
+	env.settingStorage.Create("www.internal.com", server.Guid, "renewal", "true") // nolint:errcheck
+
+	env.runManager(nil)
+
+	requests := fAgent.CommandRequests("certificates.issue")
+
+	if len(requests) != 1 {
+		t.Fatalf("expected one issue request, got %d", len(requests))
+	}
+
+	var requestData agentintegration.CertificateIssueRequestData
+
+	if err := requests[0].Decode(&requestData); err != nil {
+		t.Fatal(err)
+	}
+
+	if requestData.ChallengeType != "dns" || requestData.AdditionalParams["dnsprovider"] != "rfc2136" ||
+		requestData.AdditionalParams["rfc2136_nameserver"] != "10.0.0.53" ||
+		requestData.ServerName != "internal.com" || len(requestData.Subjects) != 2 || requestData.Subjects[0] != "*.internal.com" {
+		t.Errorf("unexpected issue request: %+v", requestData)
+	}
+}
+
+func TestRunRenewsWithPanelClient(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	ca, err := fakeacme.Start(func(challengeType, domain, token, keyAuthorization string) error {
+		if served, ok := fAgent.HttpChallenge(token); !ok || served != keyAuthorization {
+			return errors.New("challenge is not served")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	// the certificate is issued by the certificate authority of the panel, not by Let's Encrypt
+	cert := &agentintegration.Certificate{
+		CN:       "example.com",
+		DNSNames: []string{"www.example.com", "example.com"},
+		ValidTo:  time.Now().Add(24 * time.Hour).Format(time.RFC822Z),
+		Issuer:   agentintegration.Issuer{CN: "Fake ACME CA"},
+	}
+	fAgent.SetVhosts([]agentintegration.VirtualHost{{ServerName: "example.com", WebServer: "nginx", Certificate: cert}})
+	fAgent.EnableHttpChallenge()
+	fAgent.Respond("certificates.storagecertupload", cert)
+	fAgent.SetStorageCertificates(map[string]*agentintegration.Certificate{"default__panel-example.com": cert})
+	fAgent.Respond("certificates.domainassign", cert)
+
+	env.settingStorage.Create("example.com", server.Guid, "renewal", "true")                                                             // nolint:errcheck
+	env.settingStorage.Create("example.com", server.Guid, "issueclient", "panel")                                                        // nolint:errcheck
+	env.settingStorage.Create("example.com", server.Guid, "issuedcert", agent.GetIssuedCertificateKey("Fake ACME CA", "", cert.ValidTo)) // nolint:errcheck
+
+	issuer, err := acmeissuer.CreateIssuer(
+		&config.Config{AcmeDirectoryURL: ca.DirectoryURL()},
+		testutil.CreateMemoryAcmeAccountStorage(),
+		logger.NewNopLogger(),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.runManager(issuer)
+
+	if len(env.logWriter.logs) != 1 || len(env.logWriter.logs[0].successDomains) != 1 {
+		t.Fatalf("unexpected renewal logs: %+v", env.logWriter.logs)
+	}
+
+	issued := ca.Issued()
+
+	if len(issued) != 1 || issued[0].Subject.CommonName != "example.com" || len(issued[0].DNSNames) != 2 {
+		t.Fatalf("unexpected issued certificates: %d", len(issued))
+	}
+
+	if requests := fAgent.CommandRequests("certificates.issue"); len(requests) != 0 {
+		t.Error("certificate must not be renewed by the agent")
+	}
+
+	if requests := fAgent.CommandRequests("certificates.domainassign"); len(requests) != 1 {
+		t.Errorf("expected the renewed certificate to be assigned, got %d assign requests", len(requests))
+	}
+}
+
+func TestRunRenewsWithCertificateAuthority(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	zeroSsl := agentintegration.Issuer{CN: "ZeroSSL ECC Domain Secure Site CA", Organization: []string{"ZeroSSL"}}
+	commercial := agentintegration.Issuer{CN: "Sectigo RSA Domain Validation Secure Server CA", Organization: []string{"Sectigo Limited"}}
+	validTo := time.Now().Add(24 * time.Hour).Format(time.RFC822Z)
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{
+			ServerName:  "recorded.com",
+			WebServer:   "nginx",
+			Certificate: &agentintegration.Certificate{CN: "recorded.com", DNSNames: []string{"recorded.com"}, ValidTo: validTo, Issuer: zeroSsl},
+		},
+		{
+			ServerName:  "unknown.com",
+			WebServer:   "nginx",
+			Certificate: &agentintegration.Certificate{CN: "unknown.com", DNSNames: []string{"unknown.com"}, ValidTo: validTo, Issuer: zeroSsl},
+		},
+		{
+			ServerName:  "replaced.com",
+			WebServer:   "nginx",
+			Certificate: &agentintegration.Certificate{CN: "replaced.com", DNSNames: []string{"replaced.com"}, ValidTo: validTo, Issuer: commercial},
+		},
+	})
+	fAgent.SetIssueResult(&agentintegration.Certificate{CN: "recorded.com", Issuer: zeroSsl, ValidTo: "renewed"})
+
+	ca := &acmestorage.CertificateAuthority{
+		AccountID:    1,
+		Name:         "zerossl",
+		DirectoryURL: "https://acme.zerossl.com/v2/DV90",
+		EabKeyID:     "kid-1",
+		EabHmacKey:   "aG1hYy1rZXk",
+	}
+	env.caStorage.Save(ca) // nolint:errcheck
+
+	caID := strconv.Itoa(int(ca.ID))
+	env.settingStorage.Create("recorded.com", server.Guid, "renewal", "true")                                                    // nolint:errcheck
+	env.settingStorage.Create("recorded.com", server.Guid, "ca", caID)                                                           // nolint:errcheck
+	env.settingStorage.Create("recorded.com", server.Guid, "issuedcert", agent.GetIssuedCertificateKey(zeroSsl.CN, "", validTo)) // nolint:errcheck
+	// the certificate authority is not recorded for the domain, so it is not known where to renew the certificate
+	env.settingStorage.Create("unknown.com", server.Guid, "renewal", "true") // nolint:errcheck
+	// a commercial certificate is installed in place of the issued one, it must not be overwritten
+	env.settingStorage.Create("replaced.com", server.Guid, "renewal", "true")                                                    // nolint:errcheck
+	env.settingStorage.Create("replaced.com", server.Guid, "ca", caID)                                                           // nolint:errcheck
+	env.settingStorage.Create("replaced.com", server.Guid, "issuedcert", agent.GetIssuedCertificateKey(zeroSsl.CN, "", validTo)) // nolint:errcheck
+
+	env.runManager(nil)
+
+	requests := fAgent.CommandRequests("certificates.issue")
+
+	if len(requests) != 1 {
+		t.Fatalf("expected one issue request, got %d", len(requests))
+	}
+
+	var requestData agentintegration.CertificateIssueRequestData
+
+	if err := requests[0].Decode(&requestData); err != nil {
+		t.Fatal(err)
+	}
+
+	params := requestData.AdditionalParams
+
+	if requestData.ServerName != "recorded.com" || params["server"] != ca.DirectoryURL || params["eab-kid"] != "kid-1" ||
+		params["eab-hmac-key"] != "aG1hYy1rZXk" {
+		t.Errorf("unexpected issue request: %+v", requestData)
+	}
+
+	if setting, _ := env.settingStorage.FindByDomain("recorded.com", server.Guid, "issuedcert"); setting == nil || setting.SettingValue != agent.GetIssuedCertificateKey(zeroSsl.CN, "", "renewed") {
+		t.Errorf("expected the renewed certificate to be recorded, got %+v", setting)
+	}
+}
@@ -3,6 +3,7 @@ package autorenewal
 import (
 	"backend/config"
 	"backend/internal/pkg/logger"
+	"context"
 	"fmt"
 	"time"
 )
@@ -21,7 +22,7 @@ func (s Scheduler) Run() {
 		select {
 		case limiter <- struct{}{}:
 			s.logger.Debug(fmt.Sprintf("start renewal: %v", t))
-			go s.manager.Run(limiter)
+			go s.manager.Run(context.Background(), limiter)
 		default:
 			s.logger.Warning(fmt.Sprintf("renewal is in progress: %v", t))
 		}
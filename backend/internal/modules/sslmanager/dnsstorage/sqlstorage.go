@@ -0,0 +1,97 @@
+package dnsstorage
+
+import (
+	"backend/internal/pkg/secret"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SqlDnsProviderStorage stores settings of providers encrypted with the key ring
+type SqlDnsProviderStorage struct {
+	db      *gorm.DB
+	keyRing *secret.KeyRing
+}
+
+func (s *SqlDnsProviderStorage) FindByID(id int) (*DnsProvider, error) {
+	return s.findOne("id = ?", id)
+}
+
+func (s *SqlDnsProviderStorage) FindByName(accountID int, name string) (*DnsProvider, error) {
+	return s.findOne("account_id = ? AND name = ?", accountID, name)
+}
+
+func (s *SqlDnsProviderStorage) FindAllByAccountID(accountID int) ([]DnsProvider, error) {
+	var providers []DnsProvider
+	err := s.db.Where("account_id = ?", accountID).Order("name asc").Find(&providers).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range providers {
+		if err = s.decryptSettings(&providers[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return providers, nil
+}
+
+func (s *SqlDnsProviderStorage) Save(provider *DnsProvider) error {
+	settings := provider.Settings
+	encryptedSettings, err := s.keyRing.Encrypt(settings)
+
+	if err != nil {
+		return fmt.Errorf("could not encrypt dns provider settings: %v", err)
+	}
+
+	provider.Settings = encryptedSettings
+	defer func() { provider.Settings = settings }()
+
+	return s.db.Save(provider).Error
+}
+
+func (s *SqlDnsProviderStorage) Remove(provider *DnsProvider) error {
+	return s.db.Delete(provider).Error
+}
+
+func (s *SqlDnsProviderStorage) findOne(query string, args ...interface{}) (*DnsProvider, error) {
+	var provider DnsProvider
+	err := s.db.Where(query, args...).First(&provider).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find dns provider: %v", err)
+	}
+
+	if err = s.decryptSettings(&provider); err != nil {
+		return nil, err
+	}
+
+	return &provider, nil
+}
+
+func (s *SqlDnsProviderStorage) decryptSettings(provider *DnsProvider) error {
+	settings, err := s.keyRing.Decrypt(provider.Settings)
+
+	if err != nil {
+		return fmt.Errorf("could not decrypt settings of dns provider with ID %d: %v", provider.ID, err)
+	}
+
+	provider.Settings = settings
+
+	return nil
+}
+
+func CreateSqlDnsProviderStorage(db *gorm.DB, keyRing *secret.KeyRing) *SqlDnsProviderStorage {
+	return &SqlDnsProviderStorage{db: db, keyRing: keyRing}
+}
+
+func (*DnsProvider) TableName() string {
+	return "dns_providers"
+}
@@ -0,0 +1,52 @@
+package dnsstorage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DnsProvider is a DNS provider of an account used to solve DNS-01 challenges
+type DnsProvider struct {
+	ID        uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID uint
+	Name      string `gorm:"size:64"`
+	Type      string `gorm:"size:32"`
+	// Settings are JSON encoded settings of the provider, credentials included
+	Settings  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (p *DnsProvider) GetSettings() (map[string]string, error) {
+	settings := map[string]string{}
+
+	if p.Settings == "" {
+		return settings, nil
+	}
+
+	if err := json.Unmarshal([]byte(p.Settings), &settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (p *DnsProvider) SetSettings(settings map[string]string) error {
+	data, err := json.Marshal(settings)
+
+	if err != nil {
+		return err
+	}
+
+	p.Settings = string(data)
+
+	return nil
+}
+
+type DnsProviderStorage interface {
+	FindByID(id int) (*DnsProvider, error)
+	FindByName(accountID int, name string) (*DnsProvider, error)
+	FindAllByAccountID(accountID int) ([]DnsProvider, error)
+	Save(provider *DnsProvider) error
+	Remove(provider *DnsProvider) error
+}
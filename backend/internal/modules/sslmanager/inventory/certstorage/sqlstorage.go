@@ -0,0 +1,102 @@
+package certstorage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SqlCertificateStorage struct {
+	db *gorm.DB
+}
+
+func (s *SqlCertificateStorage) FindByID(id uint) (*Certificate, error) {
+	return s.findOne("id = ?", id)
+}
+
+func (s *SqlCertificateStorage) FindByFingerprint(accountID int, fingerprint string) (*Certificate, error) {
+	return s.findOne("account_id = ? AND fingerprint = ?", accountID, fingerprint)
+}
+
+func (s *SqlCertificateStorage) FindAllByLocation(accountID int, source, location string) ([]Certificate, error) {
+	certificates := []Certificate{}
+	sightings := s.db.Model(&Sighting{}).Select("certificate_id").Where("source = ? AND location = ?", source, location)
+	err := s.db.Where("account_id = ? AND id IN (?)", accountID, sightings).Order("not_after DESC").Find(&certificates).Error
+
+	return certificates, err
+}
+
+func (s *SqlCertificateStorage) FindAllExpiring(accountID int, from, to time.Time) ([]Certificate, error) {
+	certificates := []Certificate{}
+	err := s.db.Where("account_id = ? AND not_after >= ? AND not_after <= ?", accountID, from, to).
+		Order("not_after ASC").
+		Find(&certificates).Error
+
+	return certificates, err
+}
+
+func (s *SqlCertificateStorage) FindSightings(certificateIDs []uint) ([]Sighting, error) {
+	sightings := []Sighting{}
+
+	if len(certificateIDs) == 0 {
+		return sightings, nil
+	}
+
+	err := s.db.Where("certificate_id IN ?", certificateIDs).Order("last_seen_at DESC").Find(&sightings).Error
+
+	return sightings, err
+}
+
+func (s *SqlCertificateStorage) FindLatestSighting(serverID uint, source, location, webServer string) (*Sighting, error) {
+	var sighting Sighting
+	err := s.db.Where("server_id = ? AND source = ? AND location = ? AND web_server = ?", serverID, source, location, webServer).
+		Order("last_seen_at DESC").
+		First(&sighting).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find certificate sighting: %v", err)
+	}
+
+	return &sighting, nil
+}
+
+func (s *SqlCertificateStorage) SaveCertificate(certificate *Certificate) error {
+	return s.db.Save(certificate).Error
+}
+
+func (s *SqlCertificateStorage) SaveSighting(sighting *Sighting) error {
+	return s.db.Save(sighting).Error
+}
+
+func (s *SqlCertificateStorage) findOne(query string, args ...interface{}) (*Certificate, error) {
+	var certificate Certificate
+	err := s.db.Where(query, args...).First(&certificate).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not find certificate: %v", err)
+	}
+
+	return &certificate, nil
+}
+
+func CreateSqlCertificateStorage(db *gorm.DB) *SqlCertificateStorage {
+	return &SqlCertificateStorage{db: db}
+}
+
+func (*Certificate) TableName() string {
+	return "inventory_certificates"
+}
+
+func (*Sighting) TableName() string {
+	return "certificate_sightings"
+}
@@ -0,0 +1,71 @@
+package certstorage
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// VhostSource is a virtual host of the server, the location is its server name
+	VhostSource = "vhost"
+	// StorageSource is the certificate storage of the server, the location is the entry in the storage__name format
+	StorageSource = "storage"
+)
+
+// Certificate is a certificate seen by the panel on servers of the account. It is identified by its fingerprint.
+type Certificate struct {
+	ID          uint `gorm:"AUTO_INCREMENT;primary_key"`
+	AccountID   uint
+	Fingerprint string `gorm:"size:64"`
+	// SerialNumber is the hex encoded serial number
+	SerialNumber string `gorm:"size:128"`
+	CommonName   string `gorm:"size:255"`
+	// Names are subject alternative names separated by commas
+	Names              string
+	IssuerCN           string `gorm:"column:issuer_cn;size:255"`
+	IssuerOrganization string `gorm:"size:255"`
+	KeyType            string `gorm:"size:32"`
+	NotBefore          time.Time
+	NotAfter           time.Time
+	CreatedAt          time.Time
+}
+
+func (c *Certificate) GetNames() []string {
+	if c.Names == "" {
+		return []string{}
+	}
+
+	return strings.Split(c.Names, ",")
+}
+
+func (c *Certificate) SetNames(names []string) {
+	c.Names = strings.Join(names, ",")
+}
+
+// Sighting is a location of a server the certificate was deployed at, from the first to the last time it was seen.
+// A certificate deployed at the location again after another one gets a new sighting.
+type Sighting struct {
+	ID            uint `gorm:"AUTO_INCREMENT;primary_key"`
+	CertificateID uint
+	ServerID      uint
+	Source        string `gorm:"size:16"`
+	Location      string `gorm:"size:255"`
+	// WebServer is set for virtual hosts only
+	WebServer   string `gorm:"size:32"`
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+type CertificateStorage interface {
+	FindByID(id uint) (*Certificate, error)
+	FindByFingerprint(accountID int, fingerprint string) (*Certificate, error)
+	// FindAllByLocation returns certificates ever seen at the location of any server of the account
+	FindAllByLocation(accountID int, source, location string) ([]Certificate, error)
+	// FindAllExpiring returns certificates of the account that expire in the range ordered by expiry
+	FindAllExpiring(accountID int, from, to time.Time) ([]Certificate, error)
+	FindSightings(certificateIDs []uint) ([]Sighting, error)
+	// FindLatestSighting returns the sighting that was seen last at the location of the server
+	FindLatestSighting(serverID uint, source, location, webServer string) (*Sighting, error)
+	SaveCertificate(certificate *Certificate) error
+	SaveSighting(sighting *Sighting) error
+}
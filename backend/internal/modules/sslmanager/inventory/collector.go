@@ -0,0 +1,314 @@
+package inventory
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/agent"
+	"backend/internal/modules/sslmanager/inventory/certstorage"
+	serverAgent "backend/internal/pkg/agent"
+	"backend/internal/pkg/certificate"
+	"backend/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const (
+	collectWorkersCount = 10
+	collectTimeout      = 2 * time.Minute
+)
+
+// location is a place of the server a certificate is deployed at
+type location struct {
+	source    string
+	name      string
+	webServer string
+}
+
+// Collector periodically records certificates of virtual hosts and certificate storages of all servers in the inventory
+type Collector struct {
+	config             *config.Config
+	serverStorage      serverStorage.ServerStorage
+	certificateStorage certstorage.CertificateStorage
+	agentProvider      *agentprovider.AgentProvider
+	logger             logger.Logger
+}
+
+func (c Collector) Run() {
+	for range time.Tick(c.config.CertInventoryInterval) {
+		c.CollectAll(context.Background())
+	}
+}
+
+// CollectAll collects certificates of all servers and waits until all collections are finished
+func (c Collector) CollectAll(ctx context.Context) {
+	servers, err := c.serverStorage.FindAll()
+
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("certificate inventory failed: %v", err))
+
+		return
+	}
+
+	jobs := make(chan serverStorage.Server, len(servers))
+
+	for _, server := range servers {
+		jobs <- server
+	}
+
+	close(jobs)
+
+	var wg sync.WaitGroup
+
+	for range min(len(servers), collectWorkersCount) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for server := range jobs {
+				collectCtx, cancel := context.WithTimeout(ctx, collectTimeout)
+
+				if err := c.CollectServer(collectCtx, &server); err != nil {
+					c.logger.Debug(fmt.Sprintf("certificate inventory of server %s failed: %v", server.Name, err))
+				}
+
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// CollectServer records certificates of virtual hosts and the certificate storage of the server.
+// Certificates of virtual hosts are recorded only if the agent supports downloading of them.
+func (c Collector) CollectServer(ctx context.Context, server *serverStorage.Server) error {
+	sAgent, err := c.agentProvider.GetAgent(server)
+
+	if err != nil {
+		return err
+	}
+
+	certificateAgent := agent.NewCertificateAgent(sAgent)
+	now := time.Now()
+
+	return errors.Join(
+		c.collectVhosts(ctx, certificateAgent, server, now),
+		c.collectStorage(ctx, certificateAgent, server, now),
+	)
+}
+
+func (c Collector) collectVhosts(ctx context.Context, certificateAgent *agent.CertificateAgent, server *serverStorage.Server, now time.Time) error {
+	vhosts, err := certificateAgent.GetVhosts(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, vhost := range vhosts {
+		if vhost.Certificate == nil {
+			continue
+		}
+
+		loc := location{source: certstorage.VhostSource, name: vhost.ServerName, webServer: vhost.WebServer}
+		err = c.record(server, loc, vhost.Certificate, now, func() (string, error) {
+			response, err := certificateAgent.DownloadVhostCertificate(ctx, vhost.ServerName, vhost.WebServer)
+
+			if err != nil {
+				return "", err
+			}
+
+			return response.CertContent, nil
+		})
+
+		var unsupportedErr serverAgent.ErrUnsupportedCommand
+
+		if errors.As(err, &unsupportedErr) {
+			c.logger.Debug(fmt.Sprintf("skip inventory of vhost certificates of server %s: %v", server.Name, err))
+
+			return nil
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("vhost %s: %w", vhost.ServerName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Collector) collectStorage(ctx context.Context, certificateAgent *agent.CertificateAgent, server *serverStorage.Server, now time.Time) error {
+	certificates, err := certificateAgent.GetStorageCertificates(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for name, cert := range certificates {
+		storageType, certName, found := strings.Cut(name, "__")
+
+		if !found || cert == nil {
+			continue
+		}
+
+		loc := location{source: certstorage.StorageSource, name: name}
+		err = c.record(server, loc, cert, now, func() (string, error) {
+			response, err := certificateAgent.DownloadtStorageCertificate(ctx, agentintegration.CertificateDownloadRequestData{
+				CertName:    certName,
+				StorageType: storageType,
+			})
+
+			if err != nil {
+				return "", err
+			}
+
+			return response.CertContent, nil
+		})
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("storage certificate %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// record updates the latest sighting at the location if the certificate is still deployed there.
+// Otherwise the certificate is downloaded to get its fingerprint and a new sighting is created.
+func (c Collector) record(
+	server *serverStorage.Server,
+	loc location,
+	cert *agentintegration.Certificate,
+	now time.Time,
+	download func() (string, error),
+) error {
+	sighting, err := c.certificateStorage.FindLatestSighting(server.ID, loc.source, loc.name, loc.webServer)
+
+	if err != nil {
+		return err
+	}
+
+	if sighting != nil {
+		certModel, err := c.certificateStorage.FindByID(sighting.CertificateID)
+
+		if err != nil {
+			return err
+		}
+
+		if certModel != nil && isSameCertificate(certModel, cert) {
+			sighting.LastSeenAt = now
+
+			return c.certificateStorage.SaveSighting(sighting)
+		}
+	}
+
+	content, err := download()
+
+	if err != nil {
+		return err
+	}
+
+	details, err := certificate.ParseDetails([]byte(content))
+
+	if err != nil {
+		return err
+	}
+
+	certModel, err := c.findOrCreateCertificate(server.AccountID, details)
+
+	if err != nil {
+		return err
+	}
+
+	if sighting == nil || sighting.CertificateID != certModel.ID {
+		sighting = &certstorage.Sighting{
+			CertificateID: certModel.ID,
+			ServerID:      server.ID,
+			Source:        loc.source,
+			Location:      loc.name,
+			WebServer:     loc.webServer,
+			FirstSeenAt:   now,
+		}
+	}
+
+	sighting.LastSeenAt = now
+
+	return c.certificateStorage.SaveSighting(sighting)
+}
+
+func (c Collector) findOrCreateCertificate(accountID uint, details *certificate.Details) (*certstorage.Certificate, error) {
+	certModel, err := c.certificateStorage.FindByFingerprint(int(accountID), details.Fingerprint)
+
+	if err != nil || certModel != nil {
+		return certModel, err
+	}
+
+	certModel = &certstorage.Certificate{
+		AccountID:          accountID,
+		Fingerprint:        details.Fingerprint,
+		SerialNumber:       details.SerialNumber,
+		CommonName:         details.CommonName,
+		IssuerCN:           details.IssuerCN,
+		IssuerOrganization: strings.Join(details.IssuerOrganization, ", "),
+		KeyType:            details.KeyType,
+		NotBefore:          details.NotBefore,
+		NotAfter:           details.NotAfter,
+	}
+	certModel.SetNames(details.DNSNames)
+
+	if err = c.certificateStorage.SaveCertificate(certModel); err != nil {
+		// the same certificate may be recorded concurrently for another server of the account
+		if existing, findErr := c.certificateStorage.FindByFingerprint(int(accountID), details.Fingerprint); findErr == nil && existing != nil {
+			return existing, nil
+		}
+
+		return nil, fmt.Errorf("could not save certificate: %v", err)
+	}
+
+	return certModel, nil
+}
+
+// isSameCertificate compares validity periods, which agents report with minute precision,
+// since the fingerprint is known only after the certificate is downloaded
+func isSameCertificate(certModel *certstorage.Certificate, cert *agentintegration.Certificate) bool {
+	validFrom, err := time.Parse(time.RFC822Z, cert.ValidFrom)
+
+	if err != nil {
+		return false
+	}
+
+	validTo, err := time.Parse(time.RFC822Z, cert.ValidTo)
+
+	if err != nil {
+		return false
+	}
+
+	return certModel.NotBefore.Truncate(time.Minute).Equal(validFrom) && certModel.NotAfter.Truncate(time.Minute).Equal(validTo)
+}
+
+func CreateCollector(
+	config *config.Config,
+	serverStorage serverStorage.ServerStorage,
+	certificateStorage certstorage.CertificateStorage,
+	agentProvider *agentprovider.AgentProvider,
+	logger logger.Logger,
+) Collector {
+	return Collector{
+		config:             config,
+		serverStorage:      serverStorage,
+		certificateStorage: certificateStorage,
+		agentProvider:      agentProvider,
+		logger:             logger,
+	}
+}
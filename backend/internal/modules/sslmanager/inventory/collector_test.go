@@ -0,0 +1,179 @@
+package inventory
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/agentprovider"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/service"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const testToken = "test-token"
+
+func TestCollectServerRecordsDeploymentHistory(t *testing.T) {
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer fAgent.Close()
+
+	firstPem, firstCert, firstFingerprint := createTestCertificate(t, "example.com", 1, time.Now().Add(-time.Hour))
+	storagePem, storageCert, storageFingerprint := createTestCertificate(t, "storage.com", 2, time.Now().Add(-time.Hour))
+
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{ServerName: "example.com", WebServer: "nginx", Certificate: firstCert},
+		{ServerName: "plain.com", WebServer: "nginx"},
+	})
+	fAgent.SetStorageCertificates(map[string]*agentintegration.Certificate{"default__storage.com": storageCert})
+	fAgent.EnableCertificateDownload(
+		map[string]string{"example.com": firstPem},
+		map[string]string{"default__storage.com": storagePem},
+	)
+
+	nopLogger := logger.NewNopLogger()
+	sStorage := testutil.NewServerMemoryStorage()
+	certificateStorage := testutil.CreateMemoryCertificateStorage()
+	provider, err := agentprovider.CreateAgentProvider(&config.Config{}, sStorage, nopLogger)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip, port := fAgent.Address()
+	server := &serverStorage.Server{
+		Name:        "test",
+		Ipv4Address: ip,
+		AgentPort:   port,
+		Token:       testToken,
+		AccountID:   1,
+	}
+
+	if err = sStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := CreateCollector(&config.Config{}, sStorage, certificateStorage, provider, nopLogger)
+
+	if err = collector.CollectServer(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+
+	inventoryService := service.NewInventoryService(certificateStorage, sStorage)
+	certificate, err := inventoryService.FindByFingerprint(service.InventoryFingerprintRequest{Fingerprint: storageFingerprint, AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certificate.Sightings) != 1 || certificate.Sightings[0].Location != "default__storage.com" || certificate.Sightings[0].ServerGuid != server.Guid {
+		t.Fatalf("unexpected sightings of the storage certificate: %+v", certificate.Sightings)
+	}
+
+	// the certificate is still deployed, so it is not downloaded again
+	if err = collector.CollectServer(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(fAgent.CommandRequests("certificates.vhostcertdownload")); count != 1 {
+		t.Fatalf("expected the vhost certificate to be downloaded once, got %d", count)
+	}
+
+	secondPem, secondCert, secondFingerprint := createTestCertificate(t, "example.com", 3, time.Now())
+	fAgent.SetVhosts([]agentintegration.VirtualHost{{ServerName: "example.com", WebServer: "nginx", Certificate: secondCert}})
+	fAgent.EnableCertificateDownload(map[string]string{"example.com": secondPem}, map[string]string{"default__storage.com": storagePem})
+
+	if err = collector.CollectServer(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+
+	certificates, err := inventoryService.FindByDomain(service.InventoryDomainRequest{DomainName: "example.com", AccountID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certificates) != 2 {
+		t.Fatalf("expected 2 certificates deployed at example.com, got %d", len(certificates))
+	}
+
+	sightings := map[string]service.CertificateSighting{}
+
+	for _, certificate := range certificates {
+		if len(certificate.Sightings) != 1 {
+			t.Fatalf("expected 1 sighting of certificate %s, got %d", certificate.Fingerprint, len(certificate.Sightings))
+		}
+
+		sightings[certificate.Fingerprint] = certificate.Sightings[0]
+	}
+
+	first, ok := sightings[firstFingerprint]
+
+	if !ok {
+		t.Fatalf("certificate %s is not recorded", firstFingerprint)
+	}
+
+	second, ok := sightings[secondFingerprint]
+
+	if !ok {
+		t.Fatalf("certificate %s is not recorded", secondFingerprint)
+	}
+
+	if !first.FirstSeenAt.Before(first.LastSeenAt) {
+		t.Fatalf("expected the last seen time of the replaced certificate to be updated by the second collection")
+	}
+
+	if second.FirstSeenAt.Before(first.LastSeenAt) {
+		t.Fatalf("replacing certificate is seen before the replaced one")
+	}
+}
+
+func createTestCertificate(t *testing.T, domain string, serial int64, notBefore time.Time) (string, *agentintegration.Certificate, string) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.AddDate(0, 3, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := sha256.Sum256(der)
+	cert := &agentintegration.Certificate{
+		CN:        domain,
+		DNSNames:  []string{domain},
+		ValidFrom: template.NotBefore.Format(time.RFC822Z),
+		ValidTo:   template.NotAfter.Format(time.RFC822Z),
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert, hex.EncodeToString(fingerprint[:])
+}
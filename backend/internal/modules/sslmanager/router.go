@@ -3,9 +3,15 @@ package sslmanager
 import (
 	"backend/internal/app/panel/adapters/api/auth"
 	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
 	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
 	certApi "backend/internal/modules/sslmanager/adapters/api"
 	"backend/internal/modules/sslmanager/autorenewal/logstorage"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/modules/sslmanager/inventory/certstorage"
 	"backend/internal/modules/sslmanager/service"
 	"backend/internal/pkg/logger"
 
@@ -18,12 +24,22 @@ func InitRouter(
 	appServerStorage serverStorage.ServerStorage,
 	appDomainSettingStorage domainStorage.DomainSettingStorage,
 	certRenewalLogStorage logstorage.RenewalLogStorage,
+	dnsProviderStorage dnsstorage.DnsProviderStorage,
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage,
+	issuer *acmeissuer.Issuer,
+	appAgentProvider *agentprovider.AgentProvider,
+	appMaintenanceChecker maintenance.Checker,
 	logger logger.Logger,
 ) {
 	appCertificateService := service.NewCertificateService(
 		appServerStorage,
 		appDomainSettingStorage,
 		certRenewalLogStorage,
+		dnsProviderStorage,
+		certificateAuthorityStorage,
+		issuer,
+		appAgentProvider,
+		appMaintenanceChecker,
 		logger,
 	)
 
@@ -35,7 +51,53 @@ func InitRouter(
 	group.POST("/:serverId/storage/upload", certApi.CreateUploadCertificateToStorageHandler(cAuth, appCertificateService))
 	group.POST("/:serverId/storage/download", certApi.CreateDownloadCertificateFromStorageHandler(cAuth, appCertificateService))
 	group.GET("/:serverId/storage/certificates", certApi.CreateGetStorageCertificatesHandler(cAuth, appCertificateService))
+	group.POST("/:serverId/storage/assign-matching", certApi.CreateAssignMatchingCertificateHandler(cAuth, appCertificateService))
 	group.POST("/:serverId/storage/remove", certApi.CreateRemoveCertificateFromStorageHandler(cAuth, appCertificateService))
 	group.POST("/:serverId/storage/add-self-signed", certApi.CreateAddSelfSignCertificateToStorageHandler(cAuth, appCertificateService))
 	group.GET("/:serverId/renewal/latest-logs", certApi.CreateGetLatestCertRenewalLogsHandler(cAuth, appCertificateService))
 }
+
+// InitDnsProviderRouter registers routes of DNS providers that solve DNS-01 challenges of the account
+func InitDnsProviderRouter(
+	group *gin.RouterGroup,
+	cAuth auth.Auth,
+	dnsProviderStorage dnsstorage.DnsProviderStorage,
+	logger logger.Logger,
+) {
+	dnsProviderService := service.NewDnsProviderService(dnsProviderStorage, logger)
+
+	group.GET("", certApi.CreateFindDnsProvidersHandler(cAuth, dnsProviderService))
+	group.POST("", certApi.CreateSaveDnsProviderHandler(cAuth, dnsProviderService))
+	group.POST("/:providerId", certApi.CreateSaveDnsProviderHandler(cAuth, dnsProviderService))
+	group.DELETE("/:providerId", certApi.CreateRemoveDnsProviderHandler(cAuth, dnsProviderService))
+	group.POST("/:providerId/check", certApi.CreateCheckDnsProviderHandler(cAuth, dnsProviderService))
+}
+
+// InitCertificateAuthorityRouter registers routes of ACME certificate authorities of the account
+func InitCertificateAuthorityRouter(
+	group *gin.RouterGroup,
+	cAuth auth.Auth,
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage,
+	logger logger.Logger,
+) {
+	caService := service.NewCertificateAuthorityService(certificateAuthorityStorage, logger)
+
+	group.GET("", certApi.CreateFindCertificateAuthoritiesHandler(cAuth, caService))
+	group.POST("", certApi.CreateSaveCertificateAuthorityHandler(cAuth, caService))
+	group.POST("/:caId", certApi.CreateSaveCertificateAuthorityHandler(cAuth, caService))
+	group.DELETE("/:caId", certApi.CreateRemoveCertificateAuthorityHandler(cAuth, caService))
+}
+
+// InitInventoryRouter registers routes of the certificate inventory of the account
+func InitInventoryRouter(
+	group *gin.RouterGroup,
+	cAuth auth.Auth,
+	appServerStorage serverStorage.ServerStorage,
+	certificateStorage certstorage.CertificateStorage,
+) {
+	inventoryService := service.NewInventoryService(certificateStorage, appServerStorage)
+
+	group.GET("/domains/:domainName", certApi.CreateFindInventoryByDomainHandler(cAuth, inventoryService))
+	group.GET("/fingerprints/:fingerprint", certApi.CreateFindInventoryByFingerprintHandler(cAuth, inventoryService))
+	group.GET("/expiring", certApi.CreateFindExpiringInventoryHandler(cAuth, inventoryService))
+}
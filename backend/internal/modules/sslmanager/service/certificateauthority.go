@@ -0,0 +1,143 @@
+package service
+
+import (
+	"backend/internal/modules/sslmanager/acmestorage"
+	"backend/internal/pkg/acme"
+	"backend/internal/pkg/logger"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+var (
+	ErrCertificateAuthorityNotFound  = errors.New("certificate authority not found")
+	ErrCertificateAuthorityNameUsed  = errors.New("certificate authority with the same name already exists")
+	ErrInvalidDirectoryURL           = errors.New("invalid acme directory url")
+	ErrInvalidExternalAccountBinding = errors.New("eab key id and hmac key must be set together")
+)
+
+// CertificateAuthorityService manages ACME certificate authorities of accounts
+type CertificateAuthorityService struct {
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage
+	logger                      logger.Logger
+}
+
+func (s CertificateAuthorityService) FindCertificateAuthorities(accountID int) ([]CertificateAuthority, error) {
+	caModels, err := s.certificateAuthorityStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	authorities := []CertificateAuthority{}
+
+	for _, caModel := range caModels {
+		authorities = append(authorities, createCertificateAuthority(caModel))
+	}
+
+	return authorities, nil
+}
+
+func (s CertificateAuthorityService) SaveCertificateAuthority(request SaveCertificateAuthorityRequest) (*CertificateAuthority, error) {
+	caModel := &acmestorage.CertificateAuthority{AccountID: uint(request.AccountID)}
+
+	if request.ID != 0 {
+		var err error
+		caModel, err = s.findCertificateAuthority(request.ID, request.AccountID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the MAC key is not returned to clients, so an empty key means the current one is kept
+		if request.EabHmacKey == "" && request.EabKeyID == caModel.EabKeyID {
+			request.EabHmacKey = caModel.EabHmacKey
+		}
+	}
+
+	directoryURL, err := url.Parse(request.DirectoryURL)
+
+	if err != nil || (directoryURL.Scheme != "https" && directoryURL.Scheme != "http") || directoryURL.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDirectoryURL, request.DirectoryURL)
+	}
+
+	if (request.EabKeyID == "") != (request.EabHmacKey == "") {
+		return nil, ErrInvalidExternalAccountBinding
+	}
+
+	if request.EabHmacKey != "" {
+		if _, err = acme.DecodeHmacKey(request.EabHmacKey); err != nil {
+			return nil, err
+		}
+	}
+
+	sameNameCA, err := s.certificateAuthorityStorage.FindByName(request.AccountID, request.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sameNameCA != nil && sameNameCA.ID != caModel.ID {
+		return nil, ErrCertificateAuthorityNameUsed
+	}
+
+	caModel.Name = request.Name
+	caModel.DirectoryURL = request.DirectoryURL
+	caModel.EabKeyID = request.EabKeyID
+	caModel.EabHmacKey = request.EabHmacKey
+	caModel.PreferredChain = request.PreferredChain
+
+	if err = s.certificateAuthorityStorage.Save(caModel); err != nil {
+		return nil, fmt.Errorf("could not save certificate authority: %v", err)
+	}
+
+	s.logger.Info(fmt.Sprintf("certificate authority %s saved, account: %d, directory: %s", caModel.Name, request.AccountID, caModel.DirectoryURL))
+	ca := createCertificateAuthority(*caModel)
+
+	return &ca, nil
+}
+
+// RemoveCertificateAuthority removes the authority. Renewal of domains issued by it fails until they are issued again.
+func (s CertificateAuthorityService) RemoveCertificateAuthority(request CertificateAuthorityRequest) error {
+	caModel, err := s.findCertificateAuthority(request.ID, request.AccountID)
+
+	if err != nil {
+		return err
+	}
+
+	return s.certificateAuthorityStorage.Remove(caModel)
+}
+
+func (s CertificateAuthorityService) findCertificateAuthority(id, accountID int) (*acmestorage.CertificateAuthority, error) {
+	caModel, err := s.certificateAuthorityStorage.FindByID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if caModel == nil || caModel.AccountID != uint(accountID) {
+		return nil, ErrCertificateAuthorityNotFound
+	}
+
+	return caModel, nil
+}
+
+func NewCertificateAuthorityService(certificateAuthorityStorage acmestorage.CertificateAuthorityStorage, logger logger.Logger) CertificateAuthorityService {
+	return CertificateAuthorityService{
+		certificateAuthorityStorage: certificateAuthorityStorage,
+		logger:                      logger,
+	}
+}
+
+func createCertificateAuthority(caModel acmestorage.CertificateAuthority) CertificateAuthority {
+	return CertificateAuthority{
+		ID:             int(caModel.ID),
+		Name:           caModel.Name,
+		DirectoryURL:   caModel.DirectoryURL,
+		EabKeyID:       caModel.EabKeyID,
+		HasEabHmacKey:  caModel.EabHmacKey != "",
+		PreferredChain: caModel.PreferredChain,
+		CreatedAt:      caModel.CreatedAt,
+		UpdatedAt:      caModel.UpdatedAt,
+	}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/pkg/acme"
+	"backend/internal/pkg/dns"
+	"backend/internal/pkg/logger"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDnsProviderNotFound    = errors.New("dns provider not found")
+	ErrDnsProviderNameUsed    = errors.New("dns provider with the same name already exists")
+	ErrDnsProviderRequired    = errors.New("dns provider is required for the dns challenge")
+	ErrDnsProviderCheckFailed = errors.New("dns provider check failed")
+	ErrInvalidChallengeType   = errors.New("invalid challenge type")
+)
+
+// DnsProviderService manages DNS providers of accounts that solve DNS-01 challenges
+type DnsProviderService struct {
+	dnsProviderStorage dnsstorage.DnsProviderStorage
+	logger             logger.Logger
+}
+
+func (s DnsProviderService) FindDnsProviders(accountID int) ([]DnsProvider, error) {
+	providerModels, err := s.dnsProviderStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []DnsProvider{}
+
+	for _, providerModel := range providerModels {
+		provider, err := createDnsProvider(providerModel)
+
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+func (s DnsProviderService) SaveDnsProvider(request SaveDnsProviderRequest) (*DnsProvider, error) {
+	providerModel := &dnsstorage.DnsProvider{AccountID: uint(request.AccountID)}
+	settings := map[string]string{}
+
+	if request.ID != 0 {
+		var err error
+		providerModel, err = s.findDnsProvider(request.ID, request.AccountID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if providerModel.Type == request.Type {
+			if settings, err = providerModel.GetSettings(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for name, value := range request.Settings {
+		// credentials are not returned to clients, so an empty credential means the current one is kept
+		if value == "" && dns.IsSecretSetting(request.Type, name) {
+			continue
+		}
+
+		settings[name] = value
+	}
+
+	for name := range settings {
+		if _, ok := request.Settings[name]; !ok && !dns.IsSecretSetting(request.Type, name) {
+			delete(settings, name)
+		}
+	}
+
+	if _, err := dns.CreateProvider(request.Type, settings); err != nil {
+		return nil, err
+	}
+
+	sameNameProvider, err := s.dnsProviderStorage.FindByName(request.AccountID, request.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sameNameProvider != nil && sameNameProvider.ID != providerModel.ID {
+		return nil, ErrDnsProviderNameUsed
+	}
+
+	providerModel.Name = request.Name
+	providerModel.Type = request.Type
+
+	if err = providerModel.SetSettings(settings); err != nil {
+		return nil, err
+	}
+
+	if err = s.dnsProviderStorage.Save(providerModel); err != nil {
+		return nil, fmt.Errorf("could not save dns provider: %v", err)
+	}
+
+	provider, err := createDnsProvider(*providerModel)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider, nil
+}
+
+func (s DnsProviderService) RemoveDnsProvider(request DnsProviderRequest) error {
+	providerModel, err := s.findDnsProvider(request.ID, request.AccountID)
+
+	if err != nil {
+		return err
+	}
+
+	return s.dnsProviderStorage.Remove(providerModel)
+}
+
+// CheckDnsProvider creates and removes a challenge TXT record of the domain to check the provider settings
+func (s DnsProviderService) CheckDnsProvider(ctx context.Context, request CheckDnsProviderRequest) error {
+	providerModel, err := s.findDnsProvider(request.ID, request.AccountID)
+
+	if err != nil {
+		return err
+	}
+
+	provider, err := createProvider(providerModel)
+
+	if err != nil {
+		return err
+	}
+
+	token := make([]byte, 16)
+
+	if _, err = rand.Read(token); err != nil {
+		return err
+	}
+
+	fqdn, value := acme.DnsChallengeRecord(request.DomainName, hex.EncodeToString(token))
+
+	if err = provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("%w: %v", ErrDnsProviderCheckFailed, err)
+	}
+
+	if err = provider.CleanUp(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("%w: %v", ErrDnsProviderCheckFailed, err)
+	}
+
+	s.logger.Info(fmt.Sprintf("dns provider %s checked, account: %d, record: %s", providerModel.Name, request.AccountID, fqdn))
+
+	return nil
+}
+
+func (s DnsProviderService) findDnsProvider(id, accountID int) (*dnsstorage.DnsProvider, error) {
+	providerModel, err := s.dnsProviderStorage.FindByID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if providerModel == nil || providerModel.AccountID != uint(accountID) {
+		return nil, ErrDnsProviderNotFound
+	}
+
+	return providerModel, nil
+}
+
+func NewDnsProviderService(dnsProviderStorage dnsstorage.DnsProviderStorage, logger logger.Logger) DnsProviderService {
+	return DnsProviderService{
+		dnsProviderStorage: dnsProviderStorage,
+		logger:             logger,
+	}
+}
+
+func createProvider(providerModel *dnsstorage.DnsProvider) (dns.Provider, error) {
+	settings, err := providerModel.GetSettings()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dns.CreateProvider(providerModel.Type, settings)
+}
+
+func createDnsProvider(providerModel dnsstorage.DnsProvider) (DnsProvider, error) {
+	settings, err := providerModel.GetSettings()
+
+	if err != nil {
+		return DnsProvider{}, err
+	}
+
+	for name := range settings {
+		if dns.IsSecretSetting(providerModel.Type, name) {
+			delete(settings, name)
+		}
+	}
+
+	return DnsProvider{
+		ID:        int(providerModel.ID),
+		Name:      providerModel.Name,
+		Type:      providerModel.Type,
+		Settings:  settings,
+		CreatedAt: providerModel.CreatedAt,
+		UpdatedAt: providerModel.UpdatedAt,
+	}, nil
+}
@@ -42,18 +42,25 @@ type SelfSignedCertificateRequest struct {
 	Locality     string   `json:"locality"`
 	Organization string   `json:"organization"`
 	AltNames     []string `json:"altNames"`
+	Force        bool     `json:"force"`
 	AccountID    int
 }
 
 type IssueCertificateRequest struct {
-	ServerGuid       string
-	DomainName       string
-	Email            string            `json:"email"`
-	WebServer        string            `json:"webserver"`
-	ChallengeType    string            `json:"challengetype"`
+	ServerGuid    string
+	DomainName    string
+	Email         string `json:"email"`
+	WebServer     string `json:"webserver"`
+	ChallengeType string `json:"challengetype"`
+	DnsProviderID int    `json:"dnsprovider"`
+	// CertificateAuthorityID is the ID of the certificate authority of the account, zero means the default one
+	CertificateAuthorityID int `json:"ca"`
+	// Client is the ACME client that issues the certificate: certbot on the server or the panel
+	Client           string            `json:"client"`
 	Subjects         []string          `json:"subjects"`
 	AdditionalParams map[string]string `json:"params"`
 	Assign           bool              `json:"assign"`
+	Force            bool              `json:"force"`
 	AccountID        int
 }
 
@@ -69,6 +76,7 @@ type ChangeCommonDirStatusRequest struct {
 	DomainName string
 	Status     bool   `json:"status"`
 	WebServer  string `json:"webserver"`
+	Force      bool   `json:"force"`
 	AccountID  int
 }
 
@@ -83,9 +91,26 @@ type AssignCertificateRequest struct {
 	WebServer  string `json:"webserver"`
 	CertName   string `json:"name"`
 	Storage    string `json:"storage"`
+	Force      bool   `json:"force"`
 	AccountID  int
 }
 
+// AssignMatchingCertificateRequest assigns the storage certificate to every domain of the server it covers,
+// e.g. a wildcard certificate to all subdomains
+type AssignMatchingCertificateRequest struct {
+	ServerGuid string
+	CertName   string `json:"name"`
+	Storage    string `json:"storage"`
+	Force      bool   `json:"force"`
+	AccountID  int
+}
+
+type AssignResult struct {
+	DomainName string `json:"domain"`
+	WebServer  string `json:"webserver"`
+	Error      string `json:"error,omitempty"`
+}
+
 type CertificatesRequest struct {
 	Guid      string
 	AccountID int
@@ -95,6 +120,7 @@ type UploadCertificateToStorageRequest struct {
 	ServerGuid     string
 	CertName       string
 	PemCertificate string
+	Force          bool
 	AccountID      int
 }
 
@@ -109,6 +135,7 @@ type RemoveCertificateFromStorageRequest struct {
 	ServerGuid string
 	CertName   string
 	Storage    string
+	Force      bool
 	AccountID  int
 }
 
@@ -128,5 +155,109 @@ type RenewalLog struct {
 type UploadCertificateRequest struct {
 	ServerGuid string
 	Data       agentintegration.CertificateUploadRequestData
+	Force      bool
 	AccountID  int
 }
+
+// DnsProvider is a DNS provider of the account. Credentials are not included in settings.
+type DnsProvider struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Settings  map[string]string `json:"settings"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// SaveDnsProviderRequest creates a provider or updates the provider with the ID.
+// Credentials missed in settings of an existing provider are kept.
+type SaveDnsProviderRequest struct {
+	ID        int
+	Name      string            `json:"name" validate:"nonzero,max=64"`
+	Type      string            `json:"type" validate:"nonzero"`
+	Settings  map[string]string `json:"settings"`
+	AccountID int
+}
+
+type DnsProviderRequest struct {
+	ID        int
+	AccountID int
+}
+
+type CheckDnsProviderRequest struct {
+	ID         int
+	DomainName string `json:"domain" validate:"nonzero,max=255"`
+	AccountID  int
+}
+
+// CertificateAuthority is an ACME certificate authority of the account. The EAB MAC key is not included.
+type CertificateAuthority struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	DirectoryURL   string    `json:"directory_url"`
+	EabKeyID       string    `json:"eab_kid"`
+	HasEabHmacKey  bool      `json:"has_eab_hmac_key"`
+	PreferredChain string    `json:"preferred_chain"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SaveCertificateAuthorityRequest creates a certificate authority or updates the authority with the ID.
+// An empty MAC key of an existing authority with the same EAB key ID means the current key is kept.
+type SaveCertificateAuthorityRequest struct {
+	ID             int
+	Name           string `json:"name" validate:"nonzero,max=64"`
+	DirectoryURL   string `json:"directory_url" validate:"nonzero,max=255"`
+	EabKeyID       string `json:"eab_kid" validate:"max=255"`
+	EabHmacKey     string `json:"eab_hmac_key"`
+	PreferredChain string `json:"preferred_chain" validate:"max=255"`
+	AccountID      int
+}
+
+type CertificateAuthorityRequest struct {
+	ID        int
+	AccountID int
+}
+
+// InventoryCertificate is a certificate recorded in the certificate inventory with the locations it was seen at
+type InventoryCertificate struct {
+	Fingerprint        string                `json:"fingerprint"`
+	SerialNumber       string                `json:"serial_number"`
+	CommonName         string                `json:"cn"`
+	Names              []string              `json:"names"`
+	IssuerCN           string                `json:"issuer_cn"`
+	IssuerOrganization string                `json:"issuer_organization"`
+	KeyType            string                `json:"key_type"`
+	NotBefore          time.Time             `json:"not_before"`
+	NotAfter           time.Time             `json:"not_after"`
+	Sightings          []CertificateSighting `json:"sightings"`
+}
+
+// CertificateSighting is a virtual host or a storage entry of the server the certificate was deployed at
+type CertificateSighting struct {
+	ServerGuid  string    `json:"server_guid"`
+	ServerName  string    `json:"server_name"`
+	Source      string    `json:"source"`
+	Location    string    `json:"location"`
+	WebServer   string    `json:"webserver,omitempty"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+type InventoryDomainRequest struct {
+	DomainName string
+	AccountID  int
+}
+
+type InventoryFingerprintRequest struct {
+	Fingerprint string
+	AccountID   int
+}
+
+// InventoryExpiringRequest selects certificates that expire in the range. The range starts now
+// if from is not set and lasts for 30 days if to is not set.
+type InventoryExpiringRequest struct {
+	From      time.Time `form:"from" time_format:"2006-01-02"`
+	To        time.Time `form:"to" time_format:"2006-01-02"`
+	AccountID int
+}
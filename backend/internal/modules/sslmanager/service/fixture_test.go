@@ -0,0 +1,96 @@
+package service
+
+import (
+	"backend/config"
+	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"testing"
+)
+
+const testToken = "test-token"
+
+// testEnv holds memory storages and the agent provider the certificate service under test is created with
+type testEnv struct {
+	serverStorage      serverStorage.ServerStorage
+	settingStorage     domainStorage.DomainSettingStorage
+	dnsProviderStorage dnsstorage.DnsProviderStorage
+	caStorage          acmestorage.CertificateAuthorityStorage
+	maintenanceStorage serverStorage.MaintenanceStorage
+	provider           *agentprovider.AgentProvider
+	maintenance        maintenance.Checker
+}
+
+func createTestEnv(t *testing.T) testEnv {
+	t.Helper()
+
+	storage := testutil.NewServerMemoryStorage()
+	groupStorage := testutil.NewServerGroupMemoryStorage()
+	tagStorage := testutil.NewServerTagMemoryStorage()
+	maintenanceStorage := testutil.NewMaintenanceMemoryStorage()
+	provider, err := agentprovider.CreateAgentProvider(&config.Config{}, storage, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testEnv{
+		serverStorage:      storage,
+		settingStorage:     testutil.NewDomainSettingMemoryStorage(),
+		dnsProviderStorage: testutil.CreateMemoryDnsProviderStorage(),
+		caStorage:          testutil.CreateMemoryCertificateAuthorityStorage(),
+		maintenanceStorage: maintenanceStorage,
+		provider:           provider,
+		maintenance:        maintenance.CreateChecker(maintenanceStorage, groupStorage, tagStorage),
+	}
+}
+
+// certificateService creates the service that issues certificates with the panel ACME client, if the issuer is set
+func (e testEnv) certificateService(issuer *acmeissuer.Issuer) CertificateService {
+	return NewCertificateService(
+		e.serverStorage,
+		e.settingStorage,
+		nil,
+		e.dnsProviderStorage,
+		e.caStorage,
+		issuer,
+		e.provider,
+		e.maintenance,
+		logger.NewNopLogger(),
+	)
+}
+
+func (e testEnv) addServer(t *testing.T, ip string, port int) *serverStorage.Server {
+	t.Helper()
+
+	server := &serverStorage.Server{Name: "test", Ipv4Address: ip, AgentPort: port, Token: testToken, AccountID: 1}
+
+	if err := e.serverStorage.Save(server); err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+// startAgent starts the fake agent, which is closed with the test, and adds its server
+func (e testEnv) startAgent(t *testing.T) (*fakeagent.Agent, *serverStorage.Server) {
+	t.Helper()
+
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(fAgent.Close)
+	ip, port := fAgent.Address()
+
+	return fAgent, e.addServer(t, ip, port)
+}
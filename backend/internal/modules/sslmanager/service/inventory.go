@@ -0,0 +1,166 @@
+package service
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/inventory/certstorage"
+	"errors"
+	"strings"
+	"time"
+)
+
+const defaultExpiringRange = 30 * 24 * time.Hour
+
+var (
+	ErrInventoryCertificateNotFound = errors.New("certificate not found in the inventory")
+	ErrInvalidExpiringRange         = errors.New("the end of the expiry range must not be before its start")
+)
+
+// InventoryService answers queries to the certificate inventory of the account
+type InventoryService struct {
+	certificateStorage certstorage.CertificateStorage
+	serverStorage      serverStorage.ServerStorage
+}
+
+// FindByDomain returns certificates ever deployed on virtual hosts of the domain, the latest expiring first
+func (s InventoryService) FindByDomain(request InventoryDomainRequest) ([]InventoryCertificate, error) {
+	certModels, err := s.certificateStorage.FindAllByLocation(request.AccountID, certstorage.VhostSource, request.DomainName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createInventoryCertificates(request.AccountID, certModels)
+}
+
+// FindByFingerprint returns the certificate with the SHA-256 fingerprint and all locations it was seen at.
+// The fingerprint may be in the colon separated form.
+func (s InventoryService) FindByFingerprint(request InventoryFingerprintRequest) (*InventoryCertificate, error) {
+	fingerprint := strings.ToLower(strings.ReplaceAll(request.Fingerprint, ":", ""))
+	certModel, err := s.certificateStorage.FindByFingerprint(request.AccountID, fingerprint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if certModel == nil {
+		return nil, ErrInventoryCertificateNotFound
+	}
+
+	certificates, err := s.createInventoryCertificates(request.AccountID, []certstorage.Certificate{*certModel})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificates[0], nil
+}
+
+// FindExpiring returns certificates that expire in the range, the soonest expiring first
+func (s InventoryService) FindExpiring(request InventoryExpiringRequest) ([]InventoryCertificate, error) {
+	from := request.From
+
+	if from.IsZero() {
+		from = time.Now()
+	}
+
+	to := request.To
+
+	if to.IsZero() {
+		to = from.Add(defaultExpiringRange)
+	}
+
+	if to.Before(from) {
+		return nil, ErrInvalidExpiringRange
+	}
+
+	certModels, err := s.certificateStorage.FindAllExpiring(request.AccountID, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createInventoryCertificates(request.AccountID, certModels)
+}
+
+func (s InventoryService) createInventoryCertificates(accountID int, certModels []certstorage.Certificate) ([]InventoryCertificate, error) {
+	certificates := []InventoryCertificate{}
+
+	if len(certModels) == 0 {
+		return certificates, nil
+	}
+
+	ids := make([]uint, 0, len(certModels))
+
+	for _, certModel := range certModels {
+		ids = append(ids, certModel.ID)
+	}
+
+	sightingModels, err := s.certificateStorage.FindSightings(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := s.serverStorage.FindAllByAccountID(accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serversMap := map[uint]serverStorage.Server{}
+
+	for _, server := range servers {
+		serversMap[server.ID] = server
+	}
+
+	sightings := map[uint][]CertificateSighting{}
+
+	for _, sightingModel := range sightingModels {
+		// only servers of the account are reported
+		server, ok := serversMap[sightingModel.ServerID]
+
+		if !ok {
+			continue
+		}
+
+		sightings[sightingModel.CertificateID] = append(sightings[sightingModel.CertificateID], CertificateSighting{
+			ServerGuid:  server.Guid,
+			ServerName:  server.Name,
+			Source:      sightingModel.Source,
+			Location:    sightingModel.Location,
+			WebServer:   sightingModel.WebServer,
+			FirstSeenAt: sightingModel.FirstSeenAt,
+			LastSeenAt:  sightingModel.LastSeenAt,
+		})
+	}
+
+	for _, certModel := range certModels {
+		certSightings, ok := sightings[certModel.ID]
+
+		if !ok {
+			certSightings = []CertificateSighting{}
+		}
+
+		certificates = append(certificates, InventoryCertificate{
+			Fingerprint:        certModel.Fingerprint,
+			SerialNumber:       certModel.SerialNumber,
+			CommonName:         certModel.CommonName,
+			Names:              certModel.GetNames(),
+			IssuerCN:           certModel.IssuerCN,
+			IssuerOrganization: certModel.IssuerOrganization,
+			KeyType:            certModel.KeyType,
+			NotBefore:          certModel.NotBefore,
+			NotAfter:           certModel.NotAfter,
+			Sightings:          certSightings,
+		})
+	}
+
+	return certificates, nil
+}
+
+func NewInventoryService(certificateStorage certstorage.CertificateStorage, serverStorage serverStorage.ServerStorage) InventoryService {
+	return InventoryService{
+		certificateStorage: certificateStorage,
+		serverStorage:      serverStorage,
+	}
+}
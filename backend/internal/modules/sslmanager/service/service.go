@@ -4,78 +4,176 @@ import (
 	"backend/internal/app/panel/domain/dto"
 	domainFactory "backend/internal/app/panel/domain/factory"
 	domainStorage "backend/internal/app/panel/domain/storage"
+	"backend/internal/app/panel/server/agentprovider"
+	"backend/internal/app/panel/server/maintenance"
 	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
 	"backend/internal/modules/sslmanager/agent"
 	"backend/internal/modules/sslmanager/autorenewal/logstorage"
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"backend/internal/pkg/acme"
+	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
-	serverAgent "backend/internal/pkg/agent"
 	"backend/internal/pkg/certificate"
 	"backend/internal/pkg/logger"
 
 	"github.com/r2dtools/agentintegration"
 )
 
-var ErrServerNotFound = errors.New("server not found")
+var (
+	ErrServerNotFound               = errors.New("server not found")
+	ErrCertificateNotFound          = errors.New("certificate not found")
+	ErrWildcardRequiresDnsChallenge = errors.New("wildcard certificate can be issued only with the dns challenge")
+)
+
+// renewalSettings are the domain settings the certificate is renewed with
+var renewalSettings = []string{
+	"renewal",
+	"email",
+	"challengetype",
+	"dnsprovider",
+	"issueclient",
+	"ca",
+	agent.IssuedCertificateSetting,
+}
 
 type CertificateService struct {
-	serverStorage         serverStorage.ServerStorage
-	domainSettingsStorage domainStorage.DomainSettingStorage
-	certRenewalLogStorage logstorage.RenewalLogStorage
-	logger                logger.Logger
+	serverStorage               serverStorage.ServerStorage
+	domainSettingsStorage       domainStorage.DomainSettingStorage
+	certRenewalLogStorage       logstorage.RenewalLogStorage
+	dnsProviderStorage          dnsstorage.DnsProviderStorage
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage
+	issuer                      *acmeissuer.Issuer
+	agentProvider               *agentprovider.AgentProvider
+	maintenance                 maintenance.Checker
+	logger                      logger.Logger
 }
 
-func (s CertificateService) IssueCertificate(request IssueCertificateRequest) (*dto.DomainCertificate, error) {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+func (s CertificateService) IssueCertificate(ctx context.Context, request IssueCertificateRequest) (*dto.DomainCertificate, error) {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, request.DomainName, request.Force)
 
 	if err != nil {
 		return nil, err
 	}
 
-	emailSetting, err := s.domainSettingsStorage.FindByDomain(request.DomainName, request.ServerGuid, "email")
+	if err = acme.ValidateSubjects(request.Subjects); err != nil {
+		return nil, err
+	}
+
+	// wildcard domains can be validated only with the DNS challenge
+	if acme.HasWildcard(request.Subjects) {
+		if request.ChallengeType == "" {
+			request.ChallengeType = acme.DnsChallengeType
+		} else if request.ChallengeType != acme.DnsChallengeType {
+			return nil, ErrWildcardRequiresDnsChallenge
+		}
+	}
+
+	if request.Client == "" {
+		request.Client = acmeissuer.CertbotClient
+	} else if !acmeissuer.IsValidClient(request.Client) {
+		return nil, fmt.Errorf("%w: %s", acmeissuer.ErrInvalidClient, request.Client)
+	}
+
+	ca, err := s.findCertificateAuthority(request.CertificateAuthorityID, request.AccountID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if emailSetting == nil {
-		err = s.domainSettingsStorage.Create(request.DomainName, request.ServerGuid, "email", request.Email)
+	var dnsProvider *dnsstorage.DnsProvider
+	var dnsProviderID string
+
+	switch request.ChallengeType {
+	case acme.DnsChallengeType:
+		if dnsProvider, err = s.findDnsProvider(request); err != nil {
+			return nil, err
+		}
+
+		dnsProviderID = strconv.Itoa(request.DnsProviderID)
+	case acme.HttpChallengeType, "":
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidChallengeType, request.ChallengeType)
+	}
+
+	var cert *agentintegration.Certificate
+
+	if request.Client == acmeissuer.PanelClient {
+		cert, err = s.issuer.Issue(ctx, cAgent, acmeissuer.IssueRequest{
+			AccountID:            uint(request.AccountID),
+			Email:                request.Email,
+			ServerName:           request.DomainName,
+			WebServer:            request.WebServer,
+			Subjects:             request.Subjects,
+			ChallengeType:        request.ChallengeType,
+			DnsProvider:          dnsProvider,
+			CertificateAuthority: ca,
+			Assign:               request.Assign,
+		})
 	} else {
-		emailSetting.SettingValue = request.Email
-		err = s.domainSettingsStorage.Save(emailSetting)
+		params := request.AdditionalParams
+
+		if dnsProvider != nil {
+			if params, err = getDnsChallengeParams(params, dnsProvider); err != nil {
+				return nil, err
+			}
+		}
+
+		if ca != nil {
+			params = getCertificateAuthorityParams(params, ca)
+		}
+
+		cert, err = cAgent.Issue(ctx, agentintegration.CertificateIssueRequestData{
+			Email:            request.Email,
+			ServerName:       request.DomainName,
+			WebServer:        request.WebServer,
+			ChallengeType:    request.ChallengeType,
+			Subjects:         request.Subjects,
+			AdditionalParams: params,
+			Assign:           request.Assign,
+		})
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	cert, err := cAgent.Issue(agentintegration.CertificateIssueRequestData{
-		Email:            request.Email,
-		ServerName:       request.DomainName,
-		WebServer:        request.WebServer,
-		ChallengeType:    request.ChallengeType,
-		Subjects:         request.Subjects,
-		AdditionalParams: request.AdditionalParams,
-		Assign:           request.Assign,
-	})
+	// the client, the certificate authority, the challenge type and the provider are kept to renew the installed
+	// certificate the same way, along with the key of the certificate they apply to
+	if request.Assign && cert != nil {
+		settings := map[string]string{
+			"email":                        request.Email,
+			"challengetype":                request.ChallengeType,
+			"dnsprovider":                  dnsProviderID,
+			"issueclient":                  request.Client,
+			"ca":                           strconv.Itoa(request.CertificateAuthorityID),
+			agent.IssuedCertificateSetting: agent.GetIssuedCertificateKey(cert.Issuer.CN, cert.ValidFrom, cert.ValidTo),
+		}
 
-	if err != nil {
-		return nil, err
+		for name, value := range settings {
+			if err = s.saveDomainSetting(request.DomainName, request.ServerGuid, name, value); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return domainFactory.CreateCertificate(cert), nil
 }
 
-func (s CertificateService) AssignCertificate(request AssignCertificateRequest) (*dto.DomainCertificate, error) {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+func (s CertificateService) AssignCertificate(ctx context.Context, request AssignCertificateRequest) (*dto.DomainCertificate, error) {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, request.DomainName, request.Force)
 
 	if err != nil {
 		return nil, err
 	}
 
-	cert, err := cAgent.AssignCertificateToDomain(&agentintegration.CertificateAssignRequestData{
+	cert, err := cAgent.AssignCertificateToDomain(ctx, &agentintegration.CertificateAssignRequestData{
 		ServerName:  request.DomainName,
 		WebServer:   request.WebServer,
 		CertName:    request.CertName,
@@ -89,14 +187,99 @@ func (s CertificateService) AssignCertificate(request AssignCertificateRequest)
 	return domainFactory.CreateCertificate(cert), nil
 }
 
-func (s CertificateService) UploadCertificate(request UploadCertificateRequest) (*dto.DomainCertificate, error) {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+// AssignMatchingCertificate assigns the storage certificate to every domain of the server it covers.
+// Domains in maintenance are skipped unless the operation is forced, failures of single domains are reported in results.
+// If the panel issued the certificate for one of the domains, its renewal settings are copied to the assigned domains,
+// so each of them renews the certificate with the same subjects, challenge type and certificate authority.
+func (s CertificateService) AssignMatchingCertificate(ctx context.Context, request AssignMatchingCertificateRequest) ([]AssignResult, error) {
+	server, err := s.findServer(request.ServerGuid, request.AccountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkMaintenance(server, "", request.Force); err != nil {
+		return nil, err
+	}
+
+	cAgent, err := s.createCertificateAgent(server)
 
 	if err != nil {
 		return nil, err
 	}
 
-	cert, err := cAgent.Upload(&request.Data)
+	certsMap, err := cAgent.GetStorageCertificates(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := certsMap[request.Storage+"__"+request.CertName]
+
+	if !ok || cert == nil {
+		return nil, ErrCertificateNotFound
+	}
+
+	vhosts, err := cAgent.GetVhosts(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := s.findRenewalSettings(server.Guid, vhosts, cert)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := []AssignResult{}
+	subjects := append([]string{cert.CN}, cert.DNSNames...)
+
+	for _, vhost := range vhosts {
+		if !acme.MatchSubjects(subjects, vhost.ServerName) {
+			continue
+		}
+
+		result := AssignResult{DomainName: vhost.ServerName, WebServer: vhost.WebServer}
+
+		if err = s.checkMaintenance(server, vhost.ServerName, request.Force); err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+
+			continue
+		}
+
+		_, err = cAgent.AssignCertificateToDomain(ctx, &agentintegration.CertificateAssignRequestData{
+			ServerName:  vhost.ServerName,
+			WebServer:   vhost.WebServer,
+			CertName:    request.CertName,
+			StorageType: request.Storage,
+		})
+
+		if err == nil {
+			err = s.copyRenewalSettings(server.Guid, vhost.ServerName, settings)
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	s.logger.Info(fmt.Sprintf("certificate %s assigned to %d matching domains of server %s", request.CertName, len(results), server.Name))
+
+	return results, nil
+}
+
+func (s CertificateService) UploadCertificate(ctx context.Context, request UploadCertificateRequest) (*dto.DomainCertificate, error) {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, request.Data.ServerName, request.Force)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := cAgent.Upload(ctx, &request.Data)
 
 	if err != nil {
 		return nil, err
@@ -105,8 +288,8 @@ func (s CertificateService) UploadCertificate(request UploadCertificateRequest)
 	return domainFactory.CreateCertificate(cert), nil
 }
 
-func (s CertificateService) UploadCertificateToStorage(request UploadCertificateToStorageRequest) (*agentintegration.Certificate, error) {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+func (s CertificateService) UploadCertificateToStorage(ctx context.Context, request UploadCertificateToStorageRequest) (*agentintegration.Certificate, error) {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, "", request.Force)
 
 	if err != nil {
 		return nil, err
@@ -117,10 +300,10 @@ func (s CertificateService) UploadCertificateToStorage(request UploadCertificate
 		PemCertificate: request.PemCertificate,
 	}
 
-	return cAgent.UploadPemCertificateToStorage(&requestData)
+	return cAgent.UploadPemCertificateToStorage(ctx, &requestData)
 }
 
-func (s CertificateService) DownloadCertificateFromStorage(request DownloadCertificateRequest) (*agentintegration.CertificateDownloadResponseData, error) {
+func (s CertificateService) DownloadCertificateFromStorage(ctx context.Context, request DownloadCertificateRequest) (*agentintegration.CertificateDownloadResponseData, error) {
 	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
 
 	if err != nil {
@@ -132,17 +315,17 @@ func (s CertificateService) DownloadCertificateFromStorage(request DownloadCerti
 		StorageType: request.Storage,
 	}
 
-	return cAgent.DownloadtStorageCertificate(requestData)
+	return cAgent.DownloadtStorageCertificate(ctx, requestData)
 }
 
-func (s CertificateService) GetStorageCertificates(request CertificatesRequest) ([]StorageCertificateItem, error) {
+func (s CertificateService) GetStorageCertificates(ctx context.Context, request CertificatesRequest) ([]StorageCertificateItem, error) {
 	cAgent, err := s.getCertificateAgent(request.Guid, request.AccountID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	certsMap, err := cAgent.GetStorageCertificates()
+	certsMap, err := cAgent.GetStorageCertificates(ctx)
 
 	if err != nil {
 		return nil, err
@@ -167,8 +350,8 @@ func (s CertificateService) GetStorageCertificates(request CertificatesRequest)
 	return result, nil
 }
 
-func (s CertificateService) RemoveCertificateFromStorage(request RemoveCertificateFromStorageRequest) error {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+func (s CertificateService) RemoveCertificateFromStorage(ctx context.Context, request RemoveCertificateFromStorageRequest) error {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, "", request.Force)
 
 	if err != nil {
 		return err
@@ -179,10 +362,10 @@ func (s CertificateService) RemoveCertificateFromStorage(request RemoveCertifica
 		StorageType: request.Storage,
 	}
 
-	return cAgent.RemoveCertificateFromStorage(requestData)
+	return cAgent.RemoveCertificateFromStorage(ctx, requestData)
 }
 
-func (s CertificateService) GetCommonDirStatus(request CommonDirStatusRequest) (CommonDirStatusResponse, error) {
+func (s CertificateService) GetCommonDirStatus(ctx context.Context, request CommonDirStatusRequest) (CommonDirStatusResponse, error) {
 	var response CommonDirStatusResponse
 	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
 
@@ -190,7 +373,7 @@ func (s CertificateService) GetCommonDirStatus(request CommonDirStatusRequest) (
 		return response, err
 	}
 
-	agentResponse, err := cAgent.GetCommonDirStatus(agentintegration.CommonDirStatusRequestData{
+	agentResponse, err := cAgent.GetCommonDirStatus(ctx, agentintegration.CommonDirStatusRequestData{
 		WebServer:  request.WebServer,
 		ServerName: request.DomainName,
 	})
@@ -204,22 +387,22 @@ func (s CertificateService) GetCommonDirStatus(request CommonDirStatusRequest) (
 	return response, nil
 }
 
-func (s CertificateService) ChangeCommonDirStatus(request ChangeCommonDirStatusRequest) error {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+func (s CertificateService) ChangeCommonDirStatus(ctx context.Context, request ChangeCommonDirStatusRequest) error {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, request.DomainName, request.Force)
 
 	if err != nil {
 		return err
 	}
 
-	return cAgent.ChangeCommonDirStatus(agentintegration.CommonDirChangeStatusRequestData{
+	return cAgent.ChangeCommonDirStatus(ctx, agentintegration.CommonDirChangeStatusRequestData{
 		WebServer:  request.WebServer,
 		ServerName: request.DomainName,
 		Status:     request.Status,
 	})
 }
 
-func (s CertificateService) CreateSelfSignCertificate(request SelfSignedCertificateRequest) (*agentintegration.Certificate, error) {
-	cAgent, err := s.getCertificateAgent(request.ServerGuid, request.AccountID)
+func (s CertificateService) CreateSelfSignCertificate(ctx context.Context, request SelfSignedCertificateRequest) (*agentintegration.Certificate, error) {
+	cAgent, err := s.getMutatingCertificateAgent(request.ServerGuid, request.AccountID, "", request.Force)
 
 	if err != nil {
 		return nil, err
@@ -246,7 +429,7 @@ func (s CertificateService) CreateSelfSignCertificate(request SelfSignedCertific
 		PemCertificate: certPem,
 	}
 
-	return cAgent.UploadPemCertificateToStorage(&requestData)
+	return cAgent.UploadPemCertificateToStorage(ctx, &requestData)
 }
 
 func (s CertificateService) FindLatestCertificateRenewalLogs(request LatestRenewalLogsRequest) ([]RenewalLog, error) {
@@ -281,7 +464,180 @@ func (s CertificateService) FindLatestCertificateRenewalLogs(request LatestRenew
 	return logs, nil
 }
 
+// findDnsProvider returns the DNS provider of the account that solves the DNS-01 challenge of the request
+func (s CertificateService) findDnsProvider(request IssueCertificateRequest) (*dnsstorage.DnsProvider, error) {
+	if request.DnsProviderID == 0 {
+		return nil, ErrDnsProviderRequired
+	}
+
+	providerModel, err := s.dnsProviderStorage.FindByID(request.DnsProviderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if providerModel == nil || providerModel.AccountID != uint(request.AccountID) {
+		return nil, ErrDnsProviderNotFound
+	}
+
+	return providerModel, nil
+}
+
+// findCertificateAuthority returns the certificate authority of the account, nil means the default one
+func (s CertificateService) findCertificateAuthority(id, accountID int) (*acmestorage.CertificateAuthority, error) {
+	if id == 0 {
+		return nil, nil
+	}
+
+	ca, err := s.certificateAuthorityStorage.FindByID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ca == nil || ca.AccountID != uint(accountID) {
+		return nil, ErrCertificateAuthorityNotFound
+	}
+
+	return ca, nil
+}
+
+// getCertificateAuthorityParams returns additional params of the certbot issue request with the certificate authority
+func getCertificateAuthorityParams(params map[string]string, ca *acmestorage.CertificateAuthority) map[string]string {
+	return agent.CertificateAuthorityParams(params, ca.DirectoryURL, ca.EabKeyID, ca.EabHmacKey, ca.PreferredChain)
+}
+
+// getDnsChallengeParams returns additional params of the certbot issue request with the DNS provider
+func getDnsChallengeParams(params map[string]string, provider *dnsstorage.DnsProvider) (map[string]string, error) {
+	settings, err := provider.GetSettings()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return agent.DnsChallengeParams(params, provider.Type, settings), nil
+}
+
+// findRenewalSettings returns the renewal settings of the domain the panel issued the certificate for.
+// Nil is returned if the certificate is not issued by the panel for any of the domains.
+func (s CertificateService) findRenewalSettings(
+	serverGuid string,
+	vhosts []agentintegration.VirtualHost,
+	cert *agentintegration.Certificate,
+) (map[string]string, error) {
+	key := agent.GetIssuedCertificateKey(cert.Issuer.CN, cert.ValidFrom, cert.ValidTo)
+
+	for _, vhost := range vhosts {
+		setting, err := s.domainSettingsStorage.FindByDomain(vhost.ServerName, serverGuid, agent.IssuedCertificateSetting)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if setting == nil || setting.SettingValue != key {
+			continue
+		}
+
+		domainSettings, err := s.domainSettingsStorage.FindAllByDomain(vhost.ServerName, serverGuid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		settings := map[string]string{}
+
+		for _, domainSetting := range domainSettings {
+			if slices.Contains(renewalSettings, domainSetting.SettingName) {
+				settings[domainSetting.SettingName] = domainSetting.SettingValue
+			}
+		}
+
+		return settings, nil
+	}
+
+	return nil, nil
+}
+
+// copyRenewalSettings saves the renewal settings for the domain.
+// Auto renewal is enabled only if it has not been turned on or off for the domain.
+func (s CertificateService) copyRenewalSettings(serverGuid, domainName string, settings map[string]string) error {
+	for name, value := range settings {
+		if name == "renewal" {
+			setting, err := s.domainSettingsStorage.FindByDomain(domainName, serverGuid, name)
+
+			if err != nil {
+				return err
+			}
+
+			if setting != nil {
+				continue
+			}
+		}
+
+		if err := s.saveDomainSetting(domainName, serverGuid, name, value); err != nil {
+			return fmt.Errorf("certificate is assigned, but its renewal settings are not saved: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (s CertificateService) saveDomainSetting(domainName, serverGuid, name, value string) error {
+	setting, err := s.domainSettingsStorage.FindByDomain(domainName, serverGuid, name)
+
+	if err != nil {
+		return err
+	}
+
+	if setting == nil {
+		return s.domainSettingsStorage.Create(domainName, serverGuid, name, value)
+	}
+
+	setting.SettingValue = value
+
+	return s.domainSettingsStorage.Save(setting)
+}
+
 func (s CertificateService) getCertificateAgent(guid string, accountID int) (*agent.CertificateAgent, error) {
+	server, err := s.findServer(guid, accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createCertificateAgent(server)
+}
+
+// getMutatingCertificateAgent returns the agent for an operation that changes the server or the domain.
+// The operation is rejected during maintenance of the server or the domain unless it is forced.
+func (s CertificateService) getMutatingCertificateAgent(guid string, accountID int, domainName string, force bool) (*agent.CertificateAgent, error) {
+	server, err := s.findServer(guid, accountID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkMaintenance(server, domainName, force); err != nil {
+		return nil, err
+	}
+
+	return s.createCertificateAgent(server)
+}
+
+// checkMaintenance returns the maintenance error unless the operation is forced
+func (s CertificateService) checkMaintenance(server *serverStorage.Server, domainName string, force bool) error {
+	err := s.maintenance.Check(server, domainName)
+
+	if errors.Is(err, maintenance.ErrInMaintenance) && force {
+		s.logger.Info(fmt.Sprintf("operation is forced during maintenance, server: %s, domain: %s", server.Name, domainName))
+
+		return nil
+	}
+
+	return err
+}
+
+func (s CertificateService) findServer(guid string, accountID int) (*serverStorage.Server, error) {
 	server, err := s.serverStorage.FindByGuid(guid)
 
 	if err != nil {
@@ -292,13 +648,11 @@ func (s CertificateService) getCertificateAgent(guid string, accountID int) (*ag
 		return nil, ErrServerNotFound
 	}
 
-	sAgent, err := serverAgent.NewAgent(
-		server.Ipv4Address,
-		server.Ipv6Address,
-		server.Token,
-		server.AgentPort,
-		s.logger,
-	)
+	return server, nil
+}
+
+func (s CertificateService) createCertificateAgent(server *serverStorage.Server) (*agent.CertificateAgent, error) {
+	sAgent, err := s.agentProvider.GetAgent(server)
 
 	if err != nil {
 		return nil, err
@@ -311,13 +665,23 @@ func NewCertificateService(
 	serverStorage serverStorage.ServerStorage,
 	domainSettingStorage domainStorage.DomainSettingStorage,
 	certRenewalLogStorage logstorage.RenewalLogStorage,
+	dnsProviderStorage dnsstorage.DnsProviderStorage,
+	certificateAuthorityStorage acmestorage.CertificateAuthorityStorage,
+	issuer *acmeissuer.Issuer,
+	agentProvider *agentprovider.AgentProvider,
+	maintenanceChecker maintenance.Checker,
 	logger logger.Logger,
 ) CertificateService {
 	return CertificateService{
-		serverStorage:         serverStorage,
-		domainSettingsStorage: domainSettingStorage,
-		certRenewalLogStorage: certRenewalLogStorage,
-		logger:                logger,
+		serverStorage:               serverStorage,
+		domainSettingsStorage:       domainSettingStorage,
+		certRenewalLogStorage:       certRenewalLogStorage,
+		dnsProviderStorage:          dnsProviderStorage,
+		certificateAuthorityStorage: certificateAuthorityStorage,
+		issuer:                      issuer,
+		agentProvider:               agentProvider,
+		maintenance:                 maintenanceChecker,
+		logger:                      logger,
 	}
 }
 
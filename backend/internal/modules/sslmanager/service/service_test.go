@@ -0,0 +1,571 @@
+package service
+
+import (
+	"backend/config"
+	"backend/internal/app/panel/server/maintenance"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"backend/internal/modules/sslmanager/acmeissuer"
+	"backend/internal/modules/sslmanager/acmestorage"
+	"backend/internal/modules/sslmanager/agent"
+	"backend/internal/pkg/acme"
+	"backend/internal/pkg/acme/fakeacme"
+	"backend/internal/pkg/dns"
+	"backend/internal/pkg/logger"
+	"backend/internal/testutil"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+func TestIssueCertificate(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	fAgent.SetIssueResult(&agentintegration.Certificate{
+		CN:       "example.com",
+		DNSNames: []string{"example.com", "www.example.com"},
+		Issuer:   agentintegration.Issuer{CN: "R3", Organization: []string{"Let's Encrypt"}},
+	})
+
+	service := env.certificateService(nil)
+	cert, err := service.IssueCertificate(context.Background(), IssueCertificateRequest{
+		ServerGuid:    server.Guid,
+		DomainName:    "example.com",
+		Email:         "admin@example.com",
+		WebServer:     "nginx",
+		ChallengeType: "http",
+		Subjects:      []string{"example.com", "www.example.com"},
+		Assign:        true,
+		AccountID:     1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.CN != "example.com" {
+		t.Errorf("unexpected certificate: %+v", cert)
+	}
+
+	requests := fAgent.CommandRequests("certificates.issue")
+
+	if len(requests) != 1 {
+		t.Fatalf("expected one issue request, got %d", len(requests))
+	}
+
+	var requestData agentintegration.CertificateIssueRequestData
+
+	if err = requests[0].Decode(&requestData); err != nil {
+		t.Fatal(err)
+	}
+
+	if requestData.ServerName != "example.com" || requestData.Email != "admin@example.com" ||
+		requestData.WebServer != "nginx" || !requestData.Assign || len(requestData.Subjects) != 2 {
+		t.Errorf("unexpected issue request: %+v", requestData)
+	}
+
+	emailSetting, _ := env.settingStorage.FindByDomain("example.com", server.Guid, "email")
+
+	if emailSetting == nil || emailSetting.SettingValue != "admin@example.com" {
+		t.Error("email setting is not saved")
+	}
+}
+
+func TestIssueCertificateServerNotFound(t *testing.T) {
+	env := createTestEnv(t)
+	server := &serverStorage.Server{Name: "test", Ipv4Address: "127.0.0.1", AccountID: 2}
+	env.serverStorage.Save(server) // nolint:errcheck
+
+	service := env.certificateService(nil)
+	_, err := service.IssueCertificate(context.Background(), IssueCertificateRequest{
+		ServerGuid: server.Guid,
+		DomainName: "example.com",
+		AccountID:  1,
+	})
+
+	if err != ErrServerNotFound {
+		t.Fatalf("expected server not found error, got %v", err)
+	}
+}
+
+func TestIssueCertificateDuringMaintenance(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	fAgent.SetIssueResult(&agentintegration.Certificate{CN: "example.com"})
+
+	window := &serverStorage.MaintenanceWindow{ServerID: &server.ID, AccountID: server.AccountID, DomainName: "example.com"}
+	env.maintenanceStorage.Create(window) // nolint:errcheck
+
+	service := env.certificateService(nil)
+	request := IssueCertificateRequest{
+		ServerGuid: server.Guid,
+		DomainName: "example.com",
+		WebServer:  "nginx",
+		AccountID:  1,
+	}
+
+	if _, err := service.IssueCertificate(context.Background(), request); !errors.Is(err, maintenance.ErrInMaintenance) {
+		t.Fatalf("expected maintenance error, got %v", err)
+	}
+
+	if len(fAgent.CommandRequests("certificates.issue")) != 0 {
+		t.Fatal("certificate must not be issued during maintenance")
+	}
+
+	other := request
+	other.DomainName = "other.com"
+
+	if _, err := service.IssueCertificate(context.Background(), other); err != nil {
+		t.Fatalf("maintenance of a domain must not block other domains: %v", err)
+	}
+
+	request.Force = true
+
+	if _, err := service.IssueCertificate(context.Background(), request); err != nil {
+		t.Fatalf("forced issue must succeed during maintenance: %v", err)
+	}
+}
+
+func TestMutatingOperationsAreBlockedDuringMaintenance(t *testing.T) {
+	env := createTestEnv(t)
+	server := env.addServer(t, "127.0.0.1", 1)
+	env.maintenanceStorage.Create(&serverStorage.MaintenanceWindow{ServerID: &server.ID, AccountID: server.AccountID}) // nolint:errcheck
+
+	service := env.certificateService(nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		operation func(force bool) error
+	}{
+		{"upload", func(force bool) error {
+			data := agentintegration.CertificateUploadRequestData{ServerName: "example.com", WebServer: "nginx"}
+			_, err := service.UploadCertificate(ctx, UploadCertificateRequest{ServerGuid: server.Guid, Data: data, Force: force, AccountID: 1})
+
+			return err
+		}},
+		{"upload to storage", func(force bool) error {
+			request := UploadCertificateToStorageRequest{ServerGuid: server.Guid, CertName: "example", Force: force, AccountID: 1}
+			_, err := service.UploadCertificateToStorage(ctx, request)
+
+			return err
+		}},
+		{"change common dir status", func(force bool) error {
+			request := ChangeCommonDirStatusRequest{ServerGuid: server.Guid, DomainName: "example.com", Force: force, AccountID: 1}
+
+			return service.ChangeCommonDirStatus(ctx, request)
+		}},
+		{"create self-signed", func(force bool) error {
+			request := SelfSignedCertificateRequest{ServerGuid: server.Guid, CertName: "example", CommonName: "example.com", Force: force, AccountID: 1}
+			_, err := service.CreateSelfSignCertificate(ctx, request)
+
+			return err
+		}},
+		{"remove from storage", func(force bool) error {
+			request := RemoveCertificateFromStorageRequest{ServerGuid: server.Guid, CertName: "example", Force: force, AccountID: 1}
+
+			return service.RemoveCertificateFromStorage(ctx, request)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.operation(false); !errors.Is(err, maintenance.ErrInMaintenance) {
+				t.Fatalf("expected maintenance error, got %v", err)
+			}
+
+			// the forced operation reaches the agent, which is not running
+			if err := test.operation(true); err == nil || errors.Is(err, maintenance.ErrInMaintenance) {
+				t.Fatalf("expected the forced operation to pass the maintenance check, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIssueCertificateWithDnsChallenge(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	fAgent.SetIssueResult(&agentintegration.Certificate{CN: "example.com"})
+
+	dnsProviderService := NewDnsProviderService(env.dnsProviderStorage, logger.NewNopLogger())
+	dnsProvider, err := dnsProviderService.SaveDnsProvider(SaveDnsProviderRequest{
+		Name:      "primary",
+		Type:      dns.TypeRFC2136,
+		Settings:  map[string]string{"nameserver": "10.0.0.53", "tsig_key": "panel", "tsig_secret": "c2VjcmV0"},
+		AccountID: 1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := dnsProvider.Settings["tsig_secret"]; ok {
+		t.Errorf("expected the tsig secret not to be returned: %+v", dnsProvider.Settings)
+	}
+
+	service := env.certificateService(nil)
+	request := IssueCertificateRequest{
+		ServerGuid:    server.Guid,
+		DomainName:    "example.com",
+		ChallengeType: "dns",
+		Assign:        true,
+		AccountID:     1,
+	}
+
+	if _, err = service.IssueCertificate(context.Background(), request); !errors.Is(err, ErrDnsProviderRequired) {
+		t.Errorf("expected dns provider required error, got %v", err)
+	}
+
+	request.DnsProviderID = dnsProvider.ID
+	fAgent.RespondError("certificates.issue", "challenge failed")
+
+	if _, err = service.IssueCertificate(context.Background(), request); err == nil {
+		t.Fatal("expected the issue to fail")
+	}
+
+	if setting, _ := env.settingStorage.FindByDomain("example.com", server.Guid, "challengetype"); setting != nil {
+		t.Fatal("renewal settings must not be saved if the certificate is not issued")
+	}
+
+	fAgent.SetIssueResult(&agentintegration.Certificate{CN: "example.com", Issuer: agentintegration.Issuer{CN: "R3"}})
+
+	if _, err = service.IssueCertificate(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	var requestData agentintegration.CertificateIssueRequestData
+
+	if err = fAgent.CommandRequests("certificates.issue")[0].Decode(&requestData); err != nil {
+		t.Fatal(err)
+	}
+
+	if requestData.ChallengeType != "dns" || requestData.AdditionalParams["dnsprovider"] != dns.TypeRFC2136 ||
+		requestData.AdditionalParams["rfc2136_tsig_secret"] != "c2VjcmV0" {
+		t.Errorf("unexpected issue request: %+v", requestData)
+	}
+
+	setting, _ := env.settingStorage.FindByDomain("example.com", server.Guid, "dnsprovider")
+
+	if setting == nil || setting.SettingValue != strconv.Itoa(dnsProvider.ID) {
+		t.Errorf("expected the dns provider to be kept for renewal, got %+v", setting)
+	}
+
+	if setting, _ = env.settingStorage.FindByDomain("example.com", server.Guid, "issuedcert"); setting == nil || setting.SettingValue != agent.GetIssuedCertificateKey("R3", "", "") {
+		t.Errorf("expected the issued certificate to be recorded, got %+v", setting)
+	}
+}
+
+func TestWildcardCertificate(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	wildcard := &agentintegration.Certificate{
+		CN:       "*.example.com",
+		DNSNames: []string{"*.example.com", "example.com"},
+		Issuer:   agentintegration.Issuer{CN: "R3"},
+	}
+	fAgent.SetStorageCertificates(map[string]*agentintegration.Certificate{"default__wildcard": wildcard})
+	fAgent.SetVhosts([]agentintegration.VirtualHost{
+		{ServerName: "example.com", WebServer: "nginx"},
+		{ServerName: "www.example.com", WebServer: "nginx"},
+		{ServerName: "api.example.com", WebServer: "apache"},
+		{ServerName: "a.b.example.com", WebServer: "nginx"},
+		{ServerName: "another.com", WebServer: "nginx"},
+	})
+	fAgent.Respond("certificates.domainassign", wildcard)
+
+	window := &serverStorage.MaintenanceWindow{ServerID: &server.ID, AccountID: server.AccountID, DomainName: "api.example.com"}
+	env.maintenanceStorage.Create(window) // nolint:errcheck
+
+	// the certificate has been issued by the panel for example.com
+	renewalSettings := map[string]string{
+		"renewal":                      "true",
+		"email":                        "admin@example.com",
+		"challengetype":                "dns",
+		"dnsprovider":                  "1",
+		"issueclient":                  "panel",
+		"ca":                           "2",
+		agent.IssuedCertificateSetting: agent.GetIssuedCertificateKey(wildcard.Issuer.CN, wildcard.ValidFrom, wildcard.ValidTo),
+	}
+
+	for name, value := range renewalSettings {
+		env.settingStorage.Create("example.com", server.Guid, name, value) // nolint:errcheck
+	}
+
+	// auto renewal turned off for the domain is kept off
+	env.settingStorage.Create("www.example.com", server.Guid, "renewal", "false") // nolint:errcheck
+
+	service := env.certificateService(nil)
+	request := IssueCertificateRequest{
+		ServerGuid:    server.Guid,
+		DomainName:    "example.com",
+		ChallengeType: "http",
+		Subjects:      []string{"example.com", "*.example.com"},
+		AccountID:     1,
+	}
+
+	if _, err := service.IssueCertificate(context.Background(), request); !errors.Is(err, ErrWildcardRequiresDnsChallenge) {
+		t.Errorf("expected wildcard challenge error, got %v", err)
+	}
+
+	// the dns challenge is selected for wildcard subjects, so the provider is required
+	request.ChallengeType = ""
+
+	if _, err := service.IssueCertificate(context.Background(), request); !errors.Is(err, ErrDnsProviderRequired) {
+		t.Errorf("expected dns provider required error, got %v", err)
+	}
+
+	request.Subjects = []string{"*.*.example.com"}
+
+	if _, err := service.IssueCertificate(context.Background(), request); !errors.Is(err, acme.ErrInvalidSubject) {
+		t.Errorf("expected invalid subject error, got %v", err)
+	}
+
+	results, err := service.AssignMatchingCertificate(context.Background(), AssignMatchingCertificateRequest{
+		ServerGuid: server.Guid,
+		CertName:   "wildcard",
+		Storage:    "default",
+		AccountID:  1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 || results[0].DomainName != "example.com" || results[1].DomainName != "www.example.com" {
+		t.Fatalf("unexpected assign results: %+v", results)
+	}
+
+	if results[2].DomainName != "api.example.com" || results[2].Error == "" {
+		t.Errorf("expected the domain in maintenance to be skipped: %+v", results[2])
+	}
+
+	if requests := fAgent.CommandRequests("certificates.domainassign"); len(requests) != 2 {
+		t.Errorf("expected two assign requests, got %d", len(requests))
+	}
+
+	for name, value := range renewalSettings {
+		setting, _ := env.settingStorage.FindByDomain("www.example.com", server.Guid, name)
+
+		if name == "renewal" {
+			value = "false"
+		}
+
+		if setting == nil || setting.SettingValue != value {
+			t.Errorf("expected %s setting %q to be copied to www.example.com, got %+v", name, value, setting)
+		}
+
+		if setting, _ = env.settingStorage.FindByDomain("api.example.com", server.Guid, name); setting != nil {
+			t.Errorf("expected no %s setting for the skipped domain, got %+v", name, setting)
+		}
+	}
+}
+
+func TestIssueCertificateWithPanelClient(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	ca, err := fakeacme.Start(func(challengeType, domain, token, keyAuthorization string) error {
+		if served, ok := fAgent.HttpChallenge(token); !ok || served != keyAuthorization {
+			return errors.New("challenge is not served")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	cert := &agentintegration.Certificate{CN: "example.com", DNSNames: []string{"example.com", "www.example.com"}}
+	fAgent.EnableHttpChallenge()
+	fAgent.Respond("certificates.storagecertupload", cert)
+	fAgent.SetStorageCertificates(map[string]*agentintegration.Certificate{"default__panel-example.com": cert})
+	fAgent.Respond("certificates.domainassign", cert)
+
+	issuer, err := acmeissuer.CreateIssuer(
+		&config.Config{AcmeDirectoryURL: ca.DirectoryURL()},
+		testutil.CreateMemoryAcmeAccountStorage(),
+		logger.NewNopLogger(),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := env.certificateService(issuer)
+	request := IssueCertificateRequest{
+		ServerGuid: server.Guid,
+		DomainName: "example.com",
+		Email:      "admin@example.com",
+		WebServer:  "nginx",
+		Client:     "panel",
+		Subjects:   []string{"example.com", "www.example.com"},
+		Assign:     true,
+		AccountID:  1,
+	}
+
+	// the account registered with the first certificate is reused
+	for range 2 {
+		if _, err = service.IssueCertificate(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ca.Issued()) != 2 || ca.Accounts() != 1 {
+		t.Fatalf("unexpected certificates: %d, accounts: %d", len(ca.Issued()), ca.Accounts())
+	}
+
+	if requests := fAgent.CommandRequests("certificates.issue"); len(requests) != 0 {
+		t.Error("certificate must not be issued by the agent")
+	}
+
+	if requests := fAgent.CommandRequests("certificates.httpchallengecleanup"); len(requests) != 4 {
+		t.Errorf("expected challenges to be cleaned up, got %d cleanup requests", len(requests))
+	}
+
+	var uploadData agentintegration.CertificateUploadRequestData
+
+	if err = fAgent.CommandRequests("certificates.storagecertupload")[0].Decode(&uploadData); err != nil {
+		t.Fatal(err)
+	}
+
+	if uploadData.CertName != "panel-example.com" || strings.Count(uploadData.PemCertificate, "BEGIN CERTIFICATE") != 2 ||
+		!strings.Contains(uploadData.PemCertificate, "PRIVATE KEY") {
+		t.Errorf("unexpected upload request: %s", uploadData.CertName)
+	}
+
+	var assignData agentintegration.CertificateAssignRequestData
+
+	if err = fAgent.CommandRequests("certificates.domainassign")[0].Decode(&assignData); err != nil {
+		t.Fatal(err)
+	}
+
+	if assignData.CertName != "panel-example.com" || assignData.StorageType != "default" || assignData.ServerName != "example.com" {
+		t.Errorf("unexpected assign request: %+v", assignData)
+	}
+
+	clientSetting, _ := env.settingStorage.FindByDomain("example.com", server.Guid, "issueclient")
+
+	if clientSetting == nil || clientSetting.SettingValue != "panel" {
+		t.Error("issue client setting is not saved")
+	}
+
+	request.Client = "acme.sh"
+
+	if _, err = service.IssueCertificate(context.Background(), request); !errors.Is(err, acmeissuer.ErrInvalidClient) {
+		t.Errorf("expected invalid client error, got %v", err)
+	}
+}
+
+func TestIssueCertificateWithCertificateAuthority(t *testing.T) {
+	env := createTestEnv(t)
+	fAgent, server := env.startAgent(t)
+
+	ca, err := fakeacme.Start(func(challengeType, domain, token, keyAuthorization string) error {
+		if served, ok := fAgent.HttpChallenge(token); !ok || served != keyAuthorization {
+			return errors.New("challenge is not served")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	ca.RequireExternalAccountBinding("kid-1", hmacKey)
+
+	cert := &agentintegration.Certificate{CN: "example.com", DNSNames: []string{"example.com"}}
+	fAgent.EnableHttpChallenge()
+	fAgent.Respond("certificates.storagecertupload", cert)
+	fAgent.SetStorageCertificates(map[string]*agentintegration.Certificate{"default__panel-example.com": cert})
+	fAgent.Respond("certificates.domainassign", cert)
+	fAgent.SetIssueResult(cert)
+
+	caModel := &acmestorage.CertificateAuthority{
+		AccountID:      1,
+		Name:           "internal",
+		DirectoryURL:   ca.DirectoryURL(),
+		EabKeyID:       "kid-1",
+		EabHmacKey:     base64.RawURLEncoding.EncodeToString(hmacKey),
+		PreferredChain: "Fake ACME Legacy Root",
+	}
+	otherAccountCA := &acmestorage.CertificateAuthority{AccountID: 2, Name: "other", DirectoryURL: ca.DirectoryURL()}
+	env.caStorage.Save(caModel)        // nolint:errcheck
+	env.caStorage.Save(otherAccountCA) // nolint:errcheck
+
+	// the default directory is not reachable, so the certificate can be issued only by the certificate authority of the request
+	issuer, err := acmeissuer.CreateIssuer(
+		&config.Config{AcmeDirectoryURL: "http://127.0.0.1:1/directory"},
+		testutil.CreateMemoryAcmeAccountStorage(),
+		logger.NewNopLogger(),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := env.certificateService(issuer)
+	request := IssueCertificateRequest{
+		ServerGuid:             server.Guid,
+		DomainName:             "example.com",
+		WebServer:              "nginx",
+		Client:                 "panel",
+		CertificateAuthorityID: int(caModel.ID),
+		Assign:                 true,
+		AccountID:              1,
+	}
+
+	if _, err = service.IssueCertificate(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ca.Issued()) != 1 || ca.Accounts() != 1 {
+		t.Fatalf("unexpected certificates: %d, accounts: %d", len(ca.Issued()), ca.Accounts())
+	}
+
+	caSetting, _ := env.settingStorage.FindByDomain("example.com", server.Guid, "ca")
+
+	if caSetting == nil || caSetting.SettingValue != strconv.Itoa(int(caModel.ID)) {
+		t.Error("certificate authority setting is not saved")
+	}
+
+	// certbot gets the directory and the binding of the certificate authority in params
+	request.Client = "certbot"
+
+	if _, err = service.IssueCertificate(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	var requestData agentintegration.CertificateIssueRequestData
+
+	if err = fAgent.CommandRequests("certificates.issue")[0].Decode(&requestData); err != nil {
+		t.Fatal(err)
+	}
+
+	params := requestData.AdditionalParams
+
+	if params["server"] != ca.DirectoryURL() || params["eab-kid"] != "kid-1" || params["eab-hmac-key"] != caModel.EabHmacKey ||
+		params["preferred-chain"] != "Fake ACME Legacy Root" {
+		t.Errorf("unexpected params: %v", params)
+	}
+
+	request.CertificateAuthorityID = int(otherAccountCA.ID)
+
+	if _, err = service.IssueCertificate(context.Background(), request); !errors.Is(err, ErrCertificateAuthorityNotFound) {
+		t.Errorf("expected certificate authority not found error, got %v", err)
+	}
+}
@@ -1,5 +1,28 @@
 package acme
 
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
 const (
 	HttpChallengeType = "http"
+	DnsChallengeType  = "dns"
 )
+
+// dnsChallengeLabel is the label of the TXT record validated by the DNS-01 challenge
+const dnsChallengeLabel = "_acme-challenge"
+
+func IsValidChallengeType(challengeType string) bool {
+	return challengeType == HttpChallengeType || challengeType == DnsChallengeType
+}
+
+// DnsChallengeRecord returns the fully qualified name and the value of the TXT record that solves
+// the DNS-01 challenge of the domain. The record of a wildcard domain is the record of its base domain.
+func DnsChallengeRecord(domain, keyAuthorization string) (fqdn, value string) {
+	domain = strings.TrimSuffix(strings.TrimPrefix(domain, "*."), ".")
+	digest := sha256.Sum256([]byte(keyAuthorization))
+
+	return dnsChallengeLabel + "." + domain + ".", base64.RawURLEncoding.EncodeToString(digest[:])
+}
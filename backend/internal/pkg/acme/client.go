@@ -0,0 +1,344 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	xacme "golang.org/x/crypto/acme"
+)
+
+const (
+	HTTP01 = "http-01"
+	DNS01  = "dns-01"
+)
+
+var (
+	ErrChallengeNotOffered = errors.New("challenge is not offered by the certificate authority")
+	ErrInvalidEabHmacKey   = errors.New("invalid external account binding hmac key")
+)
+
+// ExternalAccountBinding binds the ACME account to the account of the customer at the certificate authority.
+// It is required by some authorities, e.g. ZeroSSL and Google Trust Services.
+type ExternalAccountBinding struct {
+	KeyID string
+	// HmacKey is the base64url encoded MAC key provided by the certificate authority
+	HmacKey string
+}
+
+// Solver makes the key authorization of a challenge available to the certificate authority
+type Solver interface {
+	// ChallengeType returns the ACME challenge type solved by the solver, e.g. http-01
+	ChallengeType() string
+	// Present publishes the key authorization for the domain. The domain of a wildcard authorization has the *. prefix.
+	Present(ctx context.Context, domain, token, keyAuthorization string) error
+	CleanUp(ctx context.Context, domain, token, keyAuthorization string) error
+}
+
+// Certificate is a certificate obtained from the certificate authority
+type Certificate struct {
+	// PrivateKey is the PEM encoded private key of the certificate
+	PrivateKey []byte
+	// Chain is the PEM encoded leaf certificate followed by the issuer certificates
+	Chain []byte
+	Leaf  *x509.Certificate
+	// URL is the location of the certificate at the certificate authority
+	URL string
+}
+
+// Client is an RFC 8555 client that obtains certificates for an account of the certificate authority
+type Client struct {
+	client *xacme.Client
+	// PreferredChain is the common name of the topmost issuer of the chain that is preferred
+	// if the certificate authority offers alternate chains. The default chain is used if none matches.
+	PreferredChain string
+}
+
+// Register creates the account of the client key, an existing account of the key is reused.
+// The binding may be nil if the certificate authority does not require it.
+// It returns the account URL that identifies the account in next requests.
+func (c *Client) Register(ctx context.Context, email string, eab *ExternalAccountBinding) (string, error) {
+	account := &xacme.Account{}
+
+	if email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+
+	if eab != nil {
+		hmacKey, err := DecodeHmacKey(eab.HmacKey)
+
+		if err != nil {
+			return "", err
+		}
+
+		account.ExternalAccountBinding = &xacme.ExternalAccountBinding{KID: eab.KeyID, Key: hmacKey}
+	}
+
+	account, err := c.client.Register(ctx, account, xacme.AcceptTOS)
+
+	if errors.Is(err, xacme.ErrAccountAlreadyExists) {
+		return string(c.client.KID), nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not register acme account: %v", err)
+	}
+
+	return account.URI, nil
+}
+
+// Obtain orders the certificate for the subjects, solves authorizations of the order with the solver and finalizes it.
+// The first subject is the common name of the certificate.
+func (c *Client) Obtain(ctx context.Context, subjects []string, solver Solver) (*Certificate, error) {
+	if len(subjects) == 0 {
+		return nil, ErrInvalidSubject
+	}
+
+	order, err := c.client.AuthorizeOrder(ctx, xacme.DomainIDs(subjects...))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create order: %v", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err = c.authorize(ctx, authzURL, solver); err != nil {
+			return nil, err
+		}
+	}
+
+	if order, err = c.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("order is not ready: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: subjects[0]},
+		DNSNames: subjects,
+	}, key)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create certificate request: %v", err)
+	}
+
+	der, certURL, err := c.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not finalize order: %v", err)
+	}
+
+	if c.PreferredChain != "" && !matchChain(der, c.PreferredChain) {
+		der = c.findPreferredChain(ctx, certURL, der)
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+
+	keyPem, err := EncodeKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var chain bytes.Buffer
+
+	for _, certDer := range der {
+		if err = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: certDer}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Certificate{
+		PrivateKey: keyPem,
+		Chain:      chain.Bytes(),
+		Leaf:       leaf,
+		URL:        certURL,
+	}, nil
+}
+
+// findPreferredChain returns the alternate chain of the certificate with the preferred issuer or the default chain
+func (c *Client) findPreferredChain(ctx context.Context, certURL string, defaultChain [][]byte) [][]byte {
+	alternates, err := c.client.ListCertAlternates(ctx, certURL)
+
+	if err != nil {
+		return defaultChain
+	}
+
+	for _, alternate := range alternates {
+		chain, err := c.client.FetchCert(ctx, alternate, true)
+
+		if err == nil && matchChain(chain, c.PreferredChain) {
+			return chain
+		}
+	}
+
+	return defaultChain
+}
+
+func (c *Client) authorize(ctx context.Context, authzURL string, solver Solver) error {
+	authz, err := c.client.GetAuthorization(ctx, authzURL)
+
+	if err != nil {
+		return fmt.Errorf("could not get authorization: %v", err)
+	}
+
+	if authz.Status == xacme.StatusValid {
+		return nil
+	}
+
+	var challenge *xacme.Challenge
+
+	for _, authzChallenge := range authz.Challenges {
+		if authzChallenge.Type == solver.ChallengeType() {
+			challenge = authzChallenge
+
+			break
+		}
+	}
+
+	domain := authz.Identifier.Value
+
+	if authz.Wildcard {
+		domain = "*." + domain
+	}
+
+	if challenge == nil {
+		return fmt.Errorf("%w: %s, domain: %s", ErrChallengeNotOffered, solver.ChallengeType(), domain)
+	}
+
+	// the key authorization of the http-01 challenge is the base of key authorizations of other challenges
+	keyAuthorization, err := c.client.HTTP01ChallengeResponse(challenge.Token)
+
+	if err != nil {
+		return err
+	}
+
+	if err = solver.Present(ctx, domain, challenge.Token, keyAuthorization); err != nil {
+		return fmt.Errorf("could not present %s challenge for %s: %w", challenge.Type, domain, err)
+	}
+
+	defer solver.CleanUp(ctx, domain, challenge.Token, keyAuthorization) // nolint:errcheck
+
+	if _, err = c.client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("could not accept %s challenge for %s: %v", challenge.Type, domain, err)
+	}
+
+	if _, err = c.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization of %s failed: %v", domain, err)
+	}
+
+	return nil
+}
+
+// NewClient creates the client of the certificate authority directory. The account URL may be empty,
+// it is looked up by the key then. A nil http client means the default one.
+func NewClient(directoryURL string, key crypto.Signer, accountURL string, httpClient *http.Client) *Client {
+	return &Client{
+		client: &xacme.Client{
+			Key:          key,
+			KID:          xacme.KeyID(accountURL),
+			DirectoryURL: directoryURL,
+			HTTPClient:   httpClient,
+			UserAgent:    "r2dtools-panel",
+		},
+	}
+}
+
+// NewHTTPClient creates the http client that trusts certificates of the bundle in addition to system roots.
+// It is used with certificate authorities with private roots, e.g. Pebble. An empty bundle means the default client.
+func NewHTTPClient(caBundleFile string) (*http.Client, error) {
+	if caBundleFile == "" {
+		return nil, nil
+	}
+
+	bundle, err := os.ReadFile(caBundleFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read ca bundle: %v", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in ca bundle %s", caBundleFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// DecodeHmacKey decodes the MAC key of the external account binding.
+// Authorities provide keys base64url encoded, padded and standard encodings are accepted as well.
+func DecodeHmacKey(hmacKey string) ([]byte, error) {
+	hmacKey = strings.TrimRight(strings.TrimSpace(hmacKey), "=")
+	hmacKey = strings.NewReplacer("+", "-", "/", "_").Replace(hmacKey)
+	key, err := base64.RawURLEncoding.DecodeString(hmacKey)
+
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidEabHmacKey
+	}
+
+	return key, nil
+}
+
+// matchChain reports whether the topmost certificate of the chain is issued by the issuer with the common name
+func matchChain(chain [][]byte, issuer string) bool {
+	topmost, err := x509.ParseCertificate(chain[len(chain)-1])
+
+	if err != nil {
+		return false
+	}
+
+	return topmost.Issuer.CommonName == issuer
+}
+
+// GenerateKey generates the ECDSA P-256 key of an account
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func EncodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func ParseKey(keyPem []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPem)
+
+	if block == nil {
+		return nil, errors.New("invalid key pem")
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
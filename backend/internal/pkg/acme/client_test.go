@@ -0,0 +1,331 @@
+package acme
+
+import (
+	"backend/internal/pkg/acme/fakeacme"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// testHttpSolver keeps key authorizations of presented challenges as an agent that serves them
+type testHttpSolver struct {
+	mu      sync.Mutex
+	tokens  map[string]string
+	cleaned int
+}
+
+func (s *testHttpSolver) ChallengeType() string {
+	return HTTP01
+}
+
+func (s *testHttpSolver) Present(ctx context.Context, domain, token, keyAuthorization string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token] = keyAuthorization
+
+	return nil
+}
+
+func (s *testHttpSolver) CleanUp(ctx context.Context, domain, token, keyAuthorization string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, token)
+	s.cleaned++
+
+	return nil
+}
+
+func (s *testHttpSolver) validate(challengeType, domain, token, keyAuthorization string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if challengeType != HTTP01 || s.tokens[token] != keyAuthorization {
+		return errors.New("key authorization mismatch")
+	}
+
+	return nil
+}
+
+// testDnsProvider keeps TXT records in memory
+type testDnsProvider struct {
+	records map[string]string
+}
+
+func (p *testDnsProvider) Present(ctx context.Context, fqdn, value string) error {
+	p.records[fqdn] = value
+
+	return nil
+}
+
+func (p *testDnsProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	delete(p.records, fqdn)
+
+	return nil
+}
+
+func TestObtainWithHttpChallenge(t *testing.T) {
+	solver := &testHttpSolver{tokens: map[string]string{}}
+	ca, err := fakeacme.Start(solver.validate)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	key, err := GenerateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	client := NewClient(ca.DirectoryURL(), key, "", nil)
+	accountURL, err := client.Register(ctx, "admin@example.com", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// registration of the same key returns the existing account
+	sameAccountURL, err := NewClient(ca.DirectoryURL(), key, "", nil).Register(ctx, "admin@example.com", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accountURL == "" || accountURL != sameAccountURL || ca.Accounts() != 1 {
+		t.Fatalf("unexpected accounts: %s, %s, %d", accountURL, sameAccountURL, ca.Accounts())
+	}
+
+	cert, err := NewClient(ca.DirectoryURL(), key, accountURL, nil).Obtain(ctx, []string{"example.com", "www.example.com"}, solver)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Leaf.Subject.CommonName != "example.com" || !slices.Equal(cert.Leaf.DNSNames, []string{"example.com", "www.example.com"}) {
+		t.Fatalf("unexpected certificate: %s, %v", cert.Leaf.Subject.CommonName, cert.Leaf.DNSNames)
+	}
+
+	if solver.cleaned != 2 || len(solver.tokens) != 0 {
+		t.Fatalf("challenges are not cleaned up: %d", solver.cleaned)
+	}
+
+	if _, err = ParseKey(cert.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.CACertificate())
+
+	if _, err = cert.Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "www.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObtainWithDnsChallenge(t *testing.T) {
+	provider := &testDnsProvider{records: map[string]string{}}
+	ca, err := fakeacme.Start(func(challengeType, domain, token, keyAuthorization string) error {
+		fqdn, value := DnsChallengeRecord(domain, keyAuthorization)
+
+		if challengeType != DNS01 || provider.records[fqdn] != value {
+			return errors.New("record not found")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	key, err := GenerateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(ca.DirectoryURL(), key, "", nil)
+
+	if _, err = client.Register(context.Background(), "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := client.Obtain(context.Background(), []string{"*.example.com"}, DnsSolver{Provider: provider})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Leaf.Subject.CommonName != "*.example.com" || len(provider.records) != 0 {
+		t.Fatalf("unexpected certificate: %s, records: %v", cert.Leaf.Subject.CommonName, provider.records)
+	}
+}
+
+func TestObtainFailsWithInvalidChallenge(t *testing.T) {
+	ca, err := fakeacme.Start(func(challengeType, domain, token, keyAuthorization string) error {
+		return errors.New("connection refused")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	key, err := GenerateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(ca.DirectoryURL(), key, "", nil)
+
+	if _, err = client.Register(context.Background(), "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	solver := &testHttpSolver{tokens: map[string]string{}}
+
+	if _, err = client.Obtain(context.Background(), []string{"example.com"}, solver); err == nil {
+		t.Fatal("expected authorization error")
+	}
+
+	// the http challenge is not offered for wildcard domains
+	if _, err = client.Obtain(context.Background(), []string{"*.example.com"}, solver); !errors.Is(err, ErrChallengeNotOffered) {
+		t.Fatalf("expected challenge error, got %v", err)
+	}
+
+	if len(ca.Issued()) != 0 {
+		t.Fatal("certificate must not be issued")
+	}
+}
+
+// TestObtainWithPebble runs against a Pebble server started with PEBBLE_VA_ALWAYS_VALID=1, e.g.
+// ACME_TEST_DIRECTORY_URL=https://localhost:14000/dir ACME_TEST_CA_BUNDLE=pebble.minica.pem go test ./internal/pkg/acme
+func TestObtainWithPebble(t *testing.T) {
+	directoryURL := os.Getenv("ACME_TEST_DIRECTORY_URL")
+
+	if directoryURL == "" {
+		t.Skip("ACME_TEST_DIRECTORY_URL is not set")
+	}
+
+	httpClient, err := NewHTTPClient(os.Getenv("ACME_TEST_CA_BUNDLE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := GenerateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	client := NewClient(directoryURL, key, "", httpClient)
+
+	if _, err = client.Register(ctx, "admin@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := client.Obtain(ctx, []string{"example.com", "www.example.com"}, &testHttpSolver{tokens: map[string]string{}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Leaf.Subject.CommonName != "example.com" && !slices.Contains(cert.Leaf.DNSNames, "example.com") {
+		t.Fatalf("unexpected certificate: %v", cert.Leaf.DNSNames)
+	}
+}
+
+func TestObtainWithExternalAccountBindingAndPreferredChain(t *testing.T) {
+	solver := &testHttpSolver{tokens: map[string]string{}}
+	ca, err := fakeacme.Start(solver.validate)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ca.Close()
+
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	ca.RequireExternalAccountBinding("kid-1", hmacKey)
+
+	if err = ca.EnableAlternateChain(); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := GenerateKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	client := NewClient(ca.DirectoryURL(), key, "", nil)
+
+	if _, err = client.Register(ctx, "", nil); err == nil {
+		t.Fatal("expected the binding to be required")
+	}
+
+	if _, err = client.Register(ctx, "", &ExternalAccountBinding{KeyID: "kid-1", HmacKey: "invalid key"}); !errors.Is(err, ErrInvalidEabHmacKey) {
+		t.Fatalf("expected invalid hmac key error, got %v", err)
+	}
+
+	eab := &ExternalAccountBinding{KeyID: "kid-1", HmacKey: base64.StdEncoding.EncodeToString(hmacKey)}
+
+	if _, err = client.Register(ctx, "", eab); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := client.Obtain(ctx, []string{"example.com"}, solver)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if topmostIssuer(t, cert.Chain) != fakeacme.CAName {
+		t.Error("expected the default chain")
+	}
+
+	client.PreferredChain = fakeacme.LegacyRootName
+
+	if cert, err = client.Obtain(ctx, []string{"example.com"}, solver); err != nil {
+		t.Fatal(err)
+	}
+
+	if topmostIssuer(t, cert.Chain) != fakeacme.LegacyRootName {
+		t.Error("expected the preferred chain")
+	}
+}
+
+func topmostIssuer(t *testing.T, chain []byte) string {
+	t.Helper()
+
+	var topmost *pem.Block
+
+	for block, rest := pem.Decode(chain); block != nil; block, rest = pem.Decode(rest) {
+		topmost = block
+	}
+
+	cert, err := x509.ParseCertificate(topmost.Bytes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert.Issuer.CommonName
+}
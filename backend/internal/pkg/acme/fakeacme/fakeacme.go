@@ -0,0 +1,856 @@
+// Package fakeacme provides an in-process ACME certificate authority that speaks RFC 8555.
+// It is intended for tests of code that obtains certificates. Signatures of requests are not verified,
+// challenges are validated synchronously by the validator of the test.
+package fakeacme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CAName is the common name of the certificate authority that issues certificates
+	CAName = "Fake ACME CA"
+	// LegacyRootName is the common name of the root that cross-signs the certificate authority in the alternate chain
+	LegacyRootName = "Fake ACME Legacy Root"
+
+	statusPending = "pending"
+	statusReady   = "ready"
+	statusValid   = "valid"
+	statusInvalid = "invalid"
+
+	errorPrefix = "urn:ietf:params:acme:error:"
+)
+
+// Validator checks the key authorization of the challenge, a nil error means the challenge is solved.
+// The domain of a wildcard authorization has the *. prefix.
+type Validator func(challengeType, domain, token, keyAuthorization string) error
+
+type account struct {
+	url        string
+	thumbprint string
+	contact    []string
+}
+
+type challenge struct {
+	id     string
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	Status string `json:"status"`
+	Error  any    `json:"error,omitempty"`
+}
+
+type authorization struct {
+	id         string
+	account    *account
+	domain     string
+	wildcard   bool
+	status     string
+	challenges []*challenge
+}
+
+type order struct {
+	id             string
+	account        *account
+	identifiers    []string
+	authorizations []*authorization
+	chain          []byte
+	// alternateChain is the chain with the cross-signed certificate authority
+	alternateChain []byte
+}
+
+type problem struct {
+	status int
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *problem) Error() string {
+	return p.Detail
+}
+
+type Server struct {
+	server    *httptest.Server
+	validator Validator
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+	// crossCert is the certificate of the certificate authority cross-signed by the legacy root
+	crossCert *x509.Certificate
+	// eabKeyID and eabKey are set if new accounts must be bound to an external account
+	eabKeyID string
+	eabKey   []byte
+
+	mu             sync.Mutex
+	nextID         int
+	accounts       map[string]*account
+	orders         map[string]*order
+	authorizations map[string]*authorization
+	challenges     map[string]*authorization
+	issued         []*x509.Certificate
+}
+
+// Start starts the certificate authority on a random local port
+func Start(validator Validator) (*Server, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template := caTemplate(CAName)
+	caDer, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, err := x509.ParseCertificate(caDer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		validator:      validator,
+		caKey:          caKey,
+		caCert:         caCert,
+		accounts:       map[string]*account{},
+		orders:         map[string]*order{},
+		authorizations: map[string]*authorization{},
+		challenges:     map[string]*authorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /directory", s.handleDirectory)
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		s.setNonce(w)
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /account", s.handle(s.newAccount))
+	mux.HandleFunc("POST /account/{id}", s.handle(s.getAccount))
+	mux.HandleFunc("POST /order", s.handle(s.newOrder))
+	mux.HandleFunc("POST /order/{id}", s.handle(s.getOrder))
+	mux.HandleFunc("POST /authz/{id}", s.handle(s.getAuthorization))
+	mux.HandleFunc("POST /challenge/{id}", s.handle(s.acceptChallenge))
+	mux.HandleFunc("POST /finalize/{id}", s.handle(s.finalizeOrder))
+	mux.HandleFunc("POST /cert/{id}", s.handleCertificate)
+	mux.HandleFunc("POST /cert/{id}/alternate", s.handleCertificate)
+	s.server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// RequireExternalAccountBinding makes the certificate authority accept only new accounts bound with the key
+func (s *Server) RequireExternalAccountBinding(keyID string, hmacKey []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eabKeyID = keyID
+	s.eabKey = hmacKey
+}
+
+// EnableAlternateChain makes the certificate authority offer the alternate chain of issued certificates
+// with the certificate authority cross-signed by the root with the common name LegacyRootName
+func (s *Server) EnableAlternateChain() error {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return err
+	}
+
+	rootTemplate := caTemplate(LegacyRootName)
+	rootDer, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+
+	if err != nil {
+		return err
+	}
+
+	root, err := x509.ParseCertificate(rootDer)
+
+	if err != nil {
+		return err
+	}
+
+	crossDer, err := x509.CreateCertificate(rand.Reader, caTemplate(CAName), root, &s.caKey.PublicKey, rootKey)
+
+	if err != nil {
+		return err
+	}
+
+	crossCert, err := x509.ParseCertificate(crossDer)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.crossCert = crossCert
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Server) DirectoryURL() string {
+	return s.server.URL + "/directory"
+}
+
+// CACertificate returns the certificate that signs issued certificates
+func (s *Server) CACertificate() *x509.Certificate {
+	return s.caCert
+}
+
+// Issued returns certificates issued by the certificate authority
+func (s *Server) Issued() []*x509.Certificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.issued)
+}
+
+// Accounts returns the number of registered accounts
+func (s *Server) Accounts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.accounts)
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+type request struct {
+	account *account
+	// thumbprint is the thumbprint of the embedded key of new account requests
+	thumbprint string
+	payload    []byte
+	id         string
+}
+
+type handler func(r request) (status int, location string, response any, err error)
+
+func (s *Server) handle(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.setNonce(w)
+
+		req, err := s.parseRequest(r)
+
+		if err != nil {
+			writeProblem(w, err)
+
+			return
+		}
+
+		s.mu.Lock()
+		status, location, response, err := h(req)
+		s.mu.Unlock()
+
+		if err != nil {
+			writeProblem(w, err)
+
+			return
+		}
+
+		if location != "" {
+			w.Header().Set("Location", location)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response) // nolint:errcheck
+	}
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	eabRequired := s.eabKey != nil
+	s.mu.Unlock()
+
+	s.setNonce(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{ // nolint:errcheck
+		"newNonce":   s.server.URL + "/nonce",
+		"newAccount": s.server.URL + "/account",
+		"newOrder":   s.server.URL + "/order",
+		"revokeCert": s.server.URL + "/revoke",
+		"keyChange":  s.server.URL + "/key-change",
+		"meta":       map[string]any{"externalAccountRequired": eabRequired},
+	})
+}
+
+func (s *Server) handleCertificate(w http.ResponseWriter, r *http.Request) {
+	s.setNonce(w)
+
+	req, err := s.parseRequest(r)
+
+	if err != nil {
+		writeProblem(w, err)
+
+		return
+	}
+
+	s.mu.Lock()
+	o, ok := s.orders[req.id]
+	s.mu.Unlock()
+
+	if !ok || o.chain == nil || o.account != req.account {
+		writeProblem(w, &problem{status: http.StatusNotFound, Type: errorPrefix + "malformed", Detail: "certificate not found"})
+
+		return
+	}
+
+	chain := o.chain
+
+	if strings.HasSuffix(r.URL.Path, "/alternate") {
+		chain = o.alternateChain
+	} else if o.alternateChain != nil {
+		w.Header().Add("Link", fmt.Sprintf(`<%s/cert/%s/alternate>;rel="alternate"`, s.server.URL, o.id))
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Write(chain) // nolint:errcheck
+}
+
+func (s *Server) newAccount(r request) (int, string, any, error) {
+	var payload struct {
+		Contact                []string         `json:"contact"`
+		OnlyReturnExisting     bool             `json:"onlyReturnExisting"`
+		ExternalAccountBinding *json.RawMessage `json:"externalAccountBinding"`
+	}
+
+	if err := json.Unmarshal(r.payload, &payload); err != nil {
+		return 0, "", nil, malformed(err.Error())
+	}
+
+	if r.thumbprint == "" {
+		return 0, "", nil, malformed("new account request must embed the key")
+	}
+
+	for _, a := range s.accounts {
+		if a.thumbprint == r.thumbprint {
+			return http.StatusOK, a.url, accountResponse(a), nil
+		}
+	}
+
+	if payload.OnlyReturnExisting {
+		return 0, "", nil, &problem{status: http.StatusBadRequest, Type: errorPrefix + "accountDoesNotExist", Detail: "account does not exist"}
+	}
+
+	if s.eabKey != nil {
+		if payload.ExternalAccountBinding == nil {
+			return 0, "", nil, &problem{status: http.StatusUnauthorized, Type: errorPrefix + "externalAccountRequired", Detail: "external account binding is required"}
+		}
+
+		if err := s.verifyExternalAccountBinding(*payload.ExternalAccountBinding, r.thumbprint); err != nil {
+			return 0, "", nil, &problem{status: http.StatusUnauthorized, Type: errorPrefix + "unauthorized", Detail: err.Error()}
+		}
+	}
+
+	a := &account{
+		url:        s.server.URL + "/account/" + s.newID(),
+		thumbprint: r.thumbprint,
+		contact:    payload.Contact,
+	}
+	s.accounts[a.url] = a
+
+	return http.StatusCreated, a.url, accountResponse(a), nil
+}
+
+func (s *Server) getAccount(r request) (int, string, any, error) {
+	if r.account == nil || !strings.HasSuffix(r.account.url, "/"+r.id) {
+		return 0, "", nil, unauthorized()
+	}
+
+	return http.StatusOK, r.account.url, accountResponse(r.account), nil
+}
+
+func (s *Server) newOrder(r request) (int, string, any, error) {
+	if r.account == nil {
+		return 0, "", nil, unauthorized()
+	}
+
+	var payload struct {
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+
+	if err := json.Unmarshal(r.payload, &payload); err != nil || len(payload.Identifiers) == 0 {
+		return 0, "", nil, malformed("invalid identifiers")
+	}
+
+	o := &order{id: s.newID(), account: r.account}
+
+	for _, identifier := range payload.Identifiers {
+		if identifier.Type != "dns" {
+			return 0, "", nil, &problem{status: http.StatusBadRequest, Type: errorPrefix + "rejectedIdentifier", Detail: "unsupported identifier type"}
+		}
+
+		authz := &authorization{
+			id:       s.newID(),
+			account:  r.account,
+			domain:   strings.TrimPrefix(identifier.Value, "*."),
+			wildcard: strings.HasPrefix(identifier.Value, "*."),
+			status:   statusPending,
+		}
+		challengeTypes := []string{"http-01", "dns-01"}
+
+		// wildcard domains can be validated only with the DNS challenge
+		if authz.wildcard {
+			challengeTypes = []string{"dns-01"}
+		}
+
+		for _, challengeType := range challengeTypes {
+			id := s.newID()
+			authz.challenges = append(authz.challenges, &challenge{
+				id:     id,
+				Type:   challengeType,
+				URL:    s.server.URL + "/challenge/" + id,
+				Token:  randomToken(),
+				Status: statusPending,
+			})
+			s.challenges[id] = authz
+		}
+
+		s.authorizations[authz.id] = authz
+		o.identifiers = append(o.identifiers, identifier.Value)
+		o.authorizations = append(o.authorizations, authz)
+	}
+
+	s.orders[o.id] = o
+
+	return http.StatusCreated, s.orderURL(o), s.orderResponse(o), nil
+}
+
+func (s *Server) getOrder(r request) (int, string, any, error) {
+	o, err := s.findOrder(r)
+
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	return http.StatusOK, s.orderURL(o), s.orderResponse(o), nil
+}
+
+func (s *Server) getAuthorization(r request) (int, string, any, error) {
+	authz, ok := s.authorizations[r.id]
+
+	if !ok || authz.account != r.account {
+		return 0, "", nil, notFound()
+	}
+
+	return http.StatusOK, "", authorizationResponse(authz), nil
+}
+
+func (s *Server) acceptChallenge(r request) (int, string, any, error) {
+	authz, ok := s.challenges[r.id]
+
+	if !ok || authz.account != r.account {
+		return 0, "", nil, notFound()
+	}
+
+	var chal *challenge
+
+	for _, authzChallenge := range authz.challenges {
+		if authzChallenge.id == r.id {
+			chal = authzChallenge
+		}
+	}
+
+	// an empty payload is a POST-as-GET request, the challenge is accepted with an empty object
+	if len(r.payload) == 0 || authz.status != statusPending {
+		return http.StatusOK, "", chal, nil
+	}
+
+	domain := authz.domain
+
+	if authz.wildcard {
+		domain = "*." + domain
+	}
+
+	if err := s.validator(chal.Type, domain, chal.Token, chal.Token+"."+r.account.thumbprint); err != nil {
+		chal.Status = statusInvalid
+		chal.Error = &problem{Type: errorPrefix + "unauthorized", Detail: err.Error()}
+		authz.status = statusInvalid
+	} else {
+		chal.Status = statusValid
+		authz.status = statusValid
+	}
+
+	return http.StatusOK, "", chal, nil
+}
+
+func (s *Server) finalizeOrder(r request) (int, string, any, error) {
+	o, err := s.findOrder(r)
+
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	if s.orderStatus(o) != statusReady {
+		return 0, "", nil, &problem{status: http.StatusForbidden, Type: errorPrefix + "orderNotReady", Detail: "order is not ready"}
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+
+	if err = json.Unmarshal(r.payload, &payload); err != nil {
+		return 0, "", nil, malformed(err.Error())
+	}
+
+	csrDer, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+
+	if err != nil {
+		return 0, "", nil, malformed(err.Error())
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDer)
+
+	if err != nil {
+		return 0, "", nil, &problem{status: http.StatusBadRequest, Type: errorPrefix + "badCSR", Detail: err.Error()}
+	}
+
+	names := slices.Clone(csr.DNSNames)
+	identifiers := slices.Clone(o.identifiers)
+	slices.Sort(names)
+	slices.Sort(identifiers)
+
+	if !slices.Equal(slices.Compact(names), slices.Compact(identifiers)) {
+		return 0, "", nil, &problem{status: http.StatusBadRequest, Type: errorPrefix + "badCSR", Detail: "names of the request do not match the order"}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(s.issued) + 2)),
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.caCert, csr.PublicKey, s.caKey)
+
+	if err != nil {
+		return 0, "", nil, &problem{status: http.StatusInternalServerError, Type: errorPrefix + "serverInternal", Detail: err.Error()}
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		return 0, "", nil, &problem{status: http.StatusInternalServerError, Type: errorPrefix + "serverInternal", Detail: err.Error()}
+	}
+
+	o.chain = encodeChain(der, s.caCert.Raw)
+
+	if s.crossCert != nil {
+		o.alternateChain = encodeChain(der, s.crossCert.Raw)
+	}
+
+	s.issued = append(s.issued, cert)
+
+	return http.StatusOK, s.orderURL(o), s.orderResponse(o), nil
+}
+
+// verifyExternalAccountBinding checks the MAC of the binding and that the binding is made for the account key
+func (s *Server) verifyExternalAccountBinding(binding json.RawMessage, accountThumbprint string) error {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}
+
+	if err := json.Unmarshal(binding, &jws); err != nil {
+		return err
+	}
+
+	protectedData, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+
+	if err != nil {
+		return err
+	}
+
+	var protected struct {
+		Alg string `json:"alg"`
+		KID string `json:"kid"`
+	}
+
+	if err = json.Unmarshal(protectedData, &protected); err != nil {
+		return err
+	}
+
+	if protected.Alg != "HS256" || protected.KID != s.eabKeyID {
+		return errors.New("unknown external account")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(jws.Signature)
+
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, s.eabKey)
+	mac.Write([]byte(jws.Protected + "." + jws.Payload))
+
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return errors.New("invalid external account binding signature")
+	}
+
+	jwk, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	if err != nil {
+		return err
+	}
+
+	bindingThumbprint, err := thumbprint(jwk)
+
+	if err != nil || bindingThumbprint != accountThumbprint {
+		return errors.New("external account binding is made for another key")
+	}
+
+	return nil
+}
+
+func (s *Server) findOrder(r request) (*order, error) {
+	o, ok := s.orders[r.id]
+
+	if !ok || o.account != r.account {
+		return nil, notFound()
+	}
+
+	return o, nil
+}
+
+func (s *Server) orderStatus(o *order) string {
+	if o.chain != nil {
+		return statusValid
+	}
+
+	status := statusReady
+
+	for _, authz := range o.authorizations {
+		switch authz.status {
+		case statusInvalid:
+			return statusInvalid
+		case statusPending:
+			status = statusPending
+		}
+	}
+
+	return status
+}
+
+func (s *Server) orderURL(o *order) string {
+	return s.server.URL + "/order/" + o.id
+}
+
+func (s *Server) orderResponse(o *order) any {
+	identifiers := []map[string]string{}
+	authorizations := []string{}
+
+	for _, identifier := range o.identifiers {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": identifier})
+	}
+
+	for _, authz := range o.authorizations {
+		authorizations = append(authorizations, s.server.URL+"/authz/"+authz.id)
+	}
+
+	response := map[string]any{
+		"status":         s.orderStatus(o),
+		"identifiers":    identifiers,
+		"authorizations": authorizations,
+		"finalize":       s.server.URL + "/finalize/" + o.id,
+	}
+
+	if o.chain != nil {
+		response["certificate"] = s.server.URL + "/cert/" + o.id
+	}
+
+	return response
+}
+
+func (s *Server) parseRequest(r *http.Request) (request, error) {
+	var body struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return request{}, malformed("invalid jws: " + err.Error())
+	}
+
+	protectedData, err := base64.RawURLEncoding.DecodeString(body.Protected)
+
+	if err != nil {
+		return request{}, malformed("invalid jws header")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(body.Payload)
+
+	if err != nil {
+		return request{}, malformed("invalid jws payload")
+	}
+
+	var protected struct {
+		KID string          `json:"kid"`
+		JWK json.RawMessage `json:"jwk"`
+	}
+
+	if err = json.Unmarshal(protectedData, &protected); err != nil {
+		return request{}, malformed("invalid jws header")
+	}
+
+	req := request{payload: payload, id: r.PathValue("id")}
+
+	if protected.JWK != nil {
+		if req.thumbprint, err = thumbprint(protected.JWK); err != nil {
+			return request{}, malformed(err.Error())
+		}
+
+		return req, nil
+	}
+
+	s.mu.Lock()
+	req.account = s.accounts[protected.KID]
+	s.mu.Unlock()
+
+	if req.account == nil {
+		return request{}, &problem{status: http.StatusBadRequest, Type: errorPrefix + "accountDoesNotExist", Detail: "account does not exist"}
+	}
+
+	return req, nil
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+
+	return fmt.Sprint(s.nextID)
+}
+
+func (s *Server) setNonce(w http.ResponseWriter) {
+	w.Header().Set("Replay-Nonce", randomToken())
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the JSON web key
+func thumbprint(jwk json.RawMessage) (string, error) {
+	var key struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		E   string `json:"e"`
+		N   string `json:"n"`
+	}
+
+	if err := json.Unmarshal(jwk, &key); err != nil {
+		return "", err
+	}
+
+	var canonical string
+
+	switch key.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, key.Crv, key.X, key.Y)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, key.E, key.N)
+	default:
+		return "", errors.New("unsupported key type")
+	}
+
+	digest := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+func caTemplate(commonName string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+func encodeChain(certificates ...[]byte) []byte {
+	var chain bytes.Buffer
+
+	for _, der := range certificates {
+		pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: der}) // nolint:errcheck
+	}
+
+	return chain.Bytes()
+}
+
+func accountResponse(a *account) any {
+	return map[string]any{
+		"status":  statusValid,
+		"contact": a.contact,
+	}
+}
+
+func authorizationResponse(authz *authorization) any {
+	return map[string]any{
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"status":     authz.status,
+		"wildcard":   authz.wildcard,
+		"challenges": authz.challenges,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, err error) {
+	var p *problem
+
+	if !errors.As(err, &p) {
+		p = &problem{status: http.StatusInternalServerError, Type: errorPrefix + "serverInternal", Detail: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.status)
+	json.NewEncoder(w).Encode(p) // nolint:errcheck
+}
+
+func malformed(detail string) error {
+	return &problem{status: http.StatusBadRequest, Type: errorPrefix + "malformed", Detail: detail}
+}
+
+func unauthorized() error {
+	return &problem{status: http.StatusForbidden, Type: errorPrefix + "unauthorized", Detail: "unauthorized"}
+}
+
+func notFound() error {
+	return &problem{status: http.StatusNotFound, Type: errorPrefix + "malformed", Detail: "resource not found"}
+}
+
+func randomToken() string {
+	token := make([]byte, 16)
+	rand.Read(token) // nolint:errcheck
+
+	return hex.EncodeToString(token)
+}
@@ -0,0 +1,46 @@
+package acme
+
+import (
+	"backend/internal/pkg/dns"
+	"context"
+	"time"
+)
+
+// DnsSolver solves the DNS-01 challenge with the TXT record created by the DNS provider
+type DnsSolver struct {
+	Provider dns.Provider
+	// PropagationDelay is the time given to secondary name servers to get the record before the challenge is accepted
+	PropagationDelay time.Duration
+}
+
+func (s DnsSolver) ChallengeType() string {
+	return DNS01
+}
+
+func (s DnsSolver) Present(ctx context.Context, domain, token, keyAuthorization string) error {
+	fqdn, value := DnsChallengeRecord(domain, keyAuthorization)
+
+	if err := s.Provider.Present(ctx, fqdn, value); err != nil {
+		return err
+	}
+
+	if s.PropagationDelay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(s.PropagationDelay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s DnsSolver) CleanUp(ctx context.Context, domain, token, keyAuthorization string) error {
+	fqdn, value := DnsChallengeRecord(domain, keyAuthorization)
+
+	return s.Provider.CleanUp(ctx, fqdn, value)
+}
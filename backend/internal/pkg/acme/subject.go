@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const wildcardPrefix = "*."
+
+var ErrInvalidSubject = errors.New("invalid certificate subject")
+
+// IsWildcard reports whether the subject is a wildcard domain, e.g. *.example.com
+func IsWildcard(subject string) bool {
+	return strings.HasPrefix(subject, wildcardPrefix)
+}
+
+func HasWildcard(subjects []string) bool {
+	for _, subject := range subjects {
+		if IsWildcard(subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateSubject checks that the subject is a domain name. A wildcard is allowed only as the whole leftmost label
+// of a domain with at least two more labels, so *.example.com is valid, while *.com and www.*.example.com are not.
+func ValidateSubject(subject string) error {
+	name := strings.TrimPrefix(subject, wildcardPrefix)
+	labels := strings.Split(name, ".")
+
+	if len(name) > 253 || (IsWildcard(subject) && len(labels) < 2) {
+		return fmt.Errorf("%w: %s", ErrInvalidSubject, subject)
+	}
+
+	for _, label := range labels {
+		if !isValidLabel(label) {
+			return fmt.Errorf("%w: %s", ErrInvalidSubject, subject)
+		}
+	}
+
+	return nil
+}
+
+func ValidateSubjects(subjects []string) error {
+	for _, subject := range subjects {
+		if err := ValidateSubject(subject); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MatchSubject reports whether the certificate subject covers the host. A wildcard covers exactly one label,
+// so *.example.com covers www.example.com, but neither example.com nor a.www.example.com.
+func MatchSubject(subject, host string) bool {
+	subject = strings.ToLower(strings.TrimSuffix(subject, "."))
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if !IsWildcard(subject) {
+		return subject == host
+	}
+
+	label, parent, found := strings.Cut(host, ".")
+
+	return found && label != "" && parent == strings.TrimPrefix(subject, wildcardPrefix)
+}
+
+// MatchSubjects reports whether any of the certificate subjects covers the host
+func MatchSubjects(subjects []string, host string) bool {
+	for _, subject := range subjects {
+		if MatchSubject(subject, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValidLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,44 @@
+package acme
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateSubject(t *testing.T) {
+	valid := []string{"example.com", "*.example.com", "*.dev.example.com", "xn--e1afmkfd.xn--p1ai", "localhost"}
+	invalid := []string{"", "*.com", "*", "www.*.example.com", "**.example.com", "-www.example.com", "exa mple.com", "example..com"}
+
+	for _, subject := range valid {
+		if err := ValidateSubject(subject); err != nil {
+			t.Errorf("expected %q to be valid, got %v", subject, err)
+		}
+	}
+
+	for _, subject := range invalid {
+		if err := ValidateSubject(subject); !errors.Is(err, ErrInvalidSubject) {
+			t.Errorf("expected %q to be invalid, got %v", subject, err)
+		}
+	}
+}
+
+func TestMatchSubject(t *testing.T) {
+	cases := []struct {
+		subject, host string
+		match         bool
+	}{
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "WWW.Example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.www.example.com", false},
+		{"*.example.com", "www.another.com", false},
+		{"example.com", "example.com", true},
+		{"example.com", "www.example.com", false},
+	}
+
+	for _, c := range cases {
+		if MatchSubject(c.subject, c.host) != c.match {
+			t.Errorf("unexpected match of %s and %s, expected %v", c.subject, c.host, c.match)
+		}
+	}
+}
@@ -2,12 +2,17 @@ package agent
 
 import (
 	"backend/internal/pkg/logger"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/r2dtools/agentintegration"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -29,9 +34,29 @@ func (err ErrAgentResponse) Error() string {
 }
 
 type Agent struct {
-	token  string
-	client *client
-	logger logger.Logger
+	serverID uint
+	token    string
+	// signingKey is set if requests are signed instead of carrying the token
+	signingKey []byte
+	transport  transport
+	breaker    *circuitBreaker
+	logger     logger.Logger
+	// logPayloads enables debug logging of redacted request and response payloads
+	logPayloads bool
+
+	// handshakes lets concurrent callers share one handshake, capabilitiesMu guards only the cached result
+	handshakes            singleflight.Group
+	capabilitiesMu        sync.Mutex
+	capabilities          *Capabilities
+	capabilitiesUpdatedAt time.Time
+}
+
+// transport delivers request frames to the agent
+type transport interface {
+	Request(ctx context.Context, data []byte, decode func(io.Reader) error) error
+	connectedAddress() (string, string)
+	evictIdle()
+	close()
 }
 
 type Response struct {
@@ -43,11 +68,32 @@ type Response struct {
 type requestData struct {
 	Token,
 	Command string
-	Data interface{}
+	Data json.RawMessage
+}
+
+// Options configure the agent connection
+type Options struct {
+	// ServerID identifies the server in metrics and traces
+	ServerID uint
+	// TLS enables the TLS transport, plaintext TCP is used if it is nil
+	TLS *TLSConfig
+	// MaxResponseSize limits the size of a response in bytes, DefaultMaxResponseSize is used if it is not positive
+	MaxResponseSize int64
+	// SignRequests replaces the token in the request body with an HMAC signature
+	SignRequests bool
+	// LogPayloads enables debug logging of request and response payloads with secrets redacted
+	LogPayloads bool
+	// PreferredFamily is the address family to dial first, FamilyIPv4 is dialed first if it is empty
+	PreferredFamily string
+	// OnPreferredFamilyChange is called when a connection is established over another address family
+	OnPreferredFamilyChange func(family string)
+	// Tunnels enables the reverse tunnel transport: requests are sent through the tunnel opened by the agent
+	// instead of connecting to the agent address
+	Tunnels *TunnelRegistry
 }
 
-func (a *Agent) GetServerData() (*agentintegration.ServerData, error) {
-	data, err := a.Request(serverDataCommand, nil)
+func (a *Agent) GetServerData(ctx context.Context) (*agentintegration.ServerData, error) {
+	data, err := a.Request(ctx, serverDataCommand, nil)
 
 	if err != nil {
 		return nil, err
@@ -63,8 +109,8 @@ func (a *Agent) GetServerData() (*agentintegration.ServerData, error) {
 	return &serverData, nil
 }
 
-func (a *Agent) GetVhosts() ([]agentintegration.VirtualHost, error) {
-	data, err := a.Request(getVhostsCommand, nil)
+func (a *Agent) GetVhosts(ctx context.Context) ([]agentintegration.VirtualHost, error) {
+	data, err := a.Request(ctx, getVhostsCommand, nil)
 
 	if err != nil {
 		return nil, err
@@ -80,8 +126,8 @@ func (a *Agent) GetVhosts() ([]agentintegration.VirtualHost, error) {
 	return vhosts, nil
 }
 
-func (a *Agent) GetVhostCertificate(vhostName string) (*agentintegration.Certificate, error) {
-	data, err := a.Request(getVhostCertificateCommand, map[string]string{
+func (a *Agent) GetVhostCertificate(ctx context.Context, vhostName string) (*agentintegration.Certificate, error) {
+	data, err := a.Request(ctx, getVhostCertificateCommand, map[string]string{
 		"vhostName": vhostName,
 	})
 
@@ -103,9 +149,16 @@ func (a *Agent) GetVhostCertificate(vhostName string) (*agentintegration.Certifi
 	return &certificate, nil
 }
 
-func (a *Agent) GetVhostConfig(request agentintegration.VirtualHostConfigRequestData) (agentintegration.VirtualHostConfigResponseData, error) {
+func (a *Agent) GetVhostConfig(ctx context.Context, request agentintegration.VirtualHostConfigRequestData) (agentintegration.VirtualHostConfigResponseData, error) {
 	var response agentintegration.VirtualHostConfigResponseData
-	data, err := a.Request(getVhostConfigCommand, request)
+	err := a.RequestInto(ctx, getVhostConfigCommand, request, &response)
+
+	return response, err
+}
+
+func (a *Agent) ChangeCertbotStatus(ctx context.Context, request agentintegration.ChangeCertbotStatusRequestData) (agentintegration.ChangeCertbotStatusResponseData, error) {
+	var response agentintegration.ChangeCertbotStatusResponseData
+	data, err := a.Request(ctx, changeCertbotStatusCommand, request)
 
 	if err != nil {
 		return response, err
@@ -120,47 +173,82 @@ func (a *Agent) GetVhostConfig(request agentintegration.VirtualHostConfigRequest
 	return response, nil
 }
 
-func (a *Agent) ChangeCertbotStatus(request agentintegration.ChangeCertbotStatusRequestData) (agentintegration.ChangeCertbotStatusResponseData, error) {
-	var response agentintegration.ChangeCertbotStatusResponseData
-	data, err := a.Request(changeCertbotStatusCommand, request)
+// ConnectedAddress returns the IP address and family of the last established connection.
+// Both are empty if the agent has not been connected yet.
+func (a *Agent) ConnectedAddress() (string, string) {
+	return a.transport.connectedAddress()
+}
 
-	if err != nil {
-		return response, err
-	}
+// BreakerState returns the state of the agent circuit breaker: closed, open or half-open
+func (a *Agent) BreakerState() string {
+	return a.breaker.State()
+}
 
-	err = mapstructure.Decode(data, &response)
+// EvictIdleConnections closes pooled connections that have not been used recently
+func (a *Agent) EvictIdleConnections() {
+	a.transport.evictIdle()
+}
 
-	if err != nil {
-		return response, errors.New("invalid response data")
+// Close closes all pooled connections to the agent
+func (a *Agent) Close() {
+	a.transport.close()
+}
+
+// Request sends the command to the agent. The request is cancelled when ctx is done or the command timeout is exceeded.
+func (a *Agent) Request(ctx context.Context, command string, data any) (interface{}, error) {
+	var result interface{}
+
+	if err := a.RequestInto(ctx, command, data, &result); err != nil {
+		return nil, err
 	}
 
-	return response, nil
+	return result, nil
 }
 
-func (a *Agent) Request(command string, data any) (interface{}, error) {
-	reqData := requestData{
-		Token:   a.token,
-		Command: command,
-		Data:    data,
+// RequestInto sends the command to the agent and decodes response data into target while the response is read.
+// It is intended for commands with large payloads.
+func (a *Agent) RequestInto(ctx context.Context, command string, data any, target any) (err error) {
+	ctx, end := getTelemetry().startRequest(ctx, a.serverID, command)
+	defer func() {
+		end(err)
+	}()
+
+	if err = a.checkCommand(ctx, command); err != nil {
+		return err
 	}
-	reqByteData, err := json.Marshal(reqData)
+
+	payload, err := json.Marshal(data)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not encode data: %v", err)
+		return fmt.Errorf("could not encode data: %v", err)
 	}
 
-	respData, err := a.client.Request(reqByteData)
+	var (
+		resp     Response
+		recorder *payloadRecorder
+	)
 
-	if err != nil {
-		return nil, err
+	if a.logPayloads {
+		recorder = &payloadRecorder{}
+		a.logger.Debug(fmt.Sprintf("request to agent, command: %s, payload: %s", command, redactPayload(payload)))
 	}
 
-	a.logger.Debug("response from agent: " + string(respData))
+	err = a.send(ctx, command, payload, func(reader io.Reader) error {
+		resp = Response{Data: target}
+
+		if recorder != nil {
+			reader = recorder.tee(reader)
+		}
+
+		return json.NewDecoder(reader).Decode(&resp)
+	})
 
-	var resp Response
+	if err != nil {
+		return err
+	}
 
-	if err = json.Unmarshal(respData, &resp); err != nil {
-		return nil, fmt.Errorf("could not decode response: %v", err)
+	if recorder != nil {
+		a.logger.Debug(fmt.Sprintf("response from agent, command: %s, payload: %s", command, recorder))
 	}
 
 	if resp.Status != "ok" {
@@ -170,21 +258,98 @@ func (a *Agent) Request(command string, data any) (interface{}, error) {
 			message = "unknown error"
 		}
 
-		return nil, ErrAgentResponse{
+		return ErrAgentResponse{
 			Command: command,
 			Message: message,
 		}
 	}
 
-	return resp.Data, nil
+	return nil
+}
+
+// send delivers the request through the circuit breaker. Read-only commands are retried on connection errors.
+func (a *Agent) send(ctx context.Context, command string, payload []byte, decode func(io.Reader) error) error {
+	if err := a.breaker.allow(); err != nil {
+		return err
+	}
+
+	timeout := getCommandTimeout(command)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var err error
+
+	for attempt := 0; attempt < maxRequestAttempts; attempt++ {
+		var data []byte
+
+		// every attempt is encoded anew, so a retried signed request gets a fresh nonce
+		if data, err = a.encodeRequest(command, payload); err != nil {
+			break
+		}
+
+		err = a.transport.Request(ctx, data, decode)
+
+		if err == nil || !isRetryable(command, err) || attempt == maxRequestAttempts-1 {
+			break
+		}
+
+		a.logger.Debug(fmt.Sprintf("retrying agent command %s: %v", command, err))
+
+		if waitErr := waitRetry(ctx, attempt); waitErr != nil {
+			err = TimeoutError{err: waitErr}
+
+			break
+		}
+	}
+
+	a.breaker.record(err)
+
+	var timeoutErr TimeoutError
+
+	if errors.As(err, &timeoutErr) {
+		timeoutErr.Command = command
+		timeoutErr.Timeout = timeout
+
+		return timeoutErr
+	}
+
+	return err
+}
+
+func (a *Agent) encodeRequest(command string, payload json.RawMessage) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if a.signingKey == nil {
+		data, err = json.Marshal(requestData{
+			Token:   a.token,
+			Command: command,
+			Data:    payload,
+		})
+	} else {
+		var request *SignedRequest
+
+		if request, err = newSignedRequest(a.signingKey, command, payload); err == nil {
+			data, err = json.Marshal(request)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not encode request: %v", err)
+	}
+
+	return data, nil
 }
 
-func NewAgent(ipv4, ipv6, token string, port int, logger logger.Logger) (*Agent, error) {
-	if ipv4 == "" && ipv6 == "" {
+// NewAgent creates an agent client
+func NewAgent(ipv4, ipv6, token string, port int, options Options, logger logger.Logger) (*Agent, error) {
+	if options.Tunnels == nil && ipv4 == "" && ipv6 == "" {
 		return nil, errors.New("ipv4 or ipv6 address must be specified")
 	}
 
-	if port <= 0 {
+	if options.Tunnels == nil && port <= 0 {
 		return nil, errors.New("invalid port")
 	}
 
@@ -192,21 +357,56 @@ func NewAgent(ipv4, ipv6, token string, port int, logger logger.Logger) (*Agent,
 		return nil, errors.New("invalid token")
 	}
 
-	ip := ipv4
+	maxResponseSize := options.MaxResponseSize
+
+	if maxResponseSize <= 0 {
+		maxResponseSize = DefaultMaxResponseSize
+	}
+
+	var agentTransport transport
 
-	if ip == "" {
-		ip = ipv6
+	if options.Tunnels != nil {
+		agentTransport = &tunnelTransport{
+			serverID: options.ServerID,
+			tunnels:  options.Tunnels,
+		}
+	} else {
+		addresses := newAddressBook(ipv4, ipv6)
+		addresses.preferred = options.PreferredFamily
+		addresses.onPreferredChange = options.OnPreferredFamilyChange
+		tcpClient := &client{
+			addresses:       addresses,
+			port:            port,
+			timeout:         defaultTimeout,
+			pool:            newConnPool(),
+			maxResponseSize: maxResponseSize,
+		}
+
+		if options.TLS != nil {
+			tcpClient.tlsConfig = options.TLS.clientConfig()
+		}
+
+		agentTransport = tcpClient
 	}
 
-	tcpClient := client{
-		ip:      ip,
-		port:    port,
-		timeout: defaultTimeout,
+	agent := &Agent{
+		serverID:    options.ServerID,
+		token:       token,
+		transport:   agentTransport,
+		breaker:     newCircuitBreaker(),
+		logger:      logger,
+		logPayloads: options.LogPayloads,
+	}
+
+	if options.SignRequests {
+		signingKey, err := DeriveSigningKey(token)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not derive signing key: %v", err)
+		}
+
+		agent.signingKey = signingKey
 	}
 
-	return &Agent{
-		token:  token,
-		client: &tcpClient,
-		logger: logger,
-	}, nil
+	return agent, nil
 }
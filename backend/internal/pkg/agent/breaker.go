@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+var ErrCircuitOpen = errors.New("server agent is unavailable, requests are suspended")
+
+// circuitBreaker stops sending requests to an agent after repeated connection failures.
+// Once the cooldown elapses the breaker is half-open and lets a single probe request through.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case BreakerOpen:
+		return ConnectionError{text: "circuit breaker is open", err: ErrCircuitOpen}
+	case BreakerHalfOpen:
+		if b.probing {
+			return ConnectionError{text: "circuit breaker is half-open", err: ErrCircuitOpen}
+		}
+
+		b.probing = true
+	}
+
+	return nil
+}
+
+// record updates the breaker with the result of a request
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if !isConnectionFailure(err) {
+		b.failures = 0
+		b.openedAt = time.Time{}
+
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state()
+}
+
+func (b *circuitBreaker) state() string {
+	if b.openedAt.IsZero() {
+		return BreakerClosed
+	}
+
+	if time.Since(b.openedAt) < b.cooldown {
+		return BreakerOpen
+	}
+
+	return BreakerHalfOpen
+}
+
+func isConnectionFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var connErr ConnectionError
+	var timeoutErr TimeoutError
+
+	return errors.As(err, &connErr) || errors.As(err, &timeoutErr)
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		threshold: defaultBreakerThreshold,
+		cooldown:  defaultBreakerCooldown,
+	}
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	connErr := ConnectionError{text: "could not connect to the server agent", err: errors.New("connection refused")}
+	timeoutErr := TimeoutError{err: context.DeadlineExceeded}
+	agentErr := ErrAgentResponse{Command: serverDataCommand, Message: "unknown error"}
+	repeat := func(err error, count int) []error {
+		errs := make([]error, count)
+
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return errs
+	}
+
+	tests := []struct {
+		name    string
+		results []error
+		elapsed time.Duration
+		state   string
+	}{
+		{"closed below the threshold", repeat(connErr, defaultBreakerThreshold-1), 0, BreakerClosed},
+		{"opens at the threshold", repeat(connErr, defaultBreakerThreshold), 0, BreakerOpen},
+		{"timeouts are failures", repeat(timeoutErr, defaultBreakerThreshold), 0, BreakerOpen},
+		{"agent errors are not failures", repeat(agentErr, defaultBreakerThreshold), 0, BreakerClosed},
+		{"success resets failures", append(repeat(connErr, defaultBreakerThreshold-1), nil, connErr), 0, BreakerClosed},
+		{"half-open after the cooldown", repeat(connErr, defaultBreakerThreshold), defaultBreakerCooldown, BreakerHalfOpen},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := newCircuitBreaker()
+
+			for _, err := range test.results {
+				breaker.record(err)
+			}
+
+			if !breaker.openedAt.IsZero() {
+				breaker.openedAt = breaker.openedAt.Add(-test.elapsed)
+			}
+
+			if state := breaker.State(); state != test.state {
+				t.Errorf("expected %s, got %s", test.state, state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	connErr := ConnectionError{text: "could not connect to the server agent", err: errors.New("connection refused")}
+
+	tests := []struct {
+		name   string
+		result error
+		state  string
+	}{
+		{"successful probe closes the breaker", nil, BreakerClosed},
+		{"failed probe opens the breaker again", connErr, BreakerOpen},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := newCircuitBreaker()
+
+			for range defaultBreakerThreshold {
+				breaker.record(connErr)
+			}
+
+			if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("expected the open breaker to reject requests, got %v", err)
+			}
+
+			breaker.openedAt = breaker.openedAt.Add(-defaultBreakerCooldown)
+
+			if err := breaker.allow(); err != nil {
+				t.Fatalf("expected the half-open breaker to let a probe through, got %v", err)
+			}
+
+			if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("expected a single probe at a time, got %v", err)
+			}
+
+			breaker.record(test.result)
+
+			if state := breaker.State(); state != test.state {
+				t.Errorf("expected %s, got %s", test.state, state)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, baseRetryBackoff},
+		{1, 2 * baseRetryBackoff},
+		{2, 4 * baseRetryBackoff},
+		{5, maxRetryBackoff},
+		{20, maxRetryBackoff},
+	}
+
+	for _, test := range tests {
+		for range 100 {
+			if backoff := retryBackoff(test.attempt); backoff <= 0 || backoff > test.max {
+				t.Fatalf("expected backoff of attempt %d in (0, %s], got %s", test.attempt, test.max, backoff)
+			}
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	connErr := ConnectionError{text: "could not connect to the server agent", err: errors.New("connection refused")}
+
+	tests := []struct {
+		name      string
+		command   string
+		err       error
+		retryable bool
+	}{
+		{"read-only command", getVhostsCommand, connErr, true},
+		{"mutating command", "certificates.issue", connErr, false},
+		{"open breaker", serverDataCommand, ConnectionError{text: "circuit breaker is open", err: ErrCircuitOpen}, false},
+		{"timeout", serverDataCommand, TimeoutError{err: context.DeadlineExceeded}, false},
+		{"agent error", serverDataCommand, ErrAgentResponse{Message: "unknown error"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if retryable := isRetryable(test.command, test.err); retryable != test.retryable {
+				t.Errorf("expected %v, got %v", test.retryable, retryable)
+			}
+		})
+	}
+}
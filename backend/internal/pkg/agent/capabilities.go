@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	handshakeCommand = "handshake"
+	// ProtocolVersion is the latest agent protocol version supported by the panel
+	ProtocolVersion = 1
+	// legacyProtocolVersion is used by agents that do not support the handshake command
+	legacyProtocolVersion = 1
+	capabilitiesTTL       = 10 * time.Minute
+	// unknownCommandMessage starts the error the agent responds with to a command it does not know
+	unknownCommandMessage = "unknown command"
+)
+
+// legacyCommands are supported by every agent released before the handshake command was introduced
+var legacyCommands = []string{
+	serverDataCommand,
+	getVhostsCommand,
+	getVhostCertificateCommand,
+	getVhostConfigCommand,
+	changeCertbotStatusCommand,
+	"certificates.issue",
+	"certificates.upload",
+	"certificates.domainassign",
+	"certificates.storagecertupload",
+	"certificates.storagecertremove",
+	"certificates.storagecertificates",
+	"certificates.storagecertdownload",
+	"certificates.commondirstatus",
+	"certificates.changecommondirstatus",
+}
+
+// Capabilities describes commands and features supported by the agent
+type Capabilities struct {
+	AgentVersion    string
+	ProtocolVersion int
+	Commands        []string
+	Features        []string
+}
+
+func (c Capabilities) SupportsCommand(command string) bool {
+	return slices.Contains(c.Commands, command)
+}
+
+func (c Capabilities) HasFeature(feature string) bool {
+	return slices.Contains(c.Features, feature)
+}
+
+type ErrUnsupportedCommand struct {
+	Command      string
+	AgentVersion string
+}
+
+func (e ErrUnsupportedCommand) Error() string {
+	return fmt.Sprintf("command %s is not supported by agent v%s", e.Command, e.AgentVersion)
+}
+
+type handshakeRequestData struct {
+	ProtocolVersion int
+}
+
+// Capabilities returns the agent capabilities. They are discovered once and cached for capabilitiesTTL.
+func (a *Agent) Capabilities(ctx context.Context) (*Capabilities, error) {
+	if capabilities := a.cachedCapabilities(); capabilities != nil {
+		return capabilities, nil
+	}
+
+	// the shared handshake is not canceled with the first caller, the command timeout still applies to it
+	result := a.handshakes.DoChan(handshakeCommand, func() (interface{}, error) {
+		capabilities, err := a.handshake(context.WithoutCancel(ctx))
+
+		if err != nil {
+			return nil, err
+		}
+
+		a.capabilitiesMu.Lock()
+		a.capabilities = capabilities
+		a.capabilitiesUpdatedAt = time.Now()
+		a.capabilitiesMu.Unlock()
+
+		return capabilities, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return res.Val.(*Capabilities), nil
+	}
+}
+
+func (a *Agent) cachedCapabilities() *Capabilities {
+	a.capabilitiesMu.Lock()
+	defer a.capabilitiesMu.Unlock()
+
+	if a.capabilities != nil && time.Since(a.capabilitiesUpdatedAt) < capabilitiesTTL {
+		return a.capabilities
+	}
+
+	return nil
+}
+
+func (a *Agent) handshake(ctx context.Context) (*Capabilities, error) {
+	data, err := a.Request(ctx, handshakeCommand, handshakeRequestData{ProtocolVersion: ProtocolVersion})
+
+	if err != nil {
+		// other errors, e.g. a rejected token, do not mean that the handshake is not supported
+		if !isUnknownCommand(err) {
+			return nil, err
+		}
+
+		// the agent does not know the handshake command
+		serverData, err := a.GetServerData(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Capabilities{
+			AgentVersion:    serverData.AgentVersion,
+			ProtocolVersion: legacyProtocolVersion,
+			Commands:        legacyCommands,
+		}, nil
+	}
+
+	var capabilities Capabilities
+
+	if err = mapstructure.Decode(data, &capabilities); err != nil {
+		return nil, errors.New("invalid handshake data")
+	}
+
+	capabilities.ProtocolVersion = min(capabilities.ProtocolVersion, ProtocolVersion)
+
+	return &capabilities, nil
+}
+
+func isUnknownCommand(err error) bool {
+	var responseErr ErrAgentResponse
+
+	return errors.As(err, &responseErr) && strings.HasPrefix(strings.ToLower(responseErr.Message), unknownCommandMessage)
+}
+
+func (a *Agent) checkCommand(ctx context.Context, command string) error {
+	if command == handshakeCommand || command == serverDataCommand {
+		return nil
+	}
+
+	capabilities, err := a.Capabilities(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if !capabilities.SupportsCommand(command) {
+		return ErrUnsupportedCommand{
+			Command:      command,
+			AgentVersion: capabilities.AgentVersion,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package agent_test
+
+import (
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+func startAgent(t *testing.T) (*fakeagent.Agent, *agent.Agent) {
+	t.Helper()
+
+	fAgent, err := fakeagent.Start(testToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(fAgent.Close)
+	ip, port := fAgent.Address()
+	nAgent, err := agent.NewAgent(ip, "", testToken, port, agent.Options{}, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(nAgent.Close)
+
+	return fAgent, nAgent
+}
+
+func TestCapabilitiesOfAgentWithoutHandshake(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake string
+		legacy    bool
+	}{
+		{"unknown command", "", true},
+		{"rejected request", "invalid token", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fAgent, nAgent := startAgent(t)
+			fAgent.SetServerData(agentintegration.ServerData{AgentVersion: "0.9.0"})
+
+			if test.handshake != "" {
+				fAgent.RespondError("handshake", test.handshake)
+			}
+
+			capabilities, err := nAgent.Capabilities(context.Background())
+
+			if !test.legacy {
+				if err == nil || err.Error() != test.handshake {
+					t.Fatalf("expected the handshake error, got %v", err)
+				}
+
+				if len(fAgent.CommandRequests("getserverdata")) != 0 {
+					t.Fatal("expected the agent not to be treated as a legacy one")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if capabilities.AgentVersion != "0.9.0" || !capabilities.SupportsCommand("getVhosts") {
+				t.Fatalf("expected legacy capabilities, got %+v", capabilities)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesShareHandshake(t *testing.T) {
+	fAgent, nAgent := startAgent(t)
+	fAgent.Delay("handshake", 100*time.Millisecond, map[string]any{
+		"AgentVersion":    "1.0.0",
+		"ProtocolVersion": agent.ProtocolVersion,
+		"Commands":        []string{"getVhosts"},
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := nAgent.Capabilities(context.Background())
+			errs <- err
+		}()
+	}
+
+	// a canceled caller returns at once, while the handshake is in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := nAgent.Capabilities(ctx); err != context.Canceled {
+		t.Errorf("expected the canceled caller to return, got %v", err)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := len(fAgent.CommandRequests("handshake")); count != 1 {
+		t.Fatalf("expected one handshake, got %d", count)
+	}
+}
@@ -0,0 +1,30 @@
+package agent
+
+import "context"
+
+const (
+	presentHttpChallengeCommand = "certificates.httpchallengepresent"
+	cleanUpHttpChallengeCommand = "certificates.httpchallengecleanup"
+)
+
+// HttpChallengeRequestData describes the HTTP-01 challenge of the domain. The agent serves the key authorization
+// at /.well-known/acme-challenge/<token> of the domain until the challenge is cleaned up.
+type HttpChallengeRequestData struct {
+	ServerName       string
+	WebServer        string
+	Token            string
+	KeyAuthorization string
+}
+
+// PresentHttpChallenge makes the agent serve the key authorization of the challenge issued to the panel ACME client
+func (a *Agent) PresentHttpChallenge(ctx context.Context, data HttpChallengeRequestData) error {
+	_, err := a.Request(ctx, presentHttpChallengeCommand, data)
+
+	return err
+}
+
+func (a *Agent) CleanUpHttpChallenge(ctx context.Context, data HttpChallengeRequestData) error {
+	_, err := a.Request(ctx, cleanUpHttpChallengeCommand, data)
+
+	return err
+}
@@ -1,7 +1,10 @@
 package agent
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -13,10 +16,17 @@ const (
 	defaultTimeout   = 5 * time.Second
 )
 
+// errStaleConnection reports that the request could not be sent, so the agent has not received it
+var errStaleConnection = errors.New("connection closed by the server agent")
+
 type client struct {
-	ip      string
-	port    int
-	timeout time.Duration
+	addresses *addressBook
+	port      int
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	pool      *connPool
+	// maxResponseSize limits the size of a response frame in bytes
+	maxResponseSize int64
 }
 
 type ConnectionError struct {
@@ -32,89 +42,208 @@ func (e ConnectionError) Unwrap() error {
 	return e.err
 }
 
-func (c client) Request(data []byte) ([]byte, error) {
-	addr := fmt.Sprintf("%s:%d", c.ip, c.port)
-	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
-
-	if err != nil {
-		return nil, ConnectionError{
-			text: "could not resolve TCP address",
-			err:  err,
+// Request sends the request data and passes the response frame to decode. Decoding happens while the response is read,
+// so large payloads are never buffered as a whole.
+func (c *client) Request(ctx context.Context, data []byte, decode func(io.Reader) error) error {
+	if conn := c.pool.get(); conn != nil {
+		err := c.roundTrip(ctx, conn, data, decode)
+
+		// the agent may close an idle connection at any moment, so the request that could not be sent
+		// is repeated on a new connection. Requests that were sent are never repeated here,
+		// since the agent may have applied them already.
+		if !errors.Is(err, errStaleConnection) {
+			return err
 		}
 	}
 
-	dialer := net.Dialer{Timeout: c.timeout}
-	conn, err := dialer.Dial(tcpAddr.Network(), tcpAddr.String())
+	conn, err := c.dial(ctx)
 
 	if err != nil {
-		return nil, ConnectionError{
-			text: "could not connect to the server agent",
+		return err
+	}
+
+	err = c.roundTrip(ctx, conn, data, decode)
+
+	if errors.Is(err, errStaleConnection) {
+		return ConnectionError{
+			text: "could not send request to the server agent",
 			err:  err,
 		}
 	}
-	defer conn.Close() // nolint:errcheck
 
-	if err = writeData(conn, data); err != nil {
-		return nil, err
+	return err
+}
+
+func (c *client) roundTrip(ctx context.Context, conn net.Conn, data []byte, decode func(io.Reader) error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) // nolint:errcheck
+	}
+
+	// cancellation of the context interrupts blocked reads and writes
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now()) // nolint:errcheck
+	})
+	defer stop()
+
+	if written, err := writeData(conn, data); err != nil {
+		conn.Close() // nolint:errcheck
+
+		if isTimeout(ctx, err) {
+			return TimeoutError{err: err}
+		}
+
+		// the agent can not have received the request if none of its bytes were written,
+		// so it can be sent again on a new connection even if the command is mutating
+		if written == 0 {
+			return fmt.Errorf("%w: %v", errStaleConnection, err)
+		}
+
+		return ConnectionError{
+			text: "could not send request to the server agent",
+			err:  err,
+		}
 	}
 
 	// read response data length
 	dataLen, err := readDataLen(conn)
 
 	if err != nil {
-		return nil, err
+		conn.Close() // nolint:errcheck
+
+		if isTimeout(ctx, err) {
+			return TimeoutError{err: err}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return ConnectionError{
+				text: "server agent closed the connection before responding",
+				err:  err,
+			}
+		}
+
+		return err
 	}
 
-	var rData []byte
-	buffer := make([]byte, 256)
-	var rLen int
+	if dataLen > c.maxResponseSize {
+		conn.Close() // nolint:errcheck
 
-	for {
-		len, err := conn.Read(buffer)
+		return ErrResponseTooLarge{Size: dataLen, Limit: c.maxResponseSize}
+	}
 
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+	frame := newFrameReader(conn, dataLen)
+	decodeErr := decode(frame)
+
+	// the rest of the frame is skipped to keep the connection in sync with the agent
+	if err = frame.drain(); err != nil {
+		conn.Close() // nolint:errcheck
 
-			return nil, fmt.Errorf("could not read response: %v", err)
+		if isTimeout(ctx, err) {
+			return TimeoutError{err: err}
 		}
 
-		rData = append(rData, buffer[:len]...)
-		rLen += len
+		var truncatedErr ErrTruncatedResponse
 
-		if rLen >= dataLen {
-			break
+		if errors.As(err, &truncatedErr) {
+			return err
 		}
+
+		return fmt.Errorf("could not read response: %v", err)
+	}
+
+	if decodeErr != nil {
+		decodeErr = DecodeError{err: decodeErr}
+	}
+
+	// the connection can not be reused if the context was cancelled while the response was read
+	if !stop() {
+		conn.Close() // nolint:errcheck
+
+		return decodeErr
 	}
 
-	return rData, nil
+	conn.SetDeadline(time.Time{}) // nolint:errcheck
+	c.pool.put(conn)
+
+	return decodeErr
+}
+
+func (c *client) dial(ctx context.Context) (net.Conn, error) {
+	conn, err := c.dialTCP(ctx)
+
+	if err != nil {
+		return nil, ConnectionError{
+			text: "could not connect to the server agent",
+			err:  err,
+		}
+	}
+
+	if c.tlsConfig == nil {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, c.tlsConfig)
+	handshakeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if err = tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		conn.Close() // nolint:errcheck
+
+		return nil, ConnectionError{
+			text: "TLS handshake with the server agent failed",
+			err:  err,
+		}
+	}
+
+	return tlsConn, nil
+}
+
+func (c *client) connectedAddress() (string, string) {
+	address := c.addresses.last()
+
+	if address == nil {
+		return "", ""
+	}
+
+	return address.ip, address.family
+}
+
+func (c *client) evictIdle() {
+	c.pool.evictIdle()
 }
 
-func writeData(writer io.Writer, data []byte) error {
+func (c *client) close() {
+	c.pool.close()
+}
+
+// writeData sends the request frame and returns the number of bytes written
+func writeData(writer io.Writer, data []byte) (int, error) {
 	// First, write sending data length to the two bytes
 	header := make([]byte, headerDataLength)
 	dataLen := len(data)
 	binary.BigEndian.PutUint32(header, uint32(dataLen))
 
-	if _, err := writer.Write(header); err != nil {
-		return fmt.Errorf("could not send request header: %v", err)
+	written, err := writer.Write(header)
+
+	if err != nil {
+		return written, fmt.Errorf("could not send request header: %v", err)
 	}
 
-	if _, err := writer.Write(data); err != nil {
-		return fmt.Errorf("could not send request data: %v", err)
+	n, err := writer.Write(data)
+	written += n
+
+	if err != nil {
+		return written, fmt.Errorf("could not send request data: %v", err)
 	}
 
-	return nil
+	return written, nil
 }
 
-// readDataLen reads first 2 bytes where data length is stored
-func readDataLen(reader io.Reader) (int, error) {
-	header := make([]byte, headerDataLength)
-
-	if _, err := reader.Read(header); err != nil {
-		return 0, fmt.Errorf("could not read response data length: %v", err)
+func isTimeout(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return true
 	}
 
-	return int(binary.BigEndian.Uint32(header)), nil
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+	// fallbackDelay is how long the preferred address is tried alone before the other family is dialed in parallel
+	fallbackDelay = 300 * time.Millisecond
+)
+
+type dialAddress struct {
+	family string
+	ip     string
+}
+
+type dialResult struct {
+	conn    net.Conn
+	address dialAddress
+	err     error
+}
+
+// addressBook keeps agent addresses and remembers the one the last connection was established to
+type addressBook struct {
+	mu        sync.Mutex
+	addresses []dialAddress
+	connected *dialAddress
+	// preferred is the family to dial first, it follows the family of the last successful connection
+	preferred string
+	// onPreferredChange is called when the preferred family changes, so it can outlive the agent
+	onPreferredChange func(family string)
+}
+
+// ordered returns addresses starting with the preferred family
+func (b *addressBook) ordered() []dialAddress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	addresses := append([]dialAddress{}, b.addresses...)
+
+	if b.preferred != "" && len(addresses) > 1 && addresses[0].family != b.preferred {
+		addresses[0], addresses[1] = addresses[1], addresses[0]
+	}
+
+	return addresses
+}
+
+func (b *addressBook) remember(address dialAddress) {
+	b.mu.Lock()
+	changed := b.preferred != address.family
+	b.connected = &address
+	b.preferred = address.family
+	onPreferredChange := b.onPreferredChange
+	b.mu.Unlock()
+
+	if changed && onPreferredChange != nil {
+		onPreferredChange(address.family)
+	}
+}
+
+// last returns the address of the last successful connection
+func (b *addressBook) last() *dialAddress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.connected
+}
+
+func newAddressBook(ipv4, ipv6 string) *addressBook {
+	book := &addressBook{}
+
+	if ipv4 != "" {
+		book.addresses = append(book.addresses, dialAddress{family: FamilyIPv4, ip: ipv4})
+	}
+
+	if ipv6 != "" {
+		book.addresses = append(book.addresses, dialAddress{family: FamilyIPv6, ip: ipv6})
+	}
+
+	return book
+}
+
+// dialTCP connects to the agent happy-eyeballs style: the preferred address is dialed first and
+// the other one is dialed in parallel if the first attempt neither succeeds nor fails within fallbackDelay.
+func (c *client) dialTCP(ctx context.Context) (net.Conn, error) {
+	addresses := c.addresses.ordered()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	results := make(chan dialResult, len(addresses))
+	next := 0
+	pending := 0
+
+	startNext := func() {
+		address := addresses[next]
+		next++
+		pending++
+
+		go func() {
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address.ip, strconv.Itoa(c.port)))
+			results <- dialResult{conn: conn, address: address, err: err}
+		}()
+	}
+
+	startNext()
+
+	var fallback <-chan time.Time
+
+	if next < len(addresses) {
+		timer := time.NewTimer(fallbackDelay)
+		defer timer.Stop()
+		fallback = timer.C
+	}
+
+	var errs []error
+
+	for pending > 0 {
+		select {
+		case <-fallback:
+			fallback = nil
+			startNext()
+		case result := <-results:
+			pending--
+
+			if result.err == nil {
+				cancel()
+				c.addresses.remember(result.address)
+
+				// close connections of attempts that succeed after the winner
+				go func(pending int) {
+					for range pending {
+						if late := <-results; late.conn != nil {
+							late.conn.Close() // nolint:errcheck
+						}
+					}
+				}(pending)
+
+				return result.conn, nil
+			}
+
+			errs = append(errs, fmt.Errorf("%s: %w", result.address.ip, result.err))
+
+			// the other family is dialed immediately if the preferred one failed fast
+			if next < len(addresses) {
+				fallback = nil
+				startNext()
+			}
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
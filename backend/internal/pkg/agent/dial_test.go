@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAddressBookOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		ipv4      string
+		ipv6      string
+		preferred string
+		order     []string
+	}{
+		{"ipv4 first by default", "10.0.0.1", "fd00::1", "", []string{"10.0.0.1", "fd00::1"}},
+		{"preferred ipv4", "10.0.0.1", "fd00::1", FamilyIPv4, []string{"10.0.0.1", "fd00::1"}},
+		{"preferred ipv6", "10.0.0.1", "fd00::1", FamilyIPv6, []string{"fd00::1", "10.0.0.1"}},
+		{"preferred family without address", "10.0.0.1", "", FamilyIPv6, []string{"10.0.0.1"}},
+		{"ipv6 only", "", "fd00::1", FamilyIPv4, []string{"fd00::1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newAddressBook(test.ipv4, test.ipv6)
+			book.preferred = test.preferred
+			var order []string
+
+			for _, address := range book.ordered() {
+				order = append(order, address.ip)
+			}
+
+			if !slices.Equal(order, test.order) {
+				t.Errorf("expected %v, got %v", test.order, order)
+			}
+		})
+	}
+}
+
+func TestAddressBookRemember(t *testing.T) {
+	var changes []string
+	book := newAddressBook("10.0.0.1", "fd00::1")
+	book.onPreferredChange = func(family string) {
+		changes = append(changes, family)
+	}
+
+	book.remember(dialAddress{family: FamilyIPv6, ip: "fd00::1"})
+	book.remember(dialAddress{family: FamilyIPv6, ip: "fd00::1"})
+	book.remember(dialAddress{family: FamilyIPv4, ip: "10.0.0.1"})
+
+	if !slices.Equal(changes, []string{FamilyIPv6, FamilyIPv4}) {
+		t.Errorf("expected a change per family switch, got %v", changes)
+	}
+
+	if last := book.last(); last == nil || last.ip != "10.0.0.1" {
+		t.Errorf("expected the last connected address, got %v", last)
+	}
+}
+
+func TestDialFallsBackToAnotherFamily(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close() // nolint:errcheck
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			conn.Close() // nolint:errcheck
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name string
+		ipv6 string
+	}{
+		// nothing listens on the port of the loopback address, so the connection is refused at once
+		{"preferred address refuses", "::1"},
+		// the documentation address does not answer, so the other family is dialed after the fallback delay
+		{"preferred address does not answer", "2001:db8::1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var changes []string
+			book := newAddressBook("127.0.0.1", test.ipv6)
+			book.preferred = FamilyIPv6
+			book.onPreferredChange = func(family string) {
+				changes = append(changes, family)
+			}
+			c := &client{addresses: book, port: port, timeout: defaultTimeout}
+			start := time.Now()
+			conn, err := c.dialTCP(context.Background())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn.Close() // nolint:errcheck
+
+			if elapsed := time.Since(start); elapsed > fallbackDelay+time.Second {
+				t.Errorf("expected the fallback within %s, took %s", fallbackDelay, elapsed)
+			}
+
+			if ip, family := c.connectedAddress(); ip != "127.0.0.1" || family != FamilyIPv4 {
+				t.Errorf("expected connection over ipv4, got %s %s", ip, family)
+			}
+
+			if !slices.Equal(changes, []string{FamilyIPv4}) {
+				t.Errorf("expected the preferred family to change to ipv4, got %v", changes)
+			}
+		})
+	}
+}
+
+func TestDialFailsIfNoAddressAnswers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close() // nolint:errcheck
+
+	c := &client{addresses: newAddressBook("127.0.0.1", "::1"), port: port, timeout: defaultTimeout}
+
+	if _, err = c.dialTCP(context.Background()); err == nil {
+		t.Fatal("expected connection error")
+	}
+
+	if ip, _ := c.connectedAddress(); ip != "" {
+		t.Errorf("expected no connected address, got %s", ip)
+	}
+}
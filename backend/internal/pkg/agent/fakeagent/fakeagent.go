@@ -0,0 +1,644 @@
+// Package fakeagent provides an in-process server agent that speaks the panel wire protocol.
+// It is intended for tests of code that talks to agents.
+package fakeagent
+
+import (
+	"backend/internal/pkg/agent"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const headerDataLength = 4 // bytes
+
+// Request is a request received by the fake agent
+type Request struct {
+	Token   string
+	Command string
+	Data    json.RawMessage
+	// Signed is true if the request was authenticated with a signature instead of the token
+	Signed bool
+	// AuthToken is the token the request was authenticated with
+	AuthToken string
+}
+
+type requestEnvelope struct {
+	Token string
+	agent.SignedRequest
+}
+
+// Decode decodes request data into v
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Data, v)
+}
+
+// Reply describes how the fake agent responds to a request
+type Reply struct {
+	Data any
+	// Error makes the agent respond with an error status
+	Error string
+	// Delay postpones the response
+	Delay time.Duration
+	// Drop closes the connection without a response
+	Drop bool
+}
+
+type Handler func(request Request) Reply
+
+type response struct {
+	Status string
+	Error  string
+	Data   any
+}
+
+type Agent struct {
+	listener net.Listener
+	// certificate is set if the agent serves TLS
+	certificate *tls.Certificate
+
+	mu    sync.Mutex
+	token string
+	// stagedToken is accepted along with the token while a token rotation is in progress
+	stagedToken string
+	// commands are reported by the handshake in addition to the basic ones
+	commands []string
+	handlers map[string]Handler
+	requests []Request
+	nonces   map[string]struct{}
+	// httpChallenges are key authorizations of presented HTTP-01 challenges keyed by token
+	httpChallenges map[string]string
+	conns          map[net.Conn]struct{}
+	wg             sync.WaitGroup
+}
+
+// Start starts the fake agent on a random local TCP port
+func Start(token string) (*Agent, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return start(token, listener, nil), nil
+}
+
+// StartTLS starts the fake agent that serves TLS with the self-signed certificate on a random local TCP port.
+// If clientCAs is not nil, the agent requires a client certificate signed by one of them.
+func StartTLS(token string, certificate tls.Certificate, clientCAs *x509.CertPool) (*Agent, error) {
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAs != nil {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return start(token, listener, &certificate), nil
+}
+
+// GenerateCertificate returns a self-signed certificate for 127.0.0.1 like the one an agent creates on installation
+func GenerateCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "r2dtools agent"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func start(token string, listener net.Listener, certificate *tls.Certificate) *Agent {
+	agent := &Agent{
+		token:       token,
+		listener:    listener,
+		certificate: certificate,
+		handlers:    map[string]Handler{},
+		conns:       map[net.Conn]struct{}{},
+		nonces:      map[string]struct{}{},
+
+		httpChallenges: map[string]string{},
+	}
+	agent.SetServerData(agentintegration.ServerData{
+		HostName:     "localhost",
+		Platform:     "ubuntu",
+		AgentVersion: "1.0.0",
+	})
+
+	agent.wg.Add(1)
+	go agent.serve()
+
+	return agent
+}
+
+// Fingerprint returns the fingerprint of the agent certificate. It is empty if the agent does not serve TLS.
+func (a *Agent) Fingerprint() string {
+	if a.certificate == nil {
+		return ""
+	}
+
+	return agent.CertificateFingerprint(a.certificate.Certificate[0])
+}
+
+// Address returns the IP address and port the agent listens on
+func (a *Agent) Address() (string, int) {
+	addr := a.listener.Addr().(*net.TCPAddr)
+
+	return addr.IP.String(), addr.Port
+}
+
+// Close stops the agent and closes all open connections
+func (a *Agent) Close() {
+	a.listener.Close() // nolint:errcheck
+
+	a.mu.Lock()
+
+	for conn := range a.conns {
+		conn.Close() // nolint:errcheck
+	}
+
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+// Handle sets the handler of the command
+func (a *Agent) Handle(command string, handler Handler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.handlers[command] = handler
+}
+
+// Respond makes the agent respond to the command with the data
+func (a *Agent) Respond(command string, data any) {
+	a.Handle(command, func(Request) Reply {
+		return Reply{Data: data}
+	})
+}
+
+// RespondError makes the agent respond to the command with the error
+func (a *Agent) RespondError(command, message string) {
+	a.Handle(command, func(Request) Reply {
+		return Reply{Error: message}
+	})
+}
+
+// Delay makes the agent respond to the command with the data after the delay
+func (a *Agent) Delay(command string, delay time.Duration, data any) {
+	a.Handle(command, func(Request) Reply {
+		return Reply{Data: data, Delay: delay}
+	})
+}
+
+// DropConnection makes the agent close the connection when the command is received
+func (a *Agent) DropConnection(command string) {
+	a.Handle(command, func(Request) Reply {
+		return Reply{Drop: true}
+	})
+}
+
+func (a *Agent) SetServerData(data agentintegration.ServerData) {
+	a.Respond("getserverdata", data)
+}
+
+func (a *Agent) SetVhosts(vhosts []agentintegration.VirtualHost) {
+	a.Respond("getVhosts", vhosts)
+}
+
+func (a *Agent) SetStorageCertificates(certificates map[string]*agentintegration.Certificate) {
+	a.Respond("certificates.storagecertificates", agentintegration.CertificatesResponseData{
+		Certificates: certificates,
+	})
+}
+
+func (a *Agent) SetIssueResult(certificate *agentintegration.Certificate) {
+	a.Respond("certificates.issue", certificate)
+}
+
+// Requests returns requests received by the agent
+func (a *Agent) Requests() []Request {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]Request{}, a.requests...)
+}
+
+// CommandRequests returns received requests of the command
+func (a *Agent) CommandRequests(command string) []Request {
+	var requests []Request
+
+	for _, request := range a.Requests() {
+		if request.Command == command {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+func (a *Agent) serve() {
+	defer a.wg.Done()
+
+	for {
+		conn, err := a.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		a.mu.Lock()
+		a.conns[conn] = struct{}{}
+		a.mu.Unlock()
+
+		a.wg.Add(1)
+		go a.serveConn(conn)
+	}
+}
+
+func (a *Agent) serveConn(conn net.Conn) {
+	defer a.wg.Done()
+	defer func() {
+		a.mu.Lock()
+		delete(a.conns, conn)
+		a.mu.Unlock()
+		conn.Close() // nolint:errcheck
+	}()
+
+	for {
+		data, err := readFrame(conn)
+
+		if err != nil {
+			return
+		}
+
+		respData, ok := a.handle(data)
+
+		if !ok {
+			return
+		}
+
+		if err = writeFrame(conn, respData); err != nil {
+			return
+		}
+	}
+}
+
+// handle authenticates the request and returns the response data. It returns false if the connection must be closed.
+func (a *Agent) handle(data []byte) ([]byte, bool) {
+	var envelope requestEnvelope
+
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, false
+	}
+
+	request := Request{
+		Token:   envelope.Token,
+		Command: envelope.Command,
+		Data:    envelope.Data,
+		Signed:  envelope.Signature != "",
+	}
+
+	var (
+		reply Reply
+		err   error
+	)
+
+	if request.Signed {
+		if request.AuthToken, err = a.verify(envelope.SignedRequest); err != nil {
+			reply = Reply{Error: err.Error()}
+		}
+	} else if a.acceptsToken(request.Token) {
+		request.AuthToken = request.Token
+	} else {
+		reply = Reply{Error: "invalid token"}
+	}
+
+	a.mu.Lock()
+	a.requests = append(a.requests, request)
+	handler, ok := a.handlers[request.Command]
+	a.mu.Unlock()
+
+	switch {
+	case reply.Error != "":
+	case !ok:
+		reply = Reply{Error: "unknown command " + request.Command}
+	default:
+		reply = handler(request)
+	}
+
+	if reply.Delay > 0 {
+		time.Sleep(reply.Delay)
+	}
+
+	if reply.Drop {
+		return nil, false
+	}
+
+	resp := response{Status: "ok", Data: reply.Data}
+
+	if reply.Error != "" {
+		resp = response{Status: "error", Error: reply.Error}
+	}
+
+	respData, err := json.Marshal(resp)
+
+	if err != nil {
+		return nil, false
+	}
+
+	return respData, true
+}
+
+// EnableTokenRotation makes the agent support two-phase token rotation commands
+func (a *Agent) EnableTokenRotation() {
+	a.supportCommands("token.stage", "token.commit", "token.abort")
+	a.Handle("token.stage", func(request Request) Reply {
+		var data struct{ Token string }
+
+		if err := request.Decode(&data); err != nil || data.Token == "" {
+			return Reply{Error: "invalid token"}
+		}
+
+		a.mu.Lock()
+		a.stagedToken = data.Token
+		a.mu.Unlock()
+
+		return Reply{}
+	})
+	a.Handle("token.commit", func(request Request) Reply {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		if a.stagedToken == "" || request.AuthToken != a.stagedToken {
+			return Reply{Error: "token is not staged"}
+		}
+
+		a.token = a.stagedToken
+		a.stagedToken = ""
+
+		return Reply{}
+	})
+	a.Handle("token.abort", func(request Request) Reply {
+		a.mu.Lock()
+		a.stagedToken = ""
+		a.mu.Unlock()
+
+		return Reply{}
+	})
+}
+
+// EnableUpgrade makes the agent support the upgrade command. The agent reports the version in server data
+// and an upgraded agent reports the requested one.
+func (a *Agent) EnableUpgrade(version string) {
+	a.supportCommands("agent.upgrade")
+	a.Handle("getserverdata", func(Request) Reply {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		return Reply{Data: agentintegration.ServerData{AgentVersion: version}}
+	})
+	a.Handle("agent.upgrade", func(request Request) Reply {
+		var data struct{ Version string }
+
+		if err := request.Decode(&data); err != nil || data.Version == "" {
+			return Reply{Error: "invalid version"}
+		}
+
+		a.mu.Lock()
+		version = data.Version
+		a.mu.Unlock()
+
+		return Reply{}
+	})
+}
+
+// EnableHttpChallenge makes the agent support HTTP-01 challenge commands along with the certificate storage commands
+// used to deploy certificates issued by the panel. Presented challenges are returned by HttpChallenge.
+func (a *Agent) EnableHttpChallenge() {
+	a.supportCommands(
+		"certificates.issue",
+		"certificates.httpchallengepresent",
+		"certificates.httpchallengecleanup",
+		"certificates.storagecertupload",
+		"certificates.storagecertificates",
+		"certificates.domainassign",
+	)
+	a.Handle("certificates.httpchallengepresent", func(request Request) Reply {
+		var data agent.HttpChallengeRequestData
+
+		if err := request.Decode(&data); err != nil || data.Token == "" {
+			return Reply{Error: "invalid challenge"}
+		}
+
+		a.mu.Lock()
+		a.httpChallenges[data.Token] = data.KeyAuthorization
+		a.mu.Unlock()
+
+		return Reply{}
+	})
+	a.Handle("certificates.httpchallengecleanup", func(request Request) Reply {
+		var data agent.HttpChallengeRequestData
+
+		if err := request.Decode(&data); err != nil {
+			return Reply{Error: "invalid challenge"}
+		}
+
+		a.mu.Lock()
+		delete(a.httpChallenges, data.Token)
+		a.mu.Unlock()
+
+		return Reply{}
+	})
+}
+
+// HttpChallenge returns the key authorization the agent serves for the token
+func (a *Agent) HttpChallenge(token string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keyAuthorization, ok := a.httpChallenges[token]
+
+	return keyAuthorization, ok
+}
+
+// EnableCertificateDownload makes the agent support downloading of certificates of virtual hosts and the storage.
+// Vhost certificates are keyed by server names, storage ones by names in the storage__name format.
+func (a *Agent) EnableCertificateDownload(vhostCertificates, storageCertificates map[string]string) {
+	a.supportCommands(
+		"certificates.vhostcertdownload",
+		"certificates.storagecertificates",
+		"certificates.storagecertdownload",
+	)
+	a.Handle("certificates.vhostcertdownload", func(request Request) Reply {
+		var data agent.VhostCertificateDownloadRequestData
+
+		if err := request.Decode(&data); err != nil {
+			return Reply{Error: err.Error()}
+		}
+
+		content, ok := vhostCertificates[data.ServerName]
+
+		if !ok {
+			return Reply{Error: "certificate not found"}
+		}
+
+		return Reply{Data: agentintegration.CertificateDownloadResponseData{CertFileName: data.ServerName + ".pem", CertContent: content}}
+	})
+	a.Handle("certificates.storagecertdownload", func(request Request) Reply {
+		var data agentintegration.CertificateDownloadRequestData
+
+		if err := request.Decode(&data); err != nil {
+			return Reply{Error: err.Error()}
+		}
+
+		content, ok := storageCertificates[data.StorageType+"__"+data.CertName]
+
+		if !ok {
+			return Reply{Error: "certificate not found"}
+		}
+
+		return Reply{Data: agentintegration.CertificateDownloadResponseData{CertFileName: data.CertName + ".pem", CertContent: content}}
+	})
+}
+
+// supportCommands makes the agent answer the handshake and report the commands along with the basic ones
+func (a *Agent) supportCommands(commands ...string) {
+	a.mu.Lock()
+	a.commands = append(a.commands, commands...)
+	capabilities := map[string]any{
+		"AgentVersion":    "1.0.0",
+		"ProtocolVersion": agent.ProtocolVersion,
+		"Commands":        append([]string{"getserverdata", "getVhosts"}, a.commands...),
+	}
+	a.mu.Unlock()
+
+	a.Respond("handshake", capabilities)
+}
+
+// Token returns the token accepted by the agent and the staged one
+func (a *Agent) Token() (string, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.token, a.stagedToken
+}
+
+func (a *Agent) acceptsToken(token string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return token == a.token || (a.stagedToken != "" && token == a.stagedToken)
+}
+
+// verify checks the request signature against keys of accepted tokens and rejects replayed nonces.
+// It returns the token the request is signed with.
+func (a *Agent) verify(request agent.SignedRequest) (string, error) {
+	a.mu.Lock()
+	tokens := []string{a.token}
+
+	if a.stagedToken != "" {
+		tokens = append(tokens, a.stagedToken)
+	}
+
+	a.mu.Unlock()
+
+	var (
+		token string
+		err   error
+	)
+
+	for _, token = range tokens {
+		var key []byte
+
+		if key, err = agent.DeriveSigningKey(token); err != nil {
+			return "", err
+		}
+
+		if err = request.Verify(key, time.Now()); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.nonces[request.Nonce]; ok {
+		return "", errors.New("replayed request")
+	}
+
+	a.nonces[request.Nonce] = struct{}{}
+
+	return token, nil
+}
+
+func readFrame(reader io.Reader) ([]byte, error) {
+	header := make([]byte, headerDataLength)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header))
+
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, errors.New("truncated request")
+	}
+
+	return data, nil
+}
+
+func writeFrame(writer io.Writer, data []byte) error {
+	frame := make([]byte, headerDataLength+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[headerDataLength:], data)
+	_, err := writer.Write(frame)
+
+	return err
+}
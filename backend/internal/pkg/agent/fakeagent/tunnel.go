@@ -0,0 +1,112 @@
+package fakeagent
+
+import (
+	"backend/internal/pkg/agent"
+	"encoding/binary"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	streamIDLength    = 4 // bytes
+	heartbeatStreamID = 0
+)
+
+// DialTunnel opens a tunnel to the panel endpoint at url, e.g. ws://127.0.0.1:8080/v1/agent/tunnel,
+// authenticated with the signature made with the agent token. Requests received through the tunnel are handled like the direct ones
+// until the tunnel or the agent is closed.
+func (a *Agent) DialTunnel(url, serverGuid string) error {
+	config, err := websocket.NewConfig(url, "http://localhost/")
+
+	if err != nil {
+		return err
+	}
+
+	token, _ := a.Token()
+	signature, err := agent.SignTunnel(serverGuid, token)
+
+	if err != nil {
+		return err
+	}
+
+	config.Header.Set(agent.TunnelServerHeader, serverGuid)
+	signature.SetHeaders(config.Header)
+
+	conn, err := websocket.DialConfig(config)
+
+	if err != nil {
+		return err
+	}
+
+	conn.PayloadType = websocket.BinaryFrame
+
+	a.mu.Lock()
+	a.conns[conn] = struct{}{}
+	a.mu.Unlock()
+
+	a.wg.Add(1)
+	go a.serveTunnel(conn)
+
+	return nil
+}
+
+func (a *Agent) serveTunnel(conn *websocket.Conn) {
+	defer a.wg.Done()
+	defer func() {
+		a.mu.Lock()
+		delete(a.conns, conn)
+		a.mu.Unlock()
+		conn.Close() // nolint:errcheck
+	}()
+
+	var (
+		writeMu  sync.Mutex
+		requests sync.WaitGroup
+	)
+
+	defer requests.Wait()
+
+	for {
+		var message []byte
+
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			return
+		}
+
+		if len(message) < streamIDLength {
+			continue
+		}
+
+		if binary.BigEndian.Uint32(message) == heartbeatStreamID {
+			writeMu.Lock()
+			websocket.Message.Send(conn, message) // nolint:errcheck
+			writeMu.Unlock()
+
+			continue
+		}
+
+		// requests are multiplexed, so they are handled concurrently and responses may come in any order
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+
+			respData, ok := a.handle(message[streamIDLength:])
+
+			if !ok {
+				conn.Close() // nolint:errcheck
+
+				return
+			}
+
+			response := make([]byte, streamIDLength+len(respData))
+			copy(response, message[:streamIDLength])
+			copy(response[streamIDLength:], respData)
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+
+			websocket.Message.Send(conn, response) // nolint:errcheck
+		}()
+	}
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxResponseSize limits the size of an agent response if no limit is configured
+const DefaultMaxResponseSize = 64 << 20 // bytes
+
+// ErrResponseTooLarge reports that the agent announced a response exceeding the configured limit
+type ErrResponseTooLarge struct {
+	Size  int64
+	Limit int64
+}
+
+func (e ErrResponseTooLarge) Error() string {
+	// the size of a response received through the tunnel is not known once it exceeds the limit
+	if e.Size <= 0 {
+		return fmt.Sprintf("agent response exceeds the limit of %d bytes", e.Limit)
+	}
+
+	return fmt.Sprintf("agent response size %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+// ErrTruncatedResponse reports that the connection was closed before the whole response frame was received
+type ErrTruncatedResponse struct {
+	Expected int64
+	Received int64
+}
+
+func (e ErrTruncatedResponse) Error() string {
+	return fmt.Sprintf("truncated agent response: received %d of %d bytes", e.Received, e.Expected)
+}
+
+// DecodeError reports that the response frame is not a valid agent response
+type DecodeError struct {
+	err error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("could not decode response: %v", e.err)
+}
+
+func (e DecodeError) Unwrap() error {
+	return e.err
+}
+
+// frameReader reads the body of a single response frame from the connection.
+// It never reads past the frame, so the connection stays usable for the next request.
+type frameReader struct {
+	reader io.Reader
+	size   int64
+	read   int64
+	err    error
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	if f.read >= f.size {
+		return 0, io.EOF
+	}
+
+	p = p[:min(int64(len(p)), f.size-f.read)]
+	n, err := f.reader.Read(p)
+	f.read += int64(n)
+
+	if errors.Is(err, io.EOF) {
+		if f.read == f.size {
+			return n, nil
+		}
+
+		err = ErrTruncatedResponse{Expected: f.size, Received: f.read}
+	}
+
+	if err != nil {
+		f.err = err
+	}
+
+	return n, err
+}
+
+// drain skips the unread rest of the frame and returns the first read error
+func (f *frameReader) drain() error {
+	_, err := io.Copy(io.Discard, f)
+
+	return err
+}
+
+func newFrameReader(reader io.Reader, size int64) *frameReader {
+	return &frameReader{reader: reader, size: size}
+}
+
+// readDataLen reads first 4 bytes where data length is stored
+func readDataLen(reader io.Reader) (int64, error) {
+	header := make([]byte, headerDataLength)
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, errors.New("could not read response data length: truncated frame header")
+		}
+
+		return 0, fmt.Errorf("could not read response data length: %w", err)
+	}
+
+	return int64(binary.BigEndian.Uint32(header)), nil
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+// frame encodes the response frame announcing size bytes followed by the body
+func frame(size int, body []byte) []byte {
+	header := make([]byte, headerDataLength)
+	binary.BigEndian.PutUint32(header, uint32(size))
+
+	return append(header, body...)
+}
+
+func TestRoundTripResponseFrames(t *testing.T) {
+	const maxResponseSize = 16
+
+	tests := []struct {
+		name     string
+		response []byte
+		pooled   bool
+		check    func(err error) bool
+	}{
+		{"within the limit", frame(4, []byte("body")), true, func(err error) bool { return err == nil }},
+		{"at the limit", frame(maxResponseSize, bytes.Repeat([]byte("a"), maxResponseSize)), true, func(err error) bool {
+			return err == nil
+		}},
+		{"over the limit", frame(maxResponseSize+1, nil), false, func(err error) bool {
+			return errors.Is(err, ErrResponseTooLarge{Size: maxResponseSize + 1, Limit: maxResponseSize})
+		}},
+		{"truncated body", frame(8, []byte("body")), false, func(err error) bool {
+			return errors.Is(err, ErrTruncatedResponse{Expected: 8, Received: 4})
+		}},
+		{"truncated header", []byte{0, 0}, false, func(err error) bool { return err != nil }},
+		{"closed before responding", nil, false, func(err error) bool {
+			var connErr ConnectionError
+
+			return errors.As(err, &connErr)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &client{pool: newConnPool(), maxResponseSize: maxResponseSize}
+			conn, agentConn := newTestConn(t)
+
+			go func() {
+				readFrameBody(agentConn)       // nolint:errcheck
+				agentConn.Write(test.response) // nolint:errcheck
+
+				// the agent closes the connection unless the whole frame has been sent
+				if !test.pooled {
+					agentConn.Close() // nolint:errcheck
+				}
+			}()
+
+			var body []byte
+			err := c.roundTrip(context.Background(), conn, []byte("request"), func(reader io.Reader) error {
+				var err error
+				body, err = io.ReadAll(reader)
+
+				return err
+			})
+
+			if !test.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if pooled := len(c.pool.idle) == 1; pooled != test.pooled {
+				t.Errorf("expected the connection to be pooled %v, got %v", test.pooled, pooled)
+			}
+
+			if test.pooled && !bytes.Equal(frame(len(body), body), test.response) {
+				t.Errorf("unexpected response body %q", body)
+			}
+		})
+	}
+}
+
+func TestRoundTripWriteFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		agent func(agentConn net.Conn)
+		stale bool
+	}{
+		{"closed before the request", func(agentConn net.Conn) {
+			agentConn.Close() // nolint:errcheck
+		}, true},
+		{"closed while the request is sent", func(agentConn net.Conn) {
+			readDataLen(agentConn) // nolint:errcheck
+			agentConn.Close()      // nolint:errcheck
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &client{pool: newConnPool(), maxResponseSize: DefaultMaxResponseSize}
+			conn, agentConn := newTestConn(t)
+			go test.agent(agentConn)
+
+			err := c.roundTrip(context.Background(), conn, []byte("request"), func(io.Reader) error { return nil })
+
+			if stale := errors.Is(err, errStaleConnection); stale != test.stale {
+				t.Fatalf("expected the connection to be stale %v, got %v", test.stale, err)
+			}
+
+			var connErr ConnectionError
+
+			if !test.stale && !errors.As(err, &connErr) {
+				t.Errorf("expected connection error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRequestRedialsStaleConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close() // nolint:errcheck
+
+	go func() {
+		agentConn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer agentConn.Close() // nolint:errcheck
+
+		readFrameBody(agentConn)                // nolint:errcheck
+		agentConn.Write(frame(2, []byte("ok"))) // nolint:errcheck
+	}()
+
+	c := &client{
+		addresses:       newAddressBook("127.0.0.1", ""),
+		port:            listener.Addr().(*net.TCPAddr).Port,
+		timeout:         defaultTimeout,
+		pool:            newConnPool(),
+		maxResponseSize: DefaultMaxResponseSize,
+	}
+	// the pooled connection is closed right after it is taken from the pool, before the request is sent
+	conn, agentConn := newTestConn(t)
+	c.pool.put(conn)
+	agentConn.Close() // nolint:errcheck
+	c.pool.idle[0].raw = &alwaysAliveConn{conn}
+
+	var body []byte
+	err = c.Request(context.Background(), []byte("certificates.issue"), func(reader io.Reader) error {
+		var err error
+		body, err = io.ReadAll(reader)
+
+		return err
+	})
+
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("expected the request to be sent on a new connection, got %q, %v", body, err)
+	}
+}
+
+// alwaysAliveConn passes the liveness check of the pool, as if the agent closed the connection after it
+type alwaysAliveConn struct {
+	net.Conn
+}
+
+func (c *alwaysAliveConn) Read([]byte) (int, error) {
+	return 0, os.ErrDeadlineExceeded
+}
+
+func TestFrameReaderStopsAtFrameEnd(t *testing.T) {
+	reader := bytes.NewReader([]byte("firstsecond"))
+	frame := newFrameReader(reader, 5)
+	body, err := io.ReadAll(frame)
+
+	if err != nil || string(body) != "first" {
+		t.Fatalf("expected the first frame, got %q, %v", body, err)
+	}
+
+	if rest, _ := io.ReadAll(reader); string(rest) != "second" {
+		t.Errorf("expected the next frame to stay unread, got %q", rest)
+	}
+}
+
+func TestFrameReaderDrain(t *testing.T) {
+	conn, agentConn := net.Pipe()
+	defer conn.Close() // nolint:errcheck
+
+	go func() {
+		agentConn.Write([]byte("partial")) // nolint:errcheck
+		agentConn.Close()                  // nolint:errcheck
+	}()
+
+	frame := newFrameReader(conn, 16)
+
+	if err := frame.drain(); !errors.Is(err, ErrTruncatedResponse{Expected: 16, Received: 7}) {
+		t.Errorf("expected truncated response error, got %v", err)
+	}
+}
+
+func readFrameBody(reader io.Reader) ([]byte, error) {
+	size, err := readDataLen(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, size)
+	_, err = io.ReadFull(reader, body)
+
+	return body, err
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxIdleConns    = 4
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+type idleConn struct {
+	conn      net.Conn
+	raw       net.Conn
+	idleSince time.Time
+}
+
+// connPool keeps idle connections to a single agent so they can be reused by subsequent requests
+type connPool struct {
+	mu          sync.Mutex
+	idle        []idleConn
+	maxIdle     int
+	idleTimeout time.Duration
+	closed      bool
+}
+
+// get returns a healthy idle connection or nil if there is none
+func (p *connPool) get() net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		last := len(p.idle) - 1
+		ic := p.idle[last]
+		p.idle = p.idle[:last]
+
+		if time.Since(ic.idleSince) > p.idleTimeout || !isConnAlive(ic.raw) {
+			ic.conn.Close() // nolint:errcheck
+
+			continue
+		}
+
+		return ic.conn
+	}
+
+	return nil
+}
+
+// put returns the connection to the pool or closes it if the pool is full or closed
+func (p *connPool) put(conn net.Conn) {
+	raw := conn
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		raw = tlsConn.NetConn()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || len(p.idle) >= p.maxIdle {
+		conn.Close() // nolint:errcheck
+
+		return
+	}
+
+	p.idle = append(p.idle, idleConn{conn: conn, raw: raw, idleSince: time.Now()})
+}
+
+// evictIdle closes connections that have been idle longer than the idle timeout
+func (p *connPool) evictIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	alive := p.idle[:0]
+
+	for _, ic := range p.idle {
+		if time.Since(ic.idleSince) > p.idleTimeout {
+			ic.conn.Close() // nolint:errcheck
+
+			continue
+		}
+
+		alive = append(alive, ic)
+	}
+
+	p.idle = alive
+}
+
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, ic := range p.idle {
+		ic.conn.Close() // nolint:errcheck
+	}
+
+	p.idle = nil
+	p.closed = true
+}
+
+// isConnAlive checks that the agent has not closed an idle connection.
+// An idle connection must not have pending data, so a read with an expired deadline has to time out.
+func isConnAlive(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now()); err != nil {
+		return false
+	}
+
+	buffer := make([]byte, 1)
+	_, err := conn.Read(buffer)
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+
+	return conn.SetReadDeadline(time.Time{}) == nil
+}
+
+func newConnPool() *connPool {
+	return &connPool{
+		maxIdle:     defaultMaxIdleConns,
+		idleTimeout: defaultIdleConnTimeout,
+	}
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestConn returns the panel side of an in-memory connection and the agent side of it
+func newTestConn(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	conn, agentConn := net.Pipe()
+	t.Cleanup(func() {
+		conn.Close()      // nolint:errcheck
+		agentConn.Close() // nolint:errcheck
+	})
+
+	return conn, agentConn
+}
+
+func TestConnPoolGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(pool *connPool, agentConn net.Conn)
+		reused  bool
+	}{
+		{"idle connection is reused", func(*connPool, net.Conn) {}, true},
+		{"connection closed by the agent is dropped", func(_ *connPool, agentConn net.Conn) {
+			agentConn.Close() // nolint:errcheck
+		}, false},
+		{"expired connection is dropped", func(pool *connPool, _ net.Conn) { pool.idle[0].idleSince = time.Now().Add(-time.Hour) }, false},
+		{"closed pool keeps no connections", func(pool *connPool, _ net.Conn) { pool.close() }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := newConnPool()
+			conn, agentConn := newTestConn(t)
+			pool.put(conn)
+			test.prepare(pool, agentConn)
+
+			if reused := pool.get(); (reused == conn) != test.reused {
+				t.Errorf("expected reuse %v, got %v", test.reused, reused)
+			}
+
+			if conn := pool.get(); conn != nil {
+				t.Errorf("expected the pool to be empty, got %v", conn)
+			}
+		})
+	}
+}
+
+func TestConnPoolLimitsIdleConnections(t *testing.T) {
+	pool := newConnPool()
+	var conns []net.Conn
+
+	for range defaultMaxIdleConns + 1 {
+		conn, _ := newTestConn(t)
+		conns = append(conns, conn)
+		pool.put(conn)
+	}
+
+	if len(pool.idle) != defaultMaxIdleConns {
+		t.Fatalf("expected %d idle connections, got %d", defaultMaxIdleConns, len(pool.idle))
+	}
+
+	// the connection over the limit is closed
+	if _, err := conns[defaultMaxIdleConns].Write([]byte{0}); err == nil {
+		t.Error("expected the connection over the limit to be closed")
+	}
+
+	// the most recently used connection is reused first
+	if conn := pool.get(); conn != conns[defaultMaxIdleConns-1] {
+		t.Errorf("expected the last returned connection, got %v", conn)
+	}
+}
+
+func TestConnPoolEvictIdle(t *testing.T) {
+	pool := newConnPool()
+	expired, _ := newTestConn(t)
+	fresh, _ := newTestConn(t)
+	pool.put(expired)
+	pool.put(fresh)
+	pool.idle[0].idleSince = time.Now().Add(-2 * defaultIdleConnTimeout)
+	pool.evictIdle()
+
+	if len(pool.idle) != 1 || pool.idle[0].conn != fresh {
+		t.Fatalf("expected only the fresh connection to be kept, got %d", len(pool.idle))
+	}
+
+	if _, err := expired.Write([]byte{0}); err == nil {
+		t.Error("expected the expired connection to be closed")
+	}
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// maxLoggedPayloadSize limits the size of a logged payload, larger payloads are cut
+const maxLoggedPayloadSize = 64 << 10 // bytes
+
+const redacted = "[REDACTED]"
+
+var (
+	// unterminated keys and values are matched too, since a logged payload may be cut
+	privateKeyPattern  = regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----(?:.*?-----END [A-Z0-9 ]*PRIVATE KEY-----|.*)`)
+	secretFieldPattern = regexp.MustCompile(`(?i)("[a-z_]*(?:token|password|secret|privatekey)"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|$)`)
+)
+
+// redactPayload hides PEM private keys and values of secret fields in the payload
+func redactPayload(payload []byte) string {
+	payload = privateKeyPattern.ReplaceAll(payload, []byte(redacted))
+	payload = secretFieldPattern.ReplaceAll(payload, []byte(`$1"`+redacted+`"`))
+
+	return string(payload)
+}
+
+// payloadRecorder keeps the beginning of a streamed payload for logging
+type payloadRecorder struct {
+	buffer    bytes.Buffer
+	truncated bool
+}
+
+func (r *payloadRecorder) Write(p []byte) (int, error) {
+	if room := maxLoggedPayloadSize - r.buffer.Len(); room < len(p) {
+		r.buffer.Write(p[:max(room, 0)])
+		r.truncated = true
+	} else {
+		r.buffer.Write(p)
+	}
+
+	return len(p), nil
+}
+
+func (r *payloadRecorder) tee(reader io.Reader) io.Reader {
+	r.buffer.Reset()
+	r.truncated = false
+
+	return io.TeeReader(reader, r)
+}
+
+func (r *payloadRecorder) String() string {
+	payload := redactPayload(r.buffer.Bytes())
+
+	if r.truncated {
+		payload += "... (truncated)"
+	}
+
+	return payload
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	maxRequestAttempts = 3
+	baseRetryBackoff   = 200 * time.Millisecond
+	maxRetryBackoff    = 2 * time.Second
+)
+
+// retryableCommands lists read-only commands that are safe to repeat.
+// Mutating commands such as certificates.issue are never retried because the agent may have applied them already.
+var retryableCommands = map[string]bool{
+	serverDataCommand:                  true,
+	getVhostsCommand:                   true,
+	"certificates.storagecertificates": true,
+}
+
+func isRetryable(command string, err error) bool {
+	if !retryableCommands[command] {
+		return false
+	}
+
+	var connErr ConnectionError
+
+	return errors.As(err, &connErr) && !errors.Is(err, ErrCircuitOpen)
+}
+
+// retryBackoff returns exponential backoff with full jitter for the given attempt starting from 0
+func retryBackoff(attempt int) time.Duration {
+	backoff := min(baseRetryBackoff<<attempt, maxRetryBackoff)
+
+	return time.Duration(rand.Int64N(int64(backoff)) + 1)
+}
+
+func waitRetry(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(retryBackoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	signingKeyInfo = "r2dtools agent request signing"
+	nonceLength    = 16 // bytes
+	// SignatureFreshnessWindow is the maximum clock difference between the panel and the agent for a signed request
+	SignatureFreshnessWindow = 5 * time.Minute
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid request signature")
+	ErrStaleRequest     = errors.New("request timestamp is outside of the freshness window")
+)
+
+// SignedRequest is a request envelope authenticated with an HMAC instead of the server token.
+// The token itself never leaves the panel, so a captured request can not be used to forge other ones.
+type SignedRequest struct {
+	Command   string
+	Data      json.RawMessage
+	Timestamp int64
+	Nonce     string
+	Signature string
+}
+
+// DeriveSigningKey derives the request signing key from the server token
+func DeriveSigningKey(token string) ([]byte, error) {
+	return hkdf.Key(sha256.New, []byte(token), nil, signingKeyInfo, sha256.Size)
+}
+
+// Sign computes the envelope signature over the command, payload, timestamp and nonce
+func (r SignedRequest) Sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(r.Command))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(r.Timestamp, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(r.Nonce))
+	mac.Write([]byte{0})
+	mac.Write(r.Data)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the envelope signature and that the request was created within the freshness window.
+// The agent must additionally reject nonces it has already seen within the window.
+func (r SignedRequest) Verify(key []byte, now time.Time) error {
+	signature, err := hex.DecodeString(r.Signature)
+
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected, _ := hex.DecodeString(r.Sign(key))
+
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(r.Timestamp, 0))
+
+	if age > SignatureFreshnessWindow || age < -SignatureFreshnessWindow {
+		return ErrStaleRequest
+	}
+
+	return nil
+}
+
+func newSignedRequest(key []byte, command string, data json.RawMessage) (*SignedRequest, error) {
+	nonce := make([]byte, nonceLength)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	request := &SignedRequest{
+		Command:   command,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	request.Signature = request.Sign(key)
+
+	return request, nil
+}
+
+// NonceCache remembers nonces of verified signed requests within the freshness window, so replayed requests are rejected
+type NonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Add records the nonce and reports whether it has not been seen yet
+func (c *NonceCache) Add(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for seenNonce, expiresAt := range c.seen {
+		if now.After(expiresAt) {
+			delete(c.seen, seenNonce)
+		}
+	}
+
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+
+	// a request timestamp may be ahead of the clock by the freshness window, so the nonce is kept for both windows
+	c.seen[nonce] = now.Add(2 * SignatureFreshnessWindow)
+
+	return true
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{seen: map[string]time.Time{}}
+}
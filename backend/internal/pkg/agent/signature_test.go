@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignedRequestVerify(t *testing.T) {
+	key, err := DeriveSigningKey("token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anotherKey, err := DeriveSigningKey("another-token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := newSignedRequest(key, serverDataCommand, json.RawMessage(`{"vhostName":"example.com"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(request.Timestamp, 0)
+	modify := func(modify func(request *SignedRequest)) SignedRequest {
+		modified := *request
+		modify(&modified)
+
+		return modified
+	}
+
+	tests := []struct {
+		name    string
+		request SignedRequest
+		key     []byte
+		now     time.Time
+		err     error
+	}{
+		{"valid", *request, key, now, nil},
+		{"clock skew within the window", *request, key, now.Add(-SignatureFreshnessWindow), nil},
+		{"another key", *request, anotherKey, now, ErrInvalidSignature},
+		{"another command", modify(func(r *SignedRequest) { r.Command = "certificates.issue" }), key, now, ErrInvalidSignature},
+		{"another payload", modify(func(r *SignedRequest) { r.Data = json.RawMessage(`{"vhostName":"another.com"}`) }), key, now, ErrInvalidSignature},
+		{"another nonce", modify(func(r *SignedRequest) { r.Nonce = "00" }), key, now, ErrInvalidSignature},
+		{"another timestamp", modify(func(r *SignedRequest) { r.Timestamp++ }), key, now, ErrInvalidSignature},
+		{"malformed signature", modify(func(r *SignedRequest) { r.Signature = "not hex" }), key, now, ErrInvalidSignature},
+		{"stale", *request, key, now.Add(SignatureFreshnessWindow + time.Second), ErrStaleRequest},
+		{"from the future", *request, key, now.Add(-SignatureFreshnessWindow - time.Second), ErrStaleRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.request.Verify(test.key, test.now); !errors.Is(err, test.err) {
+				t.Errorf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestDeriveSigningKey(t *testing.T) {
+	key, _ := DeriveSigningKey("token")
+	sameKey, _ := DeriveSigningKey("token")
+	anotherKey, _ := DeriveSigningKey("another-token")
+
+	if !bytes.Equal(key, sameKey) || bytes.Equal(key, anotherKey) {
+		t.Errorf("expected the key to depend on the token only, got %x, %x, %x", key, sameKey, anotherKey)
+	}
+}
+
+func TestSignedRequestsHaveFreshNonces(t *testing.T) {
+	key, _ := DeriveSigningKey("token")
+	nonces := map[string]bool{}
+
+	for range 100 {
+		request, err := newSignedRequest(key, serverDataCommand, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(request.Nonce) != 2*nonceLength || nonces[request.Nonce] {
+			t.Fatalf("expected a fresh nonce of %d bytes, got %s", nonceLength, request.Nonce)
+		}
+
+		nonces[request.Nonce] = true
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		nonce string
+		now   time.Time
+		added bool
+	}{
+		{"new nonce", "a", now, true},
+		{"replayed nonce", "a", now.Add(SignatureFreshnessWindow), false},
+		{"another nonce", "b", now, true},
+		{"replayed nonce before expiration", "a", now.Add(2 * SignatureFreshnessWindow), false},
+		{"nonce after expiration", "a", now.Add(2*SignatureFreshnessWindow + time.Second), true},
+	}
+
+	cache := NewNonceCache()
+
+	for _, test := range tests {
+		if added := cache.Add(test.nonce, test.now); added != test.added {
+			t.Errorf("%s: expected %v, got %v", test.name, test.added, added)
+		}
+	}
+}
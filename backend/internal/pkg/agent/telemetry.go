@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "backend/internal/pkg/agent"
+
+// error classes of failed agent requests
+const (
+	ErrorClassConnection = "connection"
+	ErrorClassTimeout    = "timeout"
+	ErrorClassDecode     = "decode"
+	ErrorClassAgent      = "agent"
+	ErrorClassOther      = "other"
+)
+
+// telemetry records agent requests with the global OpenTelemetry providers.
+// It is a no-op unless an exporter endpoint is configured, see telemetry.Setup.
+type telemetry struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+var (
+	agentTelemetry     *telemetry
+	agentTelemetryOnce sync.Once
+)
+
+func getTelemetry() *telemetry {
+	agentTelemetryOnce.Do(func() {
+		meter := otel.Meter(instrumentationName)
+		agentTelemetry = &telemetry{tracer: otel.Tracer(instrumentationName)}
+
+		// instrument creation fails only for invalid names, in that case no-op instruments are returned
+		agentTelemetry.duration, _ = meter.Float64Histogram(
+			"agent.request.duration",
+			metric.WithUnit("s"),
+			metric.WithDescription("Duration of agent commands"),
+		)
+		agentTelemetry.errors, _ = meter.Int64Counter(
+			"agent.request.errors",
+			metric.WithDescription("Failed agent commands by error class"),
+		)
+	})
+
+	return agentTelemetry
+}
+
+// startRequest starts the span of the agent command. The returned function ends the span and records metrics.
+func (t *telemetry) startRequest(ctx context.Context, serverID uint, command string) (context.Context, func(err error)) {
+	attributes := []attribute.KeyValue{
+		attribute.Int64("agent.server_id", int64(serverID)),
+		attribute.String("agent.command", command),
+	}
+	ctx, span := t.tracer.Start(
+		ctx,
+		"agent "+command,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+	start := time.Now()
+
+	return ctx, func(err error) {
+		if err != nil {
+			class := classifyError(err)
+			attributes = append(attributes, attribute.String("agent.error_class", class))
+			t.errors.Add(ctx, 1, metric.WithAttributes(attributes...))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, class)
+		}
+
+		t.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attributes...))
+		span.End()
+	}
+}
+
+func classifyError(err error) string {
+	var (
+		connErr      ConnectionError
+		timeoutErr   TimeoutError
+		decodeErr    DecodeError
+		tooLargeErr  ErrResponseTooLarge
+		truncatedErr ErrTruncatedResponse
+		agentErr     ErrAgentResponse
+	)
+
+	switch {
+	case errors.As(err, &timeoutErr):
+		return ErrorClassTimeout
+	case errors.As(err, &connErr):
+		return ErrorClassConnection
+	case errors.As(err, &decodeErr), errors.As(err, &tooLargeErr), errors.As(err, &truncatedErr):
+		return ErrorClassDecode
+	case errors.As(err, &agentErr):
+		return ErrorClassAgent
+	default:
+		return ErrorClassOther
+	}
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCommandTimeout = 30 * time.Second
+	issueCommandTimeout   = 5 * time.Minute
+)
+
+// commandTimeouts limits how long the panel waits for a response to a command.
+// Commands that are not listed are limited by defaultCommandTimeout.
+var commandTimeouts = map[string]time.Duration{
+	serverDataCommand:                    10 * time.Second,
+	commonDirStatusCommand:               10 * time.Second,
+	changeCertbotStatusCommand:           issueCommandTimeout,
+	upgradeCommand:                       2 * time.Minute,
+	"certificates.issue":                 issueCommandTimeout,
+	"certificates.commondirstatus":       10 * time.Second,
+	"certificates.changecommondirstatus": time.Minute,
+	"certificates.domainassign":          time.Minute,
+	"certificates.upload":                time.Minute,
+}
+
+type TimeoutError struct {
+	Command string
+	Timeout time.Duration
+	err     error
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("server agent did not respond to command %s within %v: %v", e.Command, e.Timeout, e.err)
+}
+
+func (e TimeoutError) Unwrap() error {
+	return e.err
+}
+
+func getCommandTimeout(command string) time.Duration {
+	if timeout, ok := commandTimeouts[command]; ok {
+		return timeout
+	}
+
+	return defaultCommandTimeout
+}
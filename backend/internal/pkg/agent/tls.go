@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TLSConfig describes a TLS transport to the server agent.
+// Agents use self-signed certificates, so trust is established by pinning the SHA-256 fingerprint of the agent certificate.
+type TLSConfig struct {
+	// Fingerprint is the pinned agent certificate fingerprint. If it is empty the first presented certificate is trusted.
+	Fingerprint string
+	// ClientCertificate is presented to the agent when mutual TLS is required.
+	ClientCertificate *tls.Certificate
+	// OnFirstUse is called with the agent certificate fingerprint when no fingerprint is pinned yet.
+	OnFirstUse func(fingerprint string) error
+
+	mu sync.Mutex
+}
+
+type ErrFingerprintMismatch struct {
+	Expected string
+	Actual   string
+}
+
+func (e ErrFingerprintMismatch) Error() string {
+	return fmt.Sprintf("agent certificate fingerprint mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// CertificateFingerprint returns hex encoded SHA-256 hash of the DER encoded certificate
+func CertificateFingerprint(der []byte) string {
+	hash := sha256.Sum256(der)
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *TLSConfig) verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server agent did not present a certificate")
+	}
+
+	fingerprint := CertificateFingerprint(state.PeerCertificates[0].Raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Fingerprint == "" {
+		if c.OnFirstUse != nil {
+			if err := c.OnFirstUse(fingerprint); err != nil {
+				return fmt.Errorf("could not pin agent certificate: %w", err)
+			}
+		}
+
+		// connections pooled for the same agent must present the same certificate
+		c.Fingerprint = fingerprint
+
+		return nil
+	}
+
+	expected := NormalizeFingerprint(c.Fingerprint)
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(fingerprint)) != 1 {
+		return ErrFingerprintMismatch{
+			Expected: expected,
+			Actual:   fingerprint,
+		}
+	}
+
+	return nil
+}
+
+func (c *TLSConfig) clientConfig() *tls.Config {
+	config := &tls.Config{
+		// the agent certificate is verified against the pinned fingerprint in VerifyConnection
+		InsecureSkipVerify: true, // nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+		VerifyConnection:   c.verifyConnection,
+	}
+
+	if c.ClientCertificate != nil {
+		config.Certificates = []tls.Certificate{*c.ClientCertificate}
+	}
+
+	return config
+}
+
+// ProbeFingerprint completes the TLS handshake with the agent and returns the fingerprint of the presented certificate.
+// No request is sent, so the server token is not disclosed to the agent that is not verified yet.
+func ProbeFingerprint(ctx context.Context, ipv4, ipv6 string, port int, clientCertificate *tls.Certificate) (string, error) {
+	if ipv4 == "" && ipv6 == "" {
+		return "", errors.New("ipv4 or ipv6 address must be specified")
+	}
+
+	var fingerprint string
+	tlsConfig := &TLSConfig{
+		ClientCertificate: clientCertificate,
+		OnFirstUse: func(presented string) error {
+			fingerprint = presented
+
+			return nil
+		},
+	}
+	probeClient := &client{
+		addresses: newAddressBook(ipv4, ipv6),
+		port:      port,
+		timeout:   defaultTimeout,
+		tlsConfig: tlsConfig.clientConfig(),
+	}
+	conn, err := probeClient.dial(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	conn.Close() // nolint:errcheck
+
+	return fingerprint, nil
+}
+
+// NormalizeFingerprint converts the fingerprint to the lower case hex form without separators
+func NormalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+}
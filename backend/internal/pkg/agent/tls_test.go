@@ -0,0 +1,209 @@
+package agent_test
+
+import (
+	"backend/internal/pkg/agent"
+	"backend/internal/pkg/agent/fakeagent"
+	"backend/internal/pkg/logger"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testToken = "test-token"
+
+func startTLSAgent(t *testing.T, clientCAs *x509.CertPool) *fakeagent.Agent {
+	t.Helper()
+
+	certificate, err := fakeagent.GenerateCertificate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fAgent, err := fakeagent.StartTLS(testToken, certificate, clientCAs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(fAgent.Close)
+
+	return fAgent
+}
+
+// colonFingerprint formats the fingerprint the way it is shown by openssl, e.g. AB:CD:...
+func colonFingerprint(fingerprint string) string {
+	var parts []string
+
+	for i := 0; i < len(fingerprint); i += 2 {
+		parts = append(parts, strings.ToUpper(fingerprint[i:i+2]))
+	}
+
+	return strings.Join(parts, ":")
+}
+
+func TestTLSFingerprintPinning(t *testing.T) {
+	fAgent := startTLSAgent(t, nil)
+	other := startTLSAgent(t, nil)
+	errPin := errors.New("could not save fingerprint")
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		pinErr      error
+		pinned      string
+		err         error
+	}{
+		{"trust on first use", "", nil, fAgent.Fingerprint(), nil},
+		{"pinned", fAgent.Fingerprint(), nil, "", nil},
+		{"pinned in openssl format", colonFingerprint(fAgent.Fingerprint()), nil, "", nil},
+		{"mismatch", other.Fingerprint(), nil, "", agent.ErrFingerprintMismatch{Expected: other.Fingerprint(), Actual: fAgent.Fingerprint()}},
+		{"pin failure", "", errPin, fAgent.Fingerprint(), errPin},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pinned string
+			ip, port := fAgent.Address()
+			tlsConfig := &agent.TLSConfig{
+				Fingerprint: test.fingerprint,
+				OnFirstUse: func(fingerprint string) error {
+					pinned = fingerprint
+
+					return test.pinErr
+				},
+			}
+			nAgent, err := agent.NewAgent(ip, "", testToken, port, agent.Options{TLS: tlsConfig}, logger.NewNopLogger())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer nAgent.Close()
+
+			_, err = nAgent.GetServerData(context.Background())
+
+			if test.err == nil && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			var mismatchErr agent.ErrFingerprintMismatch
+
+			if errors.As(test.err, &mismatchErr) {
+				if !errors.As(err, &mismatchErr) || mismatchErr != test.err {
+					t.Errorf("expected %v, got %v", test.err, err)
+				}
+			} else if !errors.Is(err, test.err) {
+				t.Errorf("expected %v, got %v", test.err, err)
+			}
+
+			if pinned != test.pinned {
+				t.Errorf("expected pinned fingerprint %q, got %q", test.pinned, pinned)
+			}
+		})
+	}
+}
+
+func TestTLSFirstUsePinsConnectionsOfAgent(t *testing.T) {
+	fAgent := startTLSAgent(t, nil)
+	ip, port := fAgent.Address()
+	tlsConfig := &agent.TLSConfig{}
+	nAgent, err := agent.NewAgent(ip, "", testToken, port, agent.Options{TLS: tlsConfig}, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer nAgent.Close()
+
+	if _, err = nAgent.GetServerData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if tlsConfig.Fingerprint != fAgent.Fingerprint() {
+		t.Errorf("expected the presented certificate to be pinned, got %q", tlsConfig.Fingerprint)
+	}
+
+	// another agent listening on the address must present the pinned certificate
+	other := startTLSAgent(t, nil)
+	otherIP, otherPort := other.Address()
+	otherAgent, err := agent.NewAgent(otherIP, "", testToken, otherPort, agent.Options{TLS: tlsConfig}, logger.NewNopLogger())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer otherAgent.Close()
+
+	var mismatchErr agent.ErrFingerprintMismatch
+
+	if _, err = otherAgent.GetServerData(context.Background()); !errors.As(err, &mismatchErr) {
+		t.Errorf("expected fingerprint mismatch, got %v", err)
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	clientCertificate, err := fakeagent.GenerateCertificate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(clientCertificate.Certificate[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+	fAgent := startTLSAgent(t, clientCAs)
+	ip, port := fAgent.Address()
+
+	tests := []struct {
+		name        string
+		certificate *tls.Certificate
+		ok          bool
+	}{
+		{"with client certificate", &clientCertificate, true},
+		{"without client certificate", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig := &agent.TLSConfig{Fingerprint: fAgent.Fingerprint(), ClientCertificate: test.certificate}
+			nAgent, err := agent.NewAgent(ip, "", testToken, port, agent.Options{TLS: tlsConfig}, logger.NewNopLogger())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer nAgent.Close()
+
+			if _, err = nAgent.GetServerData(context.Background()); (err == nil) != test.ok {
+				t.Errorf("expected success %v, got %v", test.ok, err)
+			}
+		})
+	}
+}
+
+func TestProbeFingerprint(t *testing.T) {
+	fAgent := startTLSAgent(t, nil)
+	ip, port := fAgent.Address()
+	fingerprint, err := agent.ProbeFingerprint(context.Background(), ip, "", port, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fingerprint != fAgent.Fingerprint() {
+		t.Errorf("expected fingerprint %s, got %s", fAgent.Fingerprint(), fingerprint)
+	}
+
+	if requests := fAgent.Requests(); len(requests) != 0 {
+		t.Errorf("expected no request to be sent while probing, got %d", len(requests))
+	}
+}
@@ -0,0 +1,36 @@
+package agent
+
+import "context"
+
+// Token rotation is a two-phase operation: a staged token is accepted by the agent along with the current one
+// until it is committed with a request authenticated by the staged token, or aborted.
+const (
+	stageTokenCommand  = "token.stage"
+	commitTokenCommand = "token.commit"
+	abortTokenCommand  = "token.abort"
+)
+
+type stageTokenRequestData struct {
+	Token string
+}
+
+// StageToken makes the agent accept the token in addition to the current one
+func (a *Agent) StageToken(ctx context.Context, token string) error {
+	_, err := a.Request(ctx, stageTokenCommand, stageTokenRequestData{Token: token})
+
+	return err
+}
+
+// CommitToken makes the staged token the only accepted one. It must be sent by the agent created with the staged token.
+func (a *Agent) CommitToken(ctx context.Context) error {
+	_, err := a.Request(ctx, commitTokenCommand, nil)
+
+	return err
+}
+
+// AbortToken discards the staged token
+func (a *Agent) AbortToken(ctx context.Context) error {
+	_, err := a.Request(ctx, abortTokenCommand, nil)
+
+	return err
+}
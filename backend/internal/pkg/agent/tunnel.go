@@ -0,0 +1,426 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// TunnelServerHeader identifies the server of the agent that opens a tunnel
+	TunnelServerHeader = "X-Server-Guid"
+	// TunnelTimestampHeader, TunnelNonceHeader and TunnelSignatureHeader carry the TunnelSignature of the agent
+	TunnelTimestampHeader = "X-Tunnel-Timestamp"
+	TunnelNonceHeader     = "X-Tunnel-Nonce"
+	TunnelSignatureHeader = "X-Tunnel-Signature"
+	tunnelOpenCommand     = "tunnel.open"
+	streamIDLength        = 4 // bytes
+	// heartbeatStreamID is reserved for heartbeats, the agent echoes a heartbeat message back as is
+	heartbeatStreamID  = 0
+	tunnelPingInterval = 30 * time.Second
+	// tunnelPongTimeout is how long the tunnel stays open without any message from the agent
+	tunnelPongTimeout = 2*tunnelPingInterval + defaultTimeout
+)
+
+// ErrTunnelNotConnected reports that the agent of a server in tunnel mode has no open tunnel to the panel
+var ErrTunnelNotConnected = errors.New("server agent is not connected to the panel")
+
+var errTunnelClosed = errors.New("agent tunnel closed")
+
+// TunnelSignature authenticates the agent that opens a tunnel. It is the signed request envelope
+// of the tunnel.open command over the server GUID, so the server token itself is not sent to the panel.
+type TunnelSignature struct {
+	Timestamp int64
+	Nonce     string
+	Signature string
+}
+
+// SignTunnel creates the signature of the agent that opens the tunnel for the server
+func SignTunnel(serverGuid, token string) (*TunnelSignature, error) {
+	key, err := DeriveSigningKey(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := newSignedRequest(key, tunnelOpenCommand, getTunnelPayload(serverGuid))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TunnelSignature{
+		Timestamp: request.Timestamp,
+		Nonce:     request.Nonce,
+		Signature: request.Signature,
+	}, nil
+}
+
+// ReadTunnelSignature reads the signature from the headers of the tunnel request
+func ReadTunnelSignature(header http.Header) TunnelSignature {
+	// an invalid timestamp is left zero, so the signature fails the freshness check
+	timestamp, _ := strconv.ParseInt(header.Get(TunnelTimestampHeader), 10, 64)
+
+	return TunnelSignature{
+		Timestamp: timestamp,
+		Nonce:     header.Get(TunnelNonceHeader),
+		Signature: header.Get(TunnelSignatureHeader),
+	}
+}
+
+func (s TunnelSignature) SetHeaders(header http.Header) {
+	header.Set(TunnelTimestampHeader, strconv.FormatInt(s.Timestamp, 10))
+	header.Set(TunnelNonceHeader, s.Nonce)
+	header.Set(TunnelSignatureHeader, s.Signature)
+}
+
+// Verify checks the signature with the server token. The caller must additionally reject nonces it has already seen.
+func (s TunnelSignature) Verify(serverGuid, token string, now time.Time) error {
+	if s.Nonce == "" {
+		return ErrInvalidSignature
+	}
+
+	key, err := DeriveSigningKey(token)
+
+	if err != nil {
+		return err
+	}
+
+	request := SignedRequest{
+		Command:   tunnelOpenCommand,
+		Data:      getTunnelPayload(serverGuid),
+		Timestamp: s.Timestamp,
+		Nonce:     s.Nonce,
+		Signature: s.Signature,
+	}
+
+	return request.Verify(key, now)
+}
+
+func getTunnelPayload(serverGuid string) json.RawMessage {
+	payload, _ := json.Marshal(serverGuid)
+
+	return payload
+}
+
+// Tunnel is a persistent WebSocket connection opened by the agent to the panel. Requests are multiplexed over it:
+// every binary message starts with a 4-byte big-endian stream ID followed by the request or response JSON.
+// The agent responds with the stream ID of the request, responses may come in any order.
+// Messages of stream 0 are heartbeats the agent echoes back without handling.
+type Tunnel struct {
+	conn            *websocket.Conn
+	maxResponseSize int64
+	nextStreamID    atomic.Uint32
+	remoteIP        string
+	// lastReceivedAt is the Unix time in nanoseconds of the last message received from the agent
+	lastReceivedAt atomic.Int64
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[uint32]chan tunnelResponse
+	done    chan struct{}
+	closed  bool
+}
+
+type tunnelResponse struct {
+	data []byte
+	err  error
+}
+
+// Serve reads responses and keeps the tunnel alive until it is closed
+func (t *Tunnel) Serve() {
+	t.lastReceivedAt.Store(time.Now().UnixNano())
+	go t.keepAlive()
+
+	for {
+		var message []byte
+
+		if err := websocket.Message.Receive(t.conn, &message); err != nil {
+			if errors.Is(err, websocket.ErrFrameTooLarge) && t.failOversizedResponse() == nil {
+				continue
+			}
+
+			t.Close()
+
+			return
+		}
+
+		t.lastReceivedAt.Store(time.Now().UnixNano())
+
+		if len(message) < streamIDLength {
+			continue
+		}
+
+		t.respond(binary.BigEndian.Uint32(message), tunnelResponse{data: message[streamIDLength:]})
+	}
+}
+
+// failOversizedResponse fails the request of the oversized response at once.
+// The oversized frame is left unread by the websocket package, so its stream ID is read from the frame
+// and the rest of it is discarded by the next receive.
+func (t *Tunnel) failOversizedResponse() error {
+	header := make([]byte, streamIDLength)
+
+	if _, err := io.ReadFull(t.conn, header); err != nil {
+		return err
+	}
+
+	t.lastReceivedAt.Store(time.Now().UnixNano())
+	t.respond(binary.BigEndian.Uint32(header), tunnelResponse{err: ErrResponseTooLarge{Limit: t.maxResponseSize}})
+
+	return nil
+}
+
+func (t *Tunnel) respond(streamID uint32, response tunnelResponse) {
+	t.mu.Lock()
+	pending, ok := t.pending[streamID]
+	delete(t.pending, streamID)
+	t.mu.Unlock()
+
+	if ok {
+		pending <- response
+	}
+}
+
+// Request sends the request data through the tunnel and passes the response to decode
+func (t *Tunnel) Request(ctx context.Context, data []byte, decode func(io.Reader) error) error {
+	streamID := t.nextStreamID.Add(1)
+
+	if streamID == heartbeatStreamID {
+		streamID = t.nextStreamID.Add(1)
+	}
+
+	response := make(chan tunnelResponse, 1)
+
+	t.mu.Lock()
+
+	if t.closed {
+		t.mu.Unlock()
+
+		return ConnectionError{text: "could not send request to the server agent", err: errTunnelClosed}
+	}
+
+	t.pending[streamID] = response
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, streamID)
+		t.mu.Unlock()
+	}()
+
+	message := make([]byte, streamIDLength+len(data))
+	binary.BigEndian.PutUint32(message, streamID)
+	copy(message[streamIDLength:], data)
+
+	if err := t.send(ctx, message); err != nil {
+		t.Close()
+
+		if isTimeout(ctx, err) {
+			return TimeoutError{err: err}
+		}
+
+		return ConnectionError{text: "could not send request to the server agent", err: err}
+	}
+
+	select {
+	case response := <-response:
+		if response.err != nil {
+			return response.err
+		}
+
+		if int64(len(response.data)) > t.maxResponseSize {
+			return ErrResponseTooLarge{Size: int64(len(response.data)), Limit: t.maxResponseSize}
+		}
+
+		if err := decode(bytes.NewReader(response.data)); err != nil {
+			return DecodeError{err: err}
+		}
+
+		return nil
+	case <-t.done:
+		return ConnectionError{text: "server agent did not respond", err: errTunnelClosed}
+	case <-ctx.Done():
+		return TimeoutError{err: ctx.Err()}
+	}
+}
+
+// RemoteIP returns the address the agent opened the tunnel from
+func (t *Tunnel) RemoteIP() string {
+	return t.remoteIP
+}
+
+// Done is closed when the tunnel is closed
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *Tunnel) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+
+	t.closed = true
+	close(t.done)
+	t.conn.Close() // nolint:errcheck
+}
+
+func (t *Tunnel) send(ctx context.Context, message []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	t.conn.SetWriteDeadline(deadline) // nolint:errcheck
+
+	return websocket.Message.Send(t.conn, message)
+}
+
+// keepAlive sends heartbeats, so intermediate proxies do not close an idle tunnel, and closes the tunnel
+// once the agent stops answering them. Pong frames are consumed inside the websocket package and can not be observed,
+// so the heartbeat is a message of the reserved stream the agent echoes back.
+func (t *Tunnel) keepAlive() {
+	ticker := time.NewTicker(tunnelPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, t.lastReceivedAt.Load())) > tunnelPongTimeout {
+				t.Close()
+
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+			err := t.send(ctx, make([]byte, streamIDLength))
+			cancel()
+
+			if err != nil {
+				t.Close()
+
+				return
+			}
+		}
+	}
+}
+
+// NewTunnel creates the panel side of the tunnel over the accepted WebSocket connection.
+// remoteIP is the address of the agent, the address of the connection is used if it is empty.
+func NewTunnel(conn *websocket.Conn, remoteIP string, maxResponseSize int64) *Tunnel {
+	if maxResponseSize <= 0 {
+		maxResponseSize = DefaultMaxResponseSize
+	}
+
+	conn.PayloadType = websocket.BinaryFrame
+	conn.MaxPayloadBytes = int(maxResponseSize) + streamIDLength
+	tunnel := &Tunnel{
+		conn:            conn,
+		maxResponseSize: maxResponseSize,
+		pending:         map[uint32]chan tunnelResponse{},
+		done:            make(chan struct{}),
+		remoteIP:        remoteIP,
+	}
+
+	if request := conn.Request(); request != nil && remoteIP == "" {
+		if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+			tunnel.remoteIP = host
+		}
+	}
+
+	return tunnel
+}
+
+// TunnelRegistry keeps open agent tunnels keyed by server ID. A server has at most one tunnel, a new one replaces the old.
+type TunnelRegistry struct {
+	mu      sync.Mutex
+	tunnels map[uint]*Tunnel
+}
+
+func (r *TunnelRegistry) Register(serverID uint, tunnel *Tunnel) {
+	r.mu.Lock()
+	replaced := r.tunnels[serverID]
+	r.tunnels[serverID] = tunnel
+	r.mu.Unlock()
+
+	if replaced != nil {
+		replaced.Close()
+	}
+}
+
+// Remove removes the tunnel of the server unless it has been replaced already
+func (r *TunnelRegistry) Remove(serverID uint, tunnel *Tunnel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tunnels[serverID] == tunnel {
+		delete(r.tunnels, serverID)
+	}
+}
+
+func (r *TunnelRegistry) Get(serverID uint) *Tunnel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.tunnels[serverID]
+}
+
+func NewTunnelRegistry() *TunnelRegistry {
+	return &TunnelRegistry{
+		tunnels: map[uint]*Tunnel{},
+	}
+}
+
+// tunnelTransport sends requests through the tunnel the server agent has currently open
+type tunnelTransport struct {
+	serverID uint
+	tunnels  *TunnelRegistry
+}
+
+func (t *tunnelTransport) Request(ctx context.Context, data []byte, decode func(io.Reader) error) error {
+	tunnel := t.tunnels.Get(t.serverID)
+
+	if tunnel == nil {
+		return ConnectionError{
+			text: fmt.Sprintf("server with ID %d has no agent tunnel", t.serverID),
+			err:  ErrTunnelNotConnected,
+		}
+	}
+
+	return tunnel.Request(ctx, data, decode)
+}
+
+func (t *tunnelTransport) connectedAddress() (string, string) {
+	tunnel := t.tunnels.Get(t.serverID)
+
+	if tunnel == nil || tunnel.RemoteIP() == "" {
+		return "", ""
+	}
+
+	if ip := net.ParseIP(tunnel.RemoteIP()); ip != nil && ip.To4() == nil {
+		return tunnel.RemoteIP(), FamilyIPv6
+	}
+
+	return tunnel.RemoteIP(), FamilyIPv4
+}
+
+// the tunnel is owned by the registry, so there are no connections of the transport to evict or close
+func (t *tunnelTransport) evictIdle() {}
+
+func (t *tunnelTransport) close() {}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// startTestTunnel serves a tunnel of the given response size limit and connects an agent to it.
+// The agent answers every request with the response returned by respond.
+func startTestTunnel(t *testing.T, maxResponseSize int64, respond func(request []byte) []byte) *Tunnel {
+	t.Helper()
+
+	tunnels := make(chan *Tunnel, 1)
+	endpoint := httptest.NewServer(websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			tunnel := NewTunnel(conn, "", maxResponseSize)
+			tunnels <- tunnel
+			tunnel.Serve()
+		},
+	})
+	t.Cleanup(endpoint.Close)
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(endpoint.URL, "http"), "", "http://localhost/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() }) // nolint:errcheck
+
+	conn.PayloadType = websocket.BinaryFrame
+
+	go func() {
+		for {
+			var message []byte
+
+			if err := websocket.Message.Receive(conn, &message); err != nil {
+				return
+			}
+
+			response := append(message[:streamIDLength:streamIDLength], respond(message[streamIDLength:])...)
+			websocket.Message.Send(conn, response) // nolint:errcheck
+		}
+	}()
+
+	tunnel := <-tunnels
+	t.Cleanup(tunnel.Close)
+
+	return tunnel
+}
+
+func TestTunnelFailsOversizedResponseAtOnce(t *testing.T) {
+	tunnel := startTestTunnel(t, 16, func(request []byte) []byte {
+		if string(request) == "large" {
+			return make([]byte, 64)
+		}
+
+		return []byte("small")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	started := time.Now()
+	err := tunnel.Request(ctx, []byte("large"), func(io.Reader) error { return nil })
+
+	var tooLargeErr ErrResponseTooLarge
+
+	if !errors.As(err, &tooLargeErr) || tooLargeErr.Limit != 16 {
+		t.Fatalf("expected response too large error, got %v", err)
+	}
+
+	if time.Since(started) > time.Second {
+		t.Fatalf("oversized response failed the request after %s", time.Since(started))
+	}
+
+	var response []byte
+	err = tunnel.Request(ctx, []byte("small"), func(reader io.Reader) error {
+		response, err = io.ReadAll(reader)
+
+		return err
+	})
+
+	if err != nil || string(response) != "small" {
+		t.Fatalf("expected the tunnel to keep serving after the oversized response, got %q, %v", response, err)
+	}
+}
+
+func TestTunnelSkipsHeartbeatStream(t *testing.T) {
+	tunnel := startTestTunnel(t, DefaultMaxResponseSize, func(request []byte) []byte { return request })
+	// the next stream ID wraps around to the heartbeat stream
+	tunnel.nextStreamID.Store(^uint32(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := tunnel.Request(ctx, []byte("request"), func(io.Reader) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if streamID := tunnel.nextStreamID.Load(); streamID != 1 {
+		t.Fatalf("expected the request to skip the heartbeat stream and use stream 1, got %d", streamID)
+	}
+}
+
+func TestTunnelSignature(t *testing.T) {
+	signature, err := SignTunnel("server-guid", "token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	signature.SetHeaders(header)
+	read := ReadTunnelSignature(header)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		serverGuid string
+		token      string
+		signature  TunnelSignature
+		now        time.Time
+		err        error
+	}{
+		{"valid", "server-guid", "token", read, now, nil},
+		{"another server", "another-guid", "token", read, now, ErrInvalidSignature},
+		{"another token", "server-guid", "another-token", read, now, ErrInvalidSignature},
+		{"missing nonce", "server-guid", "token", TunnelSignature{Timestamp: read.Timestamp, Signature: read.Signature}, now, ErrInvalidSignature},
+		{"stale", "server-guid", "token", read, now.Add(2 * SignatureFreshnessWindow), ErrStaleRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.signature.Verify(test.serverGuid, test.token, test.now); !errors.Is(err, test.err) {
+				t.Errorf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
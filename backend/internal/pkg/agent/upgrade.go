@@ -0,0 +1,17 @@
+package agent
+
+import "context"
+
+const upgradeCommand = "agent.upgrade"
+
+type upgradeRequestData struct {
+	Version string
+}
+
+// Upgrade makes the agent install the version and restart. The agent responds before it restarts,
+// so the installed version must be verified once the agent is back online.
+func (a *Agent) Upgrade(ctx context.Context, version string) error {
+	_, err := a.Request(ctx, upgradeCommand, upgradeRequestData{Version: version})
+
+	return err
+}
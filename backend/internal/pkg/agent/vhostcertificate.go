@@ -0,0 +1,27 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/r2dtools/agentintegration"
+)
+
+const downloadVhostCertificateCommand = "certificates.vhostcertdownload"
+
+// VhostCertificateDownloadRequestData identifies the virtual host the certificate of which is downloaded
+type VhostCertificateDownloadRequestData struct {
+	ServerName string
+	WebServer  string
+}
+
+// DownloadVhostCertificate returns the PEM encoded certificate chain served by the virtual host.
+// Agents that do not support the command return ErrUnsupportedCommand.
+func (a *Agent) DownloadVhostCertificate(ctx context.Context, data VhostCertificateDownloadRequestData) (*agentintegration.CertificateDownloadResponseData, error) {
+	var response agentintegration.CertificateDownloadResponseData
+
+	if err := a.RequestInto(ctx, downloadVhostCertificateCommand, data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
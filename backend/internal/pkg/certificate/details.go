@@ -0,0 +1,76 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoCertificate = errors.New("no certificate found in pem")
+
+// Details are properties of a certificate that identify it regardless of where it is deployed
+type Details struct {
+	// Fingerprint is the hex encoded SHA-256 digest of the DER encoded certificate
+	Fingerprint        string
+	SerialNumber       string
+	CommonName         string
+	DNSNames           []string
+	IssuerCN           string
+	IssuerOrganization []string
+	// KeyType is the algorithm and the size of the public key, e.g. RSA-2048 or ECDSA-P256
+	KeyType   string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ParseDetails returns details of the leaf certificate, which is the first certificate of the PEM chain.
+// Other blocks of the PEM, e.g. the private key, are skipped.
+func ParseDetails(pemChain []byte) (*Details, error) {
+	for block, rest := pem.Decode(pemChain); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %v", err)
+		}
+
+		fingerprint := sha256.Sum256(cert.Raw)
+
+		return &Details{
+			Fingerprint:        hex.EncodeToString(fingerprint[:]),
+			SerialNumber:       hex.EncodeToString(cert.SerialNumber.Bytes()),
+			CommonName:         cert.Subject.CommonName,
+			DNSNames:           cert.DNSNames,
+			IssuerCN:           cert.Issuer.CommonName,
+			IssuerOrganization: cert.Issuer.Organization,
+			KeyType:            getKeyType(cert),
+			NotBefore:          cert.NotBefore,
+			NotAfter:           cert.NotAfter,
+		}, nil
+	}
+
+	return nil, ErrNoCertificate
+}
+
+func getKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
@@ -0,0 +1,73 @@
+// Package dns manages TXT records of DNS-01 challenges through DNS provider backends.
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const TypeRFC2136 = "rfc2136"
+
+var (
+	ErrUnknownProviderType = errors.New("unknown dns provider type")
+	ErrInvalidSettings     = errors.New("invalid dns provider settings")
+)
+
+// Provider creates and removes TXT records of DNS-01 challenges. fqdn is the fully qualified record name,
+// e.g. _acme-challenge.example.com.
+type Provider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+type backend struct {
+	create func(settings map[string]string) (Provider, error)
+	// secrets are settings that must not be returned to clients, e.g. TSIG secrets
+	secrets []string
+}
+
+var backends = map[string]backend{
+	TypeRFC2136: {
+		create: func(settings map[string]string) (Provider, error) {
+			return NewRFC2136Provider(settings)
+		},
+		secrets: []string{RFC2136TsigSecret},
+	},
+}
+
+// CreateProvider creates the provider of the type configured with the settings
+func CreateProvider(providerType string, settings map[string]string) (Provider, error) {
+	b, ok := backends[providerType]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProviderType, providerType)
+	}
+
+	return b.create(settings)
+}
+
+// IsSecretSetting reports whether the setting of the provider type holds a credential
+func IsSecretSetting(providerType, name string) bool {
+	for _, secret := range backends[providerType].secrets {
+		if secret == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Types returns the supported provider types
+func Types() []string {
+	types := make([]string, 0, len(backends))
+
+	for providerType := range backends {
+		types = append(types, providerType)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
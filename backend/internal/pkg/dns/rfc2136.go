@@ -0,0 +1,328 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// RFC 2136 provider settings
+const (
+	RFC2136Nameserver    = "nameserver"
+	RFC2136Zone          = "zone"
+	RFC2136TsigKey       = "tsig_key"
+	RFC2136TsigAlgorithm = "tsig_algorithm"
+	RFC2136TsigSecret    = "tsig_secret"
+	RFC2136TTL           = "ttl"
+)
+
+const (
+	defaultRFC2136TTL     = 60 // seconds
+	defaultRFC2136Timeout = 10 * time.Second
+	dnsPort               = "53"
+	opCodeUpdate          = dnsmessage.OpCode(5)
+	classNone             = dnsmessage.Class(254)
+	maxMessageSize        = 65535
+)
+
+var (
+	ErrZoneNotFound = errors.New("dns zone not found")
+	ErrUpdateFailed = errors.New("dns update failed")
+)
+
+// RFC2136Provider manages records with dynamic updates (RFC 2136) sent over UDP to the primary nameserver of the zone.
+// Updates are signed with TSIG (RFC 8945) if the key is configured. If the zone is not configured,
+// it is discovered with a SOA query to the nameserver.
+type RFC2136Provider struct {
+	nameserver string
+	zone       string
+	tsig       *tsigKey
+	ttl        uint32
+	timeout    time.Duration
+}
+
+func (p *RFC2136Provider) Present(ctx context.Context, fqdn, value string) error {
+	return p.update(ctx, fqdn, value, dnsmessage.ClassINET, p.ttl)
+}
+
+func (p *RFC2136Provider) CleanUp(ctx context.Context, fqdn, value string) error {
+	// a record of the class NONE deletes the record with the same name, type and data (RFC 2136 2.5.4)
+	return p.update(ctx, fqdn, value, classNone, 0)
+}
+
+func (p *RFC2136Provider) update(ctx context.Context, fqdn, value string, class dnsmessage.Class, ttl uint32) error {
+	fqdn = toFqdn(fqdn)
+	zone, err := p.findZone(ctx, fqdn)
+
+	if err != nil {
+		return err
+	}
+
+	zoneName, err := dnsmessage.NewName(zone)
+
+	if err != nil {
+		return err
+	}
+
+	recordName, err := dnsmessage.NewName(fqdn)
+
+	if err != nil {
+		return err
+	}
+
+	id, err := messageID()
+
+	if err != nil {
+		return err
+	}
+
+	// in update messages the question section is the zone section and the authority section is the update section
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: opCodeUpdate})
+
+	if err = builder.StartQuestions(); err != nil {
+		return err
+	}
+
+	err = builder.Question(dnsmessage.Question{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET})
+
+	if err != nil {
+		return err
+	}
+
+	if err = builder.StartAuthorities(); err != nil {
+		return err
+	}
+
+	err = builder.TXTResource(
+		dnsmessage.ResourceHeader{Name: recordName, Class: class, TTL: ttl},
+		dnsmessage.TXTResource{TXT: []string{value}},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	message, err := builder.Finish()
+
+	if err != nil {
+		return err
+	}
+
+	if p.tsig != nil {
+		if message, err = p.tsig.sign(message, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	header, _, err := p.exchange(ctx, message)
+
+	if err != nil {
+		return err
+	}
+
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return fmt.Errorf("%w: record %s, zone %s: %s", ErrUpdateFailed, fqdn, zone, header.RCode)
+	}
+
+	return nil
+}
+
+// findZone returns the configured zone or asks the nameserver which zone the record belongs to.
+// An authoritative nameserver returns the SOA record of the zone in the answer or in the authority section.
+func (p *RFC2136Provider) findZone(ctx context.Context, fqdn string) (string, error) {
+	if p.zone != "" {
+		return p.zone, nil
+	}
+
+	name, err := dnsmessage.NewName(fqdn)
+
+	if err != nil {
+		return "", err
+	}
+
+	id, err := messageID()
+
+	if err != nil {
+		return "", err
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id})
+
+	if err = builder.StartQuestions(); err != nil {
+		return "", err
+	}
+
+	if err = builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return "", err
+	}
+
+	message, err := builder.Finish()
+
+	if err != nil {
+		return "", err
+	}
+
+	_, parser, err := p.exchange(ctx, message)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err = parser.SkipAllQuestions(); err != nil {
+		return "", err
+	}
+
+	answers, err := parser.AllAnswers()
+
+	if err != nil {
+		return "", err
+	}
+
+	authorities, err := parser.AllAuthorities()
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, resource := range append(answers, authorities...) {
+		if resource.Header.Type == dnsmessage.TypeSOA && isSubdomain(fqdn, resource.Header.Name.String()) {
+			return strings.ToLower(resource.Header.Name.String()), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrZoneNotFound, fqdn)
+}
+
+// exchange sends the message to the nameserver and returns the header of the response with the parser positioned after it
+func (p *RFC2136Provider) exchange(ctx context.Context, message []byte) (dnsmessage.Header, *dnsmessage.Parser, error) {
+	var header dnsmessage.Header
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", p.nameserver)
+
+	if err != nil {
+		return header, nil, err
+	}
+
+	defer conn.Close() // nolint:errcheck
+
+	deadline, _ := ctx.Deadline()
+
+	if err = conn.SetDeadline(deadline); err != nil {
+		return header, nil, err
+	}
+
+	if _, err = conn.Write(message); err != nil {
+		return header, nil, err
+	}
+
+	id := binary.BigEndian.Uint16(message)
+	buffer := make([]byte, maxMessageSize)
+
+	for {
+		n, err := conn.Read(buffer)
+
+		if err != nil {
+			return header, nil, fmt.Errorf("nameserver %s did not respond: %v", p.nameserver, err)
+		}
+
+		parser := &dnsmessage.Parser{}
+		header, err = parser.Start(buffer[:n])
+
+		// responses to other messages are ignored
+		if err != nil || !header.Response || header.ID != id {
+			continue
+		}
+
+		return header, parser, nil
+	}
+}
+
+// NewRFC2136Provider creates the provider from the settings. The nameserver is required,
+// the TSIG secret is base64 encoded and the algorithm is hmac-sha256 by default.
+func NewRFC2136Provider(settings map[string]string) (*RFC2136Provider, error) {
+	nameserver := strings.TrimSpace(settings[RFC2136Nameserver])
+
+	if nameserver == "" {
+		return nil, fmt.Errorf("%w: nameserver is required", ErrInvalidSettings)
+	}
+
+	if _, _, err := net.SplitHostPort(nameserver); err != nil {
+		nameserver = net.JoinHostPort(strings.Trim(nameserver, "[]"), dnsPort)
+	}
+
+	provider := &RFC2136Provider{
+		nameserver: nameserver,
+		ttl:        defaultRFC2136TTL,
+		timeout:    defaultRFC2136Timeout,
+	}
+
+	if zone := strings.TrimSpace(settings[RFC2136Zone]); zone != "" {
+		provider.zone = strings.ToLower(toFqdn(zone))
+	}
+
+	if ttl := settings[RFC2136TTL]; ttl != "" {
+		value, err := strconv.ParseUint(ttl, 10, 32)
+
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("%w: invalid ttl %s", ErrInvalidSettings, ttl)
+		}
+
+		provider.ttl = uint32(value)
+	}
+
+	keyName := strings.TrimSpace(settings[RFC2136TsigKey])
+	secret := strings.TrimSpace(settings[RFC2136TsigSecret])
+
+	if (keyName == "") != (secret == "") {
+		return nil, fmt.Errorf("%w: tsig key and secret must be set together", ErrInvalidSettings)
+	}
+
+	if keyName != "" {
+		key, err := newTsigKey(keyName, settings[RFC2136TsigAlgorithm], secret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		provider.tsig = key
+	}
+
+	return provider, nil
+}
+
+func messageID() (uint16, error) {
+	var id [2]byte
+
+	if _, err := rand.Read(id[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(id[:]), nil
+}
+
+func toFqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+func isSubdomain(name, zone string) bool {
+	name = strings.ToLower(name)
+	zone = strings.ToLower(zone)
+
+	return name == zone || zone == "." || strings.HasSuffix(name, "."+zone)
+}
@@ -0,0 +1,285 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	testZone    = "example.com."
+	testKeyName = "panel-key."
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testNameserver is a primary nameserver of the test zone that applies TSIG signed TXT updates
+type testNameserver struct {
+	conn    net.PacketConn
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func startTestNameserver(t *testing.T) *testNameserver {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() }) // nolint:errcheck
+
+	nameserver := &testNameserver{conn: conn, records: map[string][]string{}}
+	go nameserver.serve()
+
+	return nameserver
+}
+
+func (s *testNameserver) Records(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.records[name])
+}
+
+func (s *testNameserver) serve() {
+	buffer := make([]byte, maxMessageSize)
+
+	for {
+		n, addr, err := s.conn.ReadFrom(buffer)
+
+		if err != nil {
+			return
+		}
+
+		if response, err := s.handle(append([]byte{}, buffer[:n]...)); err == nil {
+			s.conn.WriteTo(response, addr) // nolint:errcheck
+		}
+	}
+}
+
+func (s *testNameserver) handle(request []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = parser.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+
+	response := dnsmessage.Header{ID: header.ID, OpCode: header.OpCode, Response: true, Authoritative: true}
+
+	if header.OpCode != opCodeUpdate {
+		response.RCode = dnsmessage.RCodeNameError
+
+		return buildTestResponse(response, true)
+	}
+
+	if err = parser.SkipAllAnswers(); err != nil {
+		return nil, err
+	}
+
+	updates, err := parser.AllAuthorities()
+
+	if err != nil {
+		return nil, err
+	}
+
+	additionals, err := parser.AllAdditionals()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(additionals) != 1 || !verifyTestSignature(request, additionals[0]) {
+		response.RCode = dnsmessage.RCode(9) // NOTAUTH
+
+		return buildTestResponse(response, false)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, update := range updates {
+		txt, ok := update.Body.(*dnsmessage.TXTResource)
+
+		if !ok {
+			continue
+		}
+
+		name := update.Header.Name.String()
+
+		switch update.Header.Class {
+		case dnsmessage.ClassINET:
+			s.records[name] = append(s.records[name], txt.TXT...)
+		case classNone:
+			s.records[name] = slices.DeleteFunc(s.records[name], func(value string) bool {
+				return slices.Contains(txt.TXT, value)
+			})
+		}
+	}
+
+	return buildTestResponse(response, false)
+}
+
+func buildTestResponse(header dnsmessage.Header, withSOA bool) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, header)
+
+	if withSOA {
+		if err := builder.StartAuthorities(); err != nil {
+			return nil, err
+		}
+
+		err := builder.SOAResource(
+			dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(testZone), Class: dnsmessage.ClassINET, TTL: 60},
+			dnsmessage.SOAResource{
+				NS:   dnsmessage.MustNewName("ns1." + testZone),
+				MBox: dnsmessage.MustNewName("hostmaster." + testZone),
+			},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Finish()
+}
+
+// verifyTestSignature verifies the hmac-sha256 TSIG record that ends the request
+func verifyTestSignature(request []byte, record dnsmessage.Resource) bool {
+	tsig, ok := record.Body.(*dnsmessage.UnknownResource)
+
+	if !ok || record.Header.Type != typeTSIG || record.Header.Name.String() != testKeyName {
+		return false
+	}
+
+	keyName := packName(testKeyName)
+	unsigned := append([]byte{}, request[:len(request)-len(keyName)-10-len(tsig.Data)]...)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(unsigned[10:12])-1)
+
+	data := tsig.Data
+	algorithm := packName("hmac-sha256.")
+
+	if !bytes.HasPrefix(data, algorithm) {
+		return false
+	}
+
+	timeAndFudge := data[len(algorithm) : len(algorithm)+8]
+	macSize := int(binary.BigEndian.Uint16(data[len(algorithm)+8:]))
+	signature := data[len(algorithm)+10 : len(algorithm)+10+macSize]
+
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write(unsigned)                        // nolint:errcheck
+	mac.Write(keyName)                         // nolint:errcheck
+	mac.Write([]byte{0, classANY, 0, 0, 0, 0}) // nolint:errcheck
+	mac.Write(algorithm)                       // nolint:errcheck
+	mac.Write(timeAndFudge)                    // nolint:errcheck
+	mac.Write([]byte{0, 0, 0, 0})              // nolint:errcheck
+
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+func TestRFC2136PresentAndCleanUp(t *testing.T) {
+	nameserver := startTestNameserver(t)
+	provider, err := CreateProvider(TypeRFC2136, map[string]string{
+		RFC2136Nameserver: nameserver.conn.LocalAddr().String(),
+		RFC2136TsigKey:    testKeyName,
+		RFC2136TsigSecret: base64.StdEncoding.EncodeToString(testSecret),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fqdn := "_acme-challenge.www.example.com."
+
+	if err = provider.Present(context.Background(), fqdn, "token-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = provider.Present(context.Background(), fqdn, "token-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := nameserver.Records(fqdn); !slices.Equal(records, []string{"token-1", "token-2"}) {
+		t.Fatalf("unexpected records after present: %v", records)
+	}
+
+	if err = provider.CleanUp(context.Background(), fqdn, "token-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := nameserver.Records(fqdn); !slices.Equal(records, []string{"token-2"}) {
+		t.Errorf("unexpected records after clean up: %v", records)
+	}
+}
+
+func TestRFC2136InvalidSecret(t *testing.T) {
+	nameserver := startTestNameserver(t)
+	provider, err := NewRFC2136Provider(map[string]string{
+		RFC2136Nameserver: nameserver.conn.LocalAddr().String(),
+		RFC2136Zone:       testZone,
+		RFC2136TsigKey:    testKeyName,
+		RFC2136TsigSecret: base64.StdEncoding.EncodeToString([]byte("another-secret")),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = provider.Present(context.Background(), "_acme-challenge.example.com", "token")
+
+	if !errors.Is(err, ErrUpdateFailed) {
+		t.Errorf("expected update error, got %v", err)
+	}
+
+	if records := nameserver.Records("_acme-challenge.example.com."); len(records) != 0 {
+		t.Errorf("expected no records, got %v", records)
+	}
+}
+
+func TestRFC2136Settings(t *testing.T) {
+	invalidSettings := []map[string]string{
+		{},
+		{RFC2136Nameserver: "127.0.0.1", RFC2136TsigKey: testKeyName},
+		{RFC2136Nameserver: "127.0.0.1", RFC2136TsigKey: testKeyName, RFC2136TsigSecret: "not base64!"},
+		{RFC2136Nameserver: "127.0.0.1", RFC2136TsigKey: testKeyName, RFC2136TsigSecret: "c2VjcmV0", RFC2136TsigAlgorithm: "hmac-md4"},
+		{RFC2136Nameserver: "127.0.0.1", RFC2136TTL: "0"},
+	}
+
+	for _, settings := range invalidSettings {
+		if _, err := NewRFC2136Provider(settings); !errors.Is(err, ErrInvalidSettings) {
+			t.Errorf("expected invalid settings error for %v, got %v", settings, err)
+		}
+	}
+
+	provider, err := NewRFC2136Provider(map[string]string{RFC2136Nameserver: "::1", RFC2136Zone: "Example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if provider.nameserver != "[::1]:53" || provider.zone != testZone {
+		t.Errorf("unexpected nameserver or zone: %s, %s", provider.nameserver, provider.zone)
+	}
+
+	if _, err = CreateProvider("route53", nil); !errors.Is(err, ErrUnknownProviderType) {
+		t.Errorf("expected unknown provider type error, got %v", err)
+	}
+}
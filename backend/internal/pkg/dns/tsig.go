@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+const (
+	typeTSIG   = 250
+	classANY   = 255
+	tsigFudge  = 300 // seconds
+	headerSize = 12  // bytes
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1.":   sha1.New,
+	"hmac-sha256.": sha256.New,
+	"hmac-sha512.": sha512.New,
+}
+
+// tsigKey signs messages with a transaction signature (RFC 8945)
+type tsigKey struct {
+	name      string
+	algorithm string
+	secret    []byte
+}
+
+// sign appends the TSIG record to the message. The message must not contain additional records with TSIG.
+func (k *tsigKey) sign(message []byte, now time.Time) ([]byte, error) {
+	if len(message) < headerSize {
+		return nil, fmt.Errorf("dns message is too short")
+	}
+
+	keyName := packName(k.name)
+	algorithm := packName(k.algorithm)
+	timeSigned := packTime(now)
+
+	// the MAC covers the message and the TSIG variables: the record fields without the MAC and the original ID
+	variables := appendUint16(nil, classANY)
+	variables = appendUint32(variables, 0) // TTL
+	variables = append(variables, algorithm...)
+	variables = append(variables, timeSigned...)
+	variables = appendUint16(variables, tsigFudge)
+	variables = appendUint16(variables, 0) // error
+	variables = appendUint16(variables, 0) // other data length
+
+	mac := hmac.New(tsigAlgorithms[k.algorithm], k.secret)
+	mac.Write(message)   // nolint:errcheck
+	mac.Write(keyName)   // nolint:errcheck
+	mac.Write(variables) // nolint:errcheck
+	signature := mac.Sum(nil)
+
+	data := append([]byte{}, algorithm...)
+	data = append(data, timeSigned...)
+	data = appendUint16(data, tsigFudge)
+	data = appendUint16(data, uint16(len(signature)))
+	data = append(data, signature...)
+	data = append(data, message[0:2]...) // original ID
+	data = appendUint16(data, 0)         // error
+	data = appendUint16(data, 0)         // other data length
+
+	signed := append([]byte{}, message...)
+	signed = append(signed, keyName...)
+	signed = appendUint16(signed, typeTSIG)
+	signed = appendUint16(signed, classANY)
+	signed = appendUint32(signed, 0) // TTL
+	signed = appendUint16(signed, uint16(len(data)))
+	signed = append(signed, data...)
+
+	additionalCount := binary.BigEndian.Uint16(signed[10:12])
+	binary.BigEndian.PutUint16(signed[10:12], additionalCount+1)
+
+	return signed, nil
+}
+
+func newTsigKey(name, algorithm, secret string) (*tsigKey, error) {
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+
+	algorithm = strings.ToLower(toFqdn(algorithm))
+
+	if _, ok := tsigAlgorithms[algorithm]; !ok {
+		return nil, fmt.Errorf("%w: unsupported tsig algorithm %s", ErrInvalidSettings, algorithm)
+	}
+
+	key, err := decodeSecret(secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tsigKey{
+		name:      strings.ToLower(toFqdn(name)),
+		algorithm: algorithm,
+		secret:    key,
+	}, nil
+}
+
+// packName returns the uncompressed wire format of the fully qualified name
+func packName(name string) []byte {
+	var packed []byte
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+
+		packed = append(packed, byte(len(label)))
+		packed = append(packed, label...)
+	}
+
+	return append(packed, 0)
+}
+
+// packTime returns the 48-bit time signed field
+func packTime(t time.Time) []byte {
+	seconds := uint64(t.Unix())
+
+	return []byte{
+		byte(seconds >> 40),
+		byte(seconds >> 32),
+		byte(seconds >> 24),
+		byte(seconds >> 16),
+		byte(seconds >> 8),
+		byte(seconds),
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return binary.BigEndian.AppendUint16(b, v)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(secret)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: tsig secret must be base64 encoded", ErrInvalidSettings)
+	}
+
+	return key, nil
+}
@@ -81,3 +81,15 @@ func createLogDirIfNeeded(logFilePath string) error {
 
 	return nil
 }
+
+type nopLogger struct{}
+
+func (nopLogger) Error(message string, args ...interface{})   {}
+func (nopLogger) Warning(message string, args ...interface{}) {}
+func (nopLogger) Info(message string, args ...interface{})    {}
+func (nopLogger) Debug(message string, args ...interface{})   {}
+
+// NewNopLogger returns a logger that discards all messages
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
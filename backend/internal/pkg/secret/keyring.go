@@ -0,0 +1,227 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// encryptedPrefix marks values encrypted by the key ring. Values without the prefix are stored in plaintext.
+const encryptedPrefix = "enc:v1:"
+
+const keySize = 32 // bytes, AES-256
+
+var (
+	ErrUnknownKey       = errors.New("value is encrypted with an unknown key")
+	ErrInvalidEncrypted = errors.New("invalid encrypted value")
+
+	keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// KeyRing encrypts values with envelope encryption: every value is encrypted with its own random data key
+// and the data key is encrypted with the active master key. The ID of the master key is stored with the value,
+// so values encrypted with previous keys can be decrypted as long as those keys stay in the ring.
+type KeyRing struct {
+	keys        map[string][]byte
+	activeKeyID string
+}
+
+// Enabled reports whether master keys are configured. Without keys values are stored in plaintext.
+func (r *KeyRing) Enabled() bool {
+	return r.activeKeyID != ""
+}
+
+func (r *KeyRing) ActiveKeyID() string {
+	return r.activeKeyID
+}
+
+// Encrypt encrypts the value with the active key. Empty values and values of a ring without keys are returned as is.
+func (r *KeyRing) Encrypt(value string) (string, error) {
+	if value == "" || !r.Enabled() {
+		return value, nil
+	}
+
+	dataKey := make([]byte, keySize)
+
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(r.keys[r.activeKeyID], dataKey, []byte(r.activeKeyID))
+
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(value), nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + strings.Join([]string{
+		r.activeKeyID,
+		base64.RawStdEncoding.EncodeToString(wrappedKey),
+		base64.RawStdEncoding.EncodeToString(ciphertext),
+	}, ":"), nil
+}
+
+// Decrypt decrypts the value encrypted by Encrypt. Plaintext values are returned as is.
+func (r *KeyRing) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+
+	if len(parts) != 3 {
+		return "", ErrInvalidEncrypted
+	}
+
+	keyID := parts[0]
+	masterKey, ok := r.keys[keyID]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return "", ErrInvalidEncrypted
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return "", ErrInvalidEncrypted
+	}
+
+	dataKey, err := open(masterKey, wrappedKey, []byte(keyID))
+
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt data key: %w", err)
+	}
+
+	plaintext, err := open(dataKey, ciphertext, nil)
+
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether the value is encrypted by a key ring
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// KeyID returns the ID of the master key the value is encrypted with
+func KeyID(value string) (string, bool) {
+	if !IsEncrypted(value) {
+		return "", false
+	}
+
+	keyID, _, found := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+
+	return keyID, found
+}
+
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalidEncrypted
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// NewKeyRing creates the key ring from base64 encoded 256-bit master keys indexed by key ID.
+// If activeKeyID is empty and there is a single key, that key is active.
+func NewKeyRing(keys map[string]string, activeKeyID string) (*KeyRing, error) {
+	ring := &KeyRing{keys: make(map[string][]byte, len(keys))}
+
+	for keyID, encodedKey := range keys {
+		if !keyIDPattern.MatchString(keyID) {
+			return nil, fmt.Errorf("invalid encryption key ID '%s'", keyID)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("encryption key '%s' is not base64 encoded: %v", keyID, err)
+		}
+
+		if len(key) != keySize {
+			return nil, fmt.Errorf("encryption key '%s' must be %d bytes long", keyID, keySize)
+		}
+
+		ring.keys[keyID] = key
+	}
+
+	if activeKeyID == "" && len(ring.keys) == 1 {
+		for keyID := range ring.keys {
+			activeKeyID = keyID
+		}
+	}
+
+	if activeKeyID == "" && len(ring.keys) > 1 {
+		keyIDs := make([]string, 0, len(ring.keys))
+
+		for keyID := range ring.keys {
+			keyIDs = append(keyIDs, keyID)
+		}
+
+		sort.Strings(keyIDs)
+
+		return nil, fmt.Errorf("active encryption key must be specified, configured keys: %s", strings.Join(keyIDs, ", "))
+	}
+
+	if _, ok := ring.keys[activeKeyID]; activeKeyID != "" && !ok {
+		return nil, fmt.Errorf("active encryption key '%s' is not configured", activeKeyID)
+	}
+
+	ring.activeKeyID = activeKeyID
+
+	return ring, nil
+}
@@ -0,0 +1,91 @@
+package secret
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testKey1 = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", keySize)))
+	testKey2 = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", keySize)))
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	oldRing, err := NewKeyRing(map[string]string{"k1": testKey1}, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := oldRing.Encrypt("agent-token")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyID, _ := KeyID(encrypted); keyID != "k1" || strings.Contains(encrypted, "agent-token") {
+		t.Fatalf("unexpected encrypted value %s", encrypted)
+	}
+
+	newRing, err := NewKeyRing(map[string]string{"k1": testKey1, "k2": testKey2}, "k2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := newRing.Decrypt(encrypted)
+
+	if err != nil || token != "agent-token" {
+		t.Fatalf("expected token encrypted with the previous key to be decrypted, got %q, %v", token, err)
+	}
+
+	reencrypted, err := newRing.Encrypt(token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyID, _ := KeyID(reencrypted); keyID != "k2" {
+		t.Fatalf("expected value to be encrypted with the active key, got %s", reencrypted)
+	}
+
+	if _, err = oldRing.Decrypt(reencrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestKeyRingPlaintext(t *testing.T) {
+	ring, err := NewKeyRing(nil, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := ring.Encrypt("agent-token")
+
+	if err != nil || value != "agent-token" {
+		t.Fatalf("expected value to be kept in plaintext without keys, got %q, %v", value, err)
+	}
+
+	value, err = ring.Decrypt("agent-token")
+
+	if err != nil || value != "agent-token" {
+		t.Fatalf("expected plaintext value to be returned as is, got %q, %v", value, err)
+	}
+}
+
+func TestNewKeyRingValidation(t *testing.T) {
+	if _, err := NewKeyRing(map[string]string{"k1": testKey1, "k2": testKey2}, ""); err == nil {
+		t.Fatal("expected error if active key is ambiguous")
+	}
+
+	if _, err := NewKeyRing(map[string]string{"k1": testKey1}, "k2"); err == nil {
+		t.Fatal("expected error if active key is not configured")
+	}
+
+	if _, err := NewKeyRing(map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}, ""); err == nil {
+		t.Fatal("expected error for a short key")
+	}
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"backend/config"
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ShutdownFunc flushes pending spans and metrics and stops the exporters
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup registers the global OpenTelemetry providers that export spans and metrics to the OTLP/HTTP endpoint.
+// Telemetry stays a no-op if no endpoint is configured.
+func Setup(ctx context.Context, config *config.Config) (ShutdownFunc, error) {
+	if config.TelemetryEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	appResource, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(config.TelemetryServiceName)),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create telemetry resource: %v", err)
+	}
+
+	traceOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.TelemetryEndpoint)}
+	metricOptions := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(config.TelemetryEndpoint)}
+
+	if config.TelemetryInsecure {
+		traceOptions = append(traceOptions, otlptracehttp.WithInsecure())
+		metricOptions = append(metricOptions, otlpmetrichttp.WithInsecure())
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx, traceOptions...)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create trace exporter: %v", err)
+	}
+
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOptions...)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not create metric exporter: %v", err)
+	}
+
+	tracerProvider := trace.NewTracerProvider(
+		trace.WithBatcher(traceExporter),
+		trace.WithResource(appResource),
+	)
+	meterProvider := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(metricExporter, metric.WithInterval(config.TelemetryExportInterval))),
+		metric.WithResource(appResource),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+	}, nil
+}
@@ -0,0 +1,16 @@
+package text
+
+import "unicode/utf8"
+
+// Truncate cuts the value to at most length bytes without splitting a multibyte character
+func Truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+
+	return value[:length]
+}
@@ -0,0 +1,23 @@
+package text
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value    string
+		length   int
+		expected string
+	}{
+		{"timeout", 16, "timeout"},
+		{"timeout", 4, "time"},
+		{"ошибка", 4, "ош"},
+		{"ошибка", 3, "о"},
+		{"ошибка", 1, ""},
+	}
+
+	for _, test := range tests {
+		if truncated := Truncate(test.value, test.length); truncated != test.expected {
+			t.Errorf("Truncate(%q, %d): expected %q, got %q", test.value, test.length, test.expected, truncated)
+		}
+	}
+}
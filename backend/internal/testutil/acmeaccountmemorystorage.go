@@ -0,0 +1,55 @@
+package testutil
+
+import (
+	"backend/internal/modules/sslmanager/acmestorage"
+	"sync"
+	"time"
+)
+
+// MemoryAcmeAccountStorage keeps accounts in memory. It is used in tests.
+type MemoryAcmeAccountStorage struct {
+	mu       sync.Mutex
+	accounts []acmestorage.AcmeAccount
+	lastID   uint
+}
+
+func (s *MemoryAcmeAccountStorage) FindByDirectoryURL(accountID int, directoryURL string) (*acmestorage.AcmeAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		if account.AccountID == uint(accountID) && account.DirectoryURL == directoryURL {
+			return &account, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryAcmeAccountStorage) Save(account *acmestorage.AcmeAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account.UpdatedAt = time.Now()
+
+	if account.ID == 0 {
+		s.lastID++
+		account.ID = s.lastID
+		account.CreatedAt = account.UpdatedAt
+		s.accounts = append(s.accounts, *account)
+
+		return nil
+	}
+
+	for i := range s.accounts {
+		if s.accounts[i].ID == account.ID {
+			s.accounts[i] = *account
+		}
+	}
+
+	return nil
+}
+
+func CreateMemoryAcmeAccountStorage() *MemoryAcmeAccountStorage {
+	return &MemoryAcmeAccountStorage{}
+}
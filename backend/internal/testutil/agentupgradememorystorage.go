@@ -0,0 +1,145 @@
+package testutil
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// agentUpgradeMemoryStorage keeps agent upgrades in memory. It is used in tests.
+type agentUpgradeMemoryStorage struct {
+	mu           sync.Mutex
+	upgrades     map[uint]serverStorage.AgentUpgrade
+	servers      []serverStorage.AgentUpgradeServer
+	lastID       uint
+	lastServerID uint
+}
+
+func (s *agentUpgradeMemoryStorage) Create(upgrade *serverStorage.AgentUpgrade, servers []serverStorage.AgentUpgradeServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	upgrade.ID = s.lastID
+	upgrade.CreatedAt = time.Now()
+	upgrade.UpdatedAt = upgrade.CreatedAt
+	s.upgrades[upgrade.ID] = *upgrade
+
+	for i := range servers {
+		s.lastServerID++
+		servers[i].ID = s.lastServerID
+		servers[i].UpgradeID = upgrade.ID
+		s.servers = append(s.servers, servers[i])
+	}
+
+	return nil
+}
+
+func (s *agentUpgradeMemoryStorage) FindByID(id int) (*serverStorage.AgentUpgrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upgrade, ok := s.upgrades[uint(id)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &upgrade, nil
+}
+
+func (s *agentUpgradeMemoryStorage) FindAllByAccountID(accountID int) ([]serverStorage.AgentUpgrade, error) {
+	return s.findAll(func(upgrade serverStorage.AgentUpgrade) bool {
+		return upgrade.AccountID == uint(accountID)
+	}), nil
+}
+
+func (s *agentUpgradeMemoryStorage) FindAllByStatus(status string) ([]serverStorage.AgentUpgrade, error) {
+	upgrades := s.findAll(func(upgrade serverStorage.AgentUpgrade) bool {
+		return upgrade.Status == status
+	})
+	slices.Reverse(upgrades)
+
+	return upgrades, nil
+}
+
+func (s *agentUpgradeMemoryStorage) FindServers(upgradeID int) ([]serverStorage.AgentUpgradeServer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var servers []serverStorage.AgentUpgradeServer
+
+	for _, server := range s.servers {
+		if server.UpgradeID == uint(upgradeID) {
+			servers = append(servers, server)
+		}
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].Batch < servers[j].Batch
+	})
+
+	return servers, nil
+}
+
+func (s *agentUpgradeMemoryStorage) UpdateStatus(id int, status, message string, finishedAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upgrade, ok := s.upgrades[uint(id)]
+
+	if !ok {
+		return errors.New("agent upgrade not found")
+	}
+
+	upgrade.Status = status
+	upgrade.Error = message
+	upgrade.FinishedAt = finishedAt
+	upgrade.UpdatedAt = time.Now()
+	s.upgrades[uint(id)] = upgrade
+
+	return nil
+}
+
+func (s *agentUpgradeMemoryStorage) SaveServer(server *serverStorage.AgentUpgradeServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.servers {
+		if s.servers[i].ID == server.ID {
+			s.servers[i] = *server
+
+			return nil
+		}
+	}
+
+	return errors.New("agent upgrade server not found")
+}
+
+func (s *agentUpgradeMemoryStorage) findAll(filter func(upgrade serverStorage.AgentUpgrade) bool) []serverStorage.AgentUpgrade {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upgrades := []serverStorage.AgentUpgrade{}
+
+	for _, upgrade := range s.upgrades {
+		if filter(upgrade) {
+			upgrades = append(upgrades, upgrade)
+		}
+	}
+
+	sort.Slice(upgrades, func(i, j int) bool {
+		return upgrades[i].ID > upgrades[j].ID
+	})
+
+	return upgrades
+}
+
+func NewAgentUpgradeMemoryStorage() serverStorage.AgentUpgradeStorage {
+	return &agentUpgradeMemoryStorage{
+		upgrades: map[uint]serverStorage.AgentUpgrade{},
+	}
+}
@@ -0,0 +1,99 @@
+package testutil
+
+import (
+	"backend/internal/modules/sslmanager/acmestorage"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCertificateAuthorityStorage keeps certificate authorities in memory. It is used in tests.
+type MemoryCertificateAuthorityStorage struct {
+	mu          sync.Mutex
+	authorities []acmestorage.CertificateAuthority
+	lastID      uint
+}
+
+func (s *MemoryCertificateAuthorityStorage) FindByID(id int) (*acmestorage.CertificateAuthority, error) {
+	return s.findOne(func(ca acmestorage.CertificateAuthority) bool {
+		return ca.ID == uint(id)
+	})
+}
+
+func (s *MemoryCertificateAuthorityStorage) FindByName(accountID int, name string) (*acmestorage.CertificateAuthority, error) {
+	return s.findOne(func(ca acmestorage.CertificateAuthority) bool {
+		return ca.AccountID == uint(accountID) && ca.Name == name
+	})
+}
+
+func (s *MemoryCertificateAuthorityStorage) FindAllByAccountID(accountID int) ([]acmestorage.CertificateAuthority, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var authorities []acmestorage.CertificateAuthority
+
+	for _, ca := range s.authorities {
+		if ca.AccountID == uint(accountID) {
+			authorities = append(authorities, ca)
+		}
+	}
+
+	slices.SortFunc(authorities, func(a, b acmestorage.CertificateAuthority) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return authorities, nil
+}
+
+func (s *MemoryCertificateAuthorityStorage) Save(ca *acmestorage.CertificateAuthority) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ca.UpdatedAt = time.Now()
+
+	if ca.ID == 0 {
+		s.lastID++
+		ca.ID = s.lastID
+		ca.CreatedAt = ca.UpdatedAt
+		s.authorities = append(s.authorities, *ca)
+
+		return nil
+	}
+
+	for i := range s.authorities {
+		if s.authorities[i].ID == ca.ID {
+			s.authorities[i] = *ca
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryCertificateAuthorityStorage) Remove(ca *acmestorage.CertificateAuthority) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authorities = slices.DeleteFunc(s.authorities, func(a acmestorage.CertificateAuthority) bool {
+		return a.ID == ca.ID
+	})
+
+	return nil
+}
+
+func (s *MemoryCertificateAuthorityStorage) findOne(match func(ca acmestorage.CertificateAuthority) bool) (*acmestorage.CertificateAuthority, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ca := range s.authorities {
+		if match(ca) {
+			return &ca, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func CreateMemoryCertificateAuthorityStorage() *MemoryCertificateAuthorityStorage {
+	return &MemoryCertificateAuthorityStorage{}
+}
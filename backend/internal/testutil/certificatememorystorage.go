@@ -0,0 +1,175 @@
+package testutil
+
+import (
+	"backend/internal/modules/sslmanager/inventory/certstorage"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryCertificateStorage keeps certificates and sightings in memory. It is used in tests.
+type MemoryCertificateStorage struct {
+	mu             sync.Mutex
+	certificates   []certstorage.Certificate
+	sightings      []certstorage.Sighting
+	lastID         uint
+	lastSightingID uint
+}
+
+func (s *MemoryCertificateStorage) FindByID(id uint) (*certstorage.Certificate, error) {
+	return s.findOne(func(certificate certstorage.Certificate) bool {
+		return certificate.ID == id
+	})
+}
+
+func (s *MemoryCertificateStorage) FindByFingerprint(accountID int, fingerprint string) (*certstorage.Certificate, error) {
+	return s.findOne(func(certificate certstorage.Certificate) bool {
+		return certificate.AccountID == uint(accountID) && certificate.Fingerprint == fingerprint
+	})
+}
+
+func (s *MemoryCertificateStorage) FindAllByLocation(accountID int, source, location string) ([]certstorage.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := map[uint]bool{}
+
+	for _, sighting := range s.sightings {
+		if sighting.Source == source && sighting.Location == location {
+			ids[sighting.CertificateID] = true
+		}
+	}
+
+	certificates := s.filter(func(certificate certstorage.Certificate) bool {
+		return certificate.AccountID == uint(accountID) && ids[certificate.ID]
+	})
+	slices.SortFunc(certificates, func(a, b certstorage.Certificate) int {
+		return b.NotAfter.Compare(a.NotAfter)
+	})
+
+	return certificates, nil
+}
+
+func (s *MemoryCertificateStorage) FindAllExpiring(accountID int, from, to time.Time) ([]certstorage.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	certificates := s.filter(func(certificate certstorage.Certificate) bool {
+		return certificate.AccountID == uint(accountID) && !certificate.NotAfter.Before(from) && !certificate.NotAfter.After(to)
+	})
+	slices.SortFunc(certificates, func(a, b certstorage.Certificate) int {
+		return a.NotAfter.Compare(b.NotAfter)
+	})
+
+	return certificates, nil
+}
+
+func (s *MemoryCertificateStorage) FindSightings(certificateIDs []uint) ([]certstorage.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sightings := []certstorage.Sighting{}
+
+	for _, sighting := range s.sightings {
+		if slices.Contains(certificateIDs, sighting.CertificateID) {
+			sightings = append(sightings, sighting)
+		}
+	}
+
+	slices.SortFunc(sightings, func(a, b certstorage.Sighting) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+
+	return sightings, nil
+}
+
+func (s *MemoryCertificateStorage) FindLatestSighting(serverID uint, source, location, webServer string) (*certstorage.Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest *certstorage.Sighting
+
+	for _, sighting := range s.sightings {
+		if sighting.ServerID != serverID || sighting.Source != source || sighting.Location != location || sighting.WebServer != webServer {
+			continue
+		}
+
+		if latest == nil || sighting.LastSeenAt.After(latest.LastSeenAt) {
+			latest = &sighting
+		}
+	}
+
+	return latest, nil
+}
+
+func (s *MemoryCertificateStorage) SaveCertificate(certificate *certstorage.Certificate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if certificate.ID == 0 {
+		s.lastID++
+		certificate.ID = s.lastID
+		certificate.CreatedAt = time.Now()
+		s.certificates = append(s.certificates, *certificate)
+
+		return nil
+	}
+
+	for i := range s.certificates {
+		if s.certificates[i].ID == certificate.ID {
+			s.certificates[i] = *certificate
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryCertificateStorage) SaveSighting(sighting *certstorage.Sighting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sighting.ID == 0 {
+		s.lastSightingID++
+		sighting.ID = s.lastSightingID
+		s.sightings = append(s.sightings, *sighting)
+
+		return nil
+	}
+
+	for i := range s.sightings {
+		if s.sightings[i].ID == sighting.ID {
+			s.sightings[i] = *sighting
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryCertificateStorage) findOne(match func(certificate certstorage.Certificate) bool) (*certstorage.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, certificate := range s.certificates {
+		if match(certificate) {
+			return &certificate, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryCertificateStorage) filter(match func(certificate certstorage.Certificate) bool) []certstorage.Certificate {
+	certificates := []certstorage.Certificate{}
+
+	for _, certificate := range s.certificates {
+		if match(certificate) {
+			certificates = append(certificates, certificate)
+		}
+	}
+
+	return certificates
+}
+
+func CreateMemoryCertificateStorage() *MemoryCertificateStorage {
+	return &MemoryCertificateStorage{}
+}
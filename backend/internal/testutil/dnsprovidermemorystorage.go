@@ -0,0 +1,99 @@
+package testutil
+
+import (
+	"backend/internal/modules/sslmanager/dnsstorage"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDnsProviderStorage keeps providers in memory. It is used in tests.
+type MemoryDnsProviderStorage struct {
+	mu        sync.Mutex
+	providers []dnsstorage.DnsProvider
+	lastID    uint
+}
+
+func (s *MemoryDnsProviderStorage) FindByID(id int) (*dnsstorage.DnsProvider, error) {
+	return s.findOne(func(provider dnsstorage.DnsProvider) bool {
+		return provider.ID == uint(id)
+	})
+}
+
+func (s *MemoryDnsProviderStorage) FindByName(accountID int, name string) (*dnsstorage.DnsProvider, error) {
+	return s.findOne(func(provider dnsstorage.DnsProvider) bool {
+		return provider.AccountID == uint(accountID) && provider.Name == name
+	})
+}
+
+func (s *MemoryDnsProviderStorage) FindAllByAccountID(accountID int) ([]dnsstorage.DnsProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var providers []dnsstorage.DnsProvider
+
+	for _, provider := range s.providers {
+		if provider.AccountID == uint(accountID) {
+			providers = append(providers, provider)
+		}
+	}
+
+	slices.SortFunc(providers, func(a, b dnsstorage.DnsProvider) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return providers, nil
+}
+
+func (s *MemoryDnsProviderStorage) Save(provider *dnsstorage.DnsProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider.UpdatedAt = time.Now()
+
+	if provider.ID == 0 {
+		s.lastID++
+		provider.ID = s.lastID
+		provider.CreatedAt = provider.UpdatedAt
+		s.providers = append(s.providers, *provider)
+
+		return nil
+	}
+
+	for i := range s.providers {
+		if s.providers[i].ID == provider.ID {
+			s.providers[i] = *provider
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryDnsProviderStorage) Remove(provider *dnsstorage.DnsProvider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.providers = slices.DeleteFunc(s.providers, func(p dnsstorage.DnsProvider) bool {
+		return p.ID == provider.ID
+	})
+
+	return nil
+}
+
+func (s *MemoryDnsProviderStorage) findOne(match func(provider dnsstorage.DnsProvider) bool) (*dnsstorage.DnsProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, provider := range s.providers {
+		if match(provider) {
+			return &provider, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func CreateMemoryDnsProviderStorage() *MemoryDnsProviderStorage {
+	return &MemoryDnsProviderStorage{}
+}
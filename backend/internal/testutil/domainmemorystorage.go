@@ -0,0 +1,123 @@
+package testutil
+
+import (
+	domainStorage "backend/internal/app/panel/domain/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryDomainStorage keeps the domain inventory in memory. It is used in tests.
+type memoryDomainStorage struct {
+	mu           sync.Mutex
+	domains      map[int][]domainStorage.Domain
+	syncs        map[int]domainStorage.DomainSync
+	changes      []domainStorage.DomainChange
+	lastID       int
+	lastChangeID int
+}
+
+func (s *memoryDomainStorage) FindAllByServerID(serverID int) ([]domainStorage.Domain, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domains := append([]domainStorage.Domain{}, s.domains[serverID]...)
+	sort.SliceStable(domains, func(i, j int) bool {
+		return domains[i].ServerName < domains[j].ServerName
+	})
+
+	return domains, nil
+}
+
+func (s *memoryDomainStorage) FindSync(serverID int) (*domainStorage.DomainSync, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domainSync, ok := s.syncs[serverID]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &domainSync, nil
+}
+
+func (s *memoryDomainStorage) FindChangesByServerID(serverID int, limit int) ([]domainStorage.DomainChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []domainStorage.DomainChange
+
+	for i := len(s.changes) - 1; i >= 0 && len(changes) < limit; i-- {
+		if s.changes[i].ServerID == serverID {
+			changes = append(changes, s.changes[i])
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *memoryDomainStorage) ReplaceServerDomains(serverID int, domains []domainStorage.Domain, changes []domainStorage.DomainChange, syncedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storedIDs := map[string][]int{}
+
+	for _, domain := range s.domains[serverID] {
+		storedIDs[domain.Key()] = append(storedIDs[domain.Key()], domain.ID)
+	}
+
+	replaced := make([]domainStorage.Domain, 0, len(domains))
+
+	for _, domain := range domains {
+		domain.ServerID = serverID
+		domain.SyncedAt = syncedAt
+
+		if ids := storedIDs[domain.Key()]; len(ids) != 0 {
+			domain.ID = ids[0]
+			storedIDs[domain.Key()] = ids[1:]
+		} else {
+			s.lastID++
+			domain.ID = s.lastID
+		}
+
+		replaced = append(replaced, domain)
+	}
+
+	s.domains[serverID] = replaced
+
+	for _, change := range changes {
+		s.lastChangeID++
+		change.ID = s.lastChangeID
+		change.CreatedAt = syncedAt
+		s.changes = append(s.changes, change)
+	}
+
+	s.syncs[serverID] = domainStorage.DomainSync{
+		ServerID:    serverID,
+		SyncedAt:    &syncedAt,
+		AttemptedAt: syncedAt,
+	}
+
+	return nil
+}
+
+func (s *memoryDomainStorage) SaveSyncError(serverID int, attemptedAt time.Time, syncErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domainSync := s.syncs[serverID]
+	domainSync.ServerID = serverID
+	domainSync.AttemptedAt = attemptedAt
+	domainSync.Error = syncErr
+	s.syncs[serverID] = domainSync
+
+	return nil
+}
+
+func NewDomainMemoryStorage() domainStorage.DomainStorage {
+	return &memoryDomainStorage{
+		domains: map[int][]domainStorage.Domain{},
+		syncs:   map[int]domainStorage.DomainSync{},
+	}
+}
@@ -0,0 +1,110 @@
+package testutil
+
+import (
+	domainStorage "backend/internal/app/panel/domain/storage"
+	serverStorage "backend/internal/app/panel/server/storage"
+	"sync"
+	"time"
+)
+
+// memorySettingStorage keeps domain settings in memory. It is used in tests.
+type memorySettingStorage struct {
+	mu       sync.Mutex
+	settings map[int]domainStorage.DomainSetting
+	lastID   int
+}
+
+func (s *memorySettingStorage) FindByID(id int) (*domainStorage.DomainSetting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setting, ok := s.settings[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &setting, nil
+}
+
+func (s *memorySettingStorage) FindAllByDomain(domainName string, serverGuid string) ([]domainStorage.DomainSetting, error) {
+	var settings []domainStorage.DomainSetting
+	serverId, err := serverStorage.GetServerIDByGUID(serverGuid)
+
+	if err != nil {
+		return settings, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, setting := range s.settings {
+		if setting.ServerId == serverId && setting.DomainName == domainName {
+			settings = append(settings, setting)
+		}
+	}
+
+	return settings, nil
+}
+
+func (s *memorySettingStorage) FindByDomain(domainName string, serverGuid string, settingName string) (*domainStorage.DomainSetting, error) {
+	settings, err := s.FindAllByDomain(domainName, serverGuid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, setting := range settings {
+		if setting.SettingName == settingName {
+			return &setting, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memorySettingStorage) Save(setting *domainStorage.DomainSetting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if setting.ID == 0 {
+		s.lastID++
+		setting.ID = s.lastID
+		setting.CreatedAt = time.Now()
+	}
+
+	setting.UpdatedAt = time.Now()
+	s.settings[setting.ID] = *setting
+
+	return nil
+}
+
+func (s *memorySettingStorage) Create(domainName string, serverGuid string, settingName string, settingValue string) error {
+	serverId, err := serverStorage.GetServerIDByGUID(serverGuid)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Save(&domainStorage.DomainSetting{
+		DomainName:   domainName,
+		ServerId:     serverId,
+		SettingName:  settingName,
+		SettingValue: settingValue,
+	})
+}
+
+func (s *memorySettingStorage) Remove(setting *domainStorage.DomainSetting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.settings, setting.ID)
+
+	return nil
+}
+
+func NewDomainSettingMemoryStorage() domainStorage.DomainSettingStorage {
+	return &memorySettingStorage{
+		settings: map[int]domainStorage.DomainSetting{},
+	}
+}
@@ -0,0 +1,123 @@
+package testutil
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+// enrollmentCodeMemoryStorage keeps enrollment codes in memory. It is used in tests.
+type enrollmentCodeMemoryStorage struct {
+	mu      sync.Mutex
+	codes   map[uint]serverStorage.EnrollmentCode
+	lastID  uint
+	servers serverStorage.ServerStorage
+}
+
+func (s *enrollmentCodeMemoryStorage) Create(code *serverStorage.EnrollmentCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	code.ID = s.lastID
+	code.CreatedAt = time.Now()
+	s.codes[code.ID] = *code
+
+	return nil
+}
+
+func (s *enrollmentCodeMemoryStorage) FindByID(id int) (*serverStorage.EnrollmentCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[uint(id)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &code, nil
+}
+
+func (s *enrollmentCodeMemoryStorage) FindByHash(codeHash string) (*serverStorage.EnrollmentCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range s.codes {
+		if code.CodeHash == codeHash {
+			return &code, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *enrollmentCodeMemoryStorage) FindAllByAccountID(accountID int) ([]serverStorage.EnrollmentCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := []serverStorage.EnrollmentCode{}
+
+	for _, code := range s.codes {
+		if code.AccountID == uint(accountID) {
+			codes = append(codes, code)
+		}
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].ID > codes[j].ID
+	})
+
+	return codes, nil
+}
+
+func (s *enrollmentCodeMemoryStorage) Enroll(id int, ip string, now time.Time, server *serverStorage.Server) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[uint(id)]
+
+	if !ok || !code.IsActive(now) {
+		return false, nil
+	}
+
+	if err := s.servers.Save(server); err != nil {
+		return false, err
+	}
+
+	if err := s.servers.RotateToken(int(server.ID), server.Token, &now); err != nil {
+		return false, err
+	}
+
+	code.UsedAt = &now
+	code.UsedIP = ip
+	code.ServerID = &server.ID
+	s.codes[code.ID] = code
+
+	return true, nil
+}
+
+func (s *enrollmentCodeMemoryStorage) Revoke(id int, userID uint, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[uint(id)]
+
+	if !ok || code.UsedAt != nil || code.RevokedAt != nil {
+		return false, nil
+	}
+
+	code.RevokedAt = &now
+	code.RevokedBy = &userID
+	s.codes[code.ID] = code
+
+	return true, nil
+}
+
+func NewEnrollmentCodeMemoryStorage(servers serverStorage.ServerStorage) serverStorage.EnrollmentCodeStorage {
+	return &enrollmentCodeMemoryStorage{
+		codes:   map[uint]serverStorage.EnrollmentCode{},
+		servers: servers,
+	}
+}
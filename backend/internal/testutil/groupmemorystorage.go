@@ -0,0 +1,176 @@
+package testutil
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// serverGroupMemoryStorage keeps server groups in memory. It is used in tests.
+type serverGroupMemoryStorage struct {
+	mu      sync.Mutex
+	groups  map[uint]serverStorage.ServerGroup
+	members map[uint][]uint
+	lastID  uint
+}
+
+func (s *serverGroupMemoryStorage) FindByID(id int) (*serverStorage.ServerGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[uint(id)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &group, nil
+}
+
+func (s *serverGroupMemoryStorage) FindByName(accountID int, name string) (*serverStorage.ServerGroup, error) {
+	groups, _ := s.FindAllByAccountID(accountID)
+
+	for _, group := range groups {
+		if group.Name == name {
+			return &group, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *serverGroupMemoryStorage) FindAllByAccountID(accountID int) ([]serverStorage.ServerGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := []serverStorage.ServerGroup{}
+
+	for _, group := range s.groups {
+		if group.AccountID == uint(accountID) {
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+func (s *serverGroupMemoryStorage) Save(group *serverStorage.ServerGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if group.ID == 0 {
+		s.lastID++
+		group.ID = s.lastID
+		group.CreatedAt = time.Now()
+	}
+
+	group.UpdatedAt = time.Now()
+	s.groups[group.ID] = *group
+
+	return nil
+}
+
+func (s *serverGroupMemoryStorage) Remove(group *serverStorage.ServerGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.groups, group.ID)
+	delete(s.members, group.ID)
+
+	return nil
+}
+
+func (s *serverGroupMemoryStorage) FindServerIDs(groupID int) ([]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.members[uint(groupID)]), nil
+}
+
+func (s *serverGroupMemoryStorage) SetServers(groupID int, serverIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[uint(groupID)]; !ok {
+		return errors.New("server group not found")
+	}
+
+	members := slices.Clone(serverIDs)
+	slices.Sort(members)
+	s.members[uint(groupID)] = slices.Compact(members)
+
+	return nil
+}
+
+func (s *serverGroupMemoryStorage) FindGroupIDsByServerIDs(serverIDs []uint) (map[uint][]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groupIDs := map[uint][]uint{}
+
+	for groupID, members := range s.members {
+		for _, serverID := range serverIDs {
+			if slices.Contains(members, serverID) {
+				groupIDs[serverID] = append(groupIDs[serverID], groupID)
+			}
+		}
+	}
+
+	for _, ids := range groupIDs {
+		slices.Sort(ids)
+	}
+
+	return groupIDs, nil
+}
+
+func NewServerGroupMemoryStorage() serverStorage.ServerGroupStorage {
+	return &serverGroupMemoryStorage{
+		groups:  map[uint]serverStorage.ServerGroup{},
+		members: map[uint][]uint{},
+	}
+}
+
+// serverTagMemoryStorage keeps server tags in memory. It is used in tests.
+type serverTagMemoryStorage struct {
+	mu   sync.Mutex
+	tags map[uint][]string
+}
+
+func (s *serverTagMemoryStorage) FindByServerIDs(serverIDs []uint) (map[uint][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := map[uint][]string{}
+
+	for _, serverID := range serverIDs {
+		if serverTags, ok := s.tags[serverID]; ok {
+			tags[serverID] = slices.Clone(serverTags)
+		}
+	}
+
+	return tags, nil
+}
+
+func (s *serverTagMemoryStorage) SetServerTags(serverID int, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	serverTags := slices.Clone(tags)
+	slices.Sort(serverTags)
+	s.tags[uint(serverID)] = slices.Compact(serverTags)
+
+	return nil
+}
+
+func NewServerTagMemoryStorage() serverStorage.ServerTagStorage {
+	return &serverTagMemoryStorage{
+		tags: map[uint][]string{},
+	}
+}
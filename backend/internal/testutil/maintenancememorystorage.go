@@ -0,0 +1,89 @@
+package testutil
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maintenanceMemoryStorage keeps maintenance windows in memory. It is used in tests.
+type maintenanceMemoryStorage struct {
+	mu      sync.Mutex
+	windows []serverStorage.MaintenanceWindow
+	lastID  uint
+}
+
+func (s *maintenanceMemoryStorage) Create(window *serverStorage.MaintenanceWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	window.ID = s.lastID
+
+	if window.CreatedAt.IsZero() {
+		window.CreatedAt = time.Now()
+	}
+
+	s.windows = append(s.windows, *window)
+
+	return nil
+}
+
+func (s *maintenanceMemoryStorage) FindByID(id int) (*serverStorage.MaintenanceWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, window := range s.windows {
+		if window.ID == uint(id) {
+			return &window, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *maintenanceMemoryStorage) FindAllByAccountID(accountID int, now time.Time) ([]serverStorage.MaintenanceWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var windows []serverStorage.MaintenanceWindow
+
+	for _, window := range s.windows {
+		if window.AccountID == uint(accountID) && (window.EndsAt == nil || window.EndsAt.After(now)) {
+			windows = append(windows, window)
+		}
+	}
+
+	return windows, nil
+}
+
+func (s *maintenanceMemoryStorage) FindActiveByAccountIDs(accountIDs []uint, now time.Time) ([]serverStorage.MaintenanceWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var windows []serverStorage.MaintenanceWindow
+
+	for _, window := range s.windows {
+		if slices.Contains(accountIDs, window.AccountID) && window.IsActive(now) {
+			windows = append(windows, window)
+		}
+	}
+
+	return windows, nil
+}
+
+func (s *maintenanceMemoryStorage) Remove(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.windows = slices.DeleteFunc(s.windows, func(window serverStorage.MaintenanceWindow) bool {
+		return window.ID == uint(id)
+	})
+
+	return nil
+}
+
+func NewMaintenanceMemoryStorage() serverStorage.MaintenanceStorage {
+	return &maintenanceMemoryStorage{}
+}
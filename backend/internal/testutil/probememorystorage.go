@@ -0,0 +1,79 @@
+package testutil
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"sync"
+	"time"
+)
+
+// probeMemoryStorage keeps server probes in memory. It is used in tests.
+type probeMemoryStorage struct {
+	mu     sync.Mutex
+	probes []serverStorage.ServerProbe
+	lastID uint
+}
+
+func (s *probeMemoryStorage) Create(probe *serverStorage.ServerProbe) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	probe.ID = s.lastID
+
+	if probe.CreatedAt.IsZero() {
+		probe.CreatedAt = time.Now()
+	}
+
+	s.probes = append(s.probes, *probe)
+
+	return nil
+}
+
+func (s *probeMemoryStorage) FindByServerID(serverID int, since time.Time) ([]serverStorage.ServerProbe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var probes []serverStorage.ServerProbe
+
+	for _, probe := range s.probes {
+		if probe.ServerID == uint(serverID) && probe.CreatedAt.After(since) {
+			probes = append(probes, probe)
+		}
+	}
+
+	return probes, nil
+}
+
+func (s *probeMemoryStorage) FindLastOnline(serverID int) (*serverStorage.ServerProbe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.probes) - 1; i >= 0; i-- {
+		if probe := s.probes[i]; probe.ServerID == uint(serverID) && probe.IsOnline == 1 {
+			return &probe, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *probeMemoryStorage) RemoveOlderThan(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probes := s.probes[:0]
+
+	for _, probe := range s.probes {
+		if !probe.CreatedAt.Before(before) {
+			probes = append(probes, probe)
+		}
+	}
+
+	s.probes = probes
+
+	return nil
+}
+
+func NewProbeMemoryStorage() serverStorage.ProbeStorage {
+	return &probeMemoryStorage{}
+}
@@ -0,0 +1,224 @@
+// Package testutil provides in-memory storages that tests use in place of the SQL storages.
+package testutil
+
+import (
+	serverStorage "backend/internal/app/panel/server/storage"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// serverMemoryStorage keeps servers in memory. It is used in tests.
+type serverMemoryStorage struct {
+	mu      sync.Mutex
+	servers map[uint]serverStorage.Server
+	lastID  uint
+}
+
+func (s *serverMemoryStorage) FindByID(id int) (*serverStorage.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[uint(id)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &server, nil
+}
+
+func (s *serverMemoryStorage) FindByGuid(guid string) (*serverStorage.Server, error) {
+	id, err := serverStorage.GetServerIDByGUID(guid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FindByID(id)
+}
+
+func (s *serverMemoryStorage) FindAllByAccountID(accountID int) ([]serverStorage.Server, error) {
+	servers, _ := s.FindAll()
+
+	return slices.DeleteFunc(servers, func(server serverStorage.Server) bool {
+		return server.AccountID != uint(accountID)
+	}), nil
+}
+
+func (s *serverMemoryStorage) FindAll() ([]serverStorage.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	servers := []serverStorage.Server{}
+
+	for _, server := range s.servers {
+		servers = append(servers, server)
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ID > servers[j].ID
+	})
+
+	return servers, nil
+}
+
+func (s *serverMemoryStorage) Save(server *serverStorage.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if server.ID == 0 {
+		s.lastID++
+		server.ID = s.lastID
+		server.CreatedAt = time.Now()
+	} else if stored, ok := s.servers[server.ID]; ok {
+		server.TlsFingerprint = stored.TlsFingerprint
+		server.Token = stored.Token
+		server.TokenRotatedAt = stored.TokenRotatedAt
+		server.PreferredFamily = stored.PreferredFamily
+	}
+
+	server.Guid = serverStorage.GetServerGUIDByID(int(server.ID))
+	server.UpdatedAt = time.Now()
+	s.servers[server.ID] = *server
+
+	return nil
+}
+
+func (s *serverMemoryStorage) UpdateToken(id int, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[uint(id)]
+
+	if !ok {
+		return errors.New("server not found")
+	}
+
+	server.Token = token
+	s.servers[uint(id)] = server
+
+	return nil
+}
+
+func (s *serverMemoryStorage) RotateToken(id int, token string, rotatedAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[uint(id)]
+
+	if !ok {
+		return errors.New("server not found")
+	}
+
+	server.Token = token
+	server.TokenRotatedAt = rotatedAt
+	s.servers[uint(id)] = server
+
+	return nil
+}
+
+func (s *serverMemoryStorage) UpdatePreferredFamily(id int, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[uint(id)]
+
+	if !ok {
+		return errors.New("server not found")
+	}
+
+	server.PreferredFamily = family
+	s.servers[uint(id)] = server
+
+	return nil
+}
+
+func (s *serverMemoryStorage) UpdateTlsFingerprint(id int, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[uint(id)]
+
+	if !ok {
+		return errors.New("server not found")
+	}
+
+	server.TlsFingerprint = fingerprint
+	s.servers[uint(id)] = server
+
+	return nil
+}
+
+func (s *serverMemoryStorage) UpdateStatus(id int, status serverStorage.ServerStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[uint(id)]
+
+	if !ok {
+		return errors.New("server not found")
+	}
+
+	server.IsActive = status.IsActive
+	server.AgentVersion = status.AgentVersion
+	server.OsCode = status.OsCode
+	server.OsVersion = status.OsVersion
+	s.servers[uint(id)] = server
+
+	return nil
+}
+
+func (s *serverMemoryStorage) Remove(server *serverStorage.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.servers, server.ID)
+
+	return nil
+}
+
+func (s *serverMemoryStorage) FindCountByIP(ipv4, ipv6 string, excludeIds []int) (int, error) {
+	if ipv4 == "" && ipv6 == "" {
+		return 0, errors.New("ipv4 or ipv6 must be specified")
+	}
+
+	servers, _ := s.FindAll()
+	count := 0
+
+	for _, server := range servers {
+		if slices.Contains(excludeIds, int(server.ID)) {
+			continue
+		}
+
+		if (ipv4 != "" && server.Ipv4Address == ipv4) || (ipv6 != "" && server.Ipv6Address == ipv6) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *serverMemoryStorage) FindByIP(ipv4, ipv6 string) (*serverStorage.Server, error) {
+	if ipv4 == "" && ipv6 == "" {
+		return nil, errors.New("ipv4 or ipv6 must be specified")
+	}
+
+	servers, _ := s.FindAll()
+
+	for _, server := range servers {
+		if (ipv4 != "" && server.Ipv4Address == ipv4) || (ipv6 != "" && server.Ipv6Address == ipv6) {
+			return &server, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func NewServerMemoryStorage() serverStorage.ServerStorage {
+	return &serverMemoryStorage{
+		servers: map[uint]serverStorage.Server{},
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS domain_changes;
+DROP TABLE IF EXISTS domain_syncs;
+DROP TABLE IF EXISTS domains;
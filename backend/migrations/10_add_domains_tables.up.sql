@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS domains(
+   id INT NOT NULL AUTO_INCREMENT,
+   server_id INT NOT NULL,
+   server_name VARCHAR(255) NOT NULL,
+   web_server VARCHAR(32) NOT NULL,
+   file_path VARCHAR(1024) NOT NULL DEFAULT '',
+   doc_root VARCHAR(1024) NOT NULL DEFAULT '',
+   aliases TEXT NOT NULL,
+   addresses TEXT NOT NULL,
+   `ssl` TINYINT NOT NULL DEFAULT 0,
+   certificate TEXT NOT NULL,
+   certificate_expires_at TIMESTAMP NULL DEFAULT NULL,
+   synced_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE server_id_domain_index (server_id, web_server, server_name),
+   INDEX certificate_expires_at_index (certificate_expires_at),
+
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS domain_syncs(
+   server_id INT NOT NULL,
+   synced_at TIMESTAMP NULL DEFAULT NULL,
+   attempted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   error VARCHAR(1024) NOT NULL DEFAULT '',
+
+   PRIMARY KEY(server_id),
+
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS domain_changes(
+   id INT NOT NULL AUTO_INCREMENT,
+   server_id INT NOT NULL,
+   server_name VARCHAR(255) NOT NULL,
+   web_server VARCHAR(32) NOT NULL,
+   `change` VARCHAR(16) NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   INDEX server_id_index (server_id),
+
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
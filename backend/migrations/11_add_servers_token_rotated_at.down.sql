@@ -0,0 +1,2 @@
+ALTER TABLE servers
+   DROP COLUMN token_rotated_at;
@@ -0,0 +1,2 @@
+ALTER TABLE servers
+   ADD COLUMN token_rotated_at TIMESTAMP NULL DEFAULT NULL;
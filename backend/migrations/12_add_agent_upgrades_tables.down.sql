@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS agent_upgrade_servers;
+DROP TABLE IF EXISTS agent_upgrades;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS agent_upgrades(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   target_version VARCHAR(64) NOT NULL,
+   concurrency INT NOT NULL DEFAULT 1,
+   failure_threshold INT NOT NULL DEFAULT 1,
+   status VARCHAR(16) NOT NULL DEFAULT 'pending',
+   error VARCHAR(1024) NOT NULL DEFAULT '',
+   created_by INT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   finished_at TIMESTAMP NULL DEFAULT NULL,
+
+   PRIMARY KEY(id),
+   INDEX account_id_index (account_id),
+   INDEX status_index (status),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS agent_upgrade_servers(
+   id INT NOT NULL AUTO_INCREMENT,
+   upgrade_id INT NOT NULL,
+   server_id INT NOT NULL,
+   batch INT NOT NULL DEFAULT 0,
+   status VARCHAR(16) NOT NULL DEFAULT 'pending',
+   previous_version VARCHAR(64) NOT NULL DEFAULT '',
+   version VARCHAR(64) NOT NULL DEFAULT '',
+   error VARCHAR(1024) NOT NULL DEFAULT '',
+   started_at TIMESTAMP NULL DEFAULT NULL,
+   finished_at TIMESTAMP NULL DEFAULT NULL,
+
+   PRIMARY KEY(id),
+   INDEX upgrade_id_index (upgrade_id),
+
+   FOREIGN KEY (upgrade_id) REFERENCES agent_upgrades(id)
+      ON DELETE CASCADE,
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS server_tags;
+DROP TABLE IF EXISTS server_group_members;
+DROP TABLE IF EXISTS server_groups;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS server_groups(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   name VARCHAR(64) NOT NULL,
+   description VARCHAR(255) NOT NULL DEFAULT '',
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE (account_id, name),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS server_group_members(
+   group_id INT NOT NULL,
+   server_id INT NOT NULL,
+
+   PRIMARY KEY(group_id, server_id),
+   INDEX server_id_index (server_id),
+
+   FOREIGN KEY (group_id) REFERENCES server_groups(id)
+      ON DELETE CASCADE,
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS server_tags(
+   server_id INT NOT NULL,
+   tag VARCHAR(64) NOT NULL,
+
+   PRIMARY KEY(server_id, tag),
+   INDEX tag_index (tag),
+
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
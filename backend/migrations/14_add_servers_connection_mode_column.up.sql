@@ -0,0 +1,2 @@
+ALTER TABLE servers
+   ADD COLUMN connection_mode VARCHAR(16) NOT NULL DEFAULT 'direct';
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS maintenance_windows(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   server_id INT NOT NULL,
+   domain_name VARCHAR(255) NOT NULL DEFAULT '',
+   reason VARCHAR(255) NOT NULL DEFAULT '',
+   starts_at TIMESTAMP NULL DEFAULT NULL,
+   ends_at TIMESTAMP NULL DEFAULT NULL,
+   created_by INT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   INDEX server_id_index (server_id),
+   INDEX account_id_index (account_id),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE,
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
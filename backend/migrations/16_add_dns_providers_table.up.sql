@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS dns_providers(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   name VARCHAR(64) NOT NULL,
+   type VARCHAR(32) NOT NULL,
+   settings TEXT NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE (account_id, name),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE
+);
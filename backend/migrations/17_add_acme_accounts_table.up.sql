@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS acme_accounts(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   directory_url VARCHAR(255) NOT NULL,
+   email VARCHAR(255) NOT NULL,
+   private_key TEXT NOT NULL,
+   uri VARCHAR(255) NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE (account_id, directory_url),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS certificate_authorities(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   name VARCHAR(64) NOT NULL,
+   directory_url VARCHAR(255) NOT NULL,
+   eab_key_id VARCHAR(255) NOT NULL DEFAULT '',
+   eab_hmac_key TEXT NOT NULL,
+   preferred_chain VARCHAR(255) NOT NULL DEFAULT '',
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE (account_id, name),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE
+);
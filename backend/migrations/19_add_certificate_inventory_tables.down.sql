@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS certificate_sightings;
+DROP TABLE IF EXISTS inventory_certificates;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS inventory_certificates(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   fingerprint CHAR(64) NOT NULL,
+   serial_number VARCHAR(128) NOT NULL,
+   common_name VARCHAR(255) NOT NULL DEFAULT '',
+   names TEXT NOT NULL,
+   issuer_cn VARCHAR(255) NOT NULL DEFAULT '',
+   issuer_organization VARCHAR(255) NOT NULL DEFAULT '',
+   key_type VARCHAR(32) NOT NULL DEFAULT '',
+   not_before DATETIME NOT NULL,
+   not_after DATETIME NOT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE (account_id, fingerprint),
+   INDEX not_after_index (account_id, not_after),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS certificate_sightings(
+   id INT NOT NULL AUTO_INCREMENT,
+   certificate_id INT NOT NULL,
+   server_id INT NOT NULL,
+   source VARCHAR(16) NOT NULL,
+   location VARCHAR(255) NOT NULL,
+   web_server VARCHAR(32) NOT NULL DEFAULT '',
+   first_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   INDEX certificate_id_index (certificate_id),
+   INDEX location_index (source, location),
+   INDEX server_location_index (server_id, source, location, web_server, last_seen_at),
+
+   FOREIGN KEY (certificate_id) REFERENCES inventory_certificates(id)
+      ON DELETE CASCADE,
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+DELETE FROM maintenance_windows WHERE server_id IS NULL;
+ALTER TABLE maintenance_windows
+   DROP FOREIGN KEY maintenance_windows_group_fk,
+   DROP INDEX group_id_index,
+   DROP COLUMN tag,
+   DROP COLUMN group_id,
+   MODIFY COLUMN server_id INT NOT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE maintenance_windows
+   MODIFY COLUMN server_id INT NULL DEFAULT NULL,
+   ADD COLUMN group_id INT NULL DEFAULT NULL AFTER server_id,
+   ADD COLUMN tag VARCHAR(64) NOT NULL DEFAULT '' AFTER group_id,
+   ADD INDEX group_id_index (group_id),
+   ADD CONSTRAINT maintenance_windows_group_fk FOREIGN KEY (group_id) REFERENCES server_groups(id)
+      ON DELETE CASCADE;
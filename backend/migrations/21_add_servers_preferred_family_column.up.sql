@@ -0,0 +1,2 @@
+ALTER TABLE servers
+   ADD COLUMN preferred_family VARCHAR(8) NOT NULL DEFAULT '';
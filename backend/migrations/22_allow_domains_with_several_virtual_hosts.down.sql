@@ -0,0 +1,8 @@
+DELETE duplicate FROM domains duplicate
+   JOIN domains other ON other.server_id = duplicate.server_id
+      AND other.web_server = duplicate.web_server
+      AND other.server_name = duplicate.server_name
+      AND other.id < duplicate.id;
+ALTER TABLE domains
+   ADD UNIQUE server_id_domain_index (server_id, web_server, server_name),
+   DROP INDEX server_id_name_index;
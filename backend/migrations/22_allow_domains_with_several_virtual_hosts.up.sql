@@ -0,0 +1,3 @@
+ALTER TABLE domains
+   ADD INDEX server_id_name_index (server_id, web_server, server_name),
+   DROP INDEX server_id_domain_index;
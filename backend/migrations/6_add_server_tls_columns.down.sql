@@ -0,0 +1,3 @@
+ALTER TABLE servers
+   DROP COLUMN tls_enabled,
+   DROP COLUMN tls_fingerprint;
@@ -0,0 +1,3 @@
+ALTER TABLE servers
+   ADD COLUMN tls_enabled TINYINT NOT NULL DEFAULT 0,
+   ADD COLUMN tls_fingerprint VARCHAR(128) NOT NULL DEFAULT '';
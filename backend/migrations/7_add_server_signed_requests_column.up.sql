@@ -0,0 +1,2 @@
+ALTER TABLE servers
+   ADD COLUMN signed_requests TINYINT NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS server_probes(
+   id INT NOT NULL AUTO_INCREMENT,
+   server_id INT NOT NULL,
+   is_online TINYINT NOT NULL DEFAULT 0,
+   latency_ms INT NOT NULL DEFAULT 0,
+   error VARCHAR(1024) NOT NULL DEFAULT '',
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   INDEX server_id_created_at_index (server_id, created_at),
+   INDEX created_at_index (created_at),
+
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS enrollment_codes;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS enrollment_codes(
+   id INT NOT NULL AUTO_INCREMENT,
+   account_id INT NOT NULL,
+   code_hash VARCHAR(64) NOT NULL,
+   created_by INT NOT NULL,
+   expires_at TIMESTAMP NOT NULL DEFAULT NOW(),
+   used_at TIMESTAMP NULL DEFAULT NULL,
+   used_ip VARCHAR(64) NOT NULL DEFAULT '',
+   server_id INT DEFAULT NULL,
+   revoked_at TIMESTAMP NULL DEFAULT NULL,
+   revoked_by INT DEFAULT NULL,
+   created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+   PRIMARY KEY(id),
+   UNIQUE (code_hash),
+   INDEX account_id_index (account_id),
+
+   FOREIGN KEY (account_id) REFERENCES accounts(id)
+      ON DELETE CASCADE,
+   FOREIGN KEY (server_id) REFERENCES servers(id)
+      ON DELETE SET NULL
+);
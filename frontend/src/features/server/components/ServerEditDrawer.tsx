@@ -25,7 +25,7 @@ const ServerEditDrawer: React.FC<ServerEditProps> = ({
     const [name, setName] = useState<string>(server?.name || '');
     const [ipv4, setIpv4] = useState<string>(server?.ipv4_address || '');
     const [ipv6, setIpv6] = useState<string>(server?.ipv6_address || '');
-    const [token, setToken] = useState<string>(server?.token || '');
+    const [token, setToken] = useState<string>('');
     const [port, setPort] = useState<number>(server?.agent_port || defaultPort);
     const [ipError] = useState<string>('');
 
@@ -34,7 +34,7 @@ const ServerEditDrawer: React.FC<ServerEditProps> = ({
         setIpv4(open ? server?.ipv4_address || '' : '');
         setIpv6(open ? server?.ipv6_address || '' : '');
         setPort(open ? server?.agent_port || defaultPort : defaultPort);
-        setToken(open ? server?.token || '' : '');
+        setToken('');
     }, [server, open]);
 
     const handleFormClose = (): void => {
@@ -114,8 +114,8 @@ const ServerEditDrawer: React.FC<ServerEditProps> = ({
                         <TextInput
                             id="token"
                             name="token"
-                            placeholder="Server agent token"
-                            required
+                            placeholder={server?.id ? 'Leave empty to keep the current token' : 'Server agent token'}
+                            required={!server?.id}
                             value={token}
                             onChange={(event: React.ChangeEvent<HTMLInputElement>) => setToken(event.target.value)}
                         />
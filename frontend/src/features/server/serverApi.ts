@@ -47,6 +47,14 @@ export const editServerApi = async (id: number, server: ServerSaveRequest, token
     }
 };
 
+export const updateServerTokenApi = async (id: number, serverToken: string, token: string) => {
+    try {
+        await api.post(`/v1/servers/${id}/token`, { token: serverToken }, configWithAuth(token));
+    } catch (error) {
+        throw new Error(getErrorMessage(error))
+    }
+};
+
 export const deleteServerApi = async (id: number, token: string) => {
     try {
         await api.delete(`/v1/servers/${id}`, configWithAuth(token));
@@ -2,7 +2,7 @@ import { createAsyncThunk, createSlice } from '@reduxjs/toolkit'
 import { RootState } from '../../app/store';
 import { FetchStatus } from '../../app/types';
 import { toast } from 'react-toastify';
-import { changeCertbotStatusApi, editServerApi, getServerApi, getServerDetailsApi, getServerRenewalLogsApi } from './serverApi';
+import { changeCertbotStatusApi, editServerApi, getServerApi, getServerDetailsApi, getServerRenewalLogsApi, updateServerTokenApi } from './serverApi';
 import { ChangeSettingPayload, RenewalLog, RenewalLogsFetchPayload, Server, ServerDetails, ServerFetchPayload, ServerSavePayload, ServerSaveRequest, ServerSettings } from './types';
 import { CERTBOT_STATUS_SETTING } from './constants';
 
@@ -52,11 +52,14 @@ export const editServer = createAsyncThunk(
             ipv4_address: payload.ipv4_address,
             ipv6_address: payload.ipv6_address,
             agent_port: payload.agent_port,
-            token: payload.token,
         };
 
         await editServerApi(payload.id as number, request, payload.authToken);
 
+        if (payload.token) {
+            await updateServerTokenApi(payload.id as number, payload.token, payload.authToken);
+        }
+
         return await getServerApi(payload.guid as string, payload.authToken);
     },
 );
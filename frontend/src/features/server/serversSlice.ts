@@ -2,7 +2,7 @@ import { createAsyncThunk, createSlice } from '@reduxjs/toolkit'
 import { RootState } from '../../app/store';
 import { FetchStatus } from '../../app/types';
 import { toast } from 'react-toastify';
-import { addServerApi, deleteServerApi, editServerApi, getServersApi } from './serverApi';
+import { addServerApi, deleteServerApi, editServerApi, getServersApi, updateServerTokenApi } from './serverApi';
 import { ServerSavePayload, Server, ServerSaveRequest, ServerDeletePayload } from './types';
 
 export interface ServersState {
@@ -51,11 +51,14 @@ export const editServer = createAsyncThunk(
             ipv4_address: payload.ipv4_address,
             ipv6_address: payload.ipv6_address,
             agent_port: payload.agent_port,
-            token: payload.token,
         };
 
         await editServerApi(payload.id as number, request, payload.authToken);
 
+        if (payload.token) {
+            await updateServerTokenApi(payload.id as number, payload.token, payload.authToken);
+        }
+
         return await getServersApi(payload.authToken);
     },
 );
@@ -13,7 +13,6 @@ export interface Server {
     is_active: number;
     account_id: number;
     created_at: string;
-    token: string;
 };
 
 export interface ServerDetails extends Server {
@@ -44,7 +43,7 @@ export interface ServerSaveRequest {
     ipv4_address: string;
     ipv6_address: string;
     agent_port: number;
-    token: string;
+    token?: string;
 }
 
 export interface ServerSavePayload extends ServerSaveRequest {